@@ -14,6 +14,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/qmuntal/gltf"
@@ -32,6 +33,7 @@ import (
 	extr_level "github.com/xypwn/filediver/extractor/level"
 	extr_material "github.com/xypwn/filediver/extractor/material"
 	extr_package "github.com/xypwn/filediver/extractor/package"
+	extr_physics "github.com/xypwn/filediver/extractor/physics"
 	extr_prefab "github.com/xypwn/filediver/extractor/prefab"
 	extr_shading_environment "github.com/xypwn/filediver/extractor/shading_environment"
 	extr_speedtree "github.com/xypwn/filediver/extractor/speedtree"
@@ -505,6 +507,27 @@ func OpenGameDir(ctx context.Context, gameDir string, hashStrings []string, thin
 	}, nil
 }
 
+// CheckDataLibrarySnapshot returns an error if the data library files in
+// use were taken from an older build than the opened game, or if the
+// snapshot doesn't say which build it was taken from.
+func (a *App) CheckDataLibrarySnapshot() error {
+	snapshot := datalib.CurrentSnapshot()
+	if snapshot.BuildInfo == nil {
+		if snapshot.Dir == "" {
+			return fmt.Errorf("built-in data library has no build info, so it can't be checked against the game build; weapon, armor and entity data may be outdated")
+		}
+		return fmt.Errorf("data library in \"%v\" has no build_info.json or .ah.json, so it can't be checked against the game build", snapshot.Dir)
+	}
+	if !snapshot.IsOlderThan(a.GameBuildInfo) {
+		return nil
+	}
+	source := "built-in data library"
+	if snapshot.Dir != "" {
+		source = fmt.Sprintf("data library in \"%v\"", snapshot.Dir)
+	}
+	return fmt.Errorf("%v is from %v, but the game was built on %v; weapon, armor and entity data may be outdated", source, snapshot.BuildInfo.Time().Format(time.DateOnly), a.GameBuildInfo.Time().Format(time.DateOnly))
+}
+
 func (a *App) hashNameVariationsForMatch(h stingray.Hash) []string {
 	res := []string{
 		h.StringEndian(binary.LittleEndian),
@@ -713,7 +736,13 @@ func (a *App) ExtractFile(ctx context.Context, id stingray.FileID, outDir string
 	} else {
 		switch typ {
 		case "animation":
-			extr = extr_animation.ExtractAnimationJson
+			if extrFormat == "glb" || extrFormat == "gltf" {
+				extr = extr_animation.Convert(gltfDoc)
+			} else if extrFormat == "bvh" {
+				extr = extr_animation.ConvertBVH
+			} else {
+				extr = extr_animation.ExtractAnimationJson
+			}
 		case "bik", "bk2":
 			if extrFormat == "bik" || extrFormat == "bk2" {
 				extr = extr_bik.ExtractBink(typ)
@@ -735,6 +764,8 @@ func (a *App) ExtractFile(ctx context.Context, id stingray.FileID, outDir string
 		case "material":
 			if extrFormat == "folder" {
 				extr = extr_material.ConvertToFolder
+			} else if extrFormat == "json" {
+				extr = extr_material.ConvertToJSON
 			} else {
 				extr = extr_material.Convert(gltfDoc)
 			}
@@ -767,7 +798,13 @@ func (a *App) ExtractFile(ctx context.Context, id stingray.FileID, outDir string
 				extr = extr_texture.ConvertToPNG
 			}
 		case "state_machine":
-			extr = extr_state_machine.ExtractStateMachineJson
+			if extrFormat == "dot" || extrFormat == "mermaid" {
+				extr = extr_state_machine.ExtractStateMachineGraph(extrFormat)
+			} else {
+				extr = extr_state_machine.ExtractStateMachineJson
+			}
+		case "physics":
+			extr = extr_physics.ExtractPhysicsJSON
 		case "strings":
 			extr = extr_strings.ExtractStringsJSON
 		case "package":
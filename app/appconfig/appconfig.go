@@ -18,9 +18,13 @@ import (
 // identify which game file types the category
 // is targeting.
 type Config struct {
-	Gamedir string `cfg:"short=g tags=directory default=<auto-detect> help='Helldivers 2 game directory'"`
-	Audio   struct {
-		Format string `cfg:"options=ogg,wav,aac,mp3,wwise,raw help='common media formats: ogg,wav,aac,mp3; wwise to extract as wem/bnk'"`
+	Gamedir     string `cfg:"short=g tags=directory default=<auto-detect> help='Helldivers 2 game directory'"`
+	DataLibrary string `cfg:"tags=directory,advanced help='directory with newer generated_*.dl_bin files and dl_library.dl_typelib to use instead of the built-in weapon, armor and entity data, optionally with a build_info.json or .ah.json of the game build they were taken from; empty to use the built-in data'"`
+	Audio       struct {
+		Format     string `cfg:"options=ogg,wav,flac,aac,mp3,wwise,raw help='common media formats: ogg,wav,flac,aac,mp3 (aac and mp3 require FFmpeg); wwise to extract as wem/bnk'"`
+		Markers    bool   `cfg:"help='also write loop points and markers of each audio stream to a JSON file'"`
+		EventGraph bool   `cfg:"help='also write the events of each wwise_bank and the objects and streams they play to a JSON file'"`
+		ByEvent    bool   `cfg:"help='export wwise_bank audio into one folder per event, in playback order, with a JSON file listing random container weights'"`
 	} `cfg:"tags=t:wwise_stream,t:wwise_bank help='audio collections/streams'"`
 	Video struct {
 		Format string `cfg:"options=bk2,mp4,raw help='bk2 is raw bink2 video (use RAD Video Tools to convert); mp4 has artifacts due to incomplete decoder implementation'"`
@@ -35,29 +39,42 @@ type Config struct {
 		JpegQuality         int    `cfg:"tags=advanced depends=Unit.ImageFormat=jpeg range=1...100 default=90"`
 		AllTextures         bool   `cfg:"tags=advanced help='include all referenced textures, including wounds, marks etc. and unknown ones'"`
 		AccurateOnly        bool   `cfg:"tags=advanced"`
-		SampleAnimations    bool   `cfg:"help='more accurate for now, as spline interpolation conversion isn\\'t implemented yet'"`
+		SampleAnimations    bool   `cfg:"help='resample animations at a fixed rate instead of exporting the exact spline keys as cubic spline animations'"`
 		AnimationSampleRate int    `cfg:"depends=Unit.SampleAnimations range=12...144 default=30"`
 	} `cfg:"help='general unit settings, affects materials, models and animations'"`
 	Material struct {
-		Format         string `cfg:"options=blend,glb,folder,raw help='material export format; folder dumps all referenced textures and shaders (if enabled in advanced settings) into a folder'"`
+		Format         string `cfg:"options=blend,glb,folder,json,raw help='material export format; folder dumps all referenced textures and shaders (if enabled in advanced settings) into a folder with a material.json; json only writes the material.json listing the base materials, settings, texture slots with their samplers and the shader constant buffer layout'"`
 		TexturesFormat string `cfg:"depends=Material.Format=folder options=png,dds help='format of individual textures if Format is folder'"`
-		ShaderFormat   string `cfg:"tags=advanced depends=Material.Format=folder options=none,dxbc,glsl help='material shader export format; if set to either dxbc or glsl will dump the shaders for the material in that format in the shaders/ subdirectory of the material folder'"`
+		ShaderFormat   string `cfg:"tags=advanced depends=Material.Format=folder options=none,dxbc,glsl,hlsl help='material shader export format; if set to dxbc, glsl or hlsl will dump the shaders for the material in that format in the shaders/ subdirectory of the material folder'"`
 	} `cfg:"tags=t:material help='see unit options'"`
 	Model struct {
-		Format                    string `cfg:"options=blend,glb,gltf,raw help='model export format'"`
+		Format                    string `cfg:"options=blend,glb,gltf,obj,ply,raw help='model export format; obj and ply contain static meshes only, with transforms applied'"`
 		IncludeLODS               bool   `cfg:"help='include meshes of all levels-of-detail'"`
+		LODs                      string `cfg:"depends=Model.IncludeLODS options=inline,msft_lod,files help='inline keeps all levels-of-detail side by side, msft_lod links them with the MSFT_lod glTF extension and their screen coverage, files writes one file per level-of-detail'"`
 		IncludeGibs               bool   `cfg:"help='include meshes with gib materials'"`
 		EnableAnimations          bool   `cfg:"help='export model animations, can take much longer'"`
 		EnableAnimationController bool   `cfg:"tags=advanced depends=Model.EnableAnimations help='export model animation controller, can take even longer and will add many constraints to the output blend file'"`
 		JoinComponents            bool   `cfg:"tags=advanced help='join UDIM components'"`
 		BoundingBoxes             bool   `cfg:"tags=advanced help='export model bounding boxes'"`
 		NoBones                   bool   `cfg:"tags=advanced help='don\\'t include bones'"`
+		EntityData                bool   `cfg:"tags=advanced help='embed the components of the unit\\'s entity (health, armor, attach points etc.) in the root node extras and tag bones with the damageable zones they belong to'"`
+		Terrain                   string `cfg:"options=mesh,heightfield,both help='heightfield writes terrains as 16-bit PNG and float .r32 heightmaps with their texture layers and a JSON of their world extents instead of meshes'"`
 	} `cfg:"tags=t:unit,t:geometry_group help='see unit options'"`
 	Animation struct {
-		Format string `cfg:"options=json,raw"`
-	} `cfg:"tags=t:animation,t:state_machine help='see unit options'"`
+		Format       string `cfg:"options=json,glb,gltf,bvh,raw help='glb, gltf and bvh export the animation against the skeleton of a unit or bones file'"`
+		Skeleton     string `cfg:"help='name or 0x-prefixed hash of the unit or bones file to export glb/gltf/bvh animations against; inferred from the animation if empty'"`
+		BakeAdditive bool   `cfg:"depends=Animation.Format=bvh help='apply additive animations to the bind pose instead of exporting the raw offsets'"`
+	} `cfg:"tags=t:animation help='see unit options'"`
+	StateMachine struct {
+		Format    string `cfg:"options=json,dot,mermaid,raw help='dot and mermaid export a graph of the layers, states and transitions'"`
+		Variables string `cfg:"help='comma-separated animation variable values, e.g. move_speed=3.5; blend states in the graph show the animation weights for these values, other variables keep their defaults'"`
+	} `cfg:"tags=t:state_machine help='animation state machine export settings'"`
+	Physics struct {
+		Format string `cfg:"options=json,raw help='json lists the cooked convex and triangle collision meshes in the local space of their shapes; actors, primitive shapes, shape poses and materials are not decoded yet, so no placed collision export is available'"`
+	} `cfg:"tags=t:physics help='collision export settings'"`
 	Level struct {
-		Format string `cfg:"options=model,json,raw"`
+		Format  string `cfg:"options=model,usd,json,raw help='usd writes a usda stage referencing one layer per distinct unit, prefab and speedtree, placed as instances'"`
+		Markers bool   `cfg:"help='add spawn points, objective markers and extra units as empties to level models and write them with resolved names to a JSON file'"`
 	} `cfg:"tags=t:level help='Level specific settings'"`
 	Prefab struct {
 		Format string `cfg:"options=model,json,raw"`
@@ -68,6 +85,13 @@ type Config struct {
 	SpeedTree struct {
 		Format string `cfg:"options=model,json,raw"`
 	} `cfg:"tags=t:speedtree help='Tree model export format'"`
+	Planet struct {
+		Folders bool `cfg:"help='besides the combined planets.json, write a folder per planet with its JSON, preview image, hologram material textures and shading environment'"`
+	} `cfg:"help='planet export settings'"`
+	WeaponStats struct {
+		Format    string `cfg:"options=csv,json,md help='format of the weapon stat table'"`
+		NamedOnly bool   `cfg:"help='only list weapons which have a localized name'"`
+	} `cfg:"help='weapon stat export settings'"`
 	Raw struct {
 		Format string `cfg:"options=separate,combined,main,stream,gpu help='how to handle the different file sub-types (each file may have a main, stream and GPU file)'"`
 	} `cfg:"help='applies to any file without an available extractor or \"raw\" as the selected format'"`
@@ -123,6 +147,7 @@ var Extractable = map[string]bool{
 	"strings":        true,
 	"package":        true,
 	"bones":          true,
+	"physics":        true,
 }
 
 var ConfigFields = config.MustFields(Config{})
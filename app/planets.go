@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/xypwn/filediver/app/appconfig"
+	datalib "github.com/xypwn/filediver/datalibrary"
+	"github.com/xypwn/filediver/exec"
+	"github.com/xypwn/filediver/stingray"
+)
+
+// planetDirName returns a folder name for the planet's debug name which
+// is safe to use on all platforms and not used yet.
+func planetDirName(debugName string, index int, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			return r
+		}
+		return '_'
+	}, debugName)
+	if strings.Trim(name, "_") == "" {
+		name = fmt.Sprintf("planet_%03d", index)
+	}
+	// Folder names are case insensitive on some platforms
+	unique := name
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%v_%v", name, i)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0666)
+}
+
+// ExportPlanets writes all planets with their biome, level, shading
+// environment and sky settings to planets.json in outDir. If enabled
+// in cfg, it also writes a folder per planet containing its JSON, its
+// preview image, its hologram material with textures and its shading
+// environment entity with the shading environment of the same name.
+func (a *App) ExportPlanets(ctx context.Context, outDir string, cfg appconfig.Config, runner *exec.Runner, printer Printer) error {
+	planets, err := datalib.LoadPlanets(a.LookupHash, a.LookupThinHash, a.LookupString)
+	if err != nil {
+		return err
+	}
+
+	simplePlanets := make([]datalib.SimplePlanet, 0, len(planets))
+	for _, planet := range planets {
+		simplePlanets = append(simplePlanets, planet.ToSimple(a.LookupHash, a.LookupThinHash))
+	}
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := writeJSONFile(filepath.Join(outDir, "planets.json"), simplePlanets); err != nil {
+		return fmt.Errorf("writing planets.json: %w", err)
+	}
+	printer.Infof("Wrote %v planets to %v", len(planets), filepath.Join(outDir, "planets.json"))
+	if !cfg.Planet.Folders {
+		return nil
+	}
+
+	// Materials are exported with all their textures
+	cfg.Material.Format = "folder"
+	usedNames := make(map[string]bool)
+	for i, planet := range planets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := planetDirName(planet.Data.DebugName, i, usedNames)
+		printer.Statusf("Planet %v/%v: %v", i+1, len(planets), name)
+		planetDir := filepath.Join(outDir, "planets", name)
+		if err := os.MkdirAll(planetDir, os.ModePerm); err != nil {
+			return err
+		}
+		if err := writeJSONFile(filepath.Join(planetDir, "planet.json"), simplePlanets[i]); err != nil {
+			return fmt.Errorf("writing %v: %w", name, err)
+		}
+		// The shading environment is an entity, which usually shares its
+		// name with the shading_environment resource it uses
+		shadingEnvironment := stingray.NewFileID(planet.Data.ShadingEnvironmentEntity, stingray.Sum("shading_environment"))
+		for _, id := range []stingray.FileID{
+			stingray.NewFileID(planet.Data.PlanetPreviewImage, stingray.Sum("texture")),
+			stingray.NewFileID(planet.Data.HologramPlanetMaterial, stingray.Sum("material")),
+			stingray.NewFileID(planet.Data.ShadingEnvironmentEntity, stingray.Sum("entity")),
+			shadingEnvironment,
+		} {
+			if id.Name.Value == 0 {
+				continue
+			}
+			if _, ok := a.DataDir.Files[id]; !ok {
+				if id != shadingEnvironment {
+					printer.Warnf("%v: %v.%v not found", name, a.LookupHash(id.Name), a.LookupHash(id.Type))
+				}
+				continue
+			}
+			if _, err := a.ExtractFile(ctx, id, planetDir, cfg, runner, nil, nil, printer, func(string, ...any) {}); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				printer.Errorf("%v: %v", name, err)
+			}
+		}
+	}
+	printer.NoStatus()
+	return nil
+}
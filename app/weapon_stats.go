@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/xypwn/filediver/app/appconfig"
+	datalib "github.com/xypwn/filediver/datalibrary"
+)
+
+// weaponStatColumns returns the column names of a stat table, which are
+// the JSON names of the WeaponStats fields.
+func weaponStatColumns() []string {
+	typ := reflect.TypeFor[datalib.WeaponStats]()
+	columns := make([]string, typ.NumField())
+	for i := range typ.NumField() {
+		columns[i], _, _ = strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+	}
+	return columns
+}
+
+func weaponStatValues(stats datalib.WeaponStats) []string {
+	v := reflect.ValueOf(stats)
+	values := make([]string, v.NumField())
+	for i := range v.NumField() {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Float32:
+			values[i] = strconv.FormatFloat(field.Float(), 'f', -1, 32)
+		default:
+			values[i] = fmt.Sprint(field.Interface())
+		}
+	}
+	return values
+}
+
+func writeWeaponStatsCSV(w io.Writer, stats []datalib.WeaponStats) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(weaponStatColumns()); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		if err := cw.Write(weaponStatValues(s)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeWeaponStatsMarkdown(w io.Writer, stats []datalib.WeaponStats) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+	writeRow := func(cells []string) error {
+		for i := range cells {
+			cells[i] = escape.Replace(cells[i])
+		}
+		_, err := fmt.Fprintf(w, "| %v |\n", strings.Join(cells, " | "))
+		return err
+	}
+	columns := weaponStatColumns()
+	if err := writeRow(columns); err != nil {
+		return err
+	}
+	separator := make([]string, len(columns))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	if err := writeRow(separator); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		if err := writeRow(weaponStatValues(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeWeaponStatsJSON(w io.Writer, stats []datalib.WeaponStats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(stats)
+}
+
+// WriteWeaponStats writes stats as a table with one row per weapon.
+// format is one of csv, json or md.
+func WriteWeaponStats(w io.Writer, format string, stats []datalib.WeaponStats) error {
+	switch format {
+	case "csv":
+		return writeWeaponStatsCSV(w, stats)
+	case "json":
+		return writeWeaponStatsJSON(w, stats)
+	case "md":
+		return writeWeaponStatsMarkdown(w, stats)
+	default:
+		return fmt.Errorf("unknown weapon stat format: %v", format)
+	}
+}
+
+// LoadWeaponStats returns the stats of all weapons and ordnance (see
+// [datalib.LoadWeaponStats]). Unknown strings are left empty, so unnamed
+// entities can be told apart. If namedOnly is set, only entities with a
+// localized name are returned.
+func (a *App) LoadWeaponStats(namedOnly bool) ([]datalib.WeaponStats, error) {
+	lookupString := func(id uint32) string {
+		return a.LanguageMap[id]
+	}
+	stats, err := datalib.LoadWeaponStats(a.LookupHash, a.LookupThinHash, lookupString)
+	if err != nil {
+		return nil, err
+	}
+	if namedOnly {
+		named := stats[:0]
+		for _, s := range stats {
+			if s.Name != "" {
+				named = append(named, s)
+			}
+		}
+		stats = named
+	}
+	return stats, nil
+}
+
+// ExportWeaponStats writes the stats of all weapons to weapon_stats.<format>
+// in outDir, using the format set in cfg.
+func (a *App) ExportWeaponStats(ctx context.Context, outDir string, cfg appconfig.Config, printer Printer) error {
+	stats, err := a.LoadWeaponStats(cfg.WeaponStats.NamedOnly)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+	path := filepath.Join(outDir, "weapon_stats."+cfg.WeaponStats.Format)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := WriteWeaponStats(f, cfg.WeaponStats.Format, stats); err != nil {
+		return fmt.Errorf("writing %v: %w", path, err)
+	}
+	printer.Infof("Wrote stats of %v weapons to %v", len(stats), path)
+	return nil
+}
@@ -28,6 +28,7 @@ import (
 
 	"github.com/xypwn/filediver/app"
 	"github.com/xypwn/filediver/app/appconfig"
+	datalib "github.com/xypwn/filediver/datalibrary"
 	"github.com/xypwn/filediver/exec"
 	"github.com/xypwn/filediver/extractor/blend_helper"
 	"github.com/xypwn/filediver/extractor/single_glb_helper"
@@ -75,6 +76,8 @@ func main() {
 	var optKnownHashesPath *string
 	var optThinHashListMode *string
 	var optHelpMetadata *bool
+	var optPlanets *bool
+	var optWeaponStats *bool
 	// Config common to CLI and GUI
 	cfg := appconfig.Config{}
 
@@ -137,6 +140,12 @@ func main() {
 		optHelpMetadata = argp.Flag("", "help-metadata", &argparse.Option{
 			Help: `show metadata filter syntax help`,
 		})
+		optPlanets = argp.Flag("", "planets", &argparse.Option{
+			Help: "export all planets with their biome, level, shading environment and sky settings to the output directory, then exit",
+		})
+		optWeaponStats = argp.Flag("", "weapon-stats", &argparse.Option{
+			Help: "export a stat table of all weapons and ordnance to the output directory (see weapon stat options), then exit",
+		})
 	}); err != nil {
 		log.Fatal(err)
 	} else if !dontExit {
@@ -169,9 +178,9 @@ Options:`)
 		}
 		tabw.Flush()
 		os.Exit(0)
-	} else if *optInclGlob == "" && *optInclArchives == "" && *optInclTriads == "" && *optMetadataFilter == "" {
+	} else if *optInclGlob == "" && *optInclArchives == "" && *optInclTriads == "" && *optMetadataFilter == "" && !*optPlanets && !*optWeaponStats {
 		cliShowHelp(argp)
-		fmt.Println("\nExpected some specifier of which files to extract/list/search (--include, --archives or --filter-metadata).\nIf you wish to select all files, just pass -i \"*\".")
+		fmt.Println("\nExpected some specifier of which files to extract/list/search (--include, --archives or --filter-metadata), or --planets or --weapon-stats.\nIf you wish to select all files, just pass -i \"*\".")
 		os.Exit(1)
 	}
 
@@ -199,10 +208,10 @@ Options:`)
 		if cfg.Video.Format != "bik" && cfg.Video.Format != "raw" {
 			cfg.Video.Format = "bik"
 		}
-		if cfg.Audio.Format != "wav" && cfg.Audio.Format != "raw" {
-			cfg.Video.Format = "wav"
+		if cfg.Audio.Format == "aac" || cfg.Audio.Format == "mp3" {
+			cfg.Audio.Format = "ogg"
 		}
-		prt.Warnf("FFmpeg not installed or found locally. Please install FFmpeg, or place ffmpeg.exe in the current folder to convert videos to MP4 and audio to a variety of formats. Without FFmpeg, videos will be saved as BIK and audio will be saved was WAV.")
+		prt.Warnf("FFmpeg not installed or found locally. Please install FFmpeg, or place ffmpeg.exe in the current folder to convert videos to MP4 and audio to AAC/MP3. Without FFmpeg, videos will be saved as BIK and audio will be saved as OGG, FLAC or WAV.")
 	}
 	blenderImporterCommand := []string{"scripts_dist/hd2_accurate_blender_importer/hd2_accurate_blender_importer"}
 	if value := os.Getenv("FILEDIVER_BLENDER_IMPORTER_COMMAND"); value != "" {
@@ -258,6 +267,14 @@ Options:`)
 		prt.Infof("Game directory: \"%v\"", gamedir)
 	}
 
+	if cfg.DataLibrary != "" {
+		snapshot, err := datalib.LoadSnapshot(cfg.DataLibrary)
+		if err != nil {
+			prt.Fatalf("loading data library: %v", err)
+		}
+		prt.Infof("Using data library files from \"%v\": %v", snapshot.Dir, strings.Join(snapshot.Files, ", "))
+	}
+
 	var knownHashes []string
 	knownHashes = append(knownHashes, app.ParseHashes(hashes.Hashes)...)
 	if *optKnownHashesPath != "" {
@@ -298,6 +315,23 @@ Options:`)
 	}
 	prt.NoStatus()
 
+	if err := a.CheckDataLibrarySnapshot(); err != nil {
+		prt.Warnf("%v", err)
+	}
+
+	if *optPlanets {
+		if err := a.ExportPlanets(ctx, *optOutDir, cfg, runner, prt); err != nil {
+			prt.Fatalf("Exporting planets: %v", err)
+		}
+		return
+	}
+	if *optWeaponStats {
+		if err := a.ExportWeaponStats(ctx, *optOutDir, cfg, prt); err != nil {
+			prt.Fatalf("Exporting weapon stats: %v", err)
+		}
+		return
+	}
+
 	files, err := a.MatchingFiles(*optInclGlob, *optExclGlob, inclOnlyTypes, inclArchiveIDs, *optMetadataFilter, prt.Infof)
 	if err != nil {
 		prt.Fatalf("%v", err)
@@ -672,7 +706,7 @@ Options:`)
 		var documents map[string]*gltf.Document = make(map[string]*gltf.Document)
 		var documentsToClose []func() error
 		if cfg.Unit.SingleFile {
-			for _, key := range []string{"unit", "geometry_group", "material", "speedtree", "level"} {
+			for _, key := range []string{"unit", "geometry_group", "material", "speedtree", "level", "animation"} {
 				name := "combined_" + key
 				if optInclArchives != nil && len(*optInclArchives) > 0 {
 					name = fmt.Sprintf("%s_%s", strings.ReplaceAll(*optInclArchives, ",", "_"), key)
@@ -683,6 +717,8 @@ Options:`)
 					format = cfg.Model.Format
 				case "material":
 					format = cfg.Material.Format
+				case "animation":
+					format = cfg.Animation.Format
 				default:
 					panic("unknown format: " + key)
 				}
@@ -150,7 +150,7 @@ func (gd *GameData) GoExport(extractCtx context.Context, files []stingray.FileID
 		var documents map[string]*gltf.Document = make(map[string]*gltf.Document)
 		var documentsToClose []func() error
 		if cfg.Unit.SingleFile {
-			for _, key := range []string{"unit", "geometry_group", "material", "level", "prefab", "speedtree"} {
+			for _, key := range []string{"unit", "geometry_group", "material", "level", "prefab", "speedtree", "animation"} {
 				name := "combined_" + key
 				var format string
 				switch key {
@@ -158,6 +158,8 @@ func (gd *GameData) GoExport(extractCtx context.Context, files []stingray.FileID
 					format = cfg.Model.Format
 				case "material":
 					format = cfg.Material.Format
+				case "animation":
+					format = cfg.Animation.Format
 				default:
 					panic("unknown format: " + key)
 				}
@@ -232,15 +234,90 @@ func (gd *GameData) GoExport(extractCtx context.Context, files []stingray.FileID
 	return ex
 }
 
+// GoExportPlanets exports all planets in the background (see [app.App.ExportPlanets]).
+func (gd *GameData) GoExportPlanets(extractCtx context.Context, outDir string, cfg appconfig.Config, runner *exec.Runner, printer app.Printer) *GameDataExport {
+	ex := &GameDataExport{}
+	ex.NumFiles = 1
+	ex.CurrentFileName = "planets.json"
+	extractCtx, cancel := context.WithCancel(extractCtx)
+	ex.Cancel = cancel
+
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				printer.Fatalf("%v", err)
+			}
+
+			printer.NoStatus()
+			ex.Lock()
+			ex.Done = true
+			ex.Unlock()
+		}()
+
+		if err := gd.ExportPlanets(extractCtx, outDir, cfg, runner, printer); err != nil {
+			if errors.Is(err, context.Canceled) {
+				ex.Lock()
+				ex.Canceled = true
+				ex.Unlock()
+			} else {
+				printer.Errorf("%v", err)
+			}
+		}
+	}()
+	return ex
+}
+
+// GoExportWeaponStats exports the weapon stat table in the background (see [app.App.ExportWeaponStats]).
+func (gd *GameData) GoExportWeaponStats(extractCtx context.Context, outDir string, cfg appconfig.Config, printer app.Printer) *GameDataExport {
+	ex := &GameDataExport{}
+	ex.NumFiles = 1
+	ex.CurrentFileName = "weapon_stats." + cfg.WeaponStats.Format
+	extractCtx, cancel := context.WithCancel(extractCtx)
+	ex.Cancel = cancel
+
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				printer.Fatalf("%v", err)
+			}
+
+			printer.NoStatus()
+			ex.Lock()
+			ex.Done = true
+			ex.Unlock()
+		}()
+
+		if err := gd.ExportWeaponStats(extractCtx, outDir, cfg, printer); err != nil {
+			if errors.Is(err, context.Canceled) {
+				ex.Lock()
+				ex.Canceled = true
+				ex.Unlock()
+			} else {
+				printer.Errorf("%v", err)
+			}
+		}
+	}()
+	return ex
+}
+
 type GameDataLoad struct {
 	sync.Mutex
 	Progress float32
 	Result   *GameData
 	Err      error
+	Warnings []string
 	Done     bool
 }
 
-func (gd *GameDataLoad) loadGameData(ctx context.Context, gameDir string) {
+func (gd *GameDataLoad) loadGameData(ctx context.Context, gameDir string, dataLibraryDir string) {
+	if _, err := datalib.LoadSnapshot(dataLibraryDir); err != nil {
+		gd.Lock()
+		gd.Err = fmt.Errorf("loading data library: %w, please check the data library directory under \"%v Extractor config\"", err, fnt.I.SettingsApplications)
+		gd.Done = true
+		gd.Unlock()
+		return
+	}
+
 	if gameDir == "" {
 		var err error
 		gameDir, err = app.DetectGameDir()
@@ -268,6 +345,9 @@ func (gd *GameDataLoad) loadGameData(ctx context.Context, gameDir string) {
 
 	res := NewGameData(a)
 	gd.Lock()
+	if err := a.CheckDataLibrarySnapshot(); err != nil {
+		gd.Warnings = append(gd.Warnings, err.Error())
+	}
 	gd.Result = res
 	gd.Done = true
 	gd.Unlock()
@@ -275,13 +355,15 @@ func (gd *GameDataLoad) loadGameData(ctx context.Context, gameDir string) {
 
 // GoLoadGameData asynchronously loads the game data.
 // Pass string "<auto-detect>" or empty string to gameDir to auto-detect.
-func (gd *GameDataLoad) GoLoadGameData(ctx context.Context, gameDir string) {
+// Pass an empty dataLibraryDir to use the built-in data library files.
+func (gd *GameDataLoad) GoLoadGameData(ctx context.Context, gameDir string, dataLibraryDir string) {
 	gd.Progress = 0
 	gd.Result = nil
 	gd.Err = nil
+	gd.Warnings = nil
 	gd.Done = false
 	if gameDir == "<auto-detect>" {
 		gameDir = ""
 	}
-	go gd.loadGameData(ctx, gameDir)
+	go gd.loadGameData(ctx, gameDir, dataLibraryDir)
 }
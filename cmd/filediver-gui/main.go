@@ -68,7 +68,7 @@ var (
 )
 
 const ffmpegFeatures = `- Preview video
-- Convert audio to OGG/AAC/MP3
+- Convert audio to AAC/MP3
 - Convert video to MP4`
 
 const scriptsDistFeatures = `- Export models (units/geometry_groups/prefabs) and materials to .blend (Blender)`
@@ -88,6 +88,9 @@ type guiApp struct {
 	gameDataLoad   GameDataLoad
 	gameDataExport *GameDataExport
 	gameData       *GameData
+	// Set when the game data has to be reloaded, but an export or a
+	// previous load is still using the data library.
+	gameDataReloadPending bool
 
 	previewState *previews.AutoPreviewState
 
@@ -321,7 +324,7 @@ func (a *guiApp) onInitWindow(state *imgui_wrapper.State) error {
 	}
 
 	// Load game files
-	a.gameDataLoad.GoLoadGameData(a.ctx, a.extractorConfig.Gamedir)
+	a.gameDataLoad.GoLoadGameData(a.ctx, a.extractorConfig.Gamedir, a.extractorConfig.DataLibrary)
 
 	return nil
 }
@@ -579,14 +582,38 @@ func (a *guiApp) drawMenuBar() {
 	}
 }
 
+// startPendingGameDataLoad starts reloading the game data once no
+// export or load is running anymore. Loading replaces the data library
+// globals, which exports read without synchronization.
+func (a *guiApp) startPendingGameDataLoad() {
+	if !a.gameDataReloadPending || a.gameDataExport != nil {
+		return
+	}
+	a.gameDataLoad.Lock()
+	done := a.gameDataLoad.Done
+	a.gameDataLoad.Unlock()
+	if !done {
+		return
+	}
+	a.gameDataReloadPending = false
+	a.gameDataLoad.GoLoadGameData(a.ctx, a.extractorConfig.Gamedir, a.extractorConfig.DataLibrary)
+}
+
 func (a *guiApp) drawBrowserWindow() {
+	a.startPendingGameDataLoad()
 	if imgui.Begin(fnt.I.ViewList + " Browser") {
-		if a.gameData == nil {
+		if a.gameData == nil && a.gameDataReloadPending && a.gameDataExport != nil {
+			imutils.Textf(fnt.I.HourglassTop + " Waiting for the running export to finish...")
+		} else if a.gameData == nil {
 			a.gameDataLoad.Lock()
-			if a.gameDataLoad.Done {
+			// A pending reload makes the result of the previous load stale
+			if a.gameDataLoad.Done && !a.gameDataReloadPending {
 				if a.gameDataLoad.Err == nil {
 					if a.gameData == nil {
 						a.gameData = a.gameDataLoad.Result
+						for _, warning := range a.gameDataLoad.Warnings {
+							a.logger.Warnf("%v", warning)
+						}
 						types := make(map[stingray.Hash]struct{})
 						for id := range a.gameData.DataDir.Files {
 							types[id.Type] = struct{}{}
@@ -1031,6 +1058,37 @@ func (a *guiApp) drawExportWindow() {
 			}
 			imgui.EndDisabled()
 			imgui.PopID()
+
+			imgui.PushIDStr("Export planets button")
+			imgui.BeginDisabledV(a.gameData == nil)
+			if imgui.ButtonV(fnt.I.Public+" Export planets", imgui.NewVec2(-math.SmallestNonzeroFloat32, 0)) && a.gameData != nil {
+				a.logger.Reset()
+				a.gameDataExport = a.gameData.GoExportPlanets(
+					a.ctx,
+					a.exportDir,
+					a.extractorConfig,
+					a.runner,
+					a.logger,
+				)
+			}
+			imgui.SetItemTooltip("Export all planets with their biome, level, shading environment and sky settings (see planet options)")
+			imgui.EndDisabled()
+			imgui.PopID()
+
+			imgui.PushIDStr("Export weapon stats button")
+			imgui.BeginDisabledV(a.gameData == nil)
+			if imgui.ButtonV(fnt.I.Table+" Export weapon stats", imgui.NewVec2(-math.SmallestNonzeroFloat32, 0)) && a.gameData != nil {
+				a.logger.Reset()
+				a.gameDataExport = a.gameData.GoExportWeaponStats(
+					a.ctx,
+					a.exportDir,
+					a.extractorConfig,
+					a.logger,
+				)
+			}
+			imgui.SetItemTooltip("Export a stat table of all weapons with their projectiles, damage and explosions (see weapon stat options)")
+			imgui.EndDisabled()
+			imgui.PopID()
 		} else {
 			if a.gameDataExport.Done {
 				if !a.gameDataExport.Canceled && a.exportNotifyWhenDone {
@@ -1078,9 +1136,9 @@ func (a *guiApp) drawExtractorConfigWindow() {
 	if imgui.Begin(fnt.I.SettingsApplications + " Extractor config") {
 		prevExtrCfg := a.extractorConfig
 		if widgets.ConfigEditor(&a.extractorConfig, &a.extractorConfigShowAdvanced, &a.extractorConfigSearchQuery) {
-			if a.extractorConfig.Gamedir != prevExtrCfg.Gamedir {
+			if a.extractorConfig.Gamedir != prevExtrCfg.Gamedir || a.extractorConfig.DataLibrary != prevExtrCfg.DataLibrary {
 				a.gameData = nil
-				a.gameDataLoad.GoLoadGameData(a.ctx, a.extractorConfig.Gamedir)
+				a.gameDataReloadPending = true
 			}
 			if a.extractorConfig != prevExtrCfg {
 				if err := a.extractorConfig.Save(a.extractorConfigPath); err != nil {
@@ -279,7 +279,7 @@ func (pv *AutoPreviewState) LoadFile(ctx context.Context, fileID stingray.FileID
 			return
 		}
 
-		err = pv.state.material.LoadMaterial(data, pv.getResource, pv.hashes, pv.thinhashes)
+		err = pv.state.material.LoadMaterial(fileID.Name, data, pv.getResource, pv.hashes, pv.thinhashes)
 		if err != nil {
 			pv.err = fmt.Errorf("loading material state: %w", err)
 			return
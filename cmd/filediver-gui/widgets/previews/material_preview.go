@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"maps"
 	"slices"
 	"strings"
 
@@ -24,11 +23,15 @@ type MaterialPreviewState struct {
 	textures         map[string]*DDSPreviewState // nil preview state represents null texture
 	textureKeys      [][2]string
 	activeTexture    int
+	textureDefinedBy map[string]string
 	settings         map[string][]float32
 	settingKeys      []string
+	settingDefinedBy map[string]string
 	settingsVisible  bool
-	baseMaterial     stingray.Hash
-	baseMaterialName string
+	// Base material chain, excluding the material itself
+	baseMaterials     []stingray.Hash
+	baseMaterialNames []string
+	missingBase       stingray.Hash
 
 	offset          imgui.Vec2
 	zoom            float32
@@ -39,10 +42,12 @@ type MaterialPreviewState struct {
 
 func NewMaterialPreview() *MaterialPreviewState {
 	return &MaterialPreviewState{
-		textures:        make(map[string]*DDSPreviewState),
-		activeTexture:   -1,
-		settings:        make(map[string][]float32),
-		settingsVisible: true,
+		textures:         make(map[string]*DDSPreviewState),
+		activeTexture:    -1,
+		textureDefinedBy: make(map[string]string),
+		settings:         make(map[string][]float32),
+		settingDefinedBy: make(map[string]string),
+		settingsVisible:  true,
 	}
 }
 
@@ -54,7 +59,9 @@ func (pv *MaterialPreviewState) Delete() {
 	}
 }
 
-func (pv *MaterialPreviewState) LoadMaterial(mat *material.Material, getResource GetResourceFunc, hashes map[stingray.Hash]string, thinhashes map[stingray.ThinHash]string) error {
+// LoadMaterial loads the material called name, including the textures and
+// settings inherited from its base materials.
+func (pv *MaterialPreviewState) LoadMaterial(name stingray.Hash, mat *material.Material, getResource GetResourceFunc, hashes map[stingray.Hash]string, thinhashes map[stingray.ThinHash]string) error {
 	if mat == nil {
 		return fmt.Errorf("attempted to load nil material")
 	}
@@ -63,13 +70,43 @@ func (pv *MaterialPreviewState) LoadMaterial(mat *material.Material, getResource
 	clear(pv.textures)
 	pv.textureKeys = nil
 	pv.activeTexture = -1
+	clear(pv.textureDefinedBy)
 	clear(pv.settings)
 	pv.settingKeys = nil
-	pv.baseMaterial = stingray.Hash{}
+	clear(pv.settingDefinedBy)
+	pv.baseMaterials = nil
+	pv.baseMaterialNames = nil
+	pv.missingBase = stingray.Hash{}
+
+	lookupHash := func(hash stingray.Hash) string {
+		if s, ok := hashes[hash]; ok {
+			return s
+		}
+		return hash.String()
+	}
+
+	resolved, err := material.Resolve(material.ReadFunc(func(id stingray.FileID, typ stingray.DataType) ([]byte, error) {
+		data, exists, err := getResource(id, typ)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, stingray.ErrFileNotExist
+		}
+		return data, nil
+	}), name, mat)
+	if err != nil {
+		return fmt.Errorf("resolving base materials: %w", err)
+	}
+	definedBy := func(level int) string {
+		if level == 0 {
+			return "this material"
+		}
+		return lookupHash(resolved.Chain[level])
+	}
 
-	sortedTextureUsages := slices.SortedFunc(maps.Keys(mat.Textures), stingray.ThinHash.Cmp)
-	for _, key := range sortedTextureUsages {
-		path := mat.Textures[key]
+	for _, key := range resolved.SortedTextures() {
+		path := resolved.Textures[key].Texture
 		var imageName, pathName string
 		var ok bool
 		imageName, ok = thinhashes[key]
@@ -81,6 +118,7 @@ func (pv *MaterialPreviewState) LoadMaterial(mat *material.Material, getResource
 		}
 
 		textureKey := [2]string{imageName, pathName}
+		pv.textureDefinedBy[imageName] = definedBy(resolved.Textures[key].Level)
 
 		if path.Value == 0 {
 			// Zero texture
@@ -129,22 +167,22 @@ func (pv *MaterialPreviewState) LoadMaterial(mat *material.Material, getResource
 		pv.activeTexture = 0
 	}
 
-	for key, value := range mat.Settings {
+	for key, value := range resolved.Settings {
 		keyName, ok := thinhashes[key]
 		if !ok {
 			keyName = "unknown setting: " + key.String()
 		}
-		pv.settings[keyName] = value
+		pv.settings[keyName] = value.Value
 		pv.settingKeys = append(pv.settingKeys, keyName)
+		pv.settingDefinedBy[keyName] = definedBy(value.Level)
 	}
 	slices.Sort(pv.settingKeys)
 
-	pv.baseMaterial = mat.BaseMaterial
-	if bmName, ok := hashes[mat.BaseMaterial]; ok {
-		pv.baseMaterialName = bmName
-	} else {
-		pv.baseMaterialName = mat.BaseMaterial.String()
+	for _, base := range resolved.Chain[1:] {
+		pv.baseMaterials = append(pv.baseMaterials, base)
+		pv.baseMaterialNames = append(pv.baseMaterialNames, lookupHash(base))
 	}
+	pv.missingBase = resolved.Missing
 
 	return nil
 }
@@ -182,7 +220,7 @@ func MaterialPreview(name string, pv *MaterialPreviewState) {
 	if currTexture != -1 {
 		fmt.Fprintf(&infoB, "Usage=%v (%v/%v)\n", textureUsage, pv.activeTexture+1, len(pv.textures))
 		if ddsPv != nil {
-			fmt.Fprintf(&infoB, "Size=(%v,%v)\nFormat=%v\nPath=%v\n", ddsPv.imageSize.X, ddsPv.imageSize.Y, ddsPv.ddsInfo.DXT10Header.DXGIFormat, texturePath)
+			fmt.Fprintf(&infoB, "Size=(%v,%v)\nFormat=%v\nPath=%v\nDefined by=%v\n", ddsPv.imageSize.X, ddsPv.imageSize.Y, ddsPv.ddsInfo.DXT10Header.DXGIFormat, texturePath, pv.textureDefinedBy[textureUsage])
 			ddsPv.offset = pv.offset
 			ddsPv.zoom = pv.zoom
 			ddsPv.linearFiltering = pv.linearFiltering
@@ -190,7 +228,7 @@ func MaterialPreview(name string, pv *MaterialPreviewState) {
 				ddsPv.ignoreAlpha = pv.ignoreAlpha
 			}
 		} else {
-			fmt.Fprintf(&infoB, "Usage=N/A (0/0)\nSize=N/A\nFormat=N/A\nPath=N/A\n")
+			fmt.Fprintf(&infoB, "Usage=N/A (0/0)\nSize=N/A\nFormat=N/A\nPath=N/A\nDefined by=N/A\n")
 		}
 	} else {
 		fmt.Fprintf(&infoB, "Usage=N/A (0/0)\nSize=N/A\nFormat=N/A\nPath=N/A\n")
@@ -328,22 +366,37 @@ func MaterialPreview(name string, pv *MaterialPreviewState) {
 
 	imgui.TextUnformatted("Base material:")
 	imgui.SameLine()
-	if (pv.baseMaterial == stingray.Hash{}) {
+	if len(pv.baseMaterials) == 0 && (pv.missingBase == stingray.Hash{}) {
 		imgui.TextUnformatted("none")
-	} else {
+	}
+	for i, base := range pv.baseMaterials {
+		if i > 0 {
+			imgui.SameLine()
+			imgui.TextUnformatted(fnt.I.ArrowRight)
+			imgui.SameLine()
+		}
 		fileID := stingray.FileID{
-			Name: pv.baseMaterial,
+			Name: base,
 			Type: stingray.Sum("material"),
 		}
-		widgets.GamefileLinkTextF(fileID, "%v", pv.baseMaterialName)
+		widgets.GamefileLinkTextF(fileID, "%v", pv.baseMaterialNames[i])
+	}
+	if (pv.missingBase != stingray.Hash{}) {
+		if len(pv.baseMaterials) > 0 {
+			imgui.SameLine()
+			imgui.TextUnformatted(fnt.I.ArrowRight)
+			imgui.SameLine()
+		}
+		imgui.TextUnformatted(fmt.Sprintf("%v (missing)", pv.missingBase))
 	}
 }
 
 func MaterialPreviewMaterialSettings(pv *MaterialPreviewState) {
 	const tableFlags = imgui.TableFlagsResizable | imgui.TableFlagsBorders | imgui.TableFlagsScrollY | imgui.TableFlagsRowBg
-	if imgui.BeginTableV("##Material Settings", 2, tableFlags, imgui.NewVec2(0, 0), 0) {
+	if imgui.BeginTableV("##Material Settings", 3, tableFlags, imgui.NewVec2(0, 0), 0) {
 		imgui.TableSetupColumnV("Name", imgui.TableColumnFlagsWidthStretch, 1, 0)
 		imgui.TableSetupColumnV("Value", imgui.TableColumnFlagsWidthStretch, 2, 0)
+		imgui.TableSetupColumnV("Defined by", imgui.TableColumnFlagsWidthStretch, 1, 0)
 		imgui.TableSetupScrollFreeze(0, 1)
 		imgui.TableHeadersRow()
 
@@ -365,6 +418,9 @@ func MaterialPreviewMaterialSettings(pv *MaterialPreviewState) {
 			}
 			imgui.TextUnformatted(settingString)
 
+			imgui.TableNextColumn()
+			imgui.TextUnformatted(pv.settingDefinedBy[id])
+
 			imgui.PopID()
 		}
 		imgui.EndTable()
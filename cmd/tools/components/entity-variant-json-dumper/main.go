@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hellflame/argparse"
+	"github.com/jwalton/go-supportscolor"
+	"github.com/xypwn/filediver/app"
+	datalib "github.com/xypwn/filediver/datalibrary"
+	"github.com/xypwn/filediver/hashes"
+	"github.com/xypwn/filediver/stingray"
+	stingray_strings "github.com/xypwn/filediver/stingray/strings"
+)
+
+type simpleEntityVariant struct {
+	Kind   string                `json:"kind"`
+	Base   string                `json:"base"`
+	Delta  string                `json:"delta"`
+	Diff   []datalib.FieldDiff   `json:"diff"`
+	Entity *datalib.SimpleEntity `json:"entity,omitempty"`
+}
+
+// parseResource parses either a resource name or a hash starting with 0x.
+func parseResource(s string) (stingray.Hash, error) {
+	if strings.HasPrefix(s, "0x") {
+		return stingray.ParseHash(s)
+	}
+	return stingray.Sum(s), nil
+}
+
+func main() {
+	prt := app.NewConsolePrinter(
+		supportscolor.Stderr().SupportsColor,
+		os.Stderr,
+		os.Stderr,
+	)
+
+	parser := argparse.NewParser("entity-variant-json-dumper", "Applies entity deltas to the entities they modify and lists the changed component fields", nil)
+	optBase := parser.String("b", "base", &argparse.Option{
+		Help: "Entity to apply the delta to (name or 0x-prefixed hash); lists all known variants if unset",
+	})
+	optDelta := parser.String("d", "delta", &argparse.Option{
+		Help: "Resource the delta is stored under (name or 0x-prefixed hash); defaults to the base entity",
+	})
+	optComponents := parser.Flag("c", "components", &argparse.Option{
+		Help: "Also dump the full patched component set of each variant",
+	})
+	if err := parser.Parse(nil); err != nil {
+		prt.Fatalf("parser: %v", err)
+	}
+
+	knownHashes := app.ParseHashes(hashes.Hashes)
+	knownThinHashes := app.ParseHashes(hashes.ThinHashes)
+	knownDLHashes := app.ParseHashes(hashes.DLTypeNames)
+
+	hashesMap := make(map[stingray.Hash]string)
+	for _, name := range knownHashes {
+		hashesMap[stingray.Sum(name)] = name
+	}
+
+	thinHashesMap := make(map[stingray.ThinHash]string)
+	for _, name := range knownThinHashes {
+		thinHashesMap[stingray.Sum(name).Thin()] = name
+	}
+
+	dlHashesMap := make(map[datalib.DLHash]string)
+	for _, name := range knownDLHashes {
+		dlHashesMap[datalib.Sum(name)] = name
+	}
+
+	ctx := context.Background()
+
+	gameDir, err := app.DetectGameDir()
+	if err != nil {
+		prt.Fatalf("Helldivers 2 Steam installation path not found: %v", err)
+	}
+
+	dataDir, err := stingray.OpenDataDir(ctx, filepath.Join(gameDir, "data"), func(curr, total int) {
+		prt.Statusf("Reading metadata %.0f%%", float64(curr)/float64(total)*100)
+	})
+	if err != nil {
+		prt.Fatalf("Could not open data dir: %v", err)
+	}
+	prt.NoStatus()
+	mapping := stingray_strings.LoadLanguageMap(dataDir, stingray_strings.LanguageFriendlyNameToHash["English (US)"])
+
+	lookupHash := func(hash stingray.Hash) string {
+		if name, ok := hashesMap[hash]; ok {
+			return name
+		}
+		return hash.String()
+	}
+
+	lookupThinHash := func(hash stingray.ThinHash) string {
+		if name, ok := thinHashesMap[hash]; ok {
+			return name
+		}
+		return hash.String()
+	}
+
+	lookupDLHash := func(hash datalib.DLHash) string {
+		if name, ok := dlHashesMap[hash]; ok {
+			return name
+		}
+		return hash.String()
+	}
+
+	lookupString := func(stringId uint32) string {
+		if name, ok := mapping[stringId]; ok {
+			return name
+		}
+		return fmt.Sprintf("String ID not found: %v", stringId)
+	}
+
+	var variants []datalib.EntityVariant
+	if *optBase != "" {
+		base, err := parseResource(*optBase)
+		if err != nil {
+			prt.Fatalf("base: %v", err)
+		}
+		delta := base
+		if *optDelta != "" {
+			delta, err = parseResource(*optDelta)
+			if err != nil {
+				prt.Fatalf("delta: %v", err)
+			}
+		}
+		variant, err := datalib.ParseEntityVariant(base, delta)
+		if err != nil {
+			prt.Fatalf("%v", err)
+		}
+		variants = append(variants, variant)
+	} else {
+		variants, err = datalib.ParseEntityVariants()
+		if err != nil {
+			prt.Fatalf("%v", err)
+		}
+	}
+
+	result := make([]simpleEntityVariant, 0, len(variants))
+	for _, variant := range variants {
+		diff, err := datalib.DiffEntities(variant.BaseEntity, variant.Entity, lookupHash, lookupThinHash, lookupDLHash, lookupString)
+		if err != nil {
+			prt.Errorf("diff %v with %v: %v", lookupHash(variant.Base), lookupHash(variant.Delta), err)
+			continue
+		}
+		if diff == nil {
+			diff = []datalib.FieldDiff{}
+		}
+		simple := simpleEntityVariant{
+			Kind:  variant.Kind.String(),
+			Base:  lookupHash(variant.Base),
+			Delta: lookupHash(variant.Delta),
+			Diff:  diff,
+		}
+		if *optComponents {
+			entity := variant.Entity.ToSimple(lookupHash, lookupThinHash, lookupDLHash, lookupString)
+			simple.Entity = &entity
+		}
+		result = append(result, simple)
+	}
+
+	output, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		prt.Fatalf("marshal variants as json: %v", err)
+	}
+	fmt.Println(string(output))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/hellflame/argparse"
+	"github.com/jwalton/go-supportscolor"
+	"github.com/xypwn/filediver/app"
+	datalib "github.com/xypwn/filediver/datalibrary"
+)
+
+type genericSubdata struct {
+	Type string                 `json:"type"`
+	Data *datalib.GenericStruct `json:"data"`
+}
+
+func main() {
+	prt := app.NewConsolePrinter(
+		supportscolor.Stderr().SupportsColor,
+		os.Stderr,
+		os.Stderr,
+	)
+
+	parser := argparse.NewParser("generic-json-dumper", "Decodes a .dl_bin settings file using only the type library", nil)
+	path := parser.String("", "path", &argparse.Option{
+		Help:       "The path to the .dl_bin to dump",
+		Positional: true,
+	})
+	typelibPath := parser.String("t", "typelib", &argparse.Option{
+		Help: "Path to a .dl_typelib to use instead of the embedded one",
+	})
+	if err := parser.Parse(nil); err != nil {
+		prt.Fatalf("parser: %v", err)
+	}
+
+	var typelibData []byte
+	if *typelibPath != "" {
+		var err error
+		typelibData, err = os.ReadFile(*typelibPath)
+		if err != nil {
+			prt.Fatalf("read %v: %v", *typelibPath, err)
+		}
+	}
+	typelib, err := datalib.ParseTypeLib(typelibData)
+	if err != nil {
+		prt.Fatalf("parse typelib: %v", err)
+	}
+
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		prt.Fatalf("read %v: %v", *path, err)
+	}
+	subdatas, err := datalib.ParseSubdataList(data)
+	if err != nil {
+		prt.Fatalf("parse %v: %v", *path, err)
+	}
+
+	result := make([]genericSubdata, 0, len(subdatas))
+	for i, subdata := range subdatas {
+		value, err := subdata.DecodeGeneric(typelib)
+		if err != nil {
+			prt.Errorf("decode item %v (%v): %v", i, subdata.Type, err)
+			continue
+		}
+		result = append(result, genericSubdata{
+			Type: subdata.Type.String(),
+			Data: value,
+		})
+	}
+
+	output, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		prt.Fatalf("marshal %v as json: %v", *path, err)
+	}
+	fmt.Println(string(output))
+}
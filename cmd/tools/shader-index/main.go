@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"github.com/gobwas/glob"
+	"github.com/jwalton/go-supportscolor"
+	"github.com/xypwn/filediver/app"
+	"github.com/xypwn/filediver/hashes"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/unit"
+	"github.com/xypwn/filediver/stingray/unit/material"
+	d3dops "github.com/xypwn/filediver/stingray/unit/material/d3d/opcodes"
+)
+
+func printUsage() {
+	fmt.Println(`Usage:
+  shader-index [options]
+
+Fingerprints the shader programs of all materials, groups identical programs
+and lists the materials and units using each one, along with the resources
+and constant buffers of the program.
+
+options:
+  -o OUTPUT_FILE     --  output file path (default: "fd_shader_index.json")
+  -m MATERIAL_GLOB   --  only list programs used by a material whose name matches the glob
+  -U                 --  don't search units for the materials they use
+
+examples:
+  shader-index -m "*armor*" -o armor_shaders.json  --  list all programs used by armor materials`)
+}
+
+func parseFlag(args *[]string, optionName string) bool {
+	if len(*args) > 0 && (*args)[0] == optionName {
+		*args = (*args)[1:]
+		return true
+	} else {
+		return false
+	}
+}
+
+func parseArgWithParam(args *[]string, optionName string) (string, bool) {
+	if len(*args) > 0 && (*args)[0] == optionName {
+		*args = (*args)[1:]
+		var param string
+		if len(*args) > 0 {
+			param = (*args)[0]
+			*args = (*args)[1:]
+			return param, true
+		} else {
+			return "", false
+		}
+	} else {
+		return "", false
+	}
+}
+
+type ProgramBinding struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	ViewDimension string   `json:"view_dimension,omitempty"`
+	BindPoint     uint32   `json:"bind_point"`
+	BindCount     uint32   `json:"bind_count"`
+	Stages        []string `json:"stages"`
+}
+
+type ProgramVariable struct {
+	Name   string `json:"name"`
+	Offset uint32 `json:"offset"`
+	Size   uint32 `json:"size"`
+}
+
+type ProgramConstantBuffer struct {
+	Name      string            `json:"name"`
+	Size      uint32            `json:"size"`
+	Stages    []string          `json:"stages"`
+	Variables []ProgramVariable `json:"variables"`
+}
+
+type ProgramStage struct {
+	Stage        string `json:"stage"`
+	ShaderModel  string `json:"shader_model"`
+	Digest       string `json:"digest"`
+	Instructions int    `json:"instructions"`
+}
+
+// ProgramUsage is a program slot of a material's GPU data.
+type ProgramUsage struct {
+	Material string `json:"material"`
+	Block    int    `json:"block"`
+	Program  int    `json:"program"`
+}
+
+// ProgramGroup is a set of identical shader programs.
+type ProgramGroup struct {
+	Fingerprint     string                  `json:"fingerprint"`
+	Stages          []ProgramStage          `json:"stages"`
+	Bindings        []ProgramBinding        `json:"bindings"`
+	ConstantBuffers []ProgramConstantBuffer `json:"constant_buffers"`
+	// Materials storing the program in their GPU data
+	Definitions []ProgramUsage `json:"definitions"`
+	// Materials using the program, including those inheriting it from
+	// a base material
+	Materials []string `json:"materials"`
+	Units     []string `json:"units"`
+}
+
+// fingerprint identifies a program by the DXBC digests of its stages,
+// hashing the serialized shader if the digest is missing.
+func fingerprint(program *material.ShaderProgram) (string, error) {
+	h := sha256.New()
+	for _, s := range program.Stages() {
+		h.Write([]byte(s.Stage))
+		if s.Shader.Digest != [16]byte{} {
+			h.Write(s.Shader.Digest[:])
+			continue
+		}
+		data, err := s.Shader.Serialize()
+		if err != nil {
+			return "", fmt.Errorf("%v shader: %w", s.Stage, err)
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+func newProgramGroup(fp string, program *material.ShaderProgram) *ProgramGroup {
+	group := &ProgramGroup{
+		Fingerprint:     fp,
+		Stages:          make([]ProgramStage, 0),
+		Bindings:        make([]ProgramBinding, 0),
+		ConstantBuffers: make([]ProgramConstantBuffer, 0),
+	}
+	bindings := make(map[string]int)
+	cbuffers := make(map[string]int)
+	for _, s := range program.Stages() {
+		group.Stages = append(group.Stages, ProgramStage{
+			Stage:        s.Stage,
+			ShaderModel:  fmt.Sprintf("%v.%v", s.Shader.ShaderCode.Version.Major, s.Shader.ShaderCode.Version.Minor),
+			Digest:       hex.EncodeToString(s.Shader.Digest[:]),
+			Instructions: len(s.Shader.ShaderCode.Opcodes),
+		})
+		for _, rb := range s.Shader.ResourceDefinitions.ResourceBindings {
+			key := rb.InputType.ToString() + ":" + rb.Name
+			idx, ok := bindings[key]
+			if !ok {
+				idx = len(group.Bindings)
+				bindings[key] = idx
+				var viewDimension string
+				if rb.ViewDimension != d3dops.UNKNOWN {
+					viewDimension = rb.ViewDimension.ToString()
+				}
+				group.Bindings = append(group.Bindings, ProgramBinding{
+					Name:          rb.Name,
+					Type:          rb.InputType.ToString(),
+					ViewDimension: viewDimension,
+					BindPoint:     rb.BindPoint,
+					BindCount:     rb.BindCount,
+				})
+			}
+			group.Bindings[idx].Stages = append(group.Bindings[idx].Stages, s.Stage)
+		}
+		for _, cb := range s.Shader.ResourceDefinitions.ConstantBuffers {
+			idx, ok := cbuffers[cb.Name]
+			if !ok {
+				idx = len(group.ConstantBuffers)
+				cbuffers[cb.Name] = idx
+				variables := make([]ProgramVariable, 0, len(cb.Variables))
+				for _, v := range cb.Variables {
+					variables = append(variables, ProgramVariable{
+						Name:   v.Name,
+						Offset: v.BufferOffset,
+						Size:   v.Size,
+					})
+				}
+				group.ConstantBuffers = append(group.ConstantBuffers, ProgramConstantBuffer{
+					Name:      cb.Name,
+					Size:      cb.Size,
+					Variables: variables,
+				})
+			}
+			group.ConstantBuffers[idx].Stages = append(group.ConstantBuffers[idx].Stages, s.Stage)
+		}
+	}
+	return group
+}
+
+func main() {
+	outFilePath := "fd_shader_index.json"
+	var materialGlob glob.Glob
+	searchUnits := true
+	{
+		args := os.Args[1:]
+		for len(args) > 0 {
+			if param, ok := parseArgWithParam(&args, "-o"); ok {
+				outFilePath = param
+			} else if param, ok := parseArgWithParam(&args, "-m"); ok {
+				var err error
+				materialGlob, err = glob.Compile(param)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid material glob: %v\n", err)
+					os.Exit(1)
+				}
+			} else if parseFlag(&args, "-U") {
+				searchUnits = false
+			} else {
+				printUsage()
+				os.Exit(1)
+			}
+		}
+	}
+
+	prt := app.NewConsolePrinter(
+		supportscolor.Stderr().SupportsColor,
+		os.Stderr,
+		os.Stderr,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	gameDir, err := app.DetectGameDir()
+	if err != nil {
+		prt.Fatalf("Unable to detect game install directory.")
+	}
+
+	knownHashes := app.ParseHashes(hashes.Hashes)
+	knownThinHashes := app.ParseHashes(hashes.ThinHashes)
+
+	a, err := app.OpenGameDir(ctx, gameDir, knownHashes, knownThinHashes, stingray.ThinHash{}, func(curr int, total int) {
+		prt.Statusf("Opening game directory %.0f%%", float64(curr)/float64(total)*100)
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			prt.NoStatus()
+			prt.Warnf("Shader index canceled")
+			return
+		} else {
+			prt.Fatalf("%v", err)
+		}
+	}
+	prt.NoStatus()
+
+	materialFiles, err := a.MatchingFiles("", "", []string{"material"}, nil, "", prt.Infof)
+	if err != nil {
+		prt.Fatalf("%v", err)
+	}
+
+	groups := make(map[string]*ProgramGroup)
+	// Programs defined by each material, by fingerprint
+	materialPrograms := make(map[stingray.Hash][]string)
+	baseMaterials := make(map[stingray.Hash]stingray.Hash)
+	numPrograms := 0
+	numMaterials := 0
+	for id := range materialFiles {
+		if ctx.Err() != nil {
+			prt.NoStatus()
+			prt.Warnf("Shader index canceled")
+			return
+		}
+		numMaterials++
+		prt.Statusf("Reading materials %v/%v", numMaterials, len(materialFiles))
+
+		data, err := a.DataDir.Read(id, stingray.DataMain)
+		if err != nil {
+			prt.Errorf("%v.material: %v", a.LookupHash(id.Name), err)
+			continue
+		}
+		mat, err := material.LoadMain(bytes.NewReader(data))
+		if err != nil {
+			prt.Errorf("%v.material: %v", a.LookupHash(id.Name), err)
+			continue
+		}
+		baseMaterials[id.Name] = mat.BaseMaterial
+
+		data, err = a.DataDir.Read(id, stingray.DataGPU)
+		if errors.Is(err, stingray.ErrFileDataTypeNotExist) {
+			continue
+		} else if err != nil {
+			prt.Errorf("%v.material: %v", a.LookupHash(id.Name), err)
+			continue
+		}
+		matGpu, err := material.LoadGPU(bytes.NewReader(data))
+		if err != nil {
+			prt.Errorf("%v.material: loading GPU data: %v", a.LookupHash(id.Name), err)
+			continue
+		}
+		if matGpu.ShaderPrograms == nil {
+			continue
+		}
+		for blockIdx, block := range matGpu.ShaderPrograms.ProgramBlocks {
+			for programIdx := range block.Programs {
+				program := &block.Programs[programIdx]
+				fp, err := fingerprint(program)
+				if err != nil {
+					prt.Errorf("%v.material: program %v/%v: %v", a.LookupHash(id.Name), blockIdx, programIdx, err)
+					continue
+				}
+				group, ok := groups[fp]
+				if !ok {
+					group = newProgramGroup(fp, program)
+					groups[fp] = group
+				}
+				group.Definitions = append(group.Definitions, ProgramUsage{
+					Material: a.LookupHash(id.Name),
+					Block:    blockIdx,
+					Program:  programIdx,
+				})
+				if !slices.Contains(materialPrograms[id.Name], fp) {
+					materialPrograms[id.Name] = append(materialPrograms[id.Name], fp)
+				}
+				numPrograms++
+			}
+		}
+	}
+	prt.NoStatus()
+
+	// A material uses the programs of the first material in its base
+	// material chain which has any
+	usedPrograms := func(name stingray.Hash) []string {
+		var visited []stingray.Hash
+		for name.Value != 0 && !slices.Contains(visited, name) {
+			if fps, ok := materialPrograms[name]; ok {
+				return fps
+			}
+			visited = append(visited, name)
+			name = baseMaterials[name]
+		}
+		return nil
+	}
+
+	groupMaterials := make(map[string]map[stingray.Hash]struct{})
+	for name := range baseMaterials {
+		for _, fp := range usedPrograms(name) {
+			if groupMaterials[fp] == nil {
+				groupMaterials[fp] = make(map[stingray.Hash]struct{})
+			}
+			groupMaterials[fp][name] = struct{}{}
+		}
+	}
+
+	groupUnits := make(map[string]map[stingray.Hash]struct{})
+	if searchUnits {
+		unitFiles, err := a.MatchingFiles("", "", []string{"unit"}, nil, "", prt.Infof)
+		if err != nil {
+			prt.Fatalf("%v", err)
+		}
+		numUnits := 0
+		for id := range unitFiles {
+			if ctx.Err() != nil {
+				prt.NoStatus()
+				prt.Warnf("Shader index canceled")
+				return
+			}
+			numUnits++
+			prt.Statusf("Reading units %v/%v", numUnits, len(unitFiles))
+
+			data, err := a.DataDir.Read(id, stingray.DataMain)
+			if err != nil {
+				prt.Errorf("%v.unit: %v", a.LookupHash(id.Name), err)
+				continue
+			}
+			info, err := unit.LoadInfo(bytes.NewReader(data))
+			if err != nil {
+				prt.Errorf("%v.unit: %v", a.LookupHash(id.Name), err)
+				continue
+			}
+			for _, matName := range info.Materials {
+				for _, fp := range usedPrograms(matName) {
+					if groupUnits[fp] == nil {
+						groupUnits[fp] = make(map[stingray.Hash]struct{})
+					}
+					groupUnits[fp][id.Name] = struct{}{}
+				}
+			}
+		}
+		prt.NoStatus()
+	}
+
+	sortedNames := func(set map[stingray.Hash]struct{}) []string {
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, a.LookupHash(name))
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	result := make([]*ProgramGroup, 0, len(groups))
+	for _, fp := range slices.Sorted(maps.Keys(groups)) {
+		group := groups[fp]
+		group.Materials = sortedNames(groupMaterials[fp])
+		group.Units = sortedNames(groupUnits[fp])
+		if materialGlob != nil && !slices.ContainsFunc(group.Materials, materialGlob.Match) {
+			continue
+		}
+		result = append(result, group)
+	}
+	// Most widely used programs first
+	slices.SortStableFunc(result, func(a, b *ProgramGroup) int {
+		return len(b.Materials) - len(a.Materials)
+	})
+
+	f, err := os.Create(outFilePath)
+	if err != nil {
+		prt.Fatalf("%v", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(result); err != nil {
+		prt.Fatalf("%v", err)
+	}
+
+	prt.Infof("Found %v distinct programs out of %v in %v materials", len(groups), numPrograms, len(materialPrograms))
+	if materialGlob != nil {
+		prt.Infof("%v programs are used by materials matching the glob", len(result))
+	}
+	prt.Infof("Wrote shader index to %v", outFilePath)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/jwalton/go-supportscolor"
+	"github.com/xypwn/filediver/app"
+	datalib "github.com/xypwn/filediver/datalibrary"
+	"github.com/xypwn/filediver/hashes"
+	stingray_strings "github.com/xypwn/filediver/stingray/strings"
+)
+
+func printUsage() {
+	fmt.Println(`Usage:
+  weapon-stats [options]
+
+Joins the weapon, magazine, reload and heat components of every weapon entity
+with the projectile, arc or beam it fires, its damage and its explosion, and
+writes the result as a stat table with one row per weapon.
+
+options:
+  -f FORMAT          --  output format: csv, json or md (default: "csv")
+  -o OUTPUT_FILE     --  output file path (default: "fd_weapon_stats.<format>")
+  -l LANGUAGE        --  language of weapon and projectile names (default: "English (US)")
+  -d DIRECTORY       --  load data library files from DIRECTORY instead of the built-in ones
+  -n                 --  only list weapons which have a localized name
+
+examples:
+  weapon-stats -f md -n  --  write a markdown table of all named weapons to fd_weapon_stats.md`)
+}
+
+func parseFlag(args *[]string, optionName string) bool {
+	if len(*args) > 0 && (*args)[0] == optionName {
+		*args = (*args)[1:]
+		return true
+	} else {
+		return false
+	}
+}
+
+func parseArgWithParam(args *[]string, optionName string) (string, bool) {
+	if len(*args) > 0 && (*args)[0] == optionName {
+		*args = (*args)[1:]
+		var param string
+		if len(*args) > 0 {
+			param = (*args)[0]
+			*args = (*args)[1:]
+			return param, true
+		} else {
+			return "", false
+		}
+	} else {
+		return "", false
+	}
+}
+
+func main() {
+	format := "csv"
+	outFilePath := ""
+	language := "English (US)"
+	dataLibraryDir := ""
+	namedOnly := false
+	{
+		args := os.Args[1:]
+		for len(args) > 0 {
+			if param, ok := parseArgWithParam(&args, "-f"); ok {
+				format = param
+			} else if param, ok := parseArgWithParam(&args, "-o"); ok {
+				outFilePath = param
+			} else if param, ok := parseArgWithParam(&args, "-l"); ok {
+				language = param
+			} else if param, ok := parseArgWithParam(&args, "-d"); ok {
+				dataLibraryDir = param
+			} else if parseFlag(&args, "-n") {
+				namedOnly = true
+			} else {
+				printUsage()
+				os.Exit(1)
+			}
+		}
+	}
+
+	switch format {
+	case "csv", "json", "md":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format: %v\n", format)
+		os.Exit(1)
+	}
+	if outFilePath == "" {
+		outFilePath = "fd_weapon_stats." + format
+	}
+	languageHash, ok := stingray_strings.LanguageFriendlyNameToHash[language]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown language: %v\n", language)
+		os.Exit(1)
+	}
+
+	prt := app.NewConsolePrinter(
+		supportscolor.Stderr().SupportsColor,
+		os.Stderr,
+		os.Stderr,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	if dataLibraryDir != "" {
+		snapshot, err := datalib.LoadSnapshot(dataLibraryDir)
+		if err != nil {
+			prt.Fatalf("Loading data library: %v", err)
+		}
+		prt.Infof("Using data library files from %v: %v", snapshot.Dir, strings.Join(snapshot.Files, ", "))
+	}
+
+	gameDir, err := app.DetectGameDir()
+	if err == nil {
+		prt.Infof("Using game found at: \"%v\"", gameDir)
+	} else {
+		prt.Errorf("Helldivers 2 Steam installation path not found: %v", err)
+		prt.Fatalf("Unable to detect game install directory.")
+	}
+
+	knownHashes := app.ParseHashes(hashes.Hashes)
+	knownThinHashes := app.ParseHashes(hashes.ThinHashes)
+	a, err := app.OpenGameDir(ctx, gameDir, knownHashes, knownThinHashes, languageHash, func(curr int, total int) {
+		prt.Statusf("Opening game directory %.0f%%", float64(curr)/float64(total)*100)
+	})
+	if err != nil {
+		prt.Fatalf("%v", err)
+	}
+	prt.NoStatus()
+	if err := a.CheckDataLibrarySnapshot(); err != nil {
+		prt.Warnf("%v", err)
+	}
+
+	stats, err := a.LoadWeaponStats(namedOnly)
+	if err != nil {
+		prt.Fatalf("%v", err)
+	}
+
+	f, err := os.Create(outFilePath)
+	if err != nil {
+		prt.Fatalf("%v", err)
+	}
+	defer f.Close()
+	if err := app.WriteWeaponStats(f, format, stats); err != nil {
+		prt.Fatalf("Writing %v: %v", outFilePath, err)
+	}
+	prt.Infof("Wrote stats of %v weapons to %v", len(stats), outFilePath)
+}
@@ -77,6 +77,12 @@ var entityDeltas []byte
 var typelibCompressed []byte
 var typelib []byte
 
+// Game build the embedded files were taken from, in the format of an
+// ah_bin exported to JSON. Empty values mean the build is unknown.
+//
+//go:embed build_info.json
+var builtinBuildInfo []byte
+
 var DLHashesToStrings map[DLHash]string
 
 func init() {
@@ -1,5 +1,12 @@
 package datalib
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
 type DLInstanceHeader struct {
 	_       DLHash // May be a DLHash or uint32
 	Magic   [4]byte
@@ -28,3 +35,32 @@ type DLSubdata struct {
 	DLSubdataHeader
 	Data []byte
 }
+
+// ParseSubdataList parses a count-prefixed list of subdata, as stored in
+// the generated_*.dl_bin settings files.
+func ParseSubdataList(data []byte) ([]DLSubdata, error) {
+	r := bytes.NewReader(data)
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("reading count: %v", err)
+	}
+	result := make([]DLSubdata, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var header DLSubdataHeader
+		if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+			return nil, fmt.Errorf("reading item %v: %v", i, err)
+		}
+		if header.Magic != [4]byte{'L', 'D', 'L', 'D'} {
+			return nil, fmt.Errorf("reading item %v: invalid magic %q", i, header.Magic[:])
+		}
+		subdata := DLSubdata{
+			DLSubdataHeader: header,
+			Data:            make([]byte, header.Size),
+		}
+		if _, err := io.ReadFull(r, subdata.Data); err != nil {
+			return nil, fmt.Errorf("reading item %v data: %v", i, err)
+		}
+		result = append(result, subdata)
+	}
+	return result, nil
+}
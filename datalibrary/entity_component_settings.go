@@ -582,7 +582,78 @@ func parseComponent(componentType DLHash, data []byte) (Component, error) {
 	}
 }
 
+// parseEntityComponent decodes the component of the given type belonging to
+// resource, applying delta if hasDelta is set.
+func parseEntityComponent(typelib *DLTypeLib, genericTables map[DLHash]*genericComponentTable, componentType DLHash, resource stingray.Hash, delta EntityDeltaSettings, hasDelta bool) Component {
+	componentData, err := getComponentDataForHash(componentType, resource)
+	if err != nil {
+		return parseGenericComponent(typelib, genericTables, componentType, resource, delta, hasDelta)
+	}
+
+	if hasDelta {
+		modifiedComponentData, err := PatchComponent(componentType, componentData, delta)
+		if err == nil {
+			componentData = modifiedComponentData
+		}
+	}
+	component, err := parseComponent(componentType, componentData)
+	if err != nil {
+		return ErrorComponent{e: err}
+	}
+	return component
+}
+
+// parseGenericComponent decodes a component using only the type library.
+// tables caches the component tables by component data type; a nil table
+// means the type couldn't be loaded.
+func parseGenericComponent(typelib *DLTypeLib, tables map[DLHash]*genericComponentTable, componentType DLHash, resource stingray.Hash, delta EntityDeltaSettings, hasDelta bool) Component {
+	table, ok := tables[componentType]
+	if !ok {
+		table, _ = loadGenericComponentTable(typelib, componentType)
+		tables[componentType] = table
+	}
+	if table == nil {
+		return UnimplementedComponent{}
+	}
+	offset, err := table.component(resource)
+	if err != nil {
+		return ErrorComponent{e: err}
+	}
+	data := table.data
+	if hasDelta {
+		componentData := data[offset : offset+table.componentSize]
+		modifiedComponentData, err := PatchComponent(componentType, componentData, delta)
+		if err == nil && !bytes.Equal(modifiedComponentData, componentData) {
+			data = slices.Clone(data)
+			copy(data[offset:offset+table.componentSize], modifiedComponentData)
+		}
+	}
+	value, err := DecodeGeneric(typelib, table.componentType, data, offset)
+	if err != nil {
+		return ErrorComponent{e: err}
+	}
+	return GenericComponent{value}
+}
+
 func ParseEntityComponentSettings() (map[stingray.Hash]Entity, error) {
+	return parseEntities(func(stingray.Hash) bool { return true })
+}
+
+// ParseEntity parses the components of a single entity, with its own
+// entity delta applied.
+func ParseEntity(resource stingray.Hash) (Entity, error) {
+	entities, err := parseEntities(func(r stingray.Hash) bool { return r == resource })
+	if err != nil {
+		return Entity{}, err
+	}
+	entity, ok := entities[resource]
+	if !ok {
+		return Entity{}, fmt.Errorf("%v is not an entity", resource)
+	}
+	return entity, nil
+}
+
+func parseEntities(include func(resource stingray.Hash) bool) (map[stingray.Hash]Entity, error) {
 	entitySettingsHash := Sum("EntitySettingsHashmap")
 	typelib, err := ParseTypeLib(nil)
 	if err != nil {
@@ -630,9 +701,12 @@ func ParseEntityComponentSettings() (map[stingray.Hash]Entity, error) {
 
 	entityDeltas, err := ParseEntityDeltas()
 
+	// Component types without a dedicated Go struct, loaded on demand
+	genericTables := make(map[DLHash]*genericComponentTable)
+
 	result := make(map[stingray.Hash]Entity)
 	for _, entityDef := range hashmap {
-		if entityDef.Resource.Value == 0x0 {
+		if entityDef.Resource.Value == 0x0 || !include(entityDef.Resource) {
 			continue
 		}
 		componentIndices := make([]uint16, entityDef.ComponentsCount)
@@ -652,24 +726,7 @@ func ParseEntityComponentSettings() (map[stingray.Hash]Entity, error) {
 				continue
 				//return nil, fmt.Errorf("Invalid component index in entity settings hashmap for resource %v: %v", entityDef.Resource.String(), idx)
 			}
-			componentData, err := getComponentDataForHash(componentType, entityDef.Resource)
-			if err != nil {
-				components[componentType] = UnimplementedComponent{}
-				continue
-			}
-
-			if hasDelta {
-				modifiedComponentData, err := PatchComponent(componentType, componentData, delta)
-				if err == nil {
-					componentData = modifiedComponentData
-				}
-			}
-			component, err := parseComponent(componentType, componentData)
-			if err != nil {
-				components[componentType] = ErrorComponent{e: err}
-				continue
-			}
-			components[componentType] = component
+			components[componentType] = parseEntityComponent(typelib, genericTables, componentType, entityDef.Resource, delta, hasDelta)
 		}
 
 		result[entityDef.Resource] = Entity{
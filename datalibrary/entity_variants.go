@@ -0,0 +1,398 @@
+package datalib
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/xypwn/filediver/stingray"
+)
+
+// EntityVariantKind describes how the delta of an EntityVariant relates
+// to its base entity.
+type EntityVariantKind uint8
+
+const (
+	// The delta is one of the default attachments of a weapon
+	EntityVariantAttachment EntityVariantKind = iota
+	// The delta is the override an entity applies to itself
+	EntityVariantOverride
+	// The delta changes the game mode settings for a difficulty
+	EntityVariantDifficulty
+	// The delta changes the faction of an entity
+	EntityVariantFaction
+	// The delta was explicitly paired with the entity
+	EntityVariantOther
+)
+
+func (k EntityVariantKind) String() string {
+	switch k {
+	case EntityVariantAttachment:
+		return "attachment"
+	case EntityVariantOverride:
+		return "override"
+	case EntityVariantDifficulty:
+		return "difficulty"
+	case EntityVariantFaction:
+		return "faction"
+	case EntityVariantOther:
+		return "other"
+	default:
+		return fmt.Sprintf("EntityVariantKind(%d)", uint8(k))
+	}
+}
+
+func (k EntityVariantKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// EntityVariant is an entity with an entity delta applied to its
+// components, e.g. a weapon with one of its attachments.
+type EntityVariant struct {
+	Kind EntityVariantKind
+	// Entity the delta is applied to
+	Base stingray.Hash
+	// Resource the delta is stored under. Equal to Base for the overrides
+	// an entity applies to itself.
+	Delta stingray.Hash
+	// Components of Base without the delta
+	BaseEntity Entity
+	// Components of Base with the delta applied
+	Entity Entity
+}
+
+type entityVariantParser struct {
+	typelib             *DLTypeLib
+	genericTables       map[DLHash]*genericComponentTable
+	entities            map[stingray.Hash]Entity
+	deltas              ComponentEntityDeltaStorage
+	indicesToComponents map[uint32]DLHash
+}
+
+func newEntityVariantParser() (*entityVariantParser, error) {
+	typelib, err := ParseTypeLib(nil)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := ParseEntityComponentSettings()
+	if err != nil {
+		return nil, fmt.Errorf("parsing entities: %w", err)
+	}
+	deltas, err := ParseEntityDeltas()
+	if err != nil {
+		return nil, fmt.Errorf("parsing entity deltas: %w", err)
+	}
+	indicesToComponents, err := ParseComponentIndices()
+	if err != nil {
+		return nil, fmt.Errorf("parsing component indices: %w", err)
+	}
+	return &entityVariantParser{
+		typelib:             typelib,
+		genericTables:       make(map[DLHash]*genericComponentTable),
+		entities:            entities,
+		deltas:              deltas,
+		indicesToComponents: indicesToComponents,
+	}, nil
+}
+
+func (p *entityVariantParser) modifiedComponentTypes(delta EntityDeltaSettings) []DLHash {
+	var componentTypes []DLHash
+	for _, component := range delta.ModifiedComponents {
+		componentType, ok := p.indicesToComponents[component.ComponentIndex]
+		if ok && !slices.Contains(componentTypes, componentType) {
+			componentTypes = append(componentTypes, componentType)
+		}
+	}
+	return componentTypes
+}
+
+// reparse returns entity with the components of the given types decoded
+// again, applying delta if hasDelta is set.
+func (p *entityVariantParser) reparse(resource stingray.Hash, entity Entity, componentTypes []DLHash, delta EntityDeltaSettings, hasDelta bool) Entity {
+	components := maps.Clone(entity.Components)
+	for _, componentType := range componentTypes {
+		if _, ok := components[componentType]; !ok {
+			// Deltas can't add components
+			continue
+		}
+		components[componentType] = parseEntityComponent(p.typelib, p.genericTables, componentType, resource, delta, hasDelta)
+	}
+	return Entity{
+		GameObjectID: entity.GameObjectID,
+		Components:   components,
+	}
+}
+
+func (p *entityVariantParser) variant(kind EntityVariantKind, base, delta stingray.Hash) (EntityVariant, error) {
+	entity, ok := p.entities[base]
+	if !ok {
+		return EntityVariant{}, fmt.Errorf("%v is not an entity", base)
+	}
+	deltaSettings, ok := p.deltas[delta]
+	if !ok {
+		return EntityVariant{}, fmt.Errorf("no entity delta stored under %v", delta)
+	}
+
+	componentTypes := p.modifiedComponentTypes(deltaSettings)
+
+	variant := EntityVariant{
+		Kind:  kind,
+		Base:  base,
+		Delta: delta,
+	}
+	if base == delta {
+		// ParseEntityComponentSettings already applies an entity's own delta
+		variant.BaseEntity = p.reparse(base, entity, componentTypes, EntityDeltaSettings{}, false)
+		variant.Entity = entity
+		return variant, nil
+	}
+	// Apply the delta on top of the entity's own one, if there is one
+	combined := EntityDeltaSettings{
+		ModifiedComponents: slices.Concat(p.deltas[base].ModifiedComponents, deltaSettings.ModifiedComponents),
+	}
+	variant.BaseEntity = entity
+	variant.Entity = p.reparse(base, entity, componentTypes, combined, true)
+	return variant, nil
+}
+
+// ParseEntityVariant applies the entity delta stored under delta to the
+// components of the entity base.
+func ParseEntityVariant(base, delta stingray.Hash) (EntityVariant, error) {
+	p, err := newEntityVariantParser()
+	if err != nil {
+		return EntityVariant{}, err
+	}
+	kind := EntityVariantOther
+	if base == delta {
+		kind = EntityVariantOverride
+	}
+	return p.variant(kind, base, delta)
+}
+
+// ParseEntityVariants returns the variants of all entities the entity
+// deltas are known to apply to: the default attachments of each weapon, the
+// overrides entities apply to their own components, and the difficulty and
+// faction deltas.
+//
+// The game doesn't store which entities the difficulty and faction deltas
+// are meant for, so they are paired with every entity having all of the
+// components they modify. Difficulty deltas are the ones modifying the game
+// mode or hive mind settings, faction deltas the ones modifying the faction.
+func ParseEntityVariants() ([]EntityVariant, error) {
+	p, err := newEntityVariantParser()
+	if err != nil {
+		return nil, err
+	}
+
+	weaponCustomizationSettings, err := ParseWeaponCustomizationSettings(
+		func(id stingray.FileID, typ stingray.DataType) (data []byte, exists bool, err error) {
+			return nil, false, nil
+		},
+		make(map[uint32]string),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("parsing weapon customization settings: %w", err)
+	}
+	addPaths := make(map[stingray.ThinHash]stingray.Hash)
+	isAddPath := make(map[stingray.Hash]bool)
+	for _, setting := range weaponCustomizationSettings {
+		for _, item := range setting.Items {
+			addPaths[item.ID] = item.AddPath
+			isAddPath[item.AddPath] = true
+		}
+	}
+
+	type pair struct{ base, delta stingray.Hash }
+	pairs := make(map[pair]EntityVariantKind)
+	for resource, delta := range p.deltas {
+		entity, ok := p.entities[resource]
+		if !ok {
+			continue
+		}
+		// Most deltas stored under an entity are meant for the weapons
+		// it is attached to, so only list those modifying the entity itself
+		for _, componentType := range p.modifiedComponentTypes(delta) {
+			if _, ok := entity.Components[componentType]; ok {
+				pairs[pair{resource, resource}] = EntityVariantOverride
+				break
+			}
+		}
+	}
+	for resource, entity := range p.entities {
+		customization, ok := entity.Components[Sum("WeaponCustomizationComponentData")].(WeaponCustomizationComponent)
+		if !ok {
+			continue
+		}
+		for _, attachment := range customization.DefaultCustomizations {
+			addPath, ok := addPaths[attachment.Customization]
+			if !ok {
+				continue
+			}
+			if _, ok := p.deltas[addPath]; ok {
+				pairs[pair{resource, addPath}] = EntityVariantAttachment
+			}
+		}
+	}
+	for resource, delta := range p.deltas {
+		if _, ok := p.entities[resource]; ok || isAddPath[resource] {
+			continue
+		}
+		componentTypes := p.modifiedComponentTypes(delta)
+		var kind EntityVariantKind
+		switch {
+		case slices.Contains(componentTypes, Sum("FactionComponentData")):
+			kind = EntityVariantFaction
+		case slices.Contains(componentTypes, Sum("GameModeComponentData")),
+			slices.Contains(componentTypes, Sum("HiveMindComponentData")):
+			kind = EntityVariantDifficulty
+		default:
+			continue
+		}
+	entities:
+		for base, entity := range p.entities {
+			for _, componentType := range componentTypes {
+				if _, ok := entity.Components[componentType]; !ok {
+					continue entities
+				}
+			}
+			pairs[pair{base, resource}] = kind
+		}
+	}
+
+	sortedPairs := slices.SortedFunc(maps.Keys(pairs), func(a, b pair) int {
+		return cmp.Or(
+			cmp.Compare(a.base.Value, b.base.Value),
+			cmp.Compare(a.delta.Value, b.delta.Value),
+		)
+	})
+	variants := make([]EntityVariant, 0, len(sortedPairs))
+	for _, pair := range sortedPairs {
+		variant, err := p.variant(pairs[pair], pair.base, pair.delta)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+// FieldDiff is a field of a component which differs between two entities.
+type FieldDiff struct {
+	Component string `json:"component"`
+	// Path of the field in the simplified component, e.g. "rounds_per_minute.default"
+	// or "zones[2].max_health". Empty if the component only exists in one
+	// of the entities.
+	Field   string `json:"field,omitempty"`
+	Base    any    `json:"base"`
+	Variant any    `json:"variant"`
+}
+
+// simpleJSONValue converts a simplified component to the generic
+// representation of its JSON form, so fields are named as in the
+// JSON exports.
+func simpleJSONValue(simple any) (any, error) {
+	data, err := json.Marshal(simple)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func diffJSONValues(component, path string, base, variant any, diffs []FieldDiff) []FieldDiff {
+	joinPath := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch base := base.(type) {
+	case map[string]any:
+		if variant, ok := variant.(map[string]any); ok {
+			keys := slices.Collect(maps.Keys(base))
+			for key := range variant {
+				if _, ok := base[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			slices.Sort(keys)
+			for _, key := range keys {
+				diffs = diffJSONValues(component, joinPath(key), base[key], variant[key], diffs)
+			}
+			return diffs
+		}
+	case []any:
+		if variant, ok := variant.([]any); ok {
+			for i := range max(len(base), len(variant)) {
+				var b, v any
+				if i < len(base) {
+					b = base[i]
+				}
+				if i < len(variant) {
+					v = variant[i]
+				}
+				diffs = diffJSONValues(component, fmt.Sprintf("%v[%v]", path, i), b, v, diffs)
+			}
+			return diffs
+		}
+	}
+	if !reflect.DeepEqual(base, variant) {
+		diffs = append(diffs, FieldDiff{
+			Component: component,
+			Field:     path,
+			Base:      base,
+			Variant:   variant,
+		})
+	}
+	return diffs
+}
+
+// DiffEntities compares the simplified components of two entities field by
+// field, resolving hashes, strings and enums as in their JSON exports.
+func DiffEntities(base, variant Entity, lookupHash HashLookup, lookupThinHash ThinHashLookup, lookupDLHash DLHashLookup, lookupStrings StringsLookup) ([]FieldDiff, error) {
+	componentTypes := make(map[string]DLHash)
+	for componentType := range base.Components {
+		componentTypes[lookupDLHash(componentType)] = componentType
+	}
+	for componentType := range variant.Components {
+		componentTypes[lookupDLHash(componentType)] = componentType
+	}
+
+	var diffs []FieldDiff
+	for _, name := range slices.Sorted(maps.Keys(componentTypes)) {
+		componentType := componentTypes[name]
+		var values [2]any
+		for i, entity := range []Entity{base, variant} {
+			component, ok := entity.Components[componentType]
+			if !ok {
+				continue
+			}
+			value, err := simpleJSONValue(component.ToSimple(lookupHash, lookupThinHash, lookupStrings))
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", name, err)
+			}
+			values[i] = value
+		}
+		if values[0] == nil || values[1] == nil {
+			if values[0] != nil || values[1] != nil {
+				diffs = append(diffs, FieldDiff{
+					Component: name,
+					Base:      values[0],
+					Variant:   values[1],
+				})
+			}
+			continue
+		}
+		diffs = diffJSONValues(name, "", values[0], values[1], diffs)
+	}
+	return diffs, nil
+}
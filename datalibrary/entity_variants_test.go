@@ -0,0 +1,45 @@
+package datalib
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffJSONValuesSorted(t *testing.T) {
+	base := map[string]any{"b": 1.0, "d": 1.0}
+	variant := map[string]any{"e": 1.0, "a": 1.0, "c": 1.0, "d": 2.0}
+	var fields []string
+	for _, diff := range diffJSONValues("Component", "", base, variant, nil) {
+		fields = append(fields, diff.Field)
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !slices.Equal(fields, want) {
+		t.Errorf("expected fields %v, got %v", want, fields)
+	}
+}
+
+func TestParseEntityVariantsKinds(t *testing.T) {
+	variants, err := ParseEntityVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[EntityVariantKind]int)
+	for _, variant := range variants {
+		counts[variant.Kind]++
+		if variant.Kind != EntityVariantDifficulty {
+			continue
+		}
+		if _, ok := variant.Entity.Components[Sum("GameModeComponentData")]; !ok {
+			t.Errorf("difficulty variant %v of %v without game mode", variant.Delta, variant.Base)
+		}
+	}
+	for _, kind := range []EntityVariantKind{
+		EntityVariantAttachment,
+		EntityVariantOverride,
+		EntityVariantDifficulty,
+		EntityVariantFaction,
+	} {
+		if counts[kind] == 0 {
+			t.Errorf("expected %v variants", kind)
+		}
+	}
+}
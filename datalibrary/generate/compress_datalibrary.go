@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 
@@ -30,7 +32,27 @@ func compressFile(filename string, buf *bytes.Buffer) {
 	}
 }
 
+// Checks that build_info.json names the game build the files were
+// taken from, so outdated embedded data can be detected at runtime.
+func checkBuildInfo() {
+	data, err := os.ReadFile("build_info.json")
+	if err != nil {
+		panic(err)
+	}
+	var info struct {
+		Year    uint32 `json:"year"`
+		BuildId uint32 `json:"build_id"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		panic(err)
+	}
+	if info.Year == 0 && info.BuildId == 0 {
+		panic(fmt.Errorf("build_info.json must contain the build info (ah_bin exported to JSON) of the game the data library files were taken from"))
+	}
+}
+
 func main() {
+	checkBuildInfo()
 	filenames := []string{
 		"dl_library.dl_typelib",
 		"generated_arc_settings.dl_bin",
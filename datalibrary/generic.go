@@ -0,0 +1,472 @@
+package datalib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/xypwn/filediver/stingray"
+)
+
+// GenericField is a member of a GenericStruct.
+type GenericField struct {
+	Name  string
+	Value any
+}
+
+// GenericStruct is a struct decoded using only the type library.
+// It marshals to a JSON object keeping the member order.
+type GenericStruct struct {
+	Type   DLHash
+	Fields []GenericField
+}
+
+// Get returns the value of the member with the given name.
+func (s *GenericStruct) Get(name string) (any, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (s *GenericStruct) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	if err := writeGenericJSON(&b, s); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeGenericJSON writes a decoded value as JSON. Unlike json.Marshal,
+// it writes non-finite floats as strings instead of failing.
+func writeGenericJSON(b *bytes.Buffer, value any) error {
+	switch v := value.(type) {
+	case *GenericStruct:
+		b.WriteByte('{')
+		for i, f := range v.Fields {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			name, err := json.Marshal(f.Name)
+			if err != nil {
+				return err
+			}
+			b.Write(name)
+			b.WriteByte(':')
+			if err := writeGenericJSON(b, f.Value); err != nil {
+				return fmt.Errorf("%v: %w", f.Name, err)
+			}
+		}
+		b.WriteByte('}')
+	case []any:
+		b.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeGenericJSON(b, elem); err != nil {
+				return fmt.Errorf("[%v]: %w", i, err)
+			}
+		}
+		b.WriteByte(']')
+	case float32:
+		return writeGenericJSON(b, float64(v))
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			b.WriteString(strconv.Quote(strconv.FormatFloat(v, 'g', -1, 64)))
+		} else {
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+	}
+	return nil
+}
+
+// GenericEnum is an enum value decoded using the type library.
+type GenericEnum struct {
+	Type  DLHash
+	Name  string // empty if the value isn't part of the enum
+	Value int64
+}
+
+func (e GenericEnum) MarshalJSON() ([]byte, error) {
+	if e.Name == "" {
+		return json.Marshal(e.Value)
+	}
+	return json.Marshal(e.Name)
+}
+
+// maxGenericDepth limits pointer chasing in malformed or cyclic data
+const maxGenericDepth = 64
+
+type genericDecoder struct {
+	typelib *DLTypeLib
+	// Instance data; array, pointer and string offsets are relative to
+	// its start
+	data []byte
+}
+
+// DecodeGeneric decodes the value of type typ at offset in the data of a
+// DL instance or subdata, using only the type library. Structs are
+// decoded to *GenericStruct, enums to GenericEnum, arrays to []any and
+// strings to string.
+func DecodeGeneric(typelib *DLTypeLib, typ DLHash, data []byte, offset int) (*GenericStruct, error) {
+	d := &genericDecoder{typelib: typelib, data: data}
+	return d.decodeStruct(typ, offset, 0)
+}
+
+// DecodeGeneric decodes the instance using only the type library.
+func (inst DLInstance) DecodeGeneric(typelib *DLTypeLib) (*GenericStruct, error) {
+	return DecodeGeneric(typelib, inst.Type, inst.Data, 0)
+}
+
+// DecodeGeneric decodes the subdata using only the type library.
+func (sub DLSubdata) DecodeGeneric(typelib *DLTypeLib) (*GenericStruct, error) {
+	return DecodeGeneric(typelib, sub.Type, sub.Data, 0)
+}
+
+func (d *genericDecoder) bytes(offset int, size int) ([]byte, error) {
+	if offset < 0 || size < 0 || offset+size > len(d.data) {
+		return nil, fmt.Errorf("reading %v bytes at offset %v: out of bounds (data size is %v)", size, offset, len(d.data))
+	}
+	return d.data[offset : offset+size], nil
+}
+
+func (d *genericDecoder) decodeStruct(typ DLHash, offset int, depth int) (*GenericStruct, error) {
+	if depth > maxGenericDepth {
+		return nil, fmt.Errorf("%v: maximum nesting depth exceeded", typ)
+	}
+	desc, ok := d.typelib.Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("type %v not in type library", typ)
+	}
+	result := &GenericStruct{
+		Type:   typ,
+		Fields: make([]GenericField, 0, len(desc.Members)),
+	}
+	if desc.Flags.IsUnion() {
+		return d.decodeUnion(desc, result, offset, depth)
+	}
+	for _, member := range desc.Members {
+		value, err := d.decodeMember(member, offset+int(member.Offset), depth)
+		if err != nil {
+			return nil, fmt.Errorf("%v.%v: %w", desc.Name, member.Name, err)
+		}
+		result.Fields = append(result.Fields, GenericField{Name: member.Name, Value: value})
+	}
+	return result, nil
+}
+
+// decodeUnion decodes the active member of a union. The active member is
+// identified by the hash of its name, stored after the largest member.
+func (d *genericDecoder) decodeUnion(desc DLTypeDesc, result *GenericStruct, offset int, depth int) (*GenericStruct, error) {
+	var typeOffset uint32
+	for _, member := range desc.Members {
+		typeOffset = max(typeOffset, member.Offset+member.Size)
+	}
+	typeOffset = (typeOffset + 3) &^ 3
+	b, err := d.bytes(offset+int(typeOffset), 4)
+	if err != nil {
+		return nil, fmt.Errorf("%v: union type: %w", desc.Name, err)
+	}
+	activeType := DLHash(binary.LittleEndian.Uint32(b))
+	for _, member := range desc.Members {
+		if Sum(member.Name) != activeType {
+			continue
+		}
+		value, err := d.decodeMember(member, offset+int(member.Offset), depth)
+		if err != nil {
+			return nil, fmt.Errorf("%v.%v: %w", desc.Name, member.Name, err)
+		}
+		result.Fields = append(result.Fields, GenericField{Name: member.Name, Value: value})
+		return result, nil
+	}
+	result.Fields = append(result.Fields, GenericField{Name: "union_type", Value: activeType})
+	return result, nil
+}
+
+func (d *genericDecoder) decodeMember(member DLMemberDesc, offset int, depth int) (any, error) {
+	switch member.Type.Atom {
+	case POD:
+		return d.decodeValue(member.Type.Storage, member.TypeID, offset, depth)
+	case INLINE_ARRAY:
+		count := int(member.Type.BitfieldInfoOrArrayLen.GetArrayLen())
+		if count == 0 {
+			return []any{}, nil
+		}
+		stride := int(member.Size) / count
+		values := make([]any, count)
+		for i := range values {
+			value, err := d.decodeValue(member.Type.Storage, member.TypeID, offset+i*stride, depth)
+			if err != nil {
+				return nil, fmt.Errorf("[%v]: %w", i, err)
+			}
+			values[i] = value
+		}
+		return values, nil
+	case ARRAY:
+		b, err := d.bytes(offset, 16)
+		if err != nil {
+			return nil, err
+		}
+		var array DLArray
+		if _, err := binary.Decode(b, binary.LittleEndian, &array); err != nil {
+			return nil, err
+		}
+		if array.Count > uint64(len(d.data)) {
+			return nil, fmt.Errorf("invalid array count %v", array.Count)
+		}
+		stride, err := d.storageSize(member.Type.Storage, member.TypeID)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, array.Count)
+		for i := range values {
+			value, err := d.decodeValue(member.Type.Storage, member.TypeID, int(array.Offset)+i*stride, depth)
+			if err != nil {
+				return nil, fmt.Errorf("[%v]: %w", i, err)
+			}
+			values[i] = value
+		}
+		return values, nil
+	case BITFIELD:
+		size, err := d.storageSize(member.Type.Storage, member.TypeID)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, err
+		}
+		var raw uint64
+		for i := len(b) - 1; i >= 0; i-- {
+			raw = raw<<8 | uint64(b[i])
+		}
+		bits := member.Type.BitfieldInfoOrArrayLen.GetBits()
+		raw >>= member.Type.BitfieldInfoOrArrayLen.GetOffset()
+		if bits < 64 {
+			raw &= 1<<bits - 1
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("unknown atom %v", member.Type.Atom)
+	}
+}
+
+// storageSize returns the size of a single value with the given storage.
+func (d *genericDecoder) storageSize(storage DLTypeStorage, typeID DLHash) (int, error) {
+	switch storage {
+	case INT8, UINT8, ENUM_INT8, ENUM_UINT8:
+		return 1, nil
+	case INT16, UINT16, ENUM_INT16, ENUM_UINT16:
+		return 2, nil
+	case INT32, UINT32, FP32, ENUM_INT32, ENUM_UINT32:
+		return 4, nil
+	case INT64, UINT64, FP64, ENUM_INT64, ENUM_UINT64, STR, PTR:
+		return 8, nil
+	case STRUCT:
+		desc, ok := d.typelib.Types[typeID]
+		if !ok {
+			return 0, fmt.Errorf("type %v not in type library", typeID)
+		}
+		return int(desc.Size), nil
+	default:
+		return 0, fmt.Errorf("unknown storage %v", storage)
+	}
+}
+
+func (d *genericDecoder) decodeValue(storage DLTypeStorage, typeID DLHash, offset int, depth int) (any, error) {
+	size, err := d.storageSize(storage, typeID)
+	if err != nil {
+		return nil, err
+	}
+	if storage == STRUCT {
+		return d.decodeStruct(typeID, offset, depth+1)
+	}
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, err
+	}
+	switch storage {
+	case INT8:
+		return int8(b[0]), nil
+	case INT16:
+		return int16(binary.LittleEndian.Uint16(b)), nil
+	case INT32:
+		return int32(binary.LittleEndian.Uint32(b)), nil
+	case INT64:
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	case UINT8:
+		return b[0], nil
+	case UINT16:
+		return binary.LittleEndian.Uint16(b), nil
+	case UINT32:
+		return binary.LittleEndian.Uint32(b), nil
+	case UINT64:
+		return binary.LittleEndian.Uint64(b), nil
+	case FP32:
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case FP64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case ENUM_INT8:
+		return d.enum(typeID, int64(int8(b[0]))), nil
+	case ENUM_INT16:
+		return d.enum(typeID, int64(int16(binary.LittleEndian.Uint16(b)))), nil
+	case ENUM_INT32:
+		return d.enum(typeID, int64(int32(binary.LittleEndian.Uint32(b)))), nil
+	case ENUM_INT64, ENUM_UINT64:
+		return d.enum(typeID, int64(binary.LittleEndian.Uint64(b))), nil
+	case ENUM_UINT8:
+		return d.enum(typeID, int64(b[0])), nil
+	case ENUM_UINT16:
+		return d.enum(typeID, int64(binary.LittleEndian.Uint16(b))), nil
+	case ENUM_UINT32:
+		return d.enum(typeID, int64(binary.LittleEndian.Uint32(b))), nil
+	case STR:
+		strOffset := int64(binary.LittleEndian.Uint64(b))
+		if strOffset < 0 || strOffset >= int64(len(d.data)) {
+			return nil, nil
+		}
+		end := bytes.IndexByte(d.data[strOffset:], 0)
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated string at offset %v", strOffset)
+		}
+		return string(d.data[strOffset : strOffset+int64(end)]), nil
+	case PTR:
+		ptrOffset := int64(binary.LittleEndian.Uint64(b))
+		if ptrOffset < 0 || ptrOffset >= int64(len(d.data)) {
+			return nil, nil
+		}
+		return d.decodeStruct(typeID, int(ptrOffset), depth+1)
+	default:
+		return nil, fmt.Errorf("unknown storage %v", storage)
+	}
+}
+
+func (d *genericDecoder) enum(typeID DLHash, value int64) GenericEnum {
+	result := GenericEnum{Type: typeID, Value: value}
+	if desc, ok := d.typelib.Enums[typeID]; ok {
+		for _, v := range desc.Values {
+			if int64(v.Value) == value {
+				result.Name = v.Name
+				break
+			}
+		}
+	}
+	return result
+}
+
+// GenericComponent is a component decoded using only the type library,
+// for component types without a dedicated Go struct.
+type GenericComponent struct {
+	*GenericStruct
+}
+
+func (c GenericComponent) ToSimple(_ HashLookup, _ ThinHashLookup, _ StringsLookup) any {
+	return c.GenericStruct
+}
+
+// genericComponentTable is the instance of a <Name>ComponentData type, which
+// maps entity resources to indices into an inline array of components.
+type genericComponentTable struct {
+	data          []byte
+	componentType DLHash
+	componentSize int
+	// Offset of the component array in data
+	componentsOffset int
+	indices          map[stingray.Hash]int
+}
+
+// component returns the offset of the component of resource in t.data.
+func (t *genericComponentTable) component(resource stingray.Hash) (int, error) {
+	index, ok := t.indices[resource]
+	if !ok {
+		return 0, fmt.Errorf("%v not found in %v", resource, t.componentType)
+	}
+	offset := t.componentsOffset + index*t.componentSize
+	if offset < 0 || offset+t.componentSize > len(t.data) {
+		return 0, fmt.Errorf("component %v of %v exceeds the instance data", index, resource)
+	}
+	return offset, nil
+}
+
+// loadGenericComponentTable finds the instance of the component data type
+// in the embedded entities data and indexes it.
+func loadGenericComponentTable(typelib *DLTypeLib, componentDataType DLHash) (*genericComponentTable, error) {
+	desc, ok := typelib.Types[componentDataType]
+	if !ok {
+		return nil, fmt.Errorf("could not find %v hash in dl_library", componentDataType)
+	}
+	if len(desc.Members) != 2 {
+		return nil, fmt.Errorf("%v unexpected format (there should be 2 members but were actually %v)", componentDataType, len(desc.Members))
+	}
+	hashmap, components := desc.Members[0], desc.Members[1]
+	if hashmap.Type.Atom != INLINE_ARRAY || hashmap.Type.Storage != STRUCT || hashmap.TypeID != Sum("ComponentIndexData") {
+		return nil, fmt.Errorf("%v unexpected format (hashmap was not an inline array of ComponentIndexData)", componentDataType)
+	}
+	if components.Type.Atom != INLINE_ARRAY || components.Type.Storage != STRUCT {
+		return nil, fmt.Errorf("%v unexpected format (data was not an inline array of structs)", componentDataType)
+	}
+	componentDesc, ok := typelib.Types[components.TypeID]
+	if !ok {
+		return nil, fmt.Errorf("could not find %v hash in dl_library", components.TypeID)
+	}
+
+	hashData := make([]byte, 4)
+	if _, err := binary.Encode(hashData, binary.LittleEndian, componentDataType); err != nil {
+		return nil, err
+	}
+	idx := bytes.Index(entities, hashData)
+	if idx == -1 {
+		return nil, fmt.Errorf("%v not found in generated_entities.dl_bin", componentDataType)
+	}
+	r := bytes.NewReader(entities[idx:])
+	var header DLInstanceHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	data := make([]byte, header.Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	indexData := make([]ComponentIndexData, hashmap.Type.BitfieldInfoOrArrayLen.GetArrayLen())
+	if int(hashmap.Offset)+binary.Size(indexData) > len(data) {
+		return nil, fmt.Errorf("%v hashmap exceeds the instance data", componentDataType)
+	}
+	if _, err := binary.Decode(data[hashmap.Offset:], binary.LittleEndian, &indexData); err != nil {
+		return nil, err
+	}
+	numComponents := int(components.Type.BitfieldInfoOrArrayLen.GetArrayLen())
+	if int(components.Offset)+numComponents*int(componentDesc.Size) > len(data) {
+		return nil, fmt.Errorf("%v components exceed the instance data", componentDataType)
+	}
+	table := &genericComponentTable{
+		data:             data,
+		componentType:    components.TypeID,
+		componentSize:    int(componentDesc.Size),
+		componentsOffset: int(components.Offset),
+		indices:          make(map[stingray.Hash]int),
+	}
+	for _, entry := range indexData {
+		if entry.Resource.Value == 0 {
+			continue
+		}
+		if int(entry.Index) >= numComponents {
+			return nil, fmt.Errorf("%v index %v of %v exceeds the %v components", componentDataType, entry.Index, entry.Resource, numComponents)
+		}
+		table.indices[entry.Resource] = int(entry.Index)
+	}
+	return table, nil
+}
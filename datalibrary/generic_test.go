@@ -0,0 +1,90 @@
+package datalib
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/xypwn/filediver/stingray"
+)
+
+func TestDecodeGenericHealthComponent(t *testing.T) {
+	typelib, err := ParseTypeLib(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := loadGenericComponentTable(typelib, Sum("HealthComponentData"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.indices) == 0 {
+		t.Fatal("expected health components")
+	}
+
+	for resource := range table.indices {
+		data, err := getHealthComponentDataForHash(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		component, err := parseComponent(Sum("HealthComponentData"), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := component.(HealthComponent)
+
+		offset, err := table.component(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodeGeneric(typelib, table.componentType, table.data, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The embedded type library has no member names, so the
+		// members are compared by position
+		field := func(i int) any { return got.Fields[i].Value }
+		wounded, ok := field(13).(*GenericStruct)
+		if !ok {
+			t.Fatalf("%v: expected wounded state struct, got %T", resource, field(13))
+		}
+		size, ok := field(10).(GenericEnum)
+		if !ok {
+			t.Fatalf("%v: expected unit size enum, got %T", resource, field(10))
+		}
+		var deathSounds []stingray.ThinHash
+		for _, v := range field(19).([]any) {
+			deathSounds = append(deathSounds, stingray.ThinHash{Value: v.(uint32)})
+		}
+		if field(0) != want.Health ||
+			field(1) != want.HeathChangerate ||
+			field(6) != want.Constitution ||
+			field(7) != want.ConstitutionChangerate ||
+			field(12) != want.KillScore ||
+			size.Value != int64(want.Size) ||
+			wounded.Fields[0].Value != want.Wounded.SwayMultiplier ||
+			wounded.Fields[1].Value != want.Wounded.MoveSpeedMultiplier ||
+			len(field(15).([]any)) != len(want.DamageableZones) ||
+			!slices.Equal(deathSounds, want.DeathSoundIDs[:]) {
+			t.Fatalf("%v: generic component %v doesn't match %+v", resource, got, want)
+		}
+	}
+}
+
+func TestParseGenericComponentBounds(t *testing.T) {
+	typelib, err := ParseTypeLib(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := stingray.Hash{Value: 1}
+	for _, table := range []*genericComponentTable{
+		// Component past the end of the data
+		{data: make([]byte, 16), componentType: Sum("HealthComponent"), componentSize: 8, componentsOffset: 8, indices: map[stingray.Hash]int{resource: 1}},
+		// Component array offset past the end of the data
+		{data: make([]byte, 16), componentType: Sum("HealthComponent"), componentSize: 8, componentsOffset: 64, indices: map[stingray.Hash]int{resource: 0}},
+	} {
+		tables := map[DLHash]*genericComponentTable{Sum("HealthComponentData"): table}
+		component := parseGenericComponent(typelib, tables, Sum("HealthComponentData"), resource, EntityDeltaSettings{}, false)
+		if _, ok := component.(ErrorComponent); !ok {
+			t.Errorf("expected error component, got %T", component)
+		}
+	}
+}
@@ -167,6 +167,151 @@ type PlanetData struct {
 	UnknownFloat                     float32
 }
 
+type SimpleResourceRegionOverride struct {
+	ID         string          `json:"id"`
+	RegionFlag enum.RegionFlag `json:"region_flag"`
+}
+
+type SimpleResourceOverride struct {
+	Type        string `json:"type"`
+	Replace     string `json:"replace"`
+	ReplaceWith string `json:"replace_with"`
+}
+
+type SimpleLevelGenerationPaletteGroup struct {
+	//Palette                 string                  `json:"palette"`
+	AssetGrading            string          `json:"asset_grading"`
+	SkySettingsGroup        string          `json:"sky_settings_group"`
+	DayGrading              string          `json:"day_grading"`
+	NightGrading            string          `json:"night_grading"`
+	SunsetGrading           string          `json:"sunset_grading"`
+	WeatherColorSet         string          `json:"weather_color_set"`
+	WeatherColorSetInternal WeatherColorSet `json:"weather_color_set_internal"`
+}
+
+type SimplePlanetData struct {
+	Inherits                         string                            `json:"inherits"`
+	PlanetNameLoc                    string                            `json:"planet_name_loc"`
+	PlanetDescriptionLoc             string                            `json:"planet_description_loc"`
+	PlanetDescriptionShortLoc        string                            `json:"planet_description_short_loc"`
+	PlanetSystemNameLoc              string                            `json:"planet_system_name_loc"`
+	PlanetLayoutId                   uint32                            `json:"planet_layout_id"`
+	ResourceOverrides                []SimpleResourceOverride          `json:"resource_overrides"`
+	DebugName                        string                            `json:"debug_name"`
+	RegionLowland                    LevelGenerationRegion             `json:"region_lowland"`
+	RegionHighland                   LevelGenerationRegion             `json:"region_highland"`
+	PaletteGroupLowland              SimpleLevelGenerationPaletteGroup `json:"palette_group_lowland"`
+	PaletteGroupHighland             SimpleLevelGenerationPaletteGroup `json:"palette_group_highland"`
+	ScenarioSettingsLowland          string                            `json:"scenario_settings_lowland"`
+	ScenarioSettingsHighland         string                            `json:"scenario_settings_highland"`
+	GameplayModifiers                []string                          `json:"gameplay_modifiers"`
+	PlanetType                       enum.PlanetType                   `json:"planet_type"`
+	Unknown                          uint32                            `json:"unknown"`
+	NatureLocationTags               []enum.NatureLocationTag          `json:"nature_location_tags"`
+	ScatterSettings                  string                            `json:"scatter_settings"`
+	MissionPlanetUnit                string                            `json:"mission_planet_unit"`
+	MissionPlanetHologramUnit        string                            `json:"mission_planet_hologram_unit"`
+	MissionPlanetUnitPackage         string                            `json:"mission_planet_unit_package"`
+	MissionPlanetHologramUnitPackage string                            `json:"mission_planet_hologram_unit_package"`
+	SolarSystemSettings              string                            `json:"solar_system_settings"`
+	SolarSystemIdSelections          []string                          `json:"solar_system_id_selections"`
+	SampleTypes                      []enum.SampleType                 `json:"sample_types"`
+	AmbienceSoundIdStart             uint32                            `json:"ambience_sound_id_start"`
+	AmbienceSoundIdStop              uint32                            `json:"ambience_sound_id_stop"`
+	HologramPlanetMaterial           string                            `json:"hologram_planet_material"`
+	PlanetPreviewImage               string                            `json:"planet_preview_image"`
+	ResourceRegionOverrides          []SimpleResourceRegionOverride    `json:"resource_region_overrides"`
+	ShadingEnvironmentEntity         string                            `json:"shading_environment_entity"`
+	WaterEntity                      string                            `json:"water_entity"`
+	UnknownHash                      string                            `json:"unknown_hash"`
+	PackagePath                      string                            `json:"package_path"`
+	UnknownFloat                     float32                           `json:"unknown_float"`
+}
+
+// ToSimple resolves the hashes of the planet data for JSON output.
+func (p PlanetData) ToSimple(lookupHash HashLookup, lookupThinHash ThinHashLookup) SimplePlanetData {
+	gameplayModifiers := make([]string, 0)
+	for _, modifier := range p.GameplayModifiers {
+		gameplayModifiers = append(gameplayModifiers, lookupHash(modifier))
+	}
+	solarSystemIdSelections := make([]string, 0)
+	for _, solarSystem := range p.SolarSystemIdSelections {
+		solarSystemIdSelections = append(solarSystemIdSelections, lookupHash(solarSystem))
+	}
+	resourceRegionOverrides := make([]SimpleResourceRegionOverride, 0)
+	for _, override := range p.ResourceRegionOverrides {
+		resourceRegionOverrides = append(resourceRegionOverrides, SimpleResourceRegionOverride{
+			ID:         lookupThinHash(override.ID),
+			RegionFlag: override.RegionFlag,
+		})
+	}
+	resourceOverrides := make([]SimpleResourceOverride, 0)
+	for _, override := range p.ResourceOverrides {
+		resourceOverrides = append(resourceOverrides, SimpleResourceOverride{
+			Type:        lookupHash(override.Type),
+			Replace:     lookupHash(override.Replace),
+			ReplaceWith: lookupHash(override.ReplaceWith),
+		})
+	}
+	return SimplePlanetData{
+		Inherits:                  p.Inherits,
+		PlanetNameLoc:             p.PlanetNameLoc,
+		PlanetDescriptionLoc:      p.PlanetDescriptionLoc,
+		PlanetDescriptionShortLoc: p.PlanetDescriptionShortLoc,
+		PlanetSystemNameLoc:       p.PlanetSystemNameLoc,
+		PlanetLayoutId:            p.PlanetLayoutId,
+		ResourceOverrides:         resourceOverrides,
+		DebugName:                 p.DebugName,
+		RegionLowland:             p.RegionLowland,
+		RegionHighland:            p.RegionHighland,
+
+		PaletteGroupLowland: SimpleLevelGenerationPaletteGroup{
+			//Palette:                 lookupHash(p.PaletteGroupLowland.Palette),
+			AssetGrading:            lookupHash(p.PaletteGroupLowland.AssetGrading),
+			SkySettingsGroup:        lookupHash(p.PaletteGroupLowland.SkySettingsGroup),
+			DayGrading:              lookupHash(p.PaletteGroupLowland.DayGrading),
+			NightGrading:            lookupHash(p.PaletteGroupLowland.NightGrading),
+			SunsetGrading:           lookupHash(p.PaletteGroupLowland.SunsetGrading),
+			WeatherColorSet:         lookupThinHash(p.PaletteGroupLowland.WeatherColorSet),
+			WeatherColorSetInternal: p.PaletteGroupLowland.WeatherColorSetInternal,
+		},
+		PaletteGroupHighland: SimpleLevelGenerationPaletteGroup{
+			//Palette:                 lookupHash(p.PaletteGroupHighland.Palette),
+			AssetGrading:            lookupHash(p.PaletteGroupHighland.AssetGrading),
+			SkySettingsGroup:        lookupHash(p.PaletteGroupHighland.SkySettingsGroup),
+			DayGrading:              lookupHash(p.PaletteGroupHighland.DayGrading),
+			NightGrading:            lookupHash(p.PaletteGroupHighland.NightGrading),
+			SunsetGrading:           lookupHash(p.PaletteGroupHighland.SunsetGrading),
+			WeatherColorSet:         lookupThinHash(p.PaletteGroupHighland.WeatherColorSet),
+			WeatherColorSetInternal: p.PaletteGroupHighland.WeatherColorSetInternal,
+		},
+		ScenarioSettingsLowland:          lookupHash(p.ScenarioSettingsLowland),
+		ScenarioSettingsHighland:         lookupHash(p.ScenarioSettingsHighland),
+		GameplayModifiers:                gameplayModifiers,
+		PlanetType:                       p.PlanetType,
+		Unknown:                          p.Unknown,
+		NatureLocationTags:               p.NatureLocationTags,
+		ScatterSettings:                  lookupThinHash(p.ScatterSettings),
+		MissionPlanetUnit:                lookupHash(p.MissionPlanetUnit),
+		MissionPlanetHologramUnit:        lookupHash(p.MissionPlanetHologramUnit),
+		MissionPlanetUnitPackage:         lookupHash(p.MissionPlanetUnitPackage),
+		MissionPlanetHologramUnitPackage: lookupHash(p.MissionPlanetHologramUnitPackage),
+		SolarSystemSettings:              lookupHash(p.SolarSystemSettings),
+		SolarSystemIdSelections:          solarSystemIdSelections,
+		SampleTypes:                      p.SampleTypes,
+		AmbienceSoundIdStart:             p.AmbienceSoundIdStart,
+		AmbienceSoundIdStop:              p.AmbienceSoundIdStop,
+		HologramPlanetMaterial:           lookupHash(p.HologramPlanetMaterial),
+		PlanetPreviewImage:               lookupHash(p.PlanetPreviewImage),
+		ResourceRegionOverrides:          resourceRegionOverrides,
+		ShadingEnvironmentEntity:         lookupHash(p.ShadingEnvironmentEntity),
+		WaterEntity:                      lookupHash(p.WaterEntity),
+		UnknownHash:                      lookupHash(p.UnknownHash),
+		PackagePath:                      lookupHash(p.PackagePath),
+		UnknownFloat:                     p.UnknownFloat,
+	}
+}
+
 func (a rawPlanetData) Resolve(lookupHash HashLookup, lookupThinHash ThinHashLookup, lookupStrings StringsLookup) PlanetData {
 	return PlanetData{
 		PlanetNameLoc:                    lookupStrings(a.PlanetNameLoc),
@@ -0,0 +1,120 @@
+package datalib
+
+import (
+	"fmt"
+
+	"github.com/xypwn/filediver/datalibrary/enum"
+	"github.com/xypwn/filediver/stingray"
+)
+
+// Planet is a planet's generation data joined with the biome and sky
+// settings it refers to.
+type Planet struct {
+	Data PlanetData
+	// Environment settings of the planet (see [LoadPlanets]), nil if
+	// there are none
+	Biome *EnvironmentSettings
+	// Sky settings of the lowland and highland palette groups, nil if
+	// there are none
+	SkyLowland  *SkySettings
+	SkyHighland *SkySettings
+}
+
+type SimplePlanet struct {
+	Name               string               `json:"name"`
+	SystemName         string               `json:"system_name"`
+	Description        string               `json:"description"`
+	Biome              string               `json:"biome"`
+	Level              string               `json:"level"`
+	MinimapLevel       string               `json:"minimap_level"`
+	ShadingEnvironment string               `json:"shading_environment"`
+	PreviewImage       string               `json:"preview_image"`
+	HologramMaterial   string               `json:"hologram_material"`
+	SkyLowland         []SkySetting         `json:"sky_lowland,omitempty"`
+	SkyHighland        []SkySetting         `json:"sky_highland,omitempty"`
+	Environment        *EnvironmentSettings `json:"environment,omitempty"`
+	Data               SimplePlanetData     `json:"data"`
+}
+
+// ToSimple resolves the hashes of the planet for JSON output. The level
+// is the biome's utility level, the shading environment is the planet's
+// own entity.
+func (p Planet) ToSimple(lookupHash HashLookup, lookupThinHash ThinHashLookup) SimplePlanet {
+	simple := SimplePlanet{
+		Name:               p.Data.PlanetNameLoc,
+		SystemName:         p.Data.PlanetSystemNameLoc,
+		Description:        p.Data.PlanetDescriptionLoc,
+		ShadingEnvironment: lookupHash(p.Data.ShadingEnvironmentEntity),
+		PreviewImage:       lookupHash(p.Data.PlanetPreviewImage),
+		HologramMaterial:   lookupHash(p.Data.HologramPlanetMaterial),
+		Environment:        p.Biome,
+		Data:               p.Data.ToSimple(lookupHash, lookupThinHash),
+	}
+	if p.Biome != nil {
+		simple.Biome = p.Biome.DebugName
+		simple.Level = p.Biome.UtilityLevel
+		simple.MinimapLevel = p.Biome.MinimapUtilityLevel
+	}
+	if p.SkyLowland != nil {
+		simple.SkyLowland = p.SkyLowland.Settings
+	}
+	if p.SkyHighland != nil {
+		simple.SkyHighland = p.SkyHighland.Settings
+	}
+	return simple
+}
+
+// LoadPlanets loads all planets, linking each to its environment settings
+// (its biome) and to the sky settings of its palette groups.
+//
+// Planets don't refer to their environment settings directly, so the biome
+// is a best guess: the environment settings of the planet's type sharing
+// the planet's shading environment, or else the first ones of the planet's
+// type. The game currently has one set of environment settings per type.
+func LoadPlanets(lookupHash HashLookup, lookupThinHash ThinHashLookup, lookupStrings StringsLookup) ([]Planet, error) {
+	planetData, err := LoadPlanetData(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		return nil, fmt.Errorf("loading planet data: %w", err)
+	}
+	environmentSettings, err := LoadEnvironmentSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		return nil, fmt.Errorf("loading environment settings: %w", err)
+	}
+	skySettings, err := LoadSkySettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		return nil, fmt.Errorf("loading sky settings: %w", err)
+	}
+
+	biomes := make(map[enum.PlanetType][]*EnvironmentSettings)
+	for i := range environmentSettings {
+		biomes[environmentSettings[i].PlanetType] = append(biomes[environmentSettings[i].PlanetType], &environmentSettings[i])
+	}
+	biome := func(data PlanetData) *EnvironmentSettings {
+		candidates := biomes[data.PlanetType]
+		shadingEnvironment := lookupHash(data.ShadingEnvironmentEntity)
+		for _, settings := range candidates {
+			if settings.ShadingEnvironment == shadingEnvironment {
+				return settings
+			}
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		return candidates[0]
+	}
+	skies := make(map[stingray.Hash]*SkySettings)
+	for i := range skySettings {
+		skies[skySettings[i].ID] = &skySettings[i]
+	}
+
+	planets := make([]Planet, 0, len(planetData))
+	for _, data := range planetData {
+		planets = append(planets, Planet{
+			Data:        data,
+			Biome:       biome(data),
+			SkyLowland:  skies[data.PaletteGroupLowland.SkySettingsGroup],
+			SkyHighland: skies[data.PaletteGroupHighland.SkySettingsGroup],
+		})
+	}
+	return planets, nil
+}
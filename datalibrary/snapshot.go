@@ -0,0 +1,216 @@
+package datalib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/xypwn/filediver/stingray/ah_bin"
+)
+
+type snapshotFile struct {
+	Name       string
+	Data       *[]byte
+	Compressed *[]byte
+}
+
+// Data library files which can be overridden by a snapshot
+var snapshotFiles = []snapshotFile{
+	{"dl_library.dl_typelib", &typelib, &typelibCompressed},
+	{"generated_arc_settings.dl_bin", &arcSettings, &arcSettingsCompressed},
+	{"generated_beam_settings.dl_bin", &beamSettings, &beamSettingsCompressed},
+	{"generated_customization_armor_sets.dl_bin", &customizationArmorSets, &customizationArmorSetsCompressed},
+	{"generated_customization_passive_bonuses.dl_bin", &customizationPassiveBonuses, &customizationPassiveBonusesCompressed},
+	{"generated_damage_settings.dl_bin", &damageSettings, &damageSettingsCompressed},
+	{"generated_environment_settings.dl_bin", &environmentSettings, &environmentSettingsCompressed},
+	{"generated_explosion_settings.dl_bin", &explosionSettings, &explosionSettingsCompressed},
+	{"generated_planet_data.dl_bin", &planetData, &planetDataCompressed},
+	{"generated_projectile_settings.dl_bin", &projectileSettings, &projectileSettingsCompressed},
+	{"generated_sky_settings.dl_bin", &skySettings, &skySettingsCompressed},
+	{"generated_unit_customization_settings.dl_bin", &unitCustomizationSettings, &unitCustomizationSettingsCompressed},
+	{"generated_weapon_customization_settings.dl_bin", &weaponCustomizationSettings, &weaponCustomizationSettingsCompressed},
+	{"generated_entities.dl_bin", &entities, &entitiesCompressed},
+	{"generated_entity_deltas.dl_bin", &entityDeltas, &entityDeltasCompressed},
+}
+
+// Snapshot describes where the data library files currently in use
+// come from.
+type Snapshot struct {
+	// Directory the files were loaded from; empty for the embedded files
+	Dir string
+	// Files loaded from Dir; all other files are the embedded ones
+	Files []string
+	// Build of the game the snapshot was taken from; nil if unknown
+	BuildInfo *ah_bin.BuildInfo
+}
+
+// parseBuildInfo parses a build_info.json or an ah_bin exported to JSON.
+// Returns nil if the build info is empty.
+func parseBuildInfo(data []byte) (*ah_bin.BuildInfo, error) {
+	var info ah_bin.BuildInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	if info.BuildId == 0 && info.Year == 0 {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+// builtinSnapshot describes the embedded files, whose game build is
+// stored in the embedded build_info.json.
+func builtinSnapshot() *Snapshot {
+	info, err := parseBuildInfo(builtinBuildInfo)
+	if err != nil {
+		panic(err) // this shouldn't fail, as the data is compile-time generated
+	}
+	return &Snapshot{BuildInfo: info}
+}
+
+var currentSnapshot = builtinSnapshot()
+
+// CurrentSnapshot returns the source of the data library files in use.
+func CurrentSnapshot() *Snapshot {
+	return currentSnapshot
+}
+
+// IsOlderThan reports whether the snapshot was taken before the given
+// game build. Snapshots of an unknown build are never considered older.
+func (s *Snapshot) IsOlderThan(game *ah_bin.BuildInfo) bool {
+	if game == nil || s.BuildInfo == nil {
+		return false
+	}
+	if s.BuildInfo.BuildId != 0 && game.BuildId != 0 {
+		return s.BuildInfo.BuildId < game.BuildId
+	}
+	return s.BuildInfo.Time().Before(game.Time())
+}
+
+func readSnapshotFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return io.ReadAll(r)
+}
+
+// readSnapshotBuildInfo reads the game build info stored alongside a
+// snapshot, either as build_info.json or as an ah_bin exported to JSON.
+func readSnapshotBuildInfo(dir string) (*ah_bin.BuildInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.ah.json"))
+	if err != nil {
+		return nil, err
+	}
+	paths = append([]string{filepath.Join(dir, "build_info.json")}, paths...)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		info, err := parseBuildInfo(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		return info, nil
+	}
+	return nil, nil
+}
+
+// LoadSnapshot replaces the embedded data library files with the
+// dl_library.dl_typelib and generated_*.dl_bin files in dir, which may
+// also be gzip-compressed with a .gz extension. Files missing from dir
+// keep their embedded version. An empty dir restores the embedded files.
+//
+// The game build the snapshot was taken from is read from a
+// build_info.json or *.ah.json file in dir. Without one, the build is
+// unknown and the snapshot can't be checked against the game.
+//
+// LoadSnapshot must not be called concurrently with any other function of
+// this package.
+func LoadSnapshot(dir string) (*Snapshot, error) {
+	snapshot := builtinSnapshot()
+	loaded := make(map[string][]byte)
+	if dir != "" {
+		snapshot = &Snapshot{Dir: dir}
+		for _, file := range snapshotFiles {
+			for _, name := range []string{file.Name, file.Name + ".gz"} {
+				path := filepath.Join(dir, name)
+				_, err := os.Stat(path)
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				} else if err != nil {
+					return nil, err
+				}
+				data, err := readSnapshotFile(path)
+				if err != nil {
+					return nil, err
+				}
+				loaded[file.Name] = data
+				snapshot.Files = append(snapshot.Files, name)
+				break
+			}
+		}
+		if len(loaded) == 0 {
+			return nil, fmt.Errorf("no data library files found in %v", dir)
+		}
+		var err error
+		snapshot.BuildInfo, err = readSnapshotBuildInfo(dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot build info: %w", err)
+		}
+	}
+
+	if typelibData, ok := loaded["dl_library.dl_typelib"]; ok {
+		if _, err := ParseTypeLib(typelibData); err != nil {
+			parsedTypelib = nil
+			return nil, fmt.Errorf("parsing dl_library.dl_typelib: %w", err)
+		}
+	}
+
+	for _, file := range snapshotFiles {
+		if data, ok := loaded[file.Name]; ok {
+			*file.Data = data
+			continue
+		}
+		if len(currentSnapshot.Files) == 0 {
+			// Still the embedded data
+			continue
+		}
+		r, err := gzip.NewReader(bytes.NewReader(*file.Compressed))
+		if err != nil {
+			panic(err) // this shouldn't fail, as the data is compile-time generated
+		}
+		*file.Data, err = io.ReadAll(r)
+		if err != nil {
+			panic(err) // this shouldn't fail, as the data is compile-time generated
+		}
+	}
+
+	// Drop everything parsed from the previous files
+	parsedTypelib = nil
+	parsedDeltas = nil
+	indicesToHashes = nil
+	parsedWeaponCustomizationSettings = nil
+	parsedUnitEntitiesMu.Lock()
+	parsedUnitEntities = nil
+	parsedUnitEntitiesMu.Unlock()
+
+	currentSnapshot = snapshot
+	return snapshot, nil
+}
@@ -0,0 +1,68 @@
+package datalib
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/xypwn/filediver/stingray"
+)
+
+// UnitEntities maps units to the entities which spawn them.
+type UnitEntities map[stingray.Hash][]stingray.Hash
+
+var (
+	parsedUnitEntitiesMu sync.Mutex
+	parsedUnitEntities   UnitEntities
+)
+
+// ParseUnitEntities associates each unit with the entities whose
+// UnitComponent refers to it. An entity sharing its hash with the unit
+// comes first, the others are sorted by hash.
+//
+// The result is cached until the next LoadSnapshot and must not be
+// modified.
+func ParseUnitEntities() (UnitEntities, error) {
+	parsedUnitEntitiesMu.Lock()
+	defer parsedUnitEntitiesMu.Unlock()
+	if parsedUnitEntities != nil {
+		return parsedUnitEntities, nil
+	}
+	unitComponents, err := ParseUnitComponents()
+	if err != nil {
+		return nil, err
+	}
+	result := make(UnitEntities)
+	for entity, component := range unitComponents {
+		if component.UnitPath.Value == 0 {
+			continue
+		}
+		result[component.UnitPath] = append(result[component.UnitPath], entity)
+	}
+	for unit, entities := range result {
+		slices.SortFunc(entities, func(a, b stingray.Hash) int {
+			switch {
+			case a == b:
+				return 0
+			case a == unit:
+				return -1
+			case b == unit:
+				return 1
+			}
+			return cmp.Compare(a.Value, b.Value)
+		})
+	}
+	parsedUnitEntities = result
+	return result, nil
+}
+
+// Entity returns the main entity spawning unit. Most units share their
+// hash with their entity, so if no entity refers to the unit, the unit's
+// hash is returned with ok set to false.
+func (u UnitEntities) Entity(unit stingray.Hash) (entity stingray.Hash, ok bool) {
+	entities, ok := u[unit]
+	if !ok || len(entities) == 0 {
+		return unit, false
+	}
+	return entities[0], true
+}
@@ -0,0 +1,32 @@
+package datalib
+
+import (
+	"testing"
+
+	"github.com/xypwn/filediver/stingray"
+)
+
+func TestUnitEntitiesWeapons(t *testing.T) {
+	unitEntities, err := ParseUnitEntities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Weapons whose entity (which has the weapon customization
+	// component) is named differently from their unit
+	for unit, want := range map[string]uint64{
+		"content/fac_helldivers/equipment/primary_weapons/assault_rifle_penetrator/assault_rifle_penetrator":                               0x43cb1033961a2276,
+		"content/fac_helldivers/equipment/primary_weapons/marksman_rifle_vigilance_counter_sniper/marksman_rifle_vigilance_counter_sniper": 0x4c786785c79d44e7,
+		"content/fac_helldivers/equipment/primary_weapons/assault_shotgun_sprayandpray/assault_shotgun_sprayandpray":                       0x5ebaea70c0d060b9,
+		"content/fac_helldivers/equipment/primary_weapons/jet_rifle_phoenix/jet_rifle_phoenix":                                             0xb6aff2195568767f,
+		"content/fac_helldivers/equipment/primary_weapons/assault_rifle_explosive/assault_rifle_explosive":                                 0xcf5f176e0e322be1,
+		"content/fac_helldivers/equipment/primary_weapons/plasma_rifle_charge/plasma_rifle_charge":                                         0xfb3a19078694708a,
+	} {
+		entity, ok := unitEntities.Entity(stingray.Sum(unit))
+		if !ok || entity.Value != want {
+			t.Errorf("%v: expected entity %016x, got %v (found: %v)", unit, want, entity, ok)
+		}
+		if _, err := GetWeaponCustomizationComponentDataForHash(entity); err != nil {
+			t.Errorf("%v: %v", unit, err)
+		}
+	}
+}
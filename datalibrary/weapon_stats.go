@@ -0,0 +1,338 @@
+package datalib
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/xypwn/filediver/datalibrary/enum"
+)
+
+// WeaponStats is a flat summary of a weapon or ordnance entity, joining
+// its weapon or explosive components with the projectile, damage and
+// explosion settings they refer to. All fields are scalars, so it can be
+// written as a table row.
+type WeaponStats struct {
+	Entity   string `json:"entity"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+
+	FireModes       string  `json:"fire_modes"`
+	RoundsPerMinute float32 `json:"rounds_per_minute"`
+	BurstRounds     uint32  `json:"burst_rounds"`
+	Ergonomics      float32 `json:"ergonomics"`
+	SpreadX         float32 `json:"spread_horizontal"`
+	SpreadY         float32 `json:"spread_vertical"`
+	RecoilX         float32 `json:"recoil_horizontal"`
+	RecoilY         float32 `json:"recoil_vertical"`
+
+	MagazineCapacity uint32  `json:"magazine_capacity"`
+	Magazines        uint32  `json:"magazines"`
+	MagazinesMax     uint32  `json:"magazines_max"`
+	MagazinesRefill  uint32  `json:"magazines_refill"`
+	Chambered        bool    `json:"chambered"`
+	ReloadDuration   float32 `json:"reload_duration"`
+
+	OverheatTemperature float32 `json:"overheat_temperature"`
+	HeatPerShot         float32 `json:"heat_per_shot"`
+	HeatPerSecond       float32 `json:"heat_per_second"`
+	CoolingPerSecond    float32 `json:"cooling_per_second"`
+
+	ProjectileType      string  `json:"projectile_type"`
+	ProjectileName      string  `json:"projectile_name"`
+	Calibre             float32 `json:"calibre"`
+	NumProjectiles      uint32  `json:"num_projectiles"`
+	Speed               float32 `json:"speed"`
+	Mass                float32 `json:"mass"`
+	Drag                float32 `json:"drag"`
+	GravityMultiplier   float32 `json:"gravity_multiplier"`
+	LifeTime            float32 `json:"life_time"`
+	PenetrationSlowdown float32 `json:"penetration_slowdown"`
+
+	ArcType           string  `json:"arc_type"`
+	ArcDistance       float32 `json:"arc_distance"`
+	ArcMaxChainLength uint32  `json:"arc_max_chain_length"`
+	BeamType          string  `json:"beam_type"`
+	BeamLength        float32 `json:"beam_length"`
+	BeamRadius        float32 `json:"beam_radius"`
+
+	DamageType         string `json:"damage_type"`
+	Damage             int32  `json:"damage"`
+	DurableDamage      int32  `json:"durable_damage"`
+	ArmorPenetration   string `json:"armor_penetration"`
+	DemolitionStrength uint32 `json:"demolition_strength"`
+	ForceStrength      uint32 `json:"force_strength"`
+	ForceImpulse       uint32 `json:"force_impulse"`
+	Element            string `json:"element"`
+	StatusEffects      string `json:"status_effects"`
+
+	ExplosionType             string  `json:"explosion_type"`
+	ExplosionInnerRadius      float32 `json:"explosion_inner_radius"`
+	ExplosionOuterRadius      float32 `json:"explosion_outer_radius"`
+	ExplosionDamageType       string  `json:"explosion_damage_type"`
+	ExplosionDamage           int32   `json:"explosion_damage"`
+	ExplosionDurableDamage    int32   `json:"explosion_durable_damage"`
+	ExplosionArmorPenetration string  `json:"explosion_armor_penetration"`
+	ShrapnelProjectiles       uint32  `json:"shrapnel_projectiles"`
+	ShrapnelProjectileType    string  `json:"shrapnel_projectile_type"`
+}
+
+// Components which identify the kind of stratagem an entity without an
+// equipment component belongs to, in order of precedence
+var weaponCategoryComponents = []struct {
+	Component string
+	Category  string
+}{
+	{"TurretComponentData", "Turret"},
+	{"EagleComponentData", "Eagle"},
+	{"VehicleComponentData", "Vehicle"},
+	{"BackpackComponentData", "Backpack"},
+}
+
+// firstByType maps each type to its first setting. Types are unique in
+// the built-in settings (see TestWeaponStatsSettingsUnique), so the
+// choice only matters for data library snapshots which repeat a type.
+func firstByType[T comparable, I any](infos []I, typ func(I) T) map[T]I {
+	res := make(map[T]I)
+	for _, info := range infos {
+		if _, ok := res[typ(info)]; !ok {
+			res[typ(info)] = info
+		}
+	}
+	return res
+}
+
+func joinArmorPenetration(values []uint32) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, "/")
+}
+
+func joinStatusEffects(effects []DamageStatusEffectInfo) string {
+	parts := make([]string, len(effects))
+	for i, effect := range effects {
+		parts[i] = fmt.Sprintf("%v:%v", effect.Type, effect.Value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (stats *WeaponStats) setDamage(damage DamageInfo) {
+	stats.DamageType = damage.Type.String()
+	stats.Damage = damage.Damage
+	stats.DurableDamage = damage.DurableDamage
+	stats.ArmorPenetration = joinArmorPenetration(damage.ArmorPenetrationPerAngle)
+	stats.DemolitionStrength = damage.DemolitionStrength
+	stats.ForceStrength = damage.ForceStrength
+	stats.ForceImpulse = damage.ForceImpulse
+	stats.Element = damage.ElementType.String()
+	stats.StatusEffects = joinStatusEffects(damage.StatusEffects)
+}
+
+// Sets the projectile columns and returns the damage and explosion the
+// projectile causes.
+func (stats *WeaponStats) setProjectile(projectile ProjectileInfo) (enum.DamageInfoType, enum.ExplosionType) {
+	stats.ProjectileName = projectile.NameCased
+	stats.Calibre = projectile.Calibre
+	stats.NumProjectiles = projectile.NumProjectiles
+	stats.Speed = projectile.Speed
+	stats.Mass = projectile.Mass
+	stats.Drag = projectile.Drag
+	stats.GravityMultiplier = projectile.GravityMultiplier
+	stats.LifeTime = projectile.LifeTime
+	stats.PenetrationSlowdown = projectile.PenetrationSlowdown
+	explosionType := projectile.ExplosionTypeOnImpact
+	if explosionType == enum.ExplosionType_None {
+		explosionType = projectile.ExplosionTypeExpire
+	}
+	return projectile.DamageInfoType, explosionType
+}
+
+func (stats *WeaponStats) setExplosion(explosion ExplosionInfo, damages map[enum.DamageInfoType]DamageInfo) {
+	stats.ExplosionType = explosion.Type.String()
+	stats.ExplosionInnerRadius = explosion.InnerRadius
+	stats.ExplosionOuterRadius = explosion.OuterRadius
+	stats.ShrapnelProjectiles = explosion.NumShrapnelProjectiles
+	if explosion.NumShrapnelProjectiles > 0 {
+		stats.ShrapnelProjectileType = explosion.ShrapnelProjectileType.String()
+	}
+	if damage, ok := damages[explosion.DamageType]; ok {
+		stats.ExplosionDamageType = damage.Type.String()
+		stats.ExplosionDamage = damage.Damage
+		stats.ExplosionDurableDamage = damage.DurableDamage
+		stats.ExplosionArmorPenetration = joinArmorPenetration(damage.ArmorPenetrationPerAngle)
+	}
+}
+
+// LoadWeaponStats joins the components of every entity which has a
+// WeaponDataComponent with what it fires: the projectile and the explosion
+// it causes on impact (or on expiry), the arc, or the beam and its
+// explosion, each with their damage. Entities with an ExplosiveComponent
+// or SeekingMissileComponent, such as grenades, mines, eagle bombs and
+// stratagem shells, are included with the projectile they are processed as
+// and the explosion they cause. Barrages which scripts fire as bare
+// projectile types, like most orbital strikes, have no entity and are not
+// included. Names are taken from the entity's encyclopedia entry. The
+// result is sorted by name, then entity.
+func LoadWeaponStats(lookupHash HashLookup, lookupThinHash ThinHashLookup, lookupStrings StringsLookup) ([]WeaponStats, error) {
+	entities, err := ParseEntityComponentSettings()
+	if err != nil {
+		return nil, fmt.Errorf("parsing entities: %w", err)
+	}
+	projectileSettings, err := LoadProjectileSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		return nil, fmt.Errorf("loading projectile settings: %w", err)
+	}
+	damageSettings, err := LoadDamageSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		return nil, fmt.Errorf("loading damage settings: %w", err)
+	}
+	explosionSettings, err := LoadExplosionSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		return nil, fmt.Errorf("loading explosion settings: %w", err)
+	}
+	arcSettings, err := LoadArcSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		return nil, fmt.Errorf("loading arc settings: %w", err)
+	}
+	beamSettings, err := LoadBeamSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		return nil, fmt.Errorf("loading beam settings: %w", err)
+	}
+
+	projectiles := firstByType(projectileSettings, func(info ProjectileInfo) enum.ProjectileType { return info.Type })
+	damages := firstByType(damageSettings.Infos, func(info DamageInfo) enum.DamageInfoType { return info.Type })
+	explosions := firstByType(slices.Concat(explosionSettings...), func(info ExplosionInfo) enum.ExplosionType { return info.Type })
+	arcs := firstByType(slices.Concat(arcSettings...), func(info ArcInfo) enum.ArcType { return info.Type })
+	beams := firstByType(slices.Concat(beamSettings...), func(info BeamInfo) enum.BeamType { return info.Type })
+
+	var result []WeaponStats
+	for resource, entity := range entities {
+		weaponData, isWeapon := entity.Components[Sum("WeaponDataComponentData")].(WeaponDataComponent)
+		explosive, isExplosive := entity.Components[Sum("ExplosiveComponentData")].(ExplosiveComponent)
+		missile, isMissile := entity.Components[Sum("SeekingMissileComponentData")].(SeekingMissileComponent)
+		if !isWeapon && !isExplosive && !isMissile {
+			continue
+		}
+		stats := WeaponStats{
+			Entity:      lookupHash(resource),
+			BurstRounds: weaponData.NumBurstRounds,
+			Ergonomics:  weaponData.Ergonomics,
+			SpreadX:     weaponData.Spread.Horizontal,
+			SpreadY:     weaponData.Spread.Vertical,
+			RecoilX:     weaponData.RecInfo.Drift.HorizontalRecoil,
+			RecoilY:     weaponData.RecInfo.Climb.VerticalRecoil,
+		}
+		var fireModes []string
+		for _, mode := range []enum.FireMode{
+			weaponData.PrimaryFireMode,
+			weaponData.SecondaryFireMode,
+			weaponData.TertiaryFireMode,
+			weaponData.QuaternaryFireMode,
+		} {
+			if mode != enum.FireMode_None {
+				fireModes = append(fireModes, strings.TrimPrefix(mode.String(), "FireMode_"))
+			}
+		}
+		stats.FireModes = strings.Join(fireModes, "/")
+
+		if entry, ok := entity.Components[Sum("EncyclopediaEntryComponentData")].(EncyclopediaEntryComponent); ok {
+			stats.Name = entry.ToSimple(lookupHash, lookupThinHash, lookupStrings).(SimpleEncyclopediaEntryComponent).LocName
+		}
+		if equipment, ok := entity.Components[Sum("EquipmentComponentData")].(EquipmentComponent); ok && equipment.EquipmentType != enum.EquipmentType_All {
+			stats.Category = strings.TrimPrefix(equipment.EquipmentType.String(), "EquipmentType_")
+		} else {
+			for _, c := range weaponCategoryComponents {
+				if _, ok := entity.Components[Sum(c.Component)]; ok {
+					stats.Category = c.Category
+					break
+				}
+			}
+		}
+		if stats.Category == "" && !isWeapon {
+			if isMissile {
+				stats.Category = "Missile"
+			} else {
+				stats.Category = "Explosive"
+			}
+		}
+
+		if heat, ok := entity.Components[Sum("WeaponHeatComponentData")].(WeaponHeatComponent); ok {
+			stats.Magazines = heat.Magazines
+			stats.MagazinesMax = heat.MagazinesMax
+			stats.MagazinesRefill = heat.MagazinesRefill
+			stats.OverheatTemperature = heat.OverheatTemperature
+			stats.HeatPerShot = heat.TempGainPerShot
+			stats.HeatPerSecond = heat.TempGainPerSecond
+			stats.CoolingPerSecond = heat.TempLossPerSecond
+		}
+		if magazine, ok := entity.Components[Sum("WeaponMagazineComponentData")].(WeaponMagazineComponent); ok {
+			stats.MagazineCapacity = magazine.Capacity
+			stats.Magazines = magazine.Magazines
+			stats.MagazinesMax = magazine.MagazinesMax
+			stats.MagazinesRefill = magazine.MagazinesRefill
+			stats.Chambered = magazine.Chambered != 0
+		}
+		if reload, ok := entity.Components[Sum("WeaponReloadComponentData")].(WeaponReloadComponent); ok {
+			stats.ReloadDuration = reload.Duration
+		}
+
+		damageType := enum.DamageInfoType_None
+		explosionType := enum.ExplosionType_None
+		if projectileWeapon, ok := entity.Components[Sum("ProjectileWeaponComponentData")].(ProjectileWeaponComponent); ok {
+			// The rate depends on the weapon setting; Y is the default ROF
+			stats.RoundsPerMinute = projectileWeapon.RoundsPerMinute[1]
+			stats.ProjectileType = projectileWeapon.ProjType.String()
+			if projectile, ok := projectiles[projectileWeapon.ProjType]; ok {
+				damageType, explosionType = stats.setProjectile(projectile)
+			}
+		} else if arcWeapon, ok := entity.Components[Sum("ArcWeaponComponentData")].(ArcWeaponComponent); ok {
+			stats.RoundsPerMinute = arcWeapon.RoundsPerMinute
+			stats.ArcType = arcWeapon.Type.String()
+			if arc, ok := arcs[arcWeapon.Type]; ok {
+				stats.Speed = arc.Speed
+				stats.ArcDistance = arc.Distance
+				stats.ArcMaxChainLength = arc.MaxChainLength
+				damageType = arc.DamageInfoType
+			}
+		} else if beamWeapon, ok := entity.Components[Sum("BeamWeaponComponentData")].(BeamWeaponComponent); ok {
+			stats.BeamType = beamWeapon.Type.String()
+			if beam, ok := beams[beamWeapon.Type]; ok {
+				stats.BeamLength = beam.Length
+				stats.BeamRadius = beam.Radius
+				damageType = beam.DamageInfoType
+				explosionType = beam.ExplosionType
+			}
+		} else if isMissile && missile.ProjectileTypeToProcess != enum.ProjectileType_None {
+			stats.ProjectileType = missile.ProjectileTypeToProcess.String()
+			if projectile, ok := projectiles[missile.ProjectileTypeToProcess]; ok {
+				damageType, explosionType = stats.setProjectile(projectile)
+			}
+		}
+		if isExplosive && explosionType == enum.ExplosionType_None {
+			explosionType = explosive.ExplosionType
+			if explosionType == enum.ExplosionType_None {
+				explosionType = explosive.ImpactExplosionType
+			}
+		}
+
+		if damage, ok := damages[damageType]; ok && damageType != enum.DamageInfoType_None {
+			stats.setDamage(damage)
+		}
+		if explosion, ok := explosions[explosionType]; ok && explosionType != enum.ExplosionType_None {
+			stats.setExplosion(explosion, damages)
+		}
+
+		result = append(result, stats)
+	}
+
+	slices.SortFunc(result, func(a, b WeaponStats) int {
+		return cmp.Or(
+			cmp.Compare(a.Name, b.Name),
+			cmp.Compare(a.Entity, b.Entity),
+		)
+	})
+	return result, nil
+}
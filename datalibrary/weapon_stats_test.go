@@ -0,0 +1,89 @@
+package datalib
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/xypwn/filediver/datalibrary/enum"
+	"github.com/xypwn/filediver/stingray"
+)
+
+func weaponStatsTestLookups() (HashLookup, ThinHashLookup, StringsLookup) {
+	return func(h stingray.Hash) string { return h.String() },
+		func(h stingray.ThinHash) string { return h.String() },
+		func(uint32) string { return "" }
+}
+
+func checkUniqueTypes[T comparable, I any](t *testing.T, name string, infos []I, typ func(I) T) {
+	t.Helper()
+	seen := make(map[T]bool)
+	for _, info := range infos {
+		if seen[typ(info)] {
+			t.Errorf("%v type %v appears more than once", name, typ(info))
+		}
+		seen[typ(info)] = true
+	}
+}
+
+func TestWeaponStatsSettingsUnique(t *testing.T) {
+	lookupHash, lookupThinHash, lookupStrings := weaponStatsTestLookups()
+	projectiles, err := LoadProjectileSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damages, err := LoadDamageSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explosions, err := LoadExplosionSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arcs, err := LoadArcSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beams, err := LoadBeamSettings(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUniqueTypes(t, "projectile", projectiles, func(info ProjectileInfo) enum.ProjectileType { return info.Type })
+	checkUniqueTypes(t, "damage", damages.Infos, func(info DamageInfo) enum.DamageInfoType { return info.Type })
+	checkUniqueTypes(t, "explosion", slices.Concat(explosions...), func(info ExplosionInfo) enum.ExplosionType { return info.Type })
+	checkUniqueTypes(t, "arc", slices.Concat(arcs...), func(info ArcInfo) enum.ArcType { return info.Type })
+	checkUniqueTypes(t, "beam", slices.Concat(beams...), func(info BeamInfo) enum.BeamType { return info.Type })
+}
+
+func TestLoadWeaponStatsOrdnance(t *testing.T) {
+	lookupHash, lookupThinHash, lookupStrings := weaponStatsTestLookups()
+	entities, err := ParseEntityComponentSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := LoadWeaponStats(lookupHash, lookupThinHash, lookupStrings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make(map[string]WeaponStats)
+	for _, row := range stats {
+		rows[row.Entity] = row
+	}
+	var withExplosion int
+	for resource, entity := range entities {
+		if _, ok := entity.Components[Sum("WeaponDataComponentData")]; ok {
+			continue
+		}
+		_, isExplosive := entity.Components[Sum("ExplosiveComponentData")]
+		_, isMissile := entity.Components[Sum("SeekingMissileComponentData")]
+		row, ok := rows[lookupHash(resource)]
+		if ok != (isExplosive || isMissile) {
+			t.Errorf("entity %v: explosive %v, missile %v, but included %v", lookupHash(resource), isExplosive, isMissile, ok)
+		}
+		if ok && row.ExplosionType != "" {
+			withExplosion++
+		}
+	}
+	if withExplosion == 0 {
+		t.Errorf("expected ordnance with explosions")
+	}
+}
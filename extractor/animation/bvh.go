@@ -0,0 +1,299 @@
+package animation
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/animation"
+)
+
+type bvhJoint struct {
+	Name     string
+	Parent   int // -1 for the root
+	Children []int
+	// Local bind transform
+	Translation mgl32.Vec3
+	Rotation    mgl32.Quat
+	// Index of the animated bone, -1 if the joint isn't animated
+	Bone int
+	// Direct child of the root which was added to join multiple roots
+	TopLevel bool
+}
+
+var bvhNameReplacer = strings.NewReplacer(" ", "_", "\t", "_", "{", "_", "}", "_")
+
+// Builds the joint hierarchy of the skeleton, with the first joint being the root.
+func bvhJoints(ctx *extractor.Context, sk *skeleton, anim *animation.Animation) []bvhJoint {
+	gltfConvertQuat := mgl32.QuatRotate(mgl32.DegToRad(-90), mgl32.Vec3{1, 0, 0})
+
+	boneIndices := make(map[stingray.ThinHash]int)
+	for i, hash := range sk.BoneInfo.Hashes {
+		if i < int(anim.Header.BoneCount) {
+			boneIndices[hash] = i
+		}
+	}
+	boneName := func(hash stingray.ThinHash) string {
+		if name, ok := sk.BoneInfo.NameMap[hash]; ok {
+			return bvhNameReplacer.Replace(name)
+		}
+		return fmt.Sprintf("Bone_%08x", hash.Value)
+	}
+	boneIndex := func(hash stingray.ThinHash) int {
+		if idx, ok := boneIndices[hash]; ok {
+			return idx
+		}
+		return -1
+	}
+
+	skeletonName := ctx.LookupHash(sk.Name)
+	if idx := strings.LastIndex(skeletonName, "/"); idx != -1 {
+		skeletonName = skeletonName[idx+1:]
+	}
+	syntheticRoot := bvhJoint{
+		Name:     bvhNameReplacer.Replace(skeletonName),
+		Parent:   -1,
+		Rotation: mgl32.QuatIdent(),
+		Bone:     -1,
+	}
+
+	if sk.UnitInfo == nil {
+		// Without a unit, the hierarchy is unknown, so the bones
+		// are laid out flat, posed by the animation's initial transforms
+		ctx.Warnf("no unit found for bones %v, exporting skeleton without bone hierarchy", ctx.LookupHash(sk.BonesID))
+		joints := []bvhJoint{syntheticRoot}
+		for i, hash := range sk.BoneInfo.Hashes {
+			joint := bvhJoint{
+				Name:     boneName(hash),
+				Parent:   0,
+				Rotation: gltfConvertQuat,
+				Bone:     boneIndex(hash),
+				TopLevel: true,
+			}
+			if i < len(anim.Header.InitialTransforms) && !anim.Header.InitialTransforms[i].IsAdditive() {
+				joint.Translation = gltfConvertQuat.Rotate(anim.Header.InitialTransforms[i].Position())
+				joint.Rotation = gltfConvertQuat.Mul(anim.Header.InitialTransforms[i].Rotation())
+			}
+			joints[0].Children = append(joints[0].Children, len(joints))
+			joints = append(joints, joint)
+		}
+		return joints
+	}
+
+	unitBones, _ := bindPose(sk.UnitInfo)
+	var roots []int
+	for i, bone := range unitBones {
+		if bone.ParentIndex == uint32(i) || bone.ParentIndex >= uint32(len(unitBones)) {
+			roots = append(roots, i)
+		}
+	}
+	// Joint index offset of unit bones
+	offset := 0
+	var joints []bvhJoint
+	if len(roots) != 1 {
+		offset = 1
+		joints = append(joints, syntheticRoot)
+	}
+	for i, bone := range unitBones {
+		joint := bvhJoint{
+			Name:        boneName(bone.NameHash),
+			Parent:      int(bone.ParentIndex) + offset,
+			Translation: bone.Transform.Translation,
+			Rotation:    mgl32.Mat4ToQuat(bone.Transform.Rotation.Mat4()).Normalize(),
+			Bone:        boneIndex(bone.NameHash),
+		}
+		if bone.ParentIndex == uint32(i) || bone.ParentIndex >= uint32(len(unitBones)) {
+			joint.Parent = offset - 1
+			joint.TopLevel = offset == 1
+		}
+		joints = append(joints, joint)
+	}
+	for i, joint := range joints {
+		if i >= offset && joint.Parent >= 0 {
+			joints[joint.Parent].Children = append(joints[joint.Parent].Children, i)
+		}
+	}
+	return joints
+}
+
+// Decomposes q into ZXY euler angles in degrees,
+// i.e. q = Rz * Rx * Ry.
+func quatToEulerZXY(q mgl32.Quat) mgl32.Vec3 {
+	m := q.Normalize().Mat4()
+	var x, y, z float64
+	sx := float64(mgl32.Clamp(m.At(2, 1), -1, 1))
+	x = math.Asin(sx)
+	if math.Abs(sx) < 0.9999 {
+		z = math.Atan2(float64(-m.At(0, 1)), float64(m.At(1, 1)))
+		y = math.Atan2(float64(-m.At(2, 0)), float64(m.At(2, 2)))
+	} else {
+		// Gimbal lock
+		z = math.Atan2(float64(m.At(1, 0)), float64(m.At(0, 0)))
+	}
+	return mgl32.Vec3{
+		float32(x * 180 / math.Pi),
+		float32(y * 180 / math.Pi),
+		float32(z * 180 / math.Pi),
+	}
+}
+
+// Shifts each angle by multiples of 360 degrees to be
+// as close as possible to the previous one.
+func unwrapAngles(angles, prev mgl32.Vec3) mgl32.Vec3 {
+	for i := range angles {
+		angles[i] -= 360 * float32(math.Round(float64(angles[i]-prev[i])/360))
+	}
+	return angles
+}
+
+func writeBVHJoint(w *bufio.Writer, joints []bvhJoint, idx int, depth int) {
+	indent := strings.Repeat("\t", depth)
+	joint := joints[idx]
+	if joint.Parent < 0 {
+		fmt.Fprintf(w, "%vROOT %v\n", indent, joint.Name)
+	} else {
+		fmt.Fprintf(w, "%vJOINT %v\n", indent, joint.Name)
+	}
+	fmt.Fprintf(w, "%v{\n", indent)
+	fmt.Fprintf(w, "%v\tOFFSET %.6f %.6f %.6f\n", indent, joint.Translation[0], joint.Translation[1], joint.Translation[2])
+	fmt.Fprintf(w, "%v\tCHANNELS 6 Xposition Yposition Zposition Zrotation Xrotation Yrotation\n", indent)
+	for _, child := range joint.Children {
+		writeBVHJoint(w, joints, child, depth+1)
+	}
+	if len(joint.Children) == 0 {
+		fmt.Fprintf(w, "%v\tEnd Site\n", indent)
+		fmt.Fprintf(w, "%v\t{\n", indent)
+		fmt.Fprintf(w, "%v\t\tOFFSET 0.000000 0.000000 0.000000\n", indent)
+		fmt.Fprintf(w, "%v\t}\n", indent)
+	}
+	fmt.Fprintf(w, "%v}\n", indent)
+}
+
+// Exports the animation as BVH motion of its skeleton.
+func ConvertBVH(ctx *extractor.Context) error {
+	cfg := ctx.Config()
+
+	r, err := ctx.Open(ctx.FileID(), stingray.DataMain)
+	if err != nil {
+		return err
+	}
+	anim, err := animation.LoadAnimation(r)
+	if err != nil {
+		return fmt.Errorf("convert animation to bvh: loading animation failed: %v", err)
+	}
+	curves, err := loadBoneCurves(anim, ctx.FileID().Name)
+	if err != nil {
+		return fmt.Errorf("convert animation to bvh: %v", err)
+	}
+	sk, err := resolveSkeleton(ctx, anim)
+	if err != nil {
+		return fmt.Errorf("convert animation to bvh: %v", err)
+	}
+	joints := bvhJoints(ctx, sk, anim)
+
+	frameRate := cfg.Unit.AnimationSampleRate
+	if frameRate <= 0 {
+		frameRate = 30
+	}
+	numFrames := max(1, int(math.Ceil(float64(frameRate)*float64(anim.Header.AnimationLength))))
+
+	// Sampled curves of each animated bone
+	positions := make([][]VectorKeyframe, anim.Header.BoneCount)
+	rotations := make([][]QuaternionKeyframe, anim.Header.BoneCount)
+	for i := range anim.Header.BoneCount {
+		if len(curves.Positions[i].Keyframes) > 0 {
+			positions[i] = curves.Positions[i].Sample(frameRate)
+			// The first keyframe is repeated by the sampler
+			if len(positions[i]) > 2 && positions[i][1].Time == positions[i][0].Time {
+				positions[i] = positions[i][1:]
+			}
+		}
+		if len(curves.Rotations[i].Keyframes) > 0 {
+			rotations[i] = curves.Rotations[i].Sample(frameRate)
+			if len(rotations[i]) > 2 && rotations[i][1].Time == rotations[i][0].Time {
+				rotations[i] = rotations[i][1:]
+			}
+		}
+	}
+
+	gltfConvertQuat := mgl32.QuatRotate(mgl32.DegToRad(-90), mgl32.Vec3{1, 0, 0})
+	pose := func(joint bvhJoint, frame int) (mgl32.Vec3, mgl32.Quat) {
+		translation, rotation := joint.Translation, joint.Rotation
+		if joint.Bone < 0 {
+			return translation, rotation
+		}
+		isRoot := joint.Parent < 0 || joint.TopLevel
+		additive := curves.Additive[joint.Bone]
+		if samples := positions[joint.Bone]; len(samples) > 0 {
+			value := samples[min(frame, len(samples)-1)].Vector
+			if additive && cfg.Animation.BakeAdditive {
+				translation = translation.Add(value)
+			} else if !additive && isRoot {
+				translation = gltfConvertQuat.Rotate(value)
+			} else {
+				translation = value
+			}
+		}
+		if samples := rotations[joint.Bone]; len(samples) > 0 {
+			value := samples[min(frame, len(samples)-1)].Quaternion.Normalize()
+			if additive && cfg.Animation.BakeAdditive {
+				rotation = rotation.Mul(value)
+			} else if !additive && isRoot {
+				rotation = gltfConvertQuat.Mul(value)
+			} else {
+				rotation = value
+			}
+		}
+		return translation, rotation
+	}
+
+	out, err := ctx.CreateFile(".bvh")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintf(w, "HIERARCHY\n")
+	writeBVHJoint(w, joints, 0, 0)
+	fmt.Fprintf(w, "MOTION\n")
+	fmt.Fprintf(w, "Frames: %v\n", numFrames)
+	fmt.Fprintf(w, "Frame Time: %.6f\n", 1/float64(frameRate))
+
+	// Channel order follows the depth-first order of the hierarchy
+	var order []int
+	var visit func(idx int)
+	visit = func(idx int) {
+		order = append(order, idx)
+		for _, child := range joints[idx].Children {
+			visit(child)
+		}
+	}
+	visit(0)
+
+	prevAngles := make([]mgl32.Vec3, len(joints))
+	for frame := range numFrames {
+		for i, idx := range order {
+			translation, rotation := pose(joints[idx], frame)
+			angles := quatToEulerZXY(rotation)
+			if frame > 0 {
+				angles = unwrapAngles(angles, prevAngles[idx])
+			}
+			prevAngles[idx] = angles
+			if i > 0 {
+				w.WriteByte(' ')
+			}
+			fmt.Fprintf(w, "%.6f %.6f %.6f %.6f %.6f %.6f",
+				translation[0], translation[1], translation[2],
+				angles[2], angles[0], angles[1],
+			)
+		}
+		w.WriteByte('\n')
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,37 @@
+package animation
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestQuatToEulerZXY(t *testing.T) {
+	for _, angles := range []mgl32.Vec3{
+		{0, 0, 0},
+		{30, 0, 0},
+		{0, 45, 0},
+		{0, 0, -60},
+		{20, -35, 110},
+		{-80, 170, -10},
+		// Gimbal lock, where only the sum of the Y and Z angles is defined
+		{90, 30, 40},
+		{-90, 0, 25},
+	} {
+		rad := func(deg float32) float32 { return mgl32.DegToRad(deg) }
+		euler := func(angles mgl32.Vec3) mgl32.Quat {
+			return mgl32.QuatRotate(rad(angles[2]), mgl32.Vec3{0, 0, 1}).
+				Mul(mgl32.QuatRotate(rad(angles[0]), mgl32.Vec3{1, 0, 0})).
+				Mul(mgl32.QuatRotate(rad(angles[1]), mgl32.Vec3{0, 1, 0}))
+		}
+		q := euler(angles)
+		got := quatToEulerZXY(q)
+		if math.Abs(float64(angles[0])) < 90 && !got.ApproxEqualThreshold(angles, 1e-3) {
+			t.Errorf("expected angles %v, got %v", angles, got)
+		}
+		if r := euler(got); math.Abs(float64(r.Dot(q))) < 1-1e-5 {
+			t.Errorf("%v: angles %v give rotation %v, expected %v", angles, got, r, q)
+		}
+	}
+}
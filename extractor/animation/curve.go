@@ -1,7 +1,9 @@
 package animation
 
 import (
+	"cmp"
 	"math"
+	"slices"
 
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -165,3 +167,124 @@ func (c *QuaternionCurve) Sample(framerate int) []QuaternionKeyframe {
 	}
 	return toReturn
 }
+
+// Keyframe with glTF cubic spline tangents (in units per second)
+type VectorSplineKeyframe struct {
+	Time       float32
+	InTangent  mgl32.Vec3
+	Vector     mgl32.Vec3
+	OutTangent mgl32.Vec3
+}
+
+// Returns the keyframes sorted by time, keeping only the last
+// of multiple keyframes sharing a time.
+func (c *VectorCurve) uniqueKeyframes() []VectorKeyframe {
+	keyframes := slices.Clone(c.Keyframes)
+	slices.SortStableFunc(keyframes, func(a, b VectorKeyframe) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+	toReturn := make([]VectorKeyframe, 0, len(keyframes)+1)
+	for _, keyframe := range keyframes {
+		if len(toReturn) > 0 && toReturn[len(toReturn)-1].Time == keyframe.Time {
+			toReturn[len(toReturn)-1] = keyframe
+		} else {
+			toReturn = append(toReturn, keyframe)
+		}
+	}
+	if len(toReturn) == 1 && c.Duration > toReturn[0].Time {
+		toReturn = append(toReturn, VectorKeyframe{
+			Time:   c.Duration,
+			Vector: toReturn[0].Vector,
+		})
+	}
+	return toReturn
+}
+
+// Converts the curve's keyframes into glTF cubic spline keyframes
+// describing the same curve as Sample.
+//
+// Sample uses the tangent T[i] = 0.5 * (P[i+1] - P[i-1]) relative to
+// the segment's parameter, so it's divided by the segment's duration
+// to get the per-second tangents glTF expects.
+func (c *VectorCurve) CubicSpline() []VectorSplineKeyframe {
+	keyframes := c.uniqueKeyframes()
+	toReturn := make([]VectorSplineKeyframe, len(keyframes))
+	for i, keyframe := range keyframes {
+		prev := keyframes[max(i-1, 0)]
+		next := keyframes[min(i+1, len(keyframes)-1)]
+		tangent := next.Vector.Sub(prev.Vector).Mul(0.5)
+		toReturn[i] = VectorSplineKeyframe{
+			Time:   keyframe.Time,
+			Vector: keyframe.Vector,
+		}
+		if i > 0 {
+			toReturn[i].InTangent = tangent.Mul(1 / (keyframe.Time - prev.Time))
+		}
+		if i < len(keyframes)-1 {
+			toReturn[i].OutTangent = tangent.Mul(1 / (next.Time - keyframe.Time))
+		}
+	}
+	return toReturn
+}
+
+// Keyframe with glTF cubic spline tangents (in units per second)
+type QuaternionSplineKeyframe struct {
+	Time       float32
+	InTangent  mgl32.Quat
+	Quaternion mgl32.Quat
+	OutTangent mgl32.Quat
+}
+
+// Returns the keyframes sorted by time, keeping only the last
+// of multiple keyframes sharing a time. Quaternions are flipped
+// to lie in the same hemisphere as their predecessor, so the
+// spline takes the shortest path.
+func (c *QuaternionCurve) uniqueKeyframes() []QuaternionKeyframe {
+	keyframes := slices.Clone(c.Keyframes)
+	slices.SortStableFunc(keyframes, func(a, b QuaternionKeyframe) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+	toReturn := make([]QuaternionKeyframe, 0, len(keyframes)+1)
+	for _, keyframe := range keyframes {
+		if len(toReturn) > 0 && toReturn[len(toReturn)-1].Time == keyframe.Time {
+			toReturn[len(toReturn)-1] = keyframe
+		} else {
+			toReturn = append(toReturn, keyframe)
+		}
+	}
+	for i := 1; i < len(toReturn); i++ {
+		if toReturn[i-1].Quaternion.Dot(toReturn[i].Quaternion) < 0 {
+			toReturn[i].Quaternion = toReturn[i].Quaternion.Scale(-1)
+		}
+	}
+	if len(toReturn) == 1 && c.Duration > toReturn[0].Time {
+		toReturn = append(toReturn, QuaternionKeyframe{
+			Time:       c.Duration,
+			Quaternion: toReturn[0].Quaternion,
+		})
+	}
+	return toReturn
+}
+
+// Converts the curve's keyframes into glTF cubic spline keyframes
+// describing the same curve as Sample. See VectorCurve.CubicSpline.
+func (c *QuaternionCurve) CubicSpline() []QuaternionSplineKeyframe {
+	keyframes := c.uniqueKeyframes()
+	toReturn := make([]QuaternionSplineKeyframe, len(keyframes))
+	for i, keyframe := range keyframes {
+		prev := keyframes[max(i-1, 0)]
+		next := keyframes[min(i+1, len(keyframes)-1)]
+		tangent := next.Quaternion.Sub(prev.Quaternion).Scale(0.5)
+		toReturn[i] = QuaternionSplineKeyframe{
+			Time:       keyframe.Time,
+			Quaternion: keyframe.Quaternion,
+		}
+		if i > 0 {
+			toReturn[i].InTangent = tangent.Scale(1 / (keyframe.Time - prev.Time))
+		}
+		if i < len(keyframes)-1 {
+			toReturn[i].OutTangent = tangent.Scale(1 / (next.Time - keyframe.Time))
+		}
+	}
+	return toReturn
+}
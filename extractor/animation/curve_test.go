@@ -0,0 +1,78 @@
+package animation
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Evaluates the glTF cubic spline at time t.
+func evalVectorSpline(keyframes []VectorSplineKeyframe, t float32) mgl32.Vec3 {
+	if t <= keyframes[0].Time {
+		return keyframes[0].Vector
+	}
+	for i := 0; i < len(keyframes)-1; i++ {
+		a, b := keyframes[i], keyframes[i+1]
+		if t > b.Time {
+			continue
+		}
+		td := b.Time - a.Time
+		s := (t - a.Time) / td
+		s2 := s * s
+		s3 := s * s2
+		return a.Vector.Mul(2*s3 - 3*s2 + 1).
+			Add(a.OutTangent.Mul(td * (s3 - 2*s2 + s))).
+			Add(b.Vector.Mul(-2*s3 + 3*s2)).
+			Add(b.InTangent.Mul(td * (s3 - s2)))
+	}
+	return keyframes[len(keyframes)-1].Vector
+}
+
+func TestVectorCurveCubicSpline(t *testing.T) {
+	linear := func(times ...float32) []VectorKeyframe {
+		var keyframes []VectorKeyframe
+		for _, time := range times {
+			keyframes = append(keyframes, VectorKeyframe{Time: time, Vector: mgl32.Vec3{2 * time, -time, 1}})
+		}
+		return keyframes
+	}
+	for _, test := range []struct {
+		name      string
+		keyframes []VectorKeyframe
+		duration  float32
+		// Tangents of the interior keyframes, if known
+		tangent *mgl32.Vec3
+	}{
+		{"linear", linear(0, 0.5, 1, 1.5, 2), 2, &mgl32.Vec3{2, -1, 0}},
+		{"linear unsorted", linear(1, 0, 2, 0.5, 1.5), 2, &mgl32.Vec3{2, -1, 0}},
+		{"uneven", linear(0, 0.25, 1, 2), 2, nil},
+		{"single", linear(0.5), 2, nil},
+		{"curved", []VectorKeyframe{
+			{0, mgl32.Vec3{0, 0, 0}},
+			{0.5, mgl32.Vec3{1, 3, 0}},
+			{1, mgl32.Vec3{0, -1, 2}},
+		}, 1, nil},
+	} {
+		curve := VectorCurve{Keyframes: test.keyframes, Duration: test.duration}
+		spline := curve.CubicSpline()
+		for i := 1; i < len(spline); i++ {
+			if spline[i].Time <= spline[i-1].Time {
+				t.Fatalf("%v: keyframe times not increasing: %v", test.name, spline)
+			}
+		}
+		if test.tangent != nil {
+			for _, keyframe := range spline[1 : len(spline)-1] {
+				if !keyframe.InTangent.ApproxEqual(*test.tangent) || !keyframe.OutTangent.ApproxEqual(*test.tangent) {
+					t.Errorf("%v: expected tangents %v at %v, got %v and %v", test.name, *test.tangent, keyframe.Time, keyframe.InTangent, keyframe.OutTangent)
+				}
+			}
+		}
+		// Sample expects the keyframes in order
+		sorted := VectorCurve{Keyframes: curve.uniqueKeyframes(), Duration: test.duration}
+		for _, sample := range sorted.Sample(30) {
+			if got := evalVectorSpline(spline, sample.Time); !got.ApproxEqualThreshold(sample.Vector, 1e-5) {
+				t.Errorf("%v: expected %v at %v, got %v", test.name, sample.Vector, sample.Time, got)
+			}
+		}
+	}
+}
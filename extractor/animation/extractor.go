@@ -61,13 +61,26 @@ func ExtractAnimationJson(ctx *extractor.Context) error {
 	return err
 }
 
-func getTargetNode(doc *gltf.Document, boneInfo *bones.Info, boneIdx uint32) (uint32, error) {
-	for nodeIdx := range doc.Nodes {
-		if doc.Nodes[nodeIdx].Name == boneInfo.NameMap[boneInfo.Hashes[boneIdx]] {
-			return uint32(nodeIdx), nil
+// Searches joints for the node of the bone, or all nodes if joints is nil.
+func getTargetNode(doc *gltf.Document, boneInfo *bones.Info, joints []uint32, boneIdx uint32) (uint32, error) {
+	if boneIdx >= uint32(len(boneInfo.Hashes)) {
+		return 0, fmt.Errorf("bone index %v exceeds skeleton bone count %v", boneIdx, len(boneInfo.Hashes))
+	}
+	name := boneInfo.NameMap[boneInfo.Hashes[boneIdx]]
+	if joints != nil {
+		for _, nodeIdx := range joints {
+			if doc.Nodes[nodeIdx].Name == name {
+				return nodeIdx, nil
+			}
+		}
+	} else {
+		for nodeIdx := range doc.Nodes {
+			if doc.Nodes[nodeIdx].Name == name {
+				return uint32(nodeIdx), nil
+			}
 		}
 	}
-	return 0, fmt.Errorf("could not find bone %v in document", boneInfo.NameMap[boneInfo.Hashes[boneIdx]])
+	return 0, fmt.Errorf("could not find bone %v in document", name)
 }
 
 func NameAnimation(ctx *extractor.Context, path stingray.Hash) string {
@@ -89,22 +102,15 @@ func NameAnimation(ctx *extractor.Context, path stingray.Hash) string {
 	return animationName
 }
 
-func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.Info, path stingray.Hash) (uint32, error) {
-	cfg := ctx.Config()
-
-	mainR, err := ctx.Open(stingray.NewFileID(path, stingray.Sum("animation")), stingray.DataMain)
-	if err == stingray.ErrFileNotExist {
-		return 0, fmt.Errorf("could not find animation %v", path.String())
-	}
-	if err != nil {
-		return 0, fmt.Errorf("could not open animation file %v: %v", path.String(), err)
-	}
-
-	animInfo, err := animation.LoadAnimation(mainR)
-	if err != nil {
-		return 0, fmt.Errorf("could not parse animation file %v: %v", path.String(), err)
-	}
+// Per-bone curves of an animation, starting at the bones' initial transforms
+type boneCurves struct {
+	Positions []VectorCurve
+	Rotations []QuaternionCurve
+	Scales    []VectorCurve
+	Additive  []bool
+}
 
+func loadBoneCurves(animInfo *animation.Animation, path stingray.Hash) (*boneCurves, error) {
 	bonePositions := make([]VectorCurve, animInfo.Header.BoneCount)
 	boneRotations := make([]QuaternionCurve, animInfo.Header.BoneCount)
 	boneScales := make([]VectorCurve, animInfo.Header.BoneCount)
@@ -137,13 +143,13 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 
 	for i, entry := range animInfo.Entries {
 		if uint32(entry.Header.Bone()) >= animInfo.Header.BoneCount {
-			return 0, fmt.Errorf("entry %v in animation %v had bone index %v exceeding bone count %v", i, path.String(), entry.Header.Bone(), animInfo.Header.BoneCount)
+			return nil, fmt.Errorf("entry %v in animation %v had bone index %v exceeding bone count %v", i, path.String(), entry.Header.Bone(), animInfo.Header.BoneCount)
 		}
 		switch entry.Header.Type() {
 		case animation.EntryTypePosition:
 			value, err := entry.Position()
 			if err != nil {
-				return 0, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
+				return nil, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
 			}
 			bonePositions[entry.Header.Bone()].Keyframes = append(bonePositions[entry.Header.Bone()].Keyframes, VectorKeyframe{
 				Time:   float32(entry.Header.TimeMS()) / 1000.0,
@@ -152,7 +158,7 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 		case animation.EntryTypeRotation:
 			value, err := entry.Rotation()
 			if err != nil {
-				return 0, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
+				return nil, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
 			}
 			boneRotations[entry.Header.Bone()].Keyframes = append(boneRotations[entry.Header.Bone()].Keyframes, QuaternionKeyframe{
 				Time:       float32(entry.Header.TimeMS()) / 1000.0,
@@ -161,7 +167,7 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 		case animation.EntryTypeScale:
 			value, err := entry.Scale()
 			if err != nil {
-				return 0, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
+				return nil, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
 			}
 			boneScales[entry.Header.Bone()].Keyframes = append(boneScales[entry.Header.Bone()].Keyframes, VectorKeyframe{
 				Time:   float32(entry.Header.TimeMS()) / 1000.0,
@@ -171,7 +177,7 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 			if entry.Header.Subtype() == animation.EntrySubtypePosition {
 				value, err := entry.Position()
 				if err != nil {
-					return 0, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
+					return nil, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
 				}
 				bonePositions[entry.Header.Bone()].Keyframes = append(bonePositions[entry.Header.Bone()].Keyframes, VectorKeyframe{
 					Time:   float32(entry.Header.TimeMS()) / 1000.0,
@@ -180,7 +186,7 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 			} else if entry.Header.Subtype() == animation.EntrySubtypeRotation {
 				value, err := entry.Rotation()
 				if err != nil {
-					return 0, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
+					return nil, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
 				}
 				boneRotations[entry.Header.Bone()].Keyframes = append(boneRotations[entry.Header.Bone()].Keyframes, QuaternionKeyframe{
 					Time:       float32(entry.Header.TimeMS()) / 1000.0,
@@ -189,7 +195,7 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 			} else if entry.Header.Subtype() == animation.EntrySubtypeScale {
 				value, err := entry.Scale()
 				if err != nil {
-					return 0, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
+					return nil, fmt.Errorf("adding entry %v to animation %v: %v", i, path.String(), err)
 				}
 				boneScales[entry.Header.Bone()].Keyframes = append(boneScales[entry.Header.Bone()].Keyframes, VectorKeyframe{
 					Time:   float32(entry.Header.TimeMS()) / 1000.0,
@@ -197,10 +203,44 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 				})
 			}
 		default:
-			return 0, fmt.Errorf("adding entry %v to animation %v: unimplemented entry type %v", i, path.String(), entry.Header.Type().String())
+			return nil, fmt.Errorf("adding entry %v to animation %v: unimplemented entry type %v", i, path.String(), entry.Header.Type().String())
 		}
 	}
 
+	return &boneCurves{
+		Positions: bonePositions,
+		Rotations: boneRotations,
+		Scales:    boneScales,
+		Additive:  additive,
+	}, nil
+}
+
+func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.Info, path stingray.Hash) (uint32, error) {
+	return addAnimation(ctx, doc, boneInfo, nil, path)
+}
+
+func addAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.Info, joints []uint32, path stingray.Hash) (uint32, error) {
+	cfg := ctx.Config()
+
+	mainR, err := ctx.Open(stingray.NewFileID(path, stingray.Sum("animation")), stingray.DataMain)
+	if err == stingray.ErrFileNotExist {
+		return 0, fmt.Errorf("could not find animation %v", path.String())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not open animation file %v: %v", path.String(), err)
+	}
+
+	animInfo, err := animation.LoadAnimation(mainR)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse animation file %v: %v", path.String(), err)
+	}
+
+	curves, err := loadBoneCurves(animInfo, path)
+	if err != nil {
+		return 0, err
+	}
+	bonePositions, boneRotations, boneScales, additive := curves.Positions, curves.Rotations, curves.Scales, curves.Additive
+
 	extras, ok := doc.Extras.(map[string]any)
 	if !ok {
 		extras = make(map[string]any)
@@ -216,122 +256,71 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 	channels := make([]*gltf.Channel, 0)
 	gltfConvertQuat := mgl32.QuatRotate(mgl32.DegToRad(-90), mgl32.Vec3([3]float32{1, 0, 0}))
 	for boneIdx := uint32(0); boneIdx < animInfo.Header.BoneCount; boneIdx += 1 {
-		targetNode, err := getTargetNode(doc, boneInfo, boneIdx)
+		targetNode, err := getTargetNode(doc, boneInfo, joints, boneIdx)
 		if err != nil {
 			ctx.Warnf("writing gltf animation %v: %v", path.String(), err)
 			continue
 		}
 
-		var posKeyframes, scaleKeyframes []VectorKeyframe
-		var rotKeyframes []QuaternionKeyframe
-		if cfg.Unit.SampleAnimations {
-			posKeyframes = bonePositions[boneIdx].Sample(cfg.Unit.AnimationSampleRate)
-			rotKeyframes = boneRotations[boneIdx].Sample(cfg.Unit.AnimationSampleRate)
-			scaleKeyframes = boneScales[boneIdx].Sample(cfg.Unit.AnimationSampleRate)
-		} else {
-			posKeyframes = bonePositions[boneIdx].Keyframes
-			rotKeyframes = boneRotations[boneIdx].Keyframes
-			scaleKeyframes = boneScales[boneIdx].Keyframes
-		}
-
-		times := make([]float32, 0)
-		positions := make([][3]float32, 0)
-		for _, position := range posKeyframes {
-			times = append(times, position.Time)
-			translation := position.Vector
+		// Values are converted before being written; tangents are
+		// converted the same way, minus any constant offset
+		convertPosition := func(translation mgl32.Vec3, isTangent bool) [3]float32 {
 			if additive[boneIdx] {
 				// This doesn't *really* work unfortunately - diver/the .cast blender plugin modifies the
 				// basis matrix of the bone rather than modifying the translation, but I don't know if that's
 				// feasible with GLTF - maybe theres an extension for additive animations?
-				translation = translation.Add(doc.Nodes[targetNode].Translation)
+				if !isTangent {
+					translation = translation.Add(doc.Nodes[targetNode].Translation)
+				}
 			} else if doc.Nodes[targetNode].Name == "StingrayEntityRoot" {
 				translation = gltfConvertQuat.Rotate(translation)
 			}
-			positions = append(positions, translation)
-		}
-
-		positionTimesAccessor := modeler.WriteAccessor(doc, gltf.TargetNone, times)
-		doc.Accessors[positionTimesAccessor].Min = []float32{0.0}
-		doc.Accessors[positionTimesAccessor].Max = []float32{animInfo.Header.AnimationLength}
-		positionsAccessor := modeler.WriteAccessor(doc, gltf.TargetNone, positions)
-
-		positionSampler := &gltf.AnimationSampler{
-			Input:  positionTimesAccessor,
-			Output: positionsAccessor,
-		}
-		positionChannel := &gltf.Channel{
-			Sampler: gltf.Index(uint32(len(samplers))),
-			Target: gltf.ChannelTarget{
-				Node: gltf.Index(targetNode),
-				Path: gltf.TRSTranslation,
-			},
+			return translation
 		}
-		samplers = append(samplers, positionSampler)
-		channels = append(channels, positionChannel)
-
-		times = make([]float32, 0)
-		rotations := make([][4]float32, 0)
-		for _, rotation := range rotKeyframes {
-			times = append(times, rotation.Time)
-			data := rotation.Quaternion.V.Vec4(rotation.Quaternion.W)
+		convertRotation := func(rotation mgl32.Quat) [4]float32 {
 			if additive[boneIdx] {
 				// Same comment as for translation above - this doesn't seem to quite work, though the animation
 				// at least looks sensible rather than just a pile of body parts writhing around, so I'll take
 				// the wins where I can get them lol
 				vec := mgl32.Vec4(doc.Nodes[targetNode].Rotation)
-				addRot := vec.Quat().Mul(rotation.Quaternion)
-				data = addRot.V.Vec4(addRot.W)
+				rotation = vec.Quat().Mul(rotation)
 			} else if doc.Nodes[targetNode].Name == "StingrayEntityRoot" {
-				gltfConvertedRot := gltfConvertQuat.Mul(rotation.Quaternion)
-				data = gltfConvertedRot.V.Vec4(gltfConvertedRot.W)
+				rotation = gltfConvertQuat.Mul(rotation)
 			}
-			rotations = append(rotations, data)
-		}
-
-		rotationTimesAccessor := modeler.WriteAccessor(doc, gltf.TargetNone, times)
-		doc.Accessors[rotationTimesAccessor].Min = []float32{0.0}
-		doc.Accessors[rotationTimesAccessor].Max = []float32{animInfo.Header.AnimationLength}
-		rotationsAccessor := modeler.WriteAccessor(doc, gltf.TargetNone, rotations)
-
-		rotationSampler := &gltf.AnimationSampler{
-			Input:  rotationTimesAccessor,
-			Output: rotationsAccessor,
-		}
-		rotationChannel := &gltf.Channel{
-			Sampler: gltf.Index(uint32(len(samplers))),
-			Target: gltf.ChannelTarget{
-				Path: gltf.TRSRotation,
-				Node: gltf.Index(targetNode),
-			},
+			return rotation.V.Vec4(rotation.W)
 		}
-		samplers = append(samplers, rotationSampler)
-		channels = append(channels, rotationChannel)
-
-		times = make([]float32, 0)
-		scales := make([][3]float32, 0)
-		for _, scale := range scaleKeyframes {
-			times = append(times, scale.Time)
-			scales = append(scales, scale.Vector)
+		convertScale := func(scale mgl32.Vec3, _ bool) [3]float32 {
+			return scale
 		}
 
-		scaleTimesAccessor := modeler.WriteAccessor(doc, gltf.TargetNone, times)
-		doc.Accessors[scaleTimesAccessor].Min = []float32{0.0}
-		doc.Accessors[scaleTimesAccessor].Max = []float32{animInfo.Header.AnimationLength}
-		scalesAccessor := modeler.WriteAccessor(doc, gltf.TargetNone, scales)
-
-		scaleSampler := &gltf.AnimationSampler{
-			Input:  scaleTimesAccessor,
-			Output: scalesAccessor,
+		var positionSampler, rotationSampler, scaleSampler *gltf.AnimationSampler
+		if cfg.Unit.SampleAnimations {
+			positionSampler = writeVectorSampler(doc, bonePositions[boneIdx].Sample(cfg.Unit.AnimationSampleRate), animInfo.Header.AnimationLength, convertPosition)
+			rotationSampler = writeQuaternionSampler(doc, boneRotations[boneIdx].Sample(cfg.Unit.AnimationSampleRate), animInfo.Header.AnimationLength, convertRotation)
+			scaleSampler = writeVectorSampler(doc, boneScales[boneIdx].Sample(cfg.Unit.AnimationSampleRate), animInfo.Header.AnimationLength, convertScale)
+		} else {
+			positionSampler = writeVectorSplineSampler(doc, bonePositions[boneIdx].CubicSpline(), animInfo.Header.AnimationLength, convertPosition)
+			rotationSampler = writeQuaternionSplineSampler(doc, boneRotations[boneIdx].CubicSpline(), animInfo.Header.AnimationLength, convertRotation)
+			scaleSampler = writeVectorSplineSampler(doc, boneScales[boneIdx].CubicSpline(), animInfo.Header.AnimationLength, convertScale)
 		}
-		scaleChannel := &gltf.Channel{
-			Sampler: gltf.Index(uint32(len(samplers))),
-			Target: gltf.ChannelTarget{
-				Path: gltf.TRSScale,
-				Node: gltf.Index(targetNode),
-			},
+
+		for _, ch := range []struct {
+			sampler *gltf.AnimationSampler
+			path    gltf.TRSProperty
+		}{
+			{positionSampler, gltf.TRSTranslation},
+			{rotationSampler, gltf.TRSRotation},
+			{scaleSampler, gltf.TRSScale},
+		} {
+			channels = append(channels, &gltf.Channel{
+				Sampler: gltf.Index(uint32(len(samplers))),
+				Target: gltf.ChannelTarget{
+					Node: gltf.Index(targetNode),
+					Path: ch.path,
+				},
+			})
+			samplers = append(samplers, ch.sampler)
 		}
-		samplers = append(samplers, scaleSampler)
-		channels = append(channels, scaleChannel)
 	}
 
 	beats := make([]animation.Beat, 0)
@@ -354,3 +343,73 @@ func AddAnimation(ctx *extractor.Context, doc *gltf.Document, boneInfo *bones.In
 	})
 	return animationIdx, nil
 }
+
+func writeSamplerTimes(doc *gltf.Document, times []float32, length float32) uint32 {
+	timesAccessor := modeler.WriteAccessor(doc, gltf.TargetNone, times)
+	doc.Accessors[timesAccessor].Min = []float32{0.0}
+	doc.Accessors[timesAccessor].Max = []float32{length}
+	return timesAccessor
+}
+
+func writeVectorSampler(doc *gltf.Document, keyframes []VectorKeyframe, length float32, convert func(v mgl32.Vec3, isTangent bool) [3]float32) *gltf.AnimationSampler {
+	times := make([]float32, 0, len(keyframes))
+	values := make([][3]float32, 0, len(keyframes))
+	for _, keyframe := range keyframes {
+		times = append(times, keyframe.Time)
+		values = append(values, convert(keyframe.Vector, false))
+	}
+	return &gltf.AnimationSampler{
+		Input:  writeSamplerTimes(doc, times, length),
+		Output: modeler.WriteAccessor(doc, gltf.TargetNone, values),
+	}
+}
+
+func writeQuaternionSampler(doc *gltf.Document, keyframes []QuaternionKeyframe, length float32, convert func(q mgl32.Quat) [4]float32) *gltf.AnimationSampler {
+	times := make([]float32, 0, len(keyframes))
+	values := make([][4]float32, 0, len(keyframes))
+	for _, keyframe := range keyframes {
+		times = append(times, keyframe.Time)
+		values = append(values, convert(keyframe.Quaternion))
+	}
+	return &gltf.AnimationSampler{
+		Input:  writeSamplerTimes(doc, times, length),
+		Output: modeler.WriteAccessor(doc, gltf.TargetNone, values),
+	}
+}
+
+// Output of a cubic spline sampler is in-tangent, value, out-tangent for each keyframe
+func writeVectorSplineSampler(doc *gltf.Document, keyframes []VectorSplineKeyframe, length float32, convert func(v mgl32.Vec3, isTangent bool) [3]float32) *gltf.AnimationSampler {
+	times := make([]float32, 0, len(keyframes))
+	values := make([][3]float32, 0, 3*len(keyframes))
+	for _, keyframe := range keyframes {
+		times = append(times, keyframe.Time)
+		values = append(values,
+			convert(keyframe.InTangent, true),
+			convert(keyframe.Vector, false),
+			convert(keyframe.OutTangent, true),
+		)
+	}
+	return &gltf.AnimationSampler{
+		Input:         writeSamplerTimes(doc, times, length),
+		Output:        modeler.WriteAccessor(doc, gltf.TargetNone, values),
+		Interpolation: gltf.InterpolationCubicSpline,
+	}
+}
+
+func writeQuaternionSplineSampler(doc *gltf.Document, keyframes []QuaternionSplineKeyframe, length float32, convert func(q mgl32.Quat) [4]float32) *gltf.AnimationSampler {
+	times := make([]float32, 0, len(keyframes))
+	values := make([][4]float32, 0, 3*len(keyframes))
+	for _, keyframe := range keyframes {
+		times = append(times, keyframe.Time)
+		values = append(values,
+			convert(keyframe.InTangent),
+			convert(keyframe.Quaternion),
+			convert(keyframe.OutTangent),
+		)
+	}
+	return &gltf.AnimationSampler{
+		Input:         writeSamplerTimes(doc, times, length),
+		Output:        modeler.WriteAccessor(doc, gltf.TargetNone, values),
+		Interpolation: gltf.InterpolationCubicSpline,
+	}
+}
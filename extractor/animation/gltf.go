@@ -0,0 +1,247 @@
+package animation
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/animation"
+	"github.com/xypwn/filediver/stingray/bones"
+	"github.com/xypwn/filediver/stingray/unit"
+)
+
+// Skeleton a standalone animation is exported against
+type skeleton struct {
+	Name     stingray.Hash
+	BonesID  stingray.Hash
+	BoneInfo *bones.Info
+	// Nil if only a bones file is known, in which
+	// case the bone hierarchy is unavailable
+	UnitInfo *unit.Info
+}
+
+// Loads the skeleton of the unit or bones file called name.
+// Returns nil if neither exists.
+func loadSkeleton(ctx *extractor.Context, name stingray.Hash) (*skeleton, error) {
+	sk := &skeleton{Name: name}
+	unitID := stingray.NewFileID(name, stingray.Sum("unit"))
+	if ctx.Exists(unitID, stingray.DataMain) {
+		r, err := ctx.Open(unitID, stingray.DataMain)
+		if err != nil {
+			return nil, err
+		}
+		sk.UnitInfo, err = unit.LoadInfo(r)
+		if err != nil {
+			return nil, fmt.Errorf("loading unit %v: %w", ctx.LookupHash(name), err)
+		}
+		if sk.UnitInfo.BonesHash.Value == 0 || len(sk.UnitInfo.Bones) == 0 {
+			return nil, fmt.Errorf("unit %v has no skeleton", ctx.LookupHash(name))
+		}
+		sk.BonesID = sk.UnitInfo.BonesHash
+	} else {
+		sk.BonesID = name
+	}
+
+	bonesID := stingray.NewFileID(sk.BonesID, stingray.Sum("bones"))
+	if !ctx.Exists(bonesID, stingray.DataMain) {
+		if sk.UnitInfo != nil {
+			return nil, fmt.Errorf("bones file %v of unit %v does not exist", ctx.LookupHash(sk.BonesID), ctx.LookupHash(name))
+		}
+		return nil, nil
+	}
+	r, err := ctx.Open(bonesID, stingray.DataMain)
+	if err != nil {
+		return nil, err
+	}
+	sk.BoneInfo, err = bones.LoadBones(r)
+	if err != nil {
+		return nil, fmt.Errorf("loading bones %v: %w", ctx.LookupHash(sk.BonesID), err)
+	}
+	return sk, nil
+}
+
+// Resolves the skeleton selected in the config, or
+// infers it from the hashes in the animation's header.
+func resolveSkeleton(ctx *extractor.Context, anim *animation.Animation) (*skeleton, error) {
+	if sel := ctx.Config().Animation.Skeleton; sel != "" {
+		name := stingray.Sum(sel)
+		if strings.HasPrefix(sel, "0x") {
+			var err error
+			name, err = stingray.ParseHash(sel)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sk, err := loadSkeleton(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if sk == nil {
+			return nil, fmt.Errorf("skeleton %v is neither a unit nor a bones file", sel)
+		}
+		if len(sk.BoneInfo.Hashes) < int(anim.Header.BoneCount) {
+			ctx.Warnf("skeleton %v has %v bones, but animation has %v", sel, len(sk.BoneInfo.Hashes), anim.Header.BoneCount)
+		}
+		return sk, nil
+	}
+
+	for _, hash := range anim.Header.Hashes {
+		sk, err := loadSkeleton(ctx, hash)
+		if err != nil {
+			ctx.Warnf("inferring skeleton: %v", err)
+			continue
+		}
+		if sk != nil && len(sk.BoneInfo.Hashes) >= int(anim.Header.BoneCount) {
+			return sk, nil
+		}
+	}
+	return nil, fmt.Errorf("could not infer skeleton of animation, please select one with the Animation.Skeleton option")
+}
+
+// Returns the unit's bones with their local bind transforms in
+// gltf space, and the inverse bind matrices. Same as the skeleton
+// of a unit export.
+func bindPose(unitInfo *unit.Info) ([]unit.Bone, [][4][4]float32) {
+	unitBones := slices.Clone(unitInfo.Bones)
+	matrices := make([][4][4]float32, len(unitBones))
+	gltfConversionMatrix := mgl32.HomogRotate3DX(mgl32.DegToRad(-90.0))
+	for i := range unitBones {
+		jtm := unitInfo.JointTransformMatrices[i]
+		bindMatrix := mgl32.Mat4FromRows(jtm[0], jtm[1], jtm[2], jtm[3]).Transpose()
+		bindMatrix = gltfConversionMatrix.Mul4(bindMatrix)
+		row0, row1, row2, row3 := bindMatrix.Inv().Rows()
+		matrices[i] = [4][4]float32{row0, row1, row2, row3}
+		unitBones[i].Matrix = bindMatrix
+	}
+	unitBones[0].RecursiveCalcLocalTransforms(&unitBones)
+	return unitBones, matrices
+}
+
+// Adds the skeleton's bones to the gltf document, reusing the nodes
+// of a previously added instance of the same skeleton.
+// Returns the skin index.
+func addSkeleton(ctx *extractor.Context, doc *gltf.Document, sk *skeleton, anim *animation.Animation) uint32 {
+	for i, skin := range doc.Skins {
+		if extras, ok := skin.Extras.(map[string]any); ok && extras["bones"] == sk.BonesID.String() {
+			return uint32(i)
+		}
+	}
+
+	boneName := func(hash stingray.ThinHash) string {
+		if name, ok := sk.BoneInfo.NameMap[hash]; ok {
+			return name
+		}
+		return fmt.Sprintf("Bone_%08x", hash.Value)
+	}
+
+	skeletonName := ctx.LookupHash(sk.Name)
+	if idx := strings.LastIndex(skeletonName, "/"); idx != -1 {
+		skeletonName = skeletonName[idx+1:]
+	}
+	rootIdx := uint32(len(doc.Nodes))
+	doc.Nodes = append(doc.Nodes, &gltf.Node{
+		Name: skeletonName,
+	})
+	doc.Scenes[0].Nodes = append(doc.Scenes[0].Nodes, rootIdx)
+
+	boneBaseIndex := uint32(len(doc.Nodes))
+	var matrices [][4][4]float32
+	var jointIndices []uint32
+	if sk.UnitInfo != nil {
+		var unitBones []unit.Bone
+		unitBones, matrices = bindPose(sk.UnitInfo)
+		for i, bone := range unitBones {
+			quat := mgl32.Mat4ToQuat(bone.Transform.Rotation.Mat4())
+			doc.Nodes = append(doc.Nodes, &gltf.Node{
+				Name:        boneName(bone.NameHash),
+				Rotation:    quat.V.Vec4(quat.W),
+				Translation: bone.Transform.Translation,
+				Scale:       bone.Transform.Scale,
+			})
+			boneIdx := boneBaseIndex + uint32(i)
+			if bone.ParentIndex == uint32(i) || bone.ParentIndex >= uint32(len(unitBones)) {
+				doc.Nodes[rootIdx].Children = append(doc.Nodes[rootIdx].Children, boneIdx)
+			} else {
+				parentIdx := boneBaseIndex + bone.ParentIndex
+				doc.Nodes[parentIdx].Children = append(doc.Nodes[parentIdx].Children, boneIdx)
+			}
+			jointIndices = append(jointIndices, boneIdx)
+		}
+	} else {
+		// Without a unit, the hierarchy is unknown, so the bones
+		// are laid out flat, posed by the animation's initial transforms
+		ctx.Warnf("no unit found for bones %v, exporting skeleton without bone hierarchy", ctx.LookupHash(sk.BonesID))
+		matrices = make([][4][4]float32, len(sk.BoneInfo.Hashes))
+		for i, hash := range sk.BoneInfo.Hashes {
+			node := &gltf.Node{
+				Name:     boneName(hash),
+				Rotation: [4]float32{0, 0, 0, 1},
+				Scale:    [3]float32{1, 1, 1},
+			}
+			if i < len(anim.Header.InitialTransforms) && !anim.Header.InitialTransforms[i].IsAdditive() {
+				transform := anim.Header.InitialTransforms[i]
+				rot := transform.Rotation()
+				node.Translation = transform.Position()
+				node.Rotation = rot.V.Vec4(rot.W)
+				node.Scale = transform.Scale()
+			}
+			matrix := mgl32.Translate3D(node.Translation[0], node.Translation[1], node.Translation[2]).
+				Mul4(mgl32.Quat{W: node.Rotation[3], V: mgl32.Vec3{node.Rotation[0], node.Rotation[1], node.Rotation[2]}}.Mat4()).
+				Mul4(mgl32.Scale3D(node.Scale[0], node.Scale[1], node.Scale[2]))
+			row0, row1, row2, row3 := matrix.Inv().Rows()
+			matrices[i] = [4][4]float32{row0, row1, row2, row3}
+
+			boneIdx := boneBaseIndex + uint32(i)
+			doc.Nodes = append(doc.Nodes, node)
+			doc.Nodes[rootIdx].Children = append(doc.Nodes[rootIdx].Children, boneIdx)
+			jointIndices = append(jointIndices, boneIdx)
+		}
+	}
+
+	inverseBindMatrices := modeler.WriteAccessor(doc, gltf.TargetNone, matrices)
+	doc.Skins = append(doc.Skins, &gltf.Skin{
+		Name:                sk.Name.String(),
+		InverseBindMatrices: gltf.Index(inverseBindMatrices),
+		Joints:              jointIndices,
+		Skeleton:            gltf.Index(rootIdx),
+		Extras:              map[string]any{"bones": sk.BonesID.String()},
+	})
+	return uint32(len(doc.Skins) - 1)
+}
+
+// Exports the animation as a gltf animation of its skeleton.
+func Convert(currDoc *gltf.Document) func(ctx *extractor.Context) error {
+	return func(ctx *extractor.Context) error {
+		cfg := ctx.Config()
+
+		r, err := ctx.Open(ctx.FileID(), stingray.DataMain)
+		if err != nil {
+			return err
+		}
+		anim, err := animation.LoadAnimation(r)
+		if err != nil {
+			return fmt.Errorf("convert animation: loading animation failed: %v", err)
+		}
+
+		sk, err := resolveSkeleton(ctx, anim)
+		if err != nil {
+			return fmt.Errorf("convert animation: %v", err)
+		}
+
+		doc := extractor.GetDocument(ctx, currDoc)
+		skin := addSkeleton(ctx, doc, sk, anim)
+		if _, err := addAnimation(ctx, doc, sk.BoneInfo, doc.Skins[skin].Joints, ctx.FileID().Name); err != nil {
+			return err
+		}
+
+		if currDoc == nil {
+			return extractor.SaveDocument(ctx, doc, "animation", cfg.Animation.Format)
+		}
+		return nil
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"strings"
 
 	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
 	"github.com/xypwn/filediver/extractor/blend_helper"
+	"github.com/xypwn/filediver/extractor/staticmesh"
 	"github.com/xypwn/filediver/stingray"
 )
 
@@ -239,6 +241,80 @@ func SaveDocument(ctx *Context, doc *gltf.Document, stingrayFormat, fileFormat s
 		if err != nil {
 			return err
 		}
+	} else if fileFormat == "obj" {
+		objName, err := ctx.AllocateFile(fmt.Sprintf(".%v.obj", stingrayFormat))
+		if err != nil {
+			return err
+		}
+		mtlName, err := ctx.AllocateFile(fmt.Sprintf(".%v.mtl", stingrayFormat))
+		if err != nil {
+			return err
+		}
+		objOut, err := os.Create(objName)
+		if err != nil {
+			return err
+		}
+		defer objOut.Close()
+		mtlOut, err := os.Create(mtlName)
+		if err != nil {
+			return err
+		}
+		defer mtlOut.Close()
+		folder := filepath.Dir(objName)
+		writeImage := func(doc *gltf.Document, idx uint32) (string, error) {
+			return saveDocumentImage(ctx, doc, idx, stingrayFormat, folder)
+		}
+		if err := staticmesh.WriteOBJ(objOut, mtlOut, filepath.Base(mtlName), doc, writeImage); err != nil {
+			return err
+		}
+	} else if fileFormat == "ply" {
+		out, err := ctx.CreateFile(fmt.Sprintf(".%v.ply", stingrayFormat))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		if err := staticmesh.WritePLY(out, doc); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// Saves an image embedded in the document next to the output file,
+// returning its path relative to folder.
+func saveDocumentImage(ctx *Context, doc *gltf.Document, idx uint32, stingrayFormat, folder string) (string, error) {
+	img := doc.Images[idx]
+	if img.BufferView == nil {
+		return img.URI, nil
+	}
+	data, err := modeler.ReadBufferView(doc, doc.BufferViews[*img.BufferView])
+	if err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer("/", "_", "\\", "_", " ", "_").Replace(img.Name)
+	if name == "" {
+		name = fmt.Sprint(idx)
+	}
+	switch img.MimeType {
+	case "image/png":
+		if !strings.HasSuffix(name, ".png") {
+			name += ".png"
+		}
+	case "image/jpeg":
+		if !strings.HasSuffix(name, ".jpg") {
+			name += ".jpg"
+		}
+	}
+	path, err := ctx.AllocateFile(fmt.Sprintf(".%v.textures/%v", stingrayFormat, name))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(folder, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
@@ -92,6 +92,9 @@ func ConvertOpts(ctx *extractor.Context, imgOpts *extr_material.ImageOptions, gl
 		if err != nil {
 			return err
 		}
+		if cfg.Model.EntityData {
+			extr_unit.AddEntityData(ctx.WithFileID(unitId), doc, *parent, meshNodes)
+		}
 		extr_unit.AddPrefabMetadata(ctx.WithFileID(unitId), doc, parent, skin, meshNodes, nil)
 	}
 
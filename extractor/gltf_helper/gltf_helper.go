@@ -0,0 +1,97 @@
+// Package gltf_helper has helpers for walking the node transforms and
+// instances of exported gltf documents, shared by the writers of other
+// scene formats.
+package gltf_helper
+
+import (
+	"slices"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/qmuntal/gltf"
+)
+
+// Additional placement of a model, see the
+// "filediver_instances" extras of the prefab extractor
+type Instance struct {
+	Root uint32
+	// Transform relative to the parent node
+	Matrix mgl32.Mat4
+	// Material index by primitive index
+	Materials map[uint32]uint32
+}
+
+// Returns the matrix of a gltf translation, rotation (x, y, z, w)
+// and scale.
+func TRSMatrix(translation [3]float32, rotation [4]float32, scale [3]float32) mgl32.Mat4 {
+	quat := mgl32.Quat{W: rotation[3], V: mgl32.Vec3{rotation[0], rotation[1], rotation[2]}}
+	return mgl32.Translate3D(translation[0], translation[1], translation[2]).
+		Mul4(quat.Normalize().Mat4()).
+		Mul4(mgl32.Scale3D(scale[0], scale[1], scale[2]))
+}
+
+// Returns the local transform of node.
+func NodeMatrix(node *gltf.Node) mgl32.Mat4 {
+	if node.Matrix != gltf.DefaultMatrix && node.Matrix != [16]float32{} {
+		return mgl32.Mat4(node.Matrix)
+	}
+	return TRSMatrix(node.TranslationOrDefault(), node.RotationOrDefault(), node.ScaleOrDefault())
+}
+
+// Collects the additional instances of models by parent node.
+func Instances(doc *gltf.Document) map[uint32][]Instance {
+	res := make(map[uint32][]Instance)
+	extras, ok := doc.Extras.(map[string]any)
+	if !ok {
+		return res
+	}
+	for _, metadataIface := range extras {
+		metadata, ok := metadataIface.(map[string]any)
+		if !ok {
+			continue
+		}
+		root, ok := metadata["root"].(uint32)
+		if !ok {
+			continue
+		}
+		instances, ok := metadata["filediver_instances"].([]map[string]any)
+		if !ok {
+			continue
+		}
+		for _, instance := range instances {
+			parent, ok := instance["parent"].(uint32)
+			if !ok {
+				continue
+			}
+			translation, _ := instance["translation"].(mgl32.Vec3)
+			rotation, _ := instance["rotation"].(mgl32.Vec4)
+			scale, _ := instance["scale"].(mgl32.Vec3)
+			materials, _ := instance["materials"].(map[uint32]uint32)
+			res[parent] = append(res[parent], Instance{
+				Root:      root,
+				Matrix:    TRSMatrix(translation, rotation, scale),
+				Materials: materials,
+			})
+		}
+	}
+	return res
+}
+
+// Returns the nodes of the document's scenes which aren't
+// children of other nodes.
+func RootNodes(doc *gltf.Document) []uint32 {
+	isChild := make([]bool, len(doc.Nodes))
+	for _, node := range doc.Nodes {
+		for _, child := range node.Children {
+			isChild[child] = true
+		}
+	}
+	var roots []uint32
+	for _, scene := range doc.Scenes {
+		for _, node := range scene.Nodes {
+			if !isChild[node] && !slices.Contains(roots, node) {
+				roots = append(roots, node)
+			}
+		}
+	}
+	return roots
+}
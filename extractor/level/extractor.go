@@ -349,11 +349,15 @@ func ExtractLevelJSON(ctx *extractor.Context) error {
 	if err != nil {
 		return err
 	}
+	defer out.Close()
 	enc := json.NewEncoder(out)
 	enc.SetIndent("", "    ")
 	if err := enc.Encode(outData); err != nil {
 		return err
 	}
+	if ctx.Config().Level.Markers {
+		return WriteMarkersJSON(ctx, CollectMarkers(ctx, levelData))
+	}
 	return nil
 }
 
@@ -371,6 +375,9 @@ func ConvertOpts(ctx *extractor.Context, gltfDoc *gltf.Document) error {
 	if cfg.Level.Format == "json" {
 		return ExtractLevelJSON(ctx)
 	}
+	if cfg.Level.Format == "usd" {
+		return ConvertUSD(ctx)
+	}
 	r, err := ctx.Open(ctx.FileID(), stingray.DataMain)
 	if err != nil {
 		return err
@@ -463,10 +470,7 @@ func ConvertOpts(ctx *extractor.Context, gltfDoc *gltf.Document) error {
 		if !ok {
 			materialOverrides = nil
 		}
-		metadata := make(map[string]any)
-		for _, entry := range levelData.Metadata[idx] {
-			metadata[entry.Key(ctx.LookupThinHash)] = entry.Value()
-		}
+		metadata := level.MetadataValues(levelData.Metadata[idx], ctx.LookupThinHash)
 		unitId := stingray.NewFileID(unit.Path(), stingray.Sum("unit"))
 		err := extr_prefab.AddOrDuplicateModel(ctx.WithFileID(unitId), doc, imgOpts, &unit, levelIdx, materialOverrides, metadata)
 		if err != nil {
@@ -499,6 +503,14 @@ func ConvertOpts(ctx *extractor.Context, gltfDoc *gltf.Document) error {
 		}
 	}
 
+	if cfg.Level.Markers {
+		markers := CollectMarkers(ctx, levelData)
+		AddMarkerNodes(doc, levelIdx, markers)
+		if err := WriteMarkersJSON(ctx, markers); err != nil {
+			return err
+		}
+	}
+
 	extractor.ClearChildNodesFromScene(ctx, doc)
 
 	if gltfDoc == nil {
@@ -0,0 +1,262 @@
+package level
+
+import (
+	"encoding/json"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/qmuntal/gltf"
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/level"
+)
+
+type MarkerKind string
+
+const (
+	MarkerKind_SpawnPoint MarkerKind = "spawn_point"
+	MarkerKind_Objective  MarkerKind = "objective"
+	MarkerKind_Marker     MarkerKind = "marker"
+)
+
+// Explains the kind field in the marker JSON.
+const markerKindNote = "kind is guessed from the marker, unit path, group and metadata key names; it is not stored in the level"
+
+// The purpose of most markers isn't stored anywhere, so they are
+// guessed from their resolved names.
+func classifyMarker(names ...string) MarkerKind {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		switch {
+		case strings.Contains(name, "spawn"):
+			return MarkerKind_SpawnPoint
+		case strings.Contains(name, "objective"), strings.Contains(name, "extract"), strings.Contains(name, "terminal"):
+			return MarkerKind_Objective
+		}
+	}
+	return MarkerKind_Marker
+}
+
+type Marker struct {
+	Kind MarkerKind `json:"kind"`
+	// Where in the level the marker was found:
+	// transformed_item, unit, extra_unit or extra_prefab
+	Source   string         `json:"source"`
+	Index    int            `json:"index"`
+	Name     string         `json:"name"`
+	Path     string         `json:"path,omitempty"`
+	UUID     string         `json:"uuid,omitempty"`
+	Groups   []string       `json:"groups,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+	stingray.Transform
+}
+
+type MarkerContainer struct {
+	LevelName string   `json:"level_name"`
+	Units     []Marker `json:"units"`
+	Prefabs   []Marker `json:"prefabs"`
+}
+
+type LevelMarkers struct {
+	Name                string            `json:"name"`
+	KindNote            string            `json:"kind_note"`
+	SpawnPoints         []Marker          `json:"spawn_points"`
+	Objectives          []Marker          `json:"objectives"`
+	Markers             []Marker          `json:"markers"`
+	ExtraUnitContainers []MarkerContainer `json:"extra_unit_containers"`
+}
+
+func lookupThinHashes(ctx *extractor.Context, hashes []stingray.ThinHash) []string {
+	if len(hashes) == 0 {
+		return nil
+	}
+	names := make([]string, len(hashes))
+	for i, hash := range hashes {
+		names[i] = ctx.LookupThinHash(hash)
+	}
+	return names
+}
+
+func (m *LevelMarkers) add(marker Marker) {
+	switch marker.Kind {
+	case MarkerKind_SpawnPoint:
+		m.SpawnPoints = append(m.SpawnPoints, marker)
+	case MarkerKind_Objective:
+		m.Objectives = append(m.Objectives, marker)
+	default:
+		m.Markers = append(m.Markers, marker)
+	}
+}
+
+// Collects the gameplay markers of a level, i.e. its transformed items,
+// the units which carry metadata and the units and prefabs of its
+// extra unit containers.
+func CollectMarkers(ctx *extractor.Context, levelData *level.Level) *LevelMarkers {
+	markers := &LevelMarkers{
+		Name:                ctx.LookupHash(levelData.Name),
+		KindNote:            markerKindNote,
+		SpawnPoints:         make([]Marker, 0),
+		Objectives:          make([]Marker, 0),
+		Markers:             make([]Marker, 0),
+		ExtraUnitContainers: make([]MarkerContainer, 0),
+	}
+
+	for idx, item := range levelData.UnkTransformedItems {
+		name := ctx.LookupHash(item.Hash)
+		markers.add(Marker{
+			Kind:      classifyMarker(name),
+			Source:    "transformed_item",
+			Index:     idx,
+			Name:      name,
+			Transform: item.Transform,
+		})
+	}
+
+	for idx, unit := range levelData.Units {
+		entries, ok := levelData.Metadata[idx]
+		if !ok || len(entries) == 0 {
+			continue
+		}
+		metadata := level.MetadataValues(entries, ctx.LookupThinHash)
+		groups := lookupThinHashes(ctx, level.RangeNames(levelData.UnitHashIndexRange, idx))
+		// Sorted, so the names are matched in a stable order
+		keys := slices.Sorted(maps.Keys(metadata))
+		unitPath := ctx.LookupHash(unit.Path())
+		markers.add(Marker{
+			Kind:      classifyMarker(append(append([]string{unitPath}, groups...), keys...)...),
+			Source:    "unit",
+			Index:     idx,
+			Name:      ctx.LookupHash(unit.Name),
+			Path:      unitPath,
+			UUID:      ctx.LookupHash(unit.UUIDHash),
+			Groups:    groups,
+			Metadata:  metadata,
+			Transform: unit.Transform,
+		})
+	}
+
+	for _, container := range levelData.UnkExtraUnitContainers {
+		simpleContainer := MarkerContainer{
+			LevelName: ctx.LookupHash(container.LevelName),
+			Units:     make([]Marker, 0),
+			Prefabs:   make([]Marker, 0),
+		}
+		for idx, unit := range container.ExtraUnits {
+			unitPath := ctx.LookupHash(unit.Path)
+			name := ctx.LookupHash(unit.Name)
+			simpleContainer.Units = append(simpleContainer.Units, Marker{
+				Kind:      classifyMarker(name, unitPath),
+				Source:    "extra_unit",
+				Index:     idx,
+				Name:      name,
+				Path:      unitPath,
+				UUID:      ctx.LookupHash(unit.UUIDHash),
+				Transform: unit.Transform,
+			})
+		}
+		for idx, prefab := range container.ExtraPrefabs {
+			prefabPath := ctx.LookupHash(prefab.Path)
+			simpleContainer.Prefabs = append(simpleContainer.Prefabs, Marker{
+				Kind:      classifyMarker(prefabPath),
+				Source:    "extra_prefab",
+				Index:     idx,
+				Name:      path.Base(prefabPath),
+				Path:      prefabPath,
+				UUID:      ctx.LookupHash(prefab.UUIDHash),
+				Transform: prefab.Transform,
+			})
+		}
+		markers.ExtraUnitContainers = append(markers.ExtraUnitContainers, simpleContainer)
+	}
+	return markers
+}
+
+func WriteMarkersJSON(ctx *extractor.Context, markers *LevelMarkers) error {
+	out, err := ctx.CreateFile(".level_markers.json")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "    ")
+	return enc.Encode(markers)
+}
+
+func addMarkerGroup(doc *gltf.Document, parent uint32, name string, markers []Marker) {
+	if len(markers) == 0 {
+		return
+	}
+	groupIdx := uint32(len(doc.Nodes))
+	doc.Nodes = append(doc.Nodes, &gltf.Node{
+		Name:     name,
+		Children: make([]uint32, 0, len(markers)),
+	})
+	doc.Nodes[parent].Children = append(doc.Nodes[parent].Children, groupIdx)
+	for _, marker := range markers {
+		translation, rotation, scale := marker.ToGLTF()
+		extras := map[string]any{
+			"markerKind": string(marker.Kind),
+			"source":     marker.Source,
+		}
+		if marker.Path != "" {
+			extras["path"] = marker.Path
+		}
+		if marker.UUID != "" {
+			extras["uuid"] = marker.UUID
+		}
+		if marker.Groups != nil {
+			extras["groups"] = marker.Groups
+		}
+		if marker.Metadata != nil {
+			extras["metadata"] = marker.Metadata
+		}
+		if scale == (mgl32.Vec3{}) {
+			scale = mgl32.Vec3{1, 1, 1}
+		}
+		doc.Nodes[groupIdx].Children = append(doc.Nodes[groupIdx].Children, uint32(len(doc.Nodes)))
+		doc.Nodes = append(doc.Nodes, &gltf.Node{
+			Name:        marker.Name,
+			Translation: translation,
+			Rotation:    rotation,
+			Scale:       scale,
+			Extras:      extras,
+		})
+	}
+}
+
+// Adds the markers as empty nodes, grouped by kind, below a
+// "markers" node which is a child of parent. Units with metadata are
+// skipped, as they are already part of the level.
+func AddMarkerNodes(doc *gltf.Document, parent uint32, markers *LevelMarkers) {
+	var spawnPoints, objectives, others []Marker
+	for _, list := range []struct {
+		markers []Marker
+		dst     *[]Marker
+	}{
+		{markers.SpawnPoints, &spawnPoints},
+		{markers.Objectives, &objectives},
+		{markers.Markers, &others},
+	} {
+		for _, marker := range list.markers {
+			if marker.Source != "unit" {
+				*list.dst = append(*list.dst, marker)
+			}
+		}
+	}
+
+	markersIdx := uint32(len(doc.Nodes))
+	doc.Nodes = append(doc.Nodes, &gltf.Node{
+		Name:     "markers",
+		Children: make([]uint32, 0),
+	})
+	doc.Nodes[parent].Children = append(doc.Nodes[parent].Children, markersIdx)
+	addMarkerGroup(doc, markersIdx, "spawn_points", spawnPoints)
+	addMarkerGroup(doc, markersIdx, "objectives", objectives)
+	addMarkerGroup(doc, markersIdx, "markers", others)
+	for _, container := range markers.ExtraUnitContainers {
+		addMarkerGroup(doc, markersIdx, "extra_units_"+path.Base(container.LevelName), slices.Concat(container.Units, container.Prefabs))
+	}
+}
@@ -0,0 +1,307 @@
+package level
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/extractor/gltf_helper"
+	extr_material "github.com/xypwn/filediver/extractor/material"
+	extr_prefab "github.com/xypwn/filediver/extractor/prefab"
+	extr_speedtree "github.com/xypwn/filediver/extractor/speedtree"
+	extr_unit "github.com/xypwn/filediver/extractor/unit"
+	"github.com/xypwn/filediver/extractor/usd"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/level"
+)
+
+// Placement of an asset layer in the level
+type usdInstance struct {
+	Name     string
+	Matrix   mgl32.Mat4
+	Path     string
+	UUID     string
+	Metadata map[string]any
+}
+
+// Writes each distinct unit, prefab and speedtree (with distinct material
+// overrides) of a level as its own usda layer, and references them from
+// the level's layer.
+type usdLevelWriter struct {
+	ctx     *extractor.Context
+	imgOpts *extr_material.ImageOptions
+	// Directory of assets and textures, relative to the level layer
+	dir string
+	// Asset layer file by asset key, empty if the asset failed to export
+	assets   map[string]string
+	textures map[string]bool
+}
+
+func materialOverridesKey(overrides map[stingray.ThinHash]stingray.Hash) string {
+	keys := make([]string, 0, len(overrides))
+	for slot, mat := range overrides {
+		keys = append(keys, slot.String()+"="+mat.String())
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, ",")
+}
+
+func (lw *usdLevelWriter) writeImage(doc *gltf.Document, idx uint32) (string, error) {
+	img := doc.Images[idx]
+	if img.BufferView == nil {
+		return "", nil
+	}
+	data, err := modeler.ReadBufferView(doc, doc.BufferViews[*img.BufferView])
+	if err != nil {
+		return "", err
+	}
+	var ext string
+	switch img.MimeType {
+	case "image/png":
+		ext = ".png"
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/vnd-ms.dds":
+		ext = ".dds"
+	default:
+		ext = path.Ext(img.Name)
+	}
+	sum := sha1.Sum(data)
+	name := hex.EncodeToString(sum[:8]) + ext
+	if !lw.textures[name] {
+		out, err := lw.ctx.CreateFile(".level_usd/textures/" + name)
+		if err != nil {
+			return "", err
+		}
+		_, err = out.Write(data)
+		out.Close()
+		if err != nil {
+			return "", err
+		}
+		lw.textures[name] = true
+	}
+	return "../textures/" + name, nil
+}
+
+// Returns the asset layer of the unit, prefab or speedtree, exporting
+// it if it wasn't already.
+func (lw *usdLevelWriter) asset(id stingray.FileID, overrides map[stingray.ThinHash]stingray.Hash) (string, error) {
+	key := id.Name.String() + "." + id.Type.String() + ":" + materialOverridesKey(overrides)
+	if file, ok := lw.assets[key]; ok {
+		if file == "" {
+			return "", errors.New("export failed previously")
+		}
+		return file, nil
+	}
+	lw.assets[key] = ""
+
+	ctx := lw.ctx.WithFileID(id)
+	doc := extractor.GetDocument(ctx, nil)
+	var err error
+	switch id.Type {
+	case stingray.Sum("unit"):
+		err = extr_unit.ConvertOpts(ctx.WithMaterialOverrides(overrides), lw.imgOpts, doc)
+	case stingray.Sum("speedtree"):
+		err = extr_speedtree.ConvertOpts(ctx, lw.imgOpts, doc)
+	case stingray.Sum("prefab"):
+		_, err = extr_prefab.AddPrefab(ctx, doc, lw.imgOpts)
+	default:
+		err = fmt.Errorf("unsupported asset type %v", ctx.LookupHash(id.Type))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%v_%v_%v", usd.PrimName(path.Base(ctx.LookupHash(id.Name))), id.Name.String(), ctx.LookupHash(id.Type))
+	if overrides != nil {
+		sum := sha1.Sum([]byte(materialOverridesKey(overrides)))
+		name += "_" + hex.EncodeToString(sum[:4])
+	}
+	file := name + ".usda"
+	out, err := lw.ctx.CreateFile(".level_usd/assets/" + file)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if err := usd.WriteLayer(out, doc, lw.writeImage); err != nil {
+		return "", err
+	}
+	lw.assets[key] = file
+	return file, nil
+}
+
+func writeUSDMetadata(w io.Writer, indent string, inst usdInstance) {
+	fmt.Fprintf(w, "%vcustomData = {\n", indent)
+	fmt.Fprintf(w, "%v    string path = %v\n", indent, usd.Quote(inst.Path))
+	if inst.UUID != "" {
+		fmt.Fprintf(w, "%v    string uuid = %v\n", indent, usd.Quote(inst.UUID))
+	}
+	if len(inst.Metadata) > 0 {
+		keys := make([]string, 0, len(inst.Metadata))
+		for key := range inst.Metadata {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		fmt.Fprintf(w, "%v    dictionary metadata = {\n", indent)
+		for _, key := range keys {
+			switch v := inst.Metadata[key].(type) {
+			case uint32:
+				fmt.Fprintf(w, "%v        uint %v = %v\n", indent, usd.Quote(key), v)
+			case float32:
+				fmt.Fprintf(w, "%v        float %v = %v\n", indent, usd.Quote(key), v)
+			case string:
+				fmt.Fprintf(w, "%v        string %v = %v\n", indent, usd.Quote(key), usd.Quote(v))
+			}
+		}
+		fmt.Fprintf(w, "%v    }\n", indent)
+	}
+	fmt.Fprintf(w, "%v}\n", indent)
+}
+
+func (lw *usdLevelWriter) writeInstances(w io.Writer, scope string, instances []usdInstance, files []string) {
+	fmt.Fprintf(w, "    def Scope %v\n", usd.Quote(scope))
+	fmt.Fprintf(w, "    {\n")
+	for i, inst := range instances {
+		if files[i] == "" {
+			continue
+		}
+		fmt.Fprintf(w, "        def Xform %v (\n", usd.Quote(inst.Name))
+		fmt.Fprintf(w, "            instanceable = true\n")
+		fmt.Fprintf(w, "            prepend references = @./%v/%v@\n", lw.dir+"/assets", files[i])
+		writeUSDMetadata(w, "            ", inst)
+		fmt.Fprintf(w, "        )\n")
+		fmt.Fprintf(w, "        {\n")
+		fmt.Fprintf(w, "            matrix4d xformOp:transform = %v\n", usd.FormatMatrix(inst.Matrix))
+		fmt.Fprintf(w, "            uniform token[] xformOpOrder = [\"xformOp:transform\"]\n")
+		fmt.Fprintf(w, "        }\n")
+	}
+	fmt.Fprintf(w, "    }\n")
+}
+
+func instanceMatrix(transform *stingray.Transform) mgl32.Mat4 {
+	translation, rotation, scale := transform.ToGLTF()
+	return gltf_helper.TRSMatrix(translation, rotation, scale)
+}
+
+// Exports the level as a usda stage which references a layer
+// for each distinct unit, prefab and speedtree.
+func ConvertUSD(ctx *extractor.Context) error {
+	r, err := ctx.Open(ctx.FileID(), stingray.DataMain)
+	if err != nil {
+		return err
+	}
+	levelData, err := level.LoadLevel(r)
+	if err != nil {
+		return err
+	}
+	imgOpts, err := extr_material.GetImageOpts(ctx)
+	if err != nil {
+		return err
+	}
+
+	levelName := path.Base(ctx.LookupHash(ctx.FileID().Name))
+	lw := &usdLevelWriter{
+		ctx:      ctx,
+		imgOpts:  imgOpts,
+		dir:      levelName + ".level_usd",
+		assets:   make(map[string]string),
+		textures: make(map[string]bool),
+	}
+
+	totalObjectCount := float32(len(levelData.Units) + len(levelData.Prefabs) + len(levelData.Speedtrees))
+	objectCount := 0
+	addInstance := func(id stingray.FileID, overrides map[stingray.ThinHash]stingray.Hash) string {
+		objectCount++
+		if ctx.FileID() == ctx.RootFileID() {
+			ctx.Statusf("%.2f%% - %v.%v", 100*float32(objectCount)/totalObjectCount, ctx.LookupHash(id.Name), ctx.LookupHash(id.Type))
+		}
+		file, err := lw.asset(id, overrides)
+		if err != nil {
+			ctx.Warnf("%v.%v: %v", ctx.LookupHash(id.Name), ctx.LookupHash(id.Type), err)
+		}
+		return file
+	}
+	instanceName := func(hash stingray.Hash, idx int) string {
+		return fmt.Sprintf("%v_%v", usd.PrimName(path.Base(ctx.LookupHash(hash))), idx)
+	}
+
+	var prefabs, units, speedtrees []usdInstance
+	var prefabFiles, unitFiles, speedtreeFiles []string
+	for idx, prefab := range levelData.Prefabs {
+		if ctxErr := ctx.Ctx().Err(); errors.Is(ctxErr, context.Canceled) {
+			return ctxErr
+		}
+		prefabs = append(prefabs, usdInstance{
+			Name:   instanceName(prefab.Path, idx),
+			Matrix: instanceMatrix(&prefab.Transform),
+			Path:   ctx.LookupHash(prefab.Path),
+			UUID:   ctx.LookupHash(prefab.UUIDHash),
+		})
+		prefabFiles = append(prefabFiles, addInstance(stingray.NewFileID(prefab.Path, stingray.Sum("prefab")), nil))
+	}
+	for idx, unit := range levelData.Units {
+		if ctxErr := ctx.Ctx().Err(); errors.Is(ctxErr, context.Canceled) {
+			return ctxErr
+		}
+		metadata := level.MetadataValues(levelData.Metadata[idx], ctx.LookupThinHash)
+		units = append(units, usdInstance{
+			Name:     instanceName(unit.Path(), idx),
+			Matrix:   instanceMatrix(&unit.Transform),
+			Path:     ctx.LookupHash(unit.Path()),
+			UUID:     ctx.LookupHash(unit.UUIDHash),
+			Metadata: metadata,
+		})
+		unitFiles = append(unitFiles, addInstance(stingray.NewFileID(unit.Path(), stingray.Sum("unit")), levelData.MaterialOverrides[idx]))
+	}
+	for _, speedtree := range levelData.Speedtrees {
+		if ctxErr := ctx.Ctx().Err(); errors.Is(ctxErr, context.Canceled) {
+			return ctxErr
+		}
+		file := addInstance(stingray.NewFileID(speedtree.Path(), stingray.Sum("speedtree")), nil)
+		for _, transform := range speedtree.Transforms {
+			speedtrees = append(speedtrees, usdInstance{
+				Name: instanceName(speedtree.Path(), len(speedtrees)),
+				Matrix: instanceMatrix(&stingray.Transform{
+					PositionVec: transform.Position.Vec3(),
+					RotationVec: transform.MinRotation,
+					ScaleVec:    mgl32.Vec3{1, 1, 1},
+				}),
+				Path: ctx.LookupHash(speedtree.Path()),
+			})
+			speedtreeFiles = append(speedtreeFiles, file)
+		}
+	}
+
+	out, err := ctx.CreateFile(".level.usda")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	rootPrim := usd.PrimName(levelName)
+	usd.WriteHeader(w, rootPrim)
+	fmt.Fprintf(w, "def Xform %v (\n", usd.Quote(rootPrim))
+	fmt.Fprintf(w, "    kind = \"assembly\"\n")
+	fmt.Fprintf(w, ")\n")
+	fmt.Fprintf(w, "{\n")
+	lw.writeInstances(w, "Prefabs", prefabs, prefabFiles)
+	lw.writeInstances(w, "Units", units, unitFiles)
+	lw.writeInstances(w, "Speedtrees", speedtrees, speedtreeFiles)
+	fmt.Fprintf(w, "}\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	ctx.Statusf("Done")
+	return nil
+}
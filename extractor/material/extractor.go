@@ -7,7 +7,6 @@ import (
 	"image"
 	"image/jpeg"
 	"image/png"
-	"io"
 	"math"
 	"path/filepath"
 	"slices"
@@ -791,6 +790,13 @@ func checkBuildingShaderDecalUV(ctx *extractor.Context, mat *material.Material)
 func AddMaterial(ctx *extractor.Context, mat *material.Material, doc *gltf.Document, imgOpts *ImageOptions, matName string, unitData *datalib.UnitData) (uint32, error) {
 	cfg := ctx.Config()
 
+	// Include the textures and settings inherited from base materials
+	if resolved, err := material.Resolve(ctx, stingray.Hash{}, mat); err != nil {
+		ctx.Warnf("resolving base materials of %v: %v", matName, err)
+	} else {
+		mat = resolved.Effective()
+	}
+
 	// Avoid duplicating material if it already is added to document
 	for i := range doc.Materials {
 		if compareMaterials(ctx, doc, mat, uint32(i), matName, unitData) {
@@ -1794,7 +1800,13 @@ func ConvertToFolder(ctx *extractor.Context) error {
 		return err
 	}
 
-	for _, texture := range mat.Textures {
+	resolved, err := material.Resolve(ctx, ctx.FileID().Name, mat)
+	if err != nil {
+		return err
+	}
+
+	textureFiles := make(map[stingray.Hash]string)
+	for _, texture := range resolved.Effective().Textures {
 		id := stingray.NewFileID(texture, stingray.Sum("texture"))
 		var data []byte
 		var err error
@@ -1829,29 +1841,27 @@ func ConvertToFolder(ctx *extractor.Context) error {
 		if err != nil {
 			return err
 		}
+		textureFiles[texture] = filepath.ToSlash(texName + "." + cfg.Material.TexturesFormat)
 	}
 
-	if cfg.Material.ShaderFormat == "none" {
-		return nil
+	matGpu, gpuErr := loadMaterialGPU(ctx, mat)
+	if gpuErr != nil {
+		ctx.Warnf("loading shader programs: %v", gpuErr)
 	}
 
-	var fGpu io.ReadSeeker
-	fileID := ctx.FileID()
-	if mat.BaseMaterial.Value == 0 {
-		fGpu, err = ctx.Open(fileID, stingray.DataGPU)
-	} else {
-		fileID = stingray.NewFileID(mat.BaseMaterial, stingray.Sum("material"))
-		fGpu, err = ctx.Open(fileID, stingray.DataGPU)
-	}
+	out, err := ctx.CreateFile(filepath.Join(".dir", "material.json"))
 	if err != nil {
 		return err
 	}
-
-	matGpu, err := material.LoadGPU(fGpu)
-	if err != nil {
+	defer out.Close()
+	if err := writeSimpleMaterial(out, buildSimpleMaterial(ctx, resolved, matGpu, textureFiles)); err != nil {
 		return err
 	}
 
+	if cfg.Material.ShaderFormat == "none" || gpuErr != nil {
+		return nil
+	}
+
 	for blk, shaderProgram := range matGpu.ShaderPrograms.ProgramBlocks {
 		for i := range shaderProgram.Programs {
 
@@ -1887,15 +1897,21 @@ func ConvertToFolder(ctx *extractor.Context) error {
 					defer out.Close()
 
 					var data []uint8
-					if cfg.Material.ShaderFormat == "glsl" {
+					switch cfg.Material.ShaderFormat {
+					case "glsl", "hlsl":
 						defer func() {
 							if r := recover(); r != nil {
 								ctx.Warnf("shader %v.%v failed to extract: %v (skipped)", name, cfg.Material.ShaderFormat+"."+suffixArray[0]+"e", r)
 							}
 						}()
-						glslCode := shaderProgram.Programs[i].DomainShader.ToGLSL()
-						data = []uint8(glslCode)
-					} else {
+						var code string
+						if cfg.Material.ShaderFormat == "glsl" {
+							code = shaderProgram.Programs[i].DomainShader.ToGLSL()
+						} else {
+							code = shaderProgram.Programs[i].DomainShader.ToHLSL()
+						}
+						data = []uint8(code)
+					default:
 						data, err = shaderProgram.Programs[i].DomainShader.Serialize()
 						if err != nil {
 							return err
@@ -1926,15 +1942,21 @@ func ConvertToFolder(ctx *extractor.Context) error {
 				defer out.Close()
 
 				var data []uint8
-				if cfg.Material.ShaderFormat == "glsl" {
+				switch cfg.Material.ShaderFormat {
+				case "glsl", "hlsl":
 					defer func() {
 						if r := recover(); r != nil {
 							ctx.Warnf("shader %v.%v failed to extract: %v (skipped)", name, suffix, r)
 						}
 					}()
-					glslCode := shaders[j].ToGLSL()
-					data = []uint8(glslCode)
-				} else {
+					var code string
+					if cfg.Material.ShaderFormat == "glsl" {
+						code = shaders[j].ToGLSL()
+					} else {
+						code = shaders[j].ToHLSL()
+					}
+					data = []uint8(code)
+				default:
 					data, err = shaders[j].Serialize()
 					if err != nil {
 						return err
@@ -0,0 +1,324 @@
+package material
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/unit/material"
+	d3dops "github.com/xypwn/filediver/stingray/unit/material/d3d/opcodes"
+)
+
+type SimpleMaterialSetting struct {
+	Name  string `json:"name"`
+	Hash  string `json:"hash"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+	// Index into base_materials of the material which set the value,
+	// 0 being this material
+	Level     int    `json:"level"`
+	DefinedBy string `json:"defined_by"`
+	// Constant buffer variable the setting is uploaded to, if it is known
+	ConstantBuffer string  `json:"constant_buffer,omitempty"`
+	Offset         *uint32 `json:"offset,omitempty"`
+}
+
+type SimpleMaterialSampler struct {
+	Name       string `json:"name"`
+	Register   uint32 `json:"register"`
+	Comparison bool   `json:"comparison,omitempty"`
+}
+
+type SimpleMaterialTextureSlot struct {
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+	Texture   string `json:"texture"`
+	Level     int    `json:"level"`
+	DefinedBy string `json:"defined_by"`
+	// Path of the exported texture relative to material.json, if it was exported
+	File       string                  `json:"file,omitempty"`
+	ShaderName string                  `json:"shader_name,omitempty"`
+	Register   *uint32                 `json:"register,omitempty"`
+	Samplers   []SimpleMaterialSampler `json:"samplers,omitempty"`
+	// Raw sampler state key/value pairs of the shader program
+	SamplerAttributes [][2]string `json:"sampler_attributes,omitempty"`
+}
+
+type SimpleConstantBufferVariable struct {
+	Name     string    `json:"name"`
+	Offset   uint32    `json:"offset"`
+	Size     uint32    `json:"size"`
+	Type     string    `json:"type"`
+	Elements uint16    `json:"elements,omitempty"`
+	Used     bool      `json:"used"`
+	Default  []float32 `json:"default,omitempty"`
+}
+
+type SimpleConstantBuffer struct {
+	Name      string                         `json:"name"`
+	Size      uint32                         `json:"size"`
+	Register  uint32                         `json:"register"`
+	Stages    []string                       `json:"stages"`
+	Variables []SimpleConstantBufferVariable `json:"variables"`
+}
+
+type SimpleMaterial struct {
+	Name string `json:"name"`
+	// The material itself followed by its base material, the base
+	// material of that and so on
+	BaseMaterials []string `json:"base_materials"`
+	// Base material which couldn't be found, ending the chain early
+	MissingBaseMaterial string                      `json:"missing_base_material,omitempty"`
+	Settings            []SimpleMaterialSetting     `json:"settings"`
+	Textures            []SimpleMaterialTextureSlot `json:"textures"`
+	ConstantBuffers     []SimpleConstantBuffer      `json:"constant_buffers"`
+}
+
+// loadMaterialGPU loads the shader programs of a material, which are
+// stored in its base material if it has one.
+func loadMaterialGPU(ctx *extractor.Context, mat *material.Material) (*material.MaterialGPU, error) {
+	fileID := ctx.FileID()
+	if mat.BaseMaterial.Value != 0 {
+		fileID = stingray.NewFileID(mat.BaseMaterial, stingray.Sum("material"))
+	}
+	fGpu, err := ctx.Open(fileID, stingray.DataGPU)
+	if err != nil {
+		return nil, err
+	}
+	return material.LoadGPU(fGpu)
+}
+
+func settingValue(typ material.SettingsType, value []float32) any {
+	if typ == material.SettingTypeScalar && len(value) == 1 {
+		return value[0]
+	}
+	return value
+}
+
+func defaultValue(data []byte) []float32 {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return nil
+	}
+	values := make([]float32, len(data)/4)
+	if _, err := binary.Decode(data, binary.LittleEndian, values); err != nil {
+		return nil
+	}
+	return values
+}
+
+// buildSimpleMaterial describes a resolved material and the shader
+// resources of its programs. textureFiles maps texture hashes to their
+// exported paths.
+func buildSimpleMaterial(ctx *extractor.Context, resolved *material.ResolvedMaterial, matGpu *material.MaterialGPU, textureFiles map[stingray.Hash]string) SimpleMaterial {
+	result := SimpleMaterial{
+		Name:            ctx.LookupHash(ctx.FileID().Name),
+		BaseMaterials:   make([]string, 0, len(resolved.Chain)),
+		Settings:        make([]SimpleMaterialSetting, 0),
+		Textures:        make([]SimpleMaterialTextureSlot, 0),
+		ConstantBuffers: make([]SimpleConstantBuffer, 0),
+	}
+	for _, name := range resolved.Chain {
+		result.BaseMaterials = append(result.BaseMaterials, ctx.LookupHash(name))
+	}
+	if resolved.Missing.Value != 0 {
+		result.MissingBaseMaterial = ctx.LookupHash(resolved.Missing)
+	}
+
+	// Names from the shaders resolve hashes missing from the hash list
+	shaderNames := make(map[stingray.ThinHash]string)
+	lookup := func(hash stingray.ThinHash) string {
+		if name, ok := ctx.ThinHashes()[hash]; ok {
+			return name
+		}
+		if name, ok := shaderNames[hash]; ok {
+			return name
+		}
+		return hash.String()
+	}
+
+	type variableLocation struct {
+		cbuffer string
+		offset  uint32
+	}
+	variables := make(map[stingray.ThinHash]variableLocation)
+	cbufferIdx := make(map[string]int)
+	type textureBinding struct {
+		shaderName string
+		register   uint32
+		samplers   []SimpleMaterialSampler
+	}
+	textureBindings := make(map[stingray.ThinHash]*textureBinding)
+	samplerAttrs := make(map[stingray.ThinHash][][2]uint64)
+
+	var programs []material.ShaderProgram
+	if matGpu != nil && matGpu.ShaderPrograms != nil {
+		for _, block := range matGpu.ShaderPrograms.ProgramBlocks {
+			programs = append(programs, block.Programs...)
+		}
+	}
+	for _, program := range programs {
+		for j, attr := range program.TextureAttrs {
+			if _, ok := samplerAttrs[attr.TextureHash]; !ok && j < len(program.SamplerAttrs) {
+				samplerAttrs[attr.TextureHash] = program.SamplerAttrs[j].Attributes
+			}
+		}
+		for _, s := range program.Stages() {
+			rdef := s.Shader.ResourceDefinitions
+			for _, cb := range rdef.ConstantBuffers {
+				if cb.Type != d3dops.CT_CBUFFER {
+					continue
+				}
+				if idx, ok := cbufferIdx[cb.Name]; ok {
+					if !slices.Contains(result.ConstantBuffers[idx].Stages, s.Stage) {
+						result.ConstantBuffers[idx].Stages = append(result.ConstantBuffers[idx].Stages, s.Stage)
+					}
+					continue
+				}
+				simple := SimpleConstantBuffer{
+					Name:      cb.Name,
+					Size:      cb.Size,
+					Stages:    []string{s.Stage},
+					Variables: make([]SimpleConstantBufferVariable, 0, len(cb.Variables)),
+				}
+				for _, rb := range rdef.ResourceBindings {
+					if rb.InputType == d3dops.CBUFFER && rb.Name == cb.Name {
+						simple.Register = rb.BindPoint
+					}
+				}
+				for _, v := range cb.Variables {
+					typ := v.HLSLType()
+					if typ == "" {
+						typ = v.VariableType.Name
+					}
+					simple.Variables = append(simple.Variables, SimpleConstantBufferVariable{
+						Name:     v.Name,
+						Offset:   v.BufferOffset,
+						Size:     v.Size,
+						Type:     typ,
+						Elements: v.Elements,
+						Used:     v.Flags&0x2 != 0, // D3D_SVF_USED
+						Default:  defaultValue(v.DefaultData),
+					})
+					hash := stingray.Sum(v.Name).Thin()
+					shaderNames[hash] = v.Name
+					if _, ok := variables[hash]; !ok {
+						variables[hash] = variableLocation{cb.Name, v.BufferOffset}
+					}
+				}
+				cbufferIdx[cb.Name] = len(result.ConstantBuffers)
+				result.ConstantBuffers = append(result.ConstantBuffers, simple)
+			}
+
+			texSamplers := d3dops.TextureSamplers(s.Shader.ShaderCode.Opcodes)
+			for _, meta := range s.Shader.TexMetadata {
+				binding, ok := textureBindings[meta.Name]
+				if !ok {
+					binding = &textureBinding{register: meta.Register}
+					textureBindings[meta.Name] = binding
+				}
+				for _, rb := range rdef.ResourceBindings {
+					if rb.InputType == d3dops.TEXTURE && rb.BindPoint == meta.Register {
+						binding.shaderName = rb.Name
+						shaderNames[meta.Name] = rb.Name
+					}
+				}
+				for _, sampler := range texSamplers[meta.Register] {
+					for _, rb := range rdef.ResourceBindings {
+						if rb.InputType != d3dops.SAMPLER || rb.BindPoint != sampler {
+							continue
+						}
+						if slices.ContainsFunc(binding.samplers, func(s SimpleMaterialSampler) bool { return s.Name == rb.Name }) {
+							continue
+						}
+						binding.samplers = append(binding.samplers, SimpleMaterialSampler{
+							Name:       rb.Name,
+							Register:   rb.BindPoint,
+							Comparison: rb.Flags&d3dops.SIF_COMPARISON_SAMPLER != 0,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	for _, usage := range resolved.SortedSettings() {
+		value := resolved.Settings[usage]
+		setting := SimpleMaterialSetting{
+			Name:      lookup(usage),
+			Hash:      usage.String(),
+			Type:      value.Type.String(),
+			Value:     settingValue(value.Type, value.Value),
+			Level:     value.Level,
+			DefinedBy: result.BaseMaterials[value.Level],
+		}
+		if loc, ok := variables[usage]; ok {
+			setting.ConstantBuffer = loc.cbuffer
+			setting.Offset = &loc.offset
+		}
+		result.Settings = append(result.Settings, setting)
+	}
+
+	for _, usage := range resolved.SortedTextures() {
+		texture := resolved.Textures[usage].Texture
+		slot := SimpleMaterialTextureSlot{
+			Name:      lookup(usage),
+			Hash:      usage.String(),
+			Texture:   ctx.LookupHash(texture),
+			Level:     resolved.Textures[usage].Level,
+			DefinedBy: result.BaseMaterials[resolved.Textures[usage].Level],
+			File:      textureFiles[texture],
+		}
+		if binding, ok := textureBindings[usage]; ok {
+			slot.ShaderName = binding.shaderName
+			slot.Register = &binding.register
+			slot.Samplers = binding.samplers
+		}
+		for _, attr := range samplerAttrs[usage] {
+			slot.SamplerAttributes = append(slot.SamplerAttributes, [2]string{
+				fmt.Sprintf("0x%016x", attr[0]),
+				fmt.Sprintf("0x%016x", attr[1]),
+			})
+		}
+		result.Textures = append(result.Textures, slot)
+	}
+
+	return result
+}
+
+func writeSimpleMaterial(out io.Writer, simple SimpleMaterial) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "    ")
+	return enc.Encode(simple)
+}
+
+// ConvertToJSON writes the settings, texture slots and shader constant
+// buffer layout of a material.
+func ConvertToJSON(ctx *extractor.Context) error {
+	fMain, err := ctx.Open(ctx.FileID(), stingray.DataMain)
+	if err != nil {
+		return err
+	}
+	mat, err := material.LoadMain(fMain)
+	if err != nil {
+		return err
+	}
+	resolved, err := material.Resolve(ctx, ctx.FileID().Name, mat)
+	if err != nil {
+		return err
+	}
+	matGpu, err := loadMaterialGPU(ctx, mat)
+	if err != nil {
+		ctx.Warnf("loading shader programs: %v", err)
+	}
+
+	out, err := ctx.CreateFile(".material.json")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return writeSimpleMaterial(out, buildSimpleMaterial(ctx, resolved, matGpu, nil))
+}
@@ -1,12 +1,52 @@
 package physics
 
 import (
-	"fmt"
+	"encoding/json"
 
 	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/physics"
 )
 
-// Todo: add physics support
-func ExtractPhysics(ctx *extractor.Context) error {
-	return fmt.Errorf("not implemented")
+func loadPhysics(ctx *extractor.Context, id stingray.FileID) (*physics.Physics, error) {
+	r, err := ctx.Open(id, stingray.DataMain)
+	if err != nil {
+		return nil, err
+	}
+	return physics.LoadPhysics(r)
+}
+
+// The parts of a physics resource which aren't decoded yet, so
+// readers of the JSON don't mistake their absence for missing data.
+var undecodedPhysics = []string{"actors", "primitive_shapes", "shape_poses", "materials"}
+
+type physicsJSON struct {
+	*physics.Physics
+	// Space of the mesh vertices
+	MeshSpace string   `json:"mesh_space"`
+	Undecoded []string `json:"undecoded"`
+}
+
+// ExtractPhysicsJSON writes the header and cooked collision meshes of
+// the physics resource. As the actor and shape poses aren't decoded,
+// the meshes are in the local space of their shapes, and can't be
+// exported as placed collision shapes.
+func ExtractPhysicsJSON(ctx *extractor.Context) error {
+	phys, err := loadPhysics(ctx, ctx.FileID())
+	if err != nil {
+		return err
+	}
+
+	out, err := ctx.CreateFile(".physics.json")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "    ")
+	return enc.Encode(physicsJSON{
+		Physics:   phys,
+		MeshSpace: "shape_local",
+		Undecoded: undecodedPhysics,
+	})
 }
@@ -0,0 +1,259 @@
+package state_machine
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/state_machine"
+)
+
+type graphState struct {
+	ID      string
+	Name    string
+	Default bool
+	// Additional lines describing the state
+	Lines []string
+}
+
+type graphLink struct {
+	From, To string
+	Label    string
+}
+
+type graphLayer struct {
+	ID     string
+	Name   string
+	States []graphState
+	Links  []graphLink
+}
+
+// Parses the comma-separated name=value list of animation variable values.
+func parseVariableOverrides(ctx *extractor.Context, s string) map[stingray.ThinHash]float32 {
+	overrides := make(map[stingray.ThinHash]float32)
+	for item := range strings.SplitSeq(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, valueS, ok := strings.Cut(item, "=")
+		if !ok {
+			ctx.Warnf("animation variable %q: expected name=value", item)
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(valueS), 32)
+		if err != nil {
+			ctx.Warnf("animation variable %q: %v", item, err)
+			continue
+		}
+		name = strings.TrimSpace(name)
+		hash := stingray.Sum(strings.TrimPrefix(name, state_machine.VariableNamePrefix)).Thin()
+		if strings.HasPrefix(name, "0x") {
+			hash, err = stingray.ParseThinHash(name)
+			if err != nil {
+				ctx.Warnf("animation variable %q: %v", item, err)
+				continue
+			}
+		}
+		overrides[hash] = float32(value)
+	}
+	return overrides
+}
+
+func linkLabel(ctx *extractor.Context, event stingray.ThinHash, link state_machine.Link) string {
+	label := ctx.LookupThinHash(event)
+	details := []string{strings.TrimPrefix(link.Type.String(), "LinkType_")}
+	if link.BlendTime > 0 {
+		details = append(details, fmt.Sprintf("%gs", link.BlendTime))
+	}
+	if link.Type == state_machine.LinkType_WaitUntilBeat || link.Type == state_machine.LinkType_SyncBeatClosestImmediate {
+		if link.Beat.Value != 0 {
+			details = append(details, "beat "+ctx.LookupThinHash(link.Beat))
+		}
+	}
+	return fmt.Sprintf("%v (%v)", label, strings.Join(details, ", "))
+}
+
+func animationName(ctx *extractor.Context, hash stingray.Hash) string {
+	return filepath.Base(ctx.LookupHash(hash))
+}
+
+func buildGraph(ctx *extractor.Context, sm *state_machine.StateMachine) []graphLayer {
+	variableNames := make([]string, len(sm.AnimationVariableNames))
+	for i, hash := range sm.AnimationVariableNames {
+		variableNames[i] = ctx.LookupThinHash(hash)
+	}
+	variables := sm.DefaultVariables(parseVariableOverrides(ctx, ctx.Config().StateMachine.Variables))
+
+	layers := make([]graphLayer, 0, len(sm.Layers))
+	for layerIdx, layer := range sm.Layers {
+		gl := graphLayer{
+			ID:   fmt.Sprintf("layer%v", layerIdx),
+			Name: fmt.Sprintf("Layer %v", layerIdx),
+		}
+		stateID := func(idx uint32) string {
+			return fmt.Sprintf("l%v_s%v", layerIdx, idx)
+		}
+
+		for stateIdx, state := range layer.States {
+			gs := graphState{
+				ID:      stateID(uint32(stateIdx)),
+				Name:    ctx.LookupHash(state.Name),
+				Default: uint32(stateIdx) == layer.DefaultState,
+			}
+			var flags []string
+			flags = append(flags, strings.ToLower(strings.TrimPrefix(state.Type.String(), "StateType_")))
+			if state.Loop {
+				flags = append(flags, "loop")
+			}
+			if state.Additive {
+				flags = append(flags, "additive")
+			}
+			gs.Lines = append(gs.Lines, "["+strings.Join(flags, ", ")+"]")
+
+			speedFunc, influences := state.BlendFunctions()
+			speed, weights, err := state.EvaluateBlend(variables)
+			if err != nil {
+				ctx.Warnf("state %v: evaluating blend functions: %v", gs.Name, err)
+			}
+			if speedFunc != nil && err == nil {
+				expr, _ := speedFunc.Describe(variableNames)
+				gs.Lines = append(gs.Lines, fmt.Sprintf("speed = %v = %.3g", expr, speed))
+			}
+			for i, anim := range state.AnimationHashes {
+				line := animationName(ctx, anim)
+				if i < len(influences) {
+					if expr, err := influences[i].Describe(variableNames); err == nil {
+						line += ": " + expr
+					}
+				}
+				if len(state.AnimationHashes) > 1 && i < len(weights) {
+					line += fmt.Sprintf(" = %.3g", weights[i])
+				}
+				gs.Lines = append(gs.Lines, line)
+			}
+			if state.Type == state_machine.StateType_Time && state.BlendVariableIndex < uint32(len(variableNames)) {
+				gs.Lines = append(gs.Lines, "time: "+variableNames[state.BlendVariableIndex])
+			}
+			if state.EmitEndEvent.Value != 0 {
+				gs.Lines = append(gs.Lines, "emits "+ctx.LookupThinHash(state.EmitEndEvent))
+			}
+			gl.States = append(gl.States, gs)
+
+			events := make([]stingray.ThinHash, 0, len(state.StateTransitions))
+			for event := range state.StateTransitions {
+				events = append(events, event)
+			}
+			slices.SortFunc(events, func(a, b stingray.ThinHash) int {
+				return cmp.Compare(ctx.LookupThinHash(a), ctx.LookupThinHash(b))
+			})
+			for _, event := range events {
+				link := state.StateTransitions[event]
+				if link.Index >= uint32(len(layer.States)) {
+					continue
+				}
+				gl.Links = append(gl.Links, graphLink{
+					From:  gs.ID,
+					To:    stateID(link.Index),
+					Label: linkLabel(ctx, event, link),
+				})
+			}
+		}
+		layers = append(layers, gl)
+	}
+	return layers
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeDot(w *bufio.Writer, name string, layers []graphLayer) {
+	fmt.Fprintf(w, "digraph \"%v\" {\n", dotEscaper.Replace(name))
+	fmt.Fprintf(w, "\trankdir=LR;\n")
+	fmt.Fprintf(w, "\tnode [shape=box, fontname=\"monospace\"];\n")
+	fmt.Fprintf(w, "\tedge [fontname=\"monospace\", fontsize=10];\n")
+	for _, layer := range layers {
+		fmt.Fprintf(w, "\tsubgraph cluster_%v {\n", layer.ID)
+		fmt.Fprintf(w, "\t\tlabel=\"%v\";\n", dotEscaper.Replace(layer.Name))
+		for _, state := range layer.States {
+			label := strings.Join(append([]string{state.Name}, state.Lines...), "\n")
+			attrs := fmt.Sprintf("label=\"%v\"", dotEscaper.Replace(label))
+			if state.Default {
+				attrs += ", peripheries=2"
+			}
+			fmt.Fprintf(w, "\t\t%v [%v];\n", state.ID, attrs)
+		}
+		for _, link := range layer.Links {
+			fmt.Fprintf(w, "\t\t%v -> %v [label=\"%v\"];\n", link.From, link.To, dotEscaper.Replace(link.Label))
+		}
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// Characters with special meaning are written as Mermaid entity codes
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", ":", "#58;", ";", "#59;", "{", "#123;", "}", "#125;", "\n", "<br/>")
+
+func writeMermaid(w *bufio.Writer, layers []graphLayer) {
+	fmt.Fprintf(w, "stateDiagram-v2\n")
+	for _, layer := range layers {
+		fmt.Fprintf(w, "\tstate \"%v\" as %v {\n", mermaidEscaper.Replace(layer.Name), layer.ID)
+		for _, state := range layer.States {
+			fmt.Fprintf(w, "\t\tstate \"%v\" as %v\n", mermaidEscaper.Replace(state.Name), state.ID)
+			for _, line := range state.Lines {
+				fmt.Fprintf(w, "\t\t%v : %v\n", state.ID, mermaidEscaper.Replace(line))
+			}
+			if state.Default {
+				fmt.Fprintf(w, "\t\t[*] --> %v\n", state.ID)
+			}
+		}
+		for _, link := range layer.Links {
+			fmt.Fprintf(w, "\t\t%v --> %v : %v\n", link.From, link.To, mermaidEscaper.Replace(link.Label))
+		}
+		fmt.Fprintf(w, "\t}\n")
+	}
+}
+
+// Exports a graph of the state machine's layers, states and transitions
+// in either the "dot" (Graphviz) or "mermaid" format.
+func ExtractStateMachineGraph(format string) extractor.ExtractFunc {
+	return func(ctx *extractor.Context) error {
+		r, err := ctx.Open(ctx.FileID(), stingray.DataMain)
+		if err != nil {
+			return err
+		}
+		stateMachine, err := state_machine.LoadStateMachine(r)
+		if err != nil {
+			return err
+		}
+		layers := buildGraph(ctx, stateMachine)
+
+		var suffix string
+		switch format {
+		case "dot":
+			suffix = ".state_machine.dot"
+		case "mermaid":
+			suffix = ".state_machine.mmd"
+		default:
+			return fmt.Errorf("unknown state machine graph format %q", format)
+		}
+		out, err := ctx.CreateFile(suffix)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		w := bufio.NewWriter(out)
+		switch format {
+		case "dot":
+			writeDot(w, ctx.LookupHash(ctx.FileID().Name), layers)
+		case "mermaid":
+			writeMermaid(w, layers)
+		}
+		return w.Flush()
+	}
+}
@@ -0,0 +1,175 @@
+package staticmesh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/qmuntal/gltf"
+)
+
+var objNameReplacer = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_")
+
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
+
+// Returns the unique MTL name of each material.
+func materialNames(doc *gltf.Document) []string {
+	names := make([]string, len(doc.Materials))
+	used := make(map[string]bool)
+	for i, mat := range doc.Materials {
+		name := objNameReplacer.Replace(mat.Name)
+		if name == "" {
+			name = fmt.Sprintf("material_%v", i)
+		}
+		for n := 1; used[name]; n++ {
+			name = fmt.Sprintf("%v_%v", objNameReplacer.Replace(mat.Name), n)
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+func writeMTL(w *bufio.Writer, doc *gltf.Document, names []string, writeImage ImageWriter) error {
+	imagePaths := make(map[uint32]string)
+	texturePath := func(texture uint32) (string, error) {
+		if int(texture) >= len(doc.Textures) || doc.Textures[texture].Source == nil {
+			return "", nil
+		}
+		image := *doc.Textures[texture].Source
+		if path, ok := imagePaths[image]; ok {
+			return path, nil
+		}
+		path, err := writeImage(doc, image)
+		if err != nil {
+			return "", err
+		}
+		imagePaths[image] = path
+		return path, nil
+	}
+
+	for i, mat := range doc.Materials {
+		pbr := mat.PBRMetallicRoughness
+		if pbr == nil {
+			pbr = &gltf.PBRMetallicRoughness{}
+		}
+		color := pbr.BaseColorFactorOrDefault()
+		fmt.Fprintf(w, "newmtl %v\n", names[i])
+		fmt.Fprintf(w, "Kd %v %v %v\n", formatFloat(color[0]), formatFloat(color[1]), formatFloat(color[2]))
+		if color[3] < 1 {
+			fmt.Fprintf(w, "d %v\n", formatFloat(color[3]))
+		}
+		fmt.Fprintf(w, "Ke %v %v %v\n", formatFloat(mat.EmissiveFactor[0]), formatFloat(mat.EmissiveFactor[1]), formatFloat(mat.EmissiveFactor[2]))
+		fmt.Fprintf(w, "Pm %v\n", formatFloat(pbr.MetallicFactorOrDefault()))
+		fmt.Fprintf(w, "Pr %v\n", formatFloat(pbr.RoughnessFactorOrDefault()))
+
+		maps := []struct {
+			Statement string
+			Texture   *gltf.TextureInfo
+		}{
+			{"map_Kd", pbr.BaseColorTexture},
+			{"map_Pr", pbr.MetallicRoughnessTexture},
+			{"map_Ke", mat.EmissiveTexture},
+		}
+		if mat.NormalTexture != nil && mat.NormalTexture.Index != nil {
+			maps = append(maps, struct {
+				Statement string
+				Texture   *gltf.TextureInfo
+			}{"norm", &gltf.TextureInfo{Index: *mat.NormalTexture.Index}})
+		}
+		for _, m := range maps {
+			if m.Texture == nil {
+				continue
+			}
+			path, err := texturePath(m.Texture.Index)
+			if err != nil {
+				return fmt.Errorf("material %v: %w", mat.Name, err)
+			}
+			if path == "" {
+				continue
+			}
+			if m.Statement == "map_Pr" {
+				// gltf stores roughness in the green channel
+				fmt.Fprintf(w, "map_Pr -imfchan g %v\n", path)
+				fmt.Fprintf(w, "map_Pm -imfchan b %v\n", path)
+			} else {
+				fmt.Fprintf(w, "%v %v\n", m.Statement, path)
+			}
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	return nil
+}
+
+// Writes the document's meshes with baked transforms as a Wavefront OBJ to
+// objW, and their materials to mtlW, which objW references as mtlName.
+func WriteOBJ(objW, mtlW io.Writer, mtlName string, doc *gltf.Document, writeImage ImageWriter) error {
+	batches, err := Flatten(doc)
+	if err != nil {
+		return err
+	}
+	names := materialNames(doc)
+
+	w := bufio.NewWriter(objW)
+	fmt.Fprintf(w, "# %v\n", doc.Asset.Generator)
+	if len(doc.Materials) > 0 {
+		fmt.Fprintf(w, "mtllib %v\n", mtlName)
+	}
+	// OBJ indices are 1-based and global
+	var posBase, normBase, uvBase int
+	for _, b := range batches {
+		fmt.Fprintf(w, "o %v\n", objNameReplacer.Replace(b.Name))
+		for i, p := range b.Positions {
+			fmt.Fprintf(w, "v %v %v %v", formatFloat(p[0]), formatFloat(p[1]), formatFloat(p[2]))
+			if b.Colors != nil {
+				c := b.Colors[i]
+				fmt.Fprintf(w, " %v %v %v", formatFloat(float32(c[0])/255), formatFloat(float32(c[1])/255), formatFloat(float32(c[2])/255))
+			}
+			w.WriteByte('\n')
+		}
+		for _, uv := range b.TexCoords {
+			// OBJ's texture origin is at the bottom
+			fmt.Fprintf(w, "vt %v %v\n", formatFloat(uv[0]), formatFloat(1-uv[1]))
+		}
+		for _, n := range b.Normals {
+			fmt.Fprintf(w, "vn %v %v %v\n", formatFloat(n[0]), formatFloat(n[1]), formatFloat(n[2]))
+		}
+		if b.Material != nil && int(*b.Material) < len(names) {
+			fmt.Fprintf(w, "usemtl %v\n", names[*b.Material])
+		}
+		vertex := func(idx uint32) string {
+			s := strconv.Itoa(posBase + int(idx) + 1)
+			switch {
+			case b.TexCoords != nil && b.Normals != nil:
+				s += "/" + strconv.Itoa(uvBase+int(idx)+1) + "/" + strconv.Itoa(normBase+int(idx)+1)
+			case b.TexCoords != nil:
+				s += "/" + strconv.Itoa(uvBase+int(idx)+1)
+			case b.Normals != nil:
+				s += "//" + strconv.Itoa(normBase+int(idx)+1)
+			}
+			return s
+		}
+		for i := 0; i < len(b.Indices); i += 3 {
+			fmt.Fprintf(w, "f %v %v %v\n", vertex(b.Indices[i]), vertex(b.Indices[i+1]), vertex(b.Indices[i+2]))
+		}
+		posBase += len(b.Positions)
+		uvBase += len(b.TexCoords)
+		normBase += len(b.Normals)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(doc.Materials) == 0 {
+		return nil
+	}
+	mw := bufio.NewWriter(mtlW)
+	if err := writeMTL(mw, doc, names, writeImage); err != nil {
+		return err
+	}
+	return mw.Flush()
+}
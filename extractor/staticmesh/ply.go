@@ -0,0 +1,99 @@
+package staticmesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/qmuntal/gltf"
+)
+
+// Writes the document's meshes with baked transforms as a single
+// binary little endian PLY mesh. Materials aren't supported by PLY.
+func WritePLY(w io.Writer, doc *gltf.Document) error {
+	batches, err := Flatten(doc)
+	if err != nil {
+		return err
+	}
+
+	var numVertices, numFaces int
+	var hasNormals, hasTexCoords, hasColors bool
+	for _, b := range batches {
+		numVertices += len(b.Positions)
+		numFaces += len(b.Indices) / 3
+		hasNormals = hasNormals || b.Normals != nil
+		hasTexCoords = hasTexCoords || b.TexCoords != nil
+		hasColors = hasColors || b.Colors != nil
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ply\n")
+	fmt.Fprintf(bw, "format binary_little_endian 1.0\n")
+	fmt.Fprintf(bw, "comment %v\n", doc.Asset.Generator)
+	fmt.Fprintf(bw, "element vertex %v\n", numVertices)
+	fmt.Fprintf(bw, "property float x\nproperty float y\nproperty float z\n")
+	if hasNormals {
+		fmt.Fprintf(bw, "property float nx\nproperty float ny\nproperty float nz\n")
+	}
+	if hasTexCoords {
+		fmt.Fprintf(bw, "property float s\nproperty float t\n")
+	}
+	if hasColors {
+		fmt.Fprintf(bw, "property uchar red\nproperty uchar green\nproperty uchar blue\nproperty uchar alpha\n")
+	}
+	fmt.Fprintf(bw, "element face %v\n", numFaces)
+	fmt.Fprintf(bw, "property list uchar uint vertex_indices\n")
+	fmt.Fprintf(bw, "end_header\n")
+
+	var buf [4]byte
+	writeFloat := func(f float32) {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(f))
+		bw.Write(buf[:])
+	}
+	for _, b := range batches {
+		for i, p := range b.Positions {
+			writeFloat(p[0])
+			writeFloat(p[1])
+			writeFloat(p[2])
+			if hasNormals {
+				var n [3]float32
+				if b.Normals != nil {
+					n = b.Normals[i]
+				}
+				writeFloat(n[0])
+				writeFloat(n[1])
+				writeFloat(n[2])
+			}
+			if hasTexCoords {
+				var uv [2]float32
+				if b.TexCoords != nil {
+					uv = b.TexCoords[i]
+				}
+				// PLY's texture origin is at the bottom
+				writeFloat(uv[0])
+				writeFloat(1 - uv[1])
+			}
+			if hasColors {
+				c := [4]uint8{255, 255, 255, 255}
+				if b.Colors != nil {
+					c = b.Colors[i]
+				}
+				bw.Write(c[:])
+			}
+		}
+	}
+	base := uint32(0)
+	for _, b := range batches {
+		for i := 0; i < len(b.Indices); i += 3 {
+			bw.WriteByte(3)
+			for _, idx := range b.Indices[i : i+3] {
+				binary.LittleEndian.PutUint32(buf[:], base+idx)
+				bw.Write(buf[:])
+			}
+		}
+		base += uint32(len(b.Positions))
+	}
+	return bw.Flush()
+}
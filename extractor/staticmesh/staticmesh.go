@@ -0,0 +1,160 @@
+// Package staticmesh flattens gltf documents into static meshes with
+// baked transforms and writes them in simple mesh formats (OBJ, PLY).
+package staticmesh
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+	"github.com/xypwn/filediver/extractor/gltf_helper"
+)
+
+// Saves an image of the document and returns the path it
+// should be referenced by.
+type ImageWriter func(doc *gltf.Document, image uint32) (string, error)
+
+// Mesh primitive with transforms applied
+type Batch struct {
+	Name      string
+	Material  *uint32
+	Positions [][3]float32
+	Normals   [][3]float32 // may be nil
+	TexCoords [][2]float32 // may be nil
+	Colors    [][4]uint8   // may be nil
+	Indices   []uint32
+}
+
+type flattener struct {
+	doc       *gltf.Document
+	instances map[uint32][]gltf_helper.Instance
+	batches   []Batch
+	// World transforms of the nodes visited in the current instance
+	world map[uint32]mgl32.Mat4
+}
+
+func (f *flattener) addPrimitive(name string, prim *gltf.Primitive, material *uint32, matrix mgl32.Mat4) error {
+	if prim.Mode != gltf.PrimitiveTriangles || prim.Indices == nil {
+		// Bounding boxes etc. aren't meshes
+		return nil
+	}
+	posIdx, ok := prim.Attributes[gltf.POSITION]
+	if !ok {
+		return nil
+	}
+	doc := f.doc
+	positions, err := modeler.ReadPosition(doc, doc.Accessors[posIdx], nil)
+	if err != nil {
+		return err
+	}
+	indices, err := modeler.ReadIndices(doc, doc.Accessors[*prim.Indices], nil)
+	if err != nil {
+		return err
+	}
+	indices = indices[:len(indices)/3*3]
+	for _, idx := range indices {
+		if int(idx) >= len(positions) {
+			return fmt.Errorf("index out of range")
+		}
+	}
+
+	b := Batch{
+		Name:      name,
+		Material:  material,
+		Positions: make([][3]float32, len(positions)),
+		Indices:   slices.Clone(indices),
+	}
+	for i, p := range positions {
+		b.Positions[i] = matrix.Mul4x1(mgl32.Vec3(p).Vec4(1)).Vec3()
+	}
+	if idx, ok := prim.Attributes[gltf.NORMAL]; ok {
+		if normals, err := modeler.ReadNormal(doc, doc.Accessors[idx], nil); err == nil && len(normals) == len(positions) {
+			normalMatrix := matrix.Mat3().Inv().Transpose()
+			b.Normals = make([][3]float32, len(normals))
+			for i, n := range normals {
+				b.Normals[i] = normalMatrix.Mul3x1(n).Normalize()
+			}
+		}
+	}
+	if idx, ok := prim.Attributes[gltf.TEXCOORD_0]; ok {
+		if uvs, err := modeler.ReadTextureCoord(doc, doc.Accessors[idx], nil); err == nil && len(uvs) == len(positions) {
+			b.TexCoords = uvs
+		}
+	}
+	if idx, ok := prim.Attributes[gltf.COLOR_0]; ok {
+		if colors, err := modeler.ReadColor(doc, doc.Accessors[idx], nil); err == nil && len(colors) == len(positions) {
+			b.Colors = colors
+		}
+	}
+	if matrix.Det() < 0 {
+		// Mirroring flips the winding order
+		for i := 0; i < len(b.Indices); i += 3 {
+			b.Indices[i+1], b.Indices[i+2] = b.Indices[i+2], b.Indices[i+1]
+		}
+	}
+	f.batches = append(f.batches, b)
+	return nil
+}
+
+func (f *flattener) visit(node uint32, parentWorld, local mgl32.Mat4, materials map[uint32]uint32) error {
+	n := f.doc.Nodes[node]
+	world := parentWorld.Mul4(local)
+	f.world[node] = world
+	if n.Mesh != nil {
+		matrix := world
+		if n.Skin != nil {
+			// Skinned vertices are in the space of the skeleton's root
+			// node, regardless of where the mesh node is
+			matrix = parentWorld
+			if skeleton := f.doc.Skins[*n.Skin].Skeleton; skeleton != nil {
+				if skeletonWorld, ok := f.world[*skeleton]; ok {
+					matrix = skeletonWorld
+				}
+			}
+		}
+		mesh := f.doc.Meshes[*n.Mesh]
+		for i, prim := range mesh.Primitives {
+			material := prim.Material
+			if idx, ok := materials[uint32(i)]; ok {
+				material = &idx
+			}
+			name := n.Name
+			if len(mesh.Primitives) > 1 {
+				name = fmt.Sprintf("%v_%v", n.Name, i)
+			}
+			if err := f.addPrimitive(name, prim, material, matrix); err != nil {
+				return fmt.Errorf("mesh %v: %w", mesh.Name, err)
+			}
+		}
+	}
+	for _, child := range n.Children {
+		if err := f.visit(child, world, gltf_helper.NodeMatrix(f.doc.Nodes[child]), materials); err != nil {
+			return err
+		}
+	}
+	for _, instance := range f.instances[node] {
+		if err := f.visit(instance.Root, world, instance.Matrix, instance.Materials); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the triangle meshes of the document's scenes, including
+// additional instances, with node transforms applied. Skinned meshes
+// are in their bind pose.
+func Flatten(doc *gltf.Document) ([]Batch, error) {
+	f := &flattener{
+		doc:       doc,
+		instances: gltf_helper.Instances(doc),
+		world:     make(map[uint32]mgl32.Mat4),
+	}
+	for _, root := range gltf_helper.RootNodes(doc) {
+		if err := f.visit(root, mgl32.Ident4(), gltf_helper.NodeMatrix(doc.Nodes[root]), nil); err != nil {
+			return nil, err
+		}
+	}
+	return f.batches, nil
+}
@@ -0,0 +1,64 @@
+package unit
+
+import (
+	"github.com/qmuntal/gltf"
+
+	datalib "github.com/xypwn/filediver/datalibrary"
+	"github.com/xypwn/filediver/extractor"
+)
+
+func setNodeExtra(doc *gltf.Document, node uint32, key string, value any) {
+	extras, ok := doc.Nodes[node].Extras.(map[string]any)
+	if !ok {
+		extras = make(map[string]any)
+	}
+	extras[key] = value
+	doc.Nodes[node].Extras = extras
+}
+
+// AddEntityData links the unit's entity in the extras of the root node,
+// embedding its simplified components, and tags the bones and meshes
+// making up the damageable zones of its health component with the
+// zone's name.
+func AddEntityData(ctx *extractor.Context, doc *gltf.Document, root uint32, meshNodes []uint32) {
+	entityHash := GetUnitEntityHash(ctx)
+	entity, err := datalib.ParseEntity(entityHash)
+	if err != nil {
+		// Many units, e.g. level props, aren't spawned by an entity
+		return
+	}
+
+	setNodeExtra(doc, root, "entity", ctx.LookupHash(entityHash))
+	setNodeExtra(doc, root, "entityData", entity.ToSimple(ctx.LookupHash, ctx.LookupThinHash, datalib.DLHash.String, ctx.LookupString))
+
+	health, ok := entity.Components[datalib.Sum("HealthComponentData")].(datalib.HealthComponent)
+	if !ok {
+		return
+	}
+	for _, zone := range health.DamageableZones {
+		if zone.Info.ZoneName.Value == 0 {
+			break
+		}
+		zoneName := ctx.LookupThinHash(zone.Info.ZoneName)
+		for _, actor := range zone.Actors {
+			if actor.Value == 0 {
+				break
+			}
+			// Actors are named after the bones (or meshes) they are attached to
+			var nodes []uint32
+			if bone := findBone(ctx, doc, &root, actor); bone != nil {
+				nodes = append(nodes, *bone)
+			}
+			nodes = append(nodes, meshNodesByName(doc, meshNodes, ctx.LookupThinHash(actor))...)
+			for _, node := range nodes {
+				if extras, ok := doc.Nodes[node].Extras.(map[string]any); ok {
+					if _, ok := extras["damageableZone"]; ok {
+						// Keep the first zone an actor belongs to
+						continue
+					}
+				}
+				setNodeExtra(doc, node, "damageableZone", zoneName)
+			}
+		}
+	}
+}
@@ -212,6 +212,7 @@ func AddMaterialVariant(ctx *extractor.Context, mat *material.Material, doc *glt
 		BaseMaterial: mat.BaseMaterial,
 		Textures:     maps.Clone(mat.Textures),
 		Settings:     maps.Clone(mat.Settings),
+		SettingTypes: maps.Clone(mat.SettingTypes),
 	}
 	idx := 0
 	if ctx.FileID().Name == stingray.Sum("content/fac_helldivers/hellpod/ammo_rack/ammo_rack") ||
@@ -239,26 +240,18 @@ func AddMaterialVariant(ctx *extractor.Context, mat *material.Material, doc *glt
 	return gltf.Index(skinMatIdx), nil
 }
 
-// Most weapons share a name with their entity (what actually has the customization component)
-// but a few do not, so we need to patch those up to get 100% weapon skin export
-// Theoretically we should just be exporting based on entity name rather than unit name, but
-// thats a gigantic can of worms I don't want to get into right now
-func getWeaponEntityHashFromUnitHash(weaponUnit stingray.Hash) stingray.Hash {
-	switch weaponUnit {
-	case stingray.Sum("content/fac_helldivers/equipment/primary_weapons/assault_rifle_penetrator/assault_rifle_penetrator"):
-		weaponUnit = stingray.Hash{Value: 0x43cb1033961a2276}
-	case stingray.Sum("content/fac_helldivers/equipment/primary_weapons/marksman_rifle_vigilance_counter_sniper/marksman_rifle_vigilance_counter_sniper"):
-		weaponUnit = stingray.Hash{Value: 0x4c786785c79d44e7}
-	case stingray.Sum("content/fac_helldivers/equipment/primary_weapons/assault_shotgun_sprayandpray/assault_shotgun_sprayandpray"):
-		weaponUnit = stingray.Hash{Value: 0x5ebaea70c0d060b9}
-	case stingray.Sum("content/fac_helldivers/equipment/primary_weapons/jet_rifle_phoenix/jet_rifle_phoenix"):
-		weaponUnit = stingray.Hash{Value: 0xb6aff2195568767f}
-	case stingray.Sum("content/fac_helldivers/equipment/primary_weapons/assault_rifle_explosive/assault_rifle_explosive"):
-		weaponUnit = stingray.Hash{Value: 0xcf5f176e0e322be1}
-	case stingray.Sum("content/fac_helldivers/equipment/primary_weapons/plasma_rifle_charge/plasma_rifle_charge"):
-		weaponUnit = stingray.Hash{Value: 0xfb3a19078694708a}
-	}
-	return weaponUnit
+// GetUnitEntityHash returns the entity which spawns the unit being
+// extracted. Most units share a name with their entity, but a few (e.g.
+// some weapons) are referred to by the UnitComponent of a differently
+// named entity.
+func GetUnitEntityHash(ctx *extractor.Context) stingray.Hash {
+	unitEntities, err := datalib.ParseUnitEntities()
+	if err != nil {
+		ctx.Warnf("GetUnitEntityHash: %v", err)
+		return ctx.FileID().Name
+	}
+	entity, _ := unitEntities.Entity(ctx.FileID().Name)
+	return entity
 }
 
 func AddMaterials(ctx *extractor.Context, doc *gltf.Document, imgOpts *extr_material.ImageOptions, unitInfo *unit.Info, metadata *datalib.UnitData) ([]geometry.MaterialVariantMap, error) {
@@ -266,7 +259,7 @@ func AddMaterials(ctx *extractor.Context, doc *gltf.Document, imgOpts *extr_mate
 	namesToVariantIdx := make(map[string]uint32)
 
 	// Check if this is a weapon with weapon customization component or an attachment in the weapon customization settings
-	weaponHash := getWeaponEntityHashFromUnitHash(ctx.FileID().Name)
+	weaponHash := GetUnitEntityHash(ctx)
 	weaponCustCmpData, weaponErr := datalib.GetWeaponCustomizationComponentDataForHash(weaponHash)
 
 	attachmentSlot, isAttachment := ctx.AttachmentSlots()[ctx.FileID().Name]
@@ -780,12 +773,36 @@ func ConvertOpts(ctx *extractor.Context, imgOpts *extr_material.ImageOptions, gl
 	}
 
 	if len(unitInfo.TerrainInfos) > 0 {
-		doc.Nodes[*parent].Children = append(doc.Nodes[*parent].Children, AddTerrain(ctx, doc, unitInfo, &meshNodes)...)
+		if cfg.Model.Terrain != "heightfield" {
+			doc.Nodes[*parent].Children = append(doc.Nodes[*parent].Children, AddTerrain(ctx, doc, unitInfo, &meshNodes)...)
+		}
+		if cfg.Model.Terrain == "heightfield" || cfg.Model.Terrain == "both" {
+			if err := WriteTerrainHeightfields(ctx, unitInfo); err != nil {
+				ctx.Warnf("write terrain heightfields: %v", err)
+			}
+		}
+	}
+
+	var lodGroups []lodGroup
+	if cfg.Model.IncludeLODS && (cfg.Model.LODs == "msft_lod" || cfg.Model.LODs == "files") {
+		lodGroups = collectLODGroups(ctx, doc, unitInfo, meshNodes)
+		if cfg.Model.LODs == "msft_lod" || gltfDoc != nil {
+			// Shared documents can't be split into one file per LOD
+			addMSFTLod(doc, lodGroups)
+			lodGroups = nil
+		}
+	}
+
+	if cfg.Model.EntityData {
+		AddEntityData(ctx, doc, *parent, meshNodes)
 	}
 
 	AddPrefabMetadata(ctx, doc, parent, skin, meshNodes, armorSetName)
 
 	if gltfDoc == nil {
+		if lodGroups != nil {
+			return saveLODFiles(ctx, doc, lodGroups, "unit", cfg.Model.Format)
+		}
 		err := extractor.SaveDocument(ctx, doc, "unit", cfg.Model.Format)
 		if err != nil {
 			return err
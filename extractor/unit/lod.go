@@ -0,0 +1,250 @@
+package unit
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/qmuntal/gltf"
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray/unit"
+)
+
+type lodLevel struct {
+	// Minimum screen coverage at which this level is shown, negative
+	// if unknown
+	Coverage float32
+	Nodes    []uint32
+}
+
+// Levels of detail of a single object, highest detail first
+type lodGroup struct {
+	Name   string
+	Levels []lodLevel
+}
+
+var lodSuffixRegexp = regexp.MustCompile(`^(.*)_LOD(\d+)$`)
+
+// Returns the mesh nodes which were created for the mesh of the group bone.
+func meshNodesByName(doc *gltf.Document, meshNodes []uint32, name string) []uint32 {
+	var nodes []uint32
+	for _, node := range meshNodes {
+		nodeName := doc.Nodes[node].Name
+		// UDIM nodes are suffixed with their component name
+		if nodeName == name || strings.HasPrefix(nodeName, name+" ") {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Returns the LOD groups of the unit using the unit's LOD group data,
+// or, if there is none, the _LOD<n> suffixes of the mesh names.
+func collectLODGroups(ctx *extractor.Context, doc *gltf.Document, unitInfo *unit.Info, meshNodes []uint32) []lodGroup {
+	var groups []lodGroup
+	for _, lodGroupInfo := range unitInfo.LODGroups {
+		group := lodGroup{Name: ctx.LookupThinHash(lodGroupInfo.Header.UnkHash00)}
+		for _, entry := range lodGroupInfo.Entries {
+			level := lodLevel{Coverage: min(entry.Detail.Min, entry.Detail.Max)}
+			for _, meshIdx := range entry.Indices {
+				if int(meshIdx) >= len(unitInfo.GroupBones) {
+					ctx.Warnf("LOD group %v: mesh index %v out of range", group.Name, meshIdx)
+					continue
+				}
+				name := ctx.LookupThinHash(unitInfo.GroupBones[meshIdx])
+				level.Nodes = append(level.Nodes, meshNodesByName(doc, meshNodes, name)...)
+			}
+			if len(level.Nodes) > 0 {
+				group.Levels = append(group.Levels, level)
+			}
+		}
+		if len(group.Levels) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) > 0 {
+		return groups
+	}
+
+	// No usable LOD data, fall back to mesh names
+	levelsByName := make(map[string]map[int][]uint32)
+	var names []string
+	for _, node := range meshNodes {
+		name, _, _ := strings.Cut(doc.Nodes[node].Name, " ")
+		match := lodSuffixRegexp.FindStringSubmatch(name)
+		if match == nil || strings.Contains(name, "shadow") {
+			continue
+		}
+		lod, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		if _, ok := levelsByName[match[1]]; !ok {
+			levelsByName[match[1]] = make(map[int][]uint32)
+			names = append(names, match[1])
+		}
+		levelsByName[match[1]][lod] = append(levelsByName[match[1]][lod], node)
+	}
+	for _, name := range names {
+		lods := make([]int, 0, len(levelsByName[name]))
+		for lod := range levelsByName[name] {
+			lods = append(lods, lod)
+		}
+		if len(lods) < 2 {
+			continue
+		}
+		slices.Sort(lods)
+		group := lodGroup{Name: name}
+		for _, lod := range lods {
+			group.Levels = append(group.Levels, lodLevel{
+				Coverage: -1,
+				Nodes:    levelsByName[name][lod],
+			})
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// Returns the parent of each node which is a child of another node.
+func nodeParents(doc *gltf.Document) map[uint32]uint32 {
+	parents := make(map[uint32]uint32)
+	for i, node := range doc.Nodes {
+		for _, child := range node.Children {
+			parents[child] = uint32(i)
+		}
+	}
+	return parents
+}
+
+// Groups each LOD level below a node and links the levels using the
+// MSFT_lod extension. Only the highest detail level stays part of the
+// node hierarchy.
+func addMSFTLod(doc *gltf.Document, groups []lodGroup) {
+	if len(groups) == 0 {
+		return
+	}
+	parents := nodeParents(doc)
+	for _, group := range groups {
+		parent, hasParent := parents[group.Levels[0].Nodes[0]]
+		levelNodes := make([]uint32, len(group.Levels))
+		haveCoverage := true
+		for i, level := range group.Levels {
+			for _, node := range level.Nodes {
+				if nodeParent, ok := parents[node]; ok {
+					doc.Nodes[nodeParent].Children = slices.DeleteFunc(doc.Nodes[nodeParent].Children, func(child uint32) bool {
+						return child == node
+					})
+				}
+			}
+			levelNodes[i] = uint32(len(doc.Nodes))
+			doc.Nodes = append(doc.Nodes, &gltf.Node{
+				Name:     fmt.Sprintf("%v LOD%v", group.Name, i),
+				Children: slices.Clone(level.Nodes),
+			})
+			haveCoverage = haveCoverage && level.Coverage >= 0
+		}
+		// Level nodes which were scene roots are replaced by the LOD0
+		// group in the same scenes
+		isLevelNode := make(map[uint32]bool)
+		for _, level := range group.Levels {
+			for _, node := range level.Nodes {
+				isLevelNode[node] = true
+			}
+		}
+		var rootScenes []*gltf.Scene
+		for _, scene := range doc.Scenes {
+			if slices.Contains(scene.Nodes, group.Levels[0].Nodes[0]) {
+				rootScenes = append(rootScenes, scene)
+			}
+			scene.Nodes = slices.DeleteFunc(scene.Nodes, func(node uint32) bool {
+				return isLevelNode[node]
+			})
+		}
+		if hasParent {
+			doc.Nodes[parent].Children = append(doc.Nodes[parent].Children, levelNodes[0])
+		} else {
+			if len(rootScenes) == 0 && len(doc.Scenes) > 0 {
+				rootScenes = doc.Scenes[:1]
+			}
+			for _, scene := range rootScenes {
+				scene.Nodes = append(scene.Nodes, levelNodes[0])
+			}
+		}
+
+		lod0 := doc.Nodes[levelNodes[0]]
+		lod0.Extensions = gltf.Extensions{
+			"MSFT_lod": map[string]any{
+				"ids": levelNodes[1:],
+			},
+		}
+		if haveCoverage {
+			coverages := make([]float32, len(group.Levels))
+			for i, level := range group.Levels {
+				coverages[i] = level.Coverage
+			}
+			lod0.Extras = map[string]any{
+				"MSFT_screencoverage": coverages,
+			}
+		}
+	}
+	if !slices.Contains(doc.ExtensionsUsed, "MSFT_lod") {
+		doc.ExtensionsUsed = append(doc.ExtensionsUsed, "MSFT_lod")
+	}
+}
+
+// Saves one document per level of detail. Objects with fewer levels
+// use their lowest detail level in the remaining documents.
+func saveLODFiles(ctx *extractor.Context, doc *gltf.Document, groups []lodGroup, stingrayFormat, fileFormat string) error {
+	numLevels := 0
+	for _, group := range groups {
+		numLevels = max(numLevels, len(group.Levels))
+	}
+	if numLevels == 0 {
+		return extractor.SaveDocument(ctx, doc, stingrayFormat, fileFormat)
+	}
+	for lod := range numLevels {
+		excluded := make(map[uint32]bool)
+		for _, group := range groups {
+			keep := min(lod, len(group.Levels)-1)
+			for i, level := range group.Levels {
+				if i == keep {
+					continue
+				}
+				for _, node := range level.Nodes {
+					excluded[node] = true
+				}
+			}
+		}
+
+		lodDoc := *doc
+		lodDoc.Nodes = make([]*gltf.Node, len(doc.Nodes))
+		for i, node := range doc.Nodes {
+			nodeCopy := *node
+			nodeCopy.Children = slices.DeleteFunc(slices.Clone(node.Children), func(child uint32) bool {
+				return excluded[child]
+			})
+			lodDoc.Nodes[i] = &nodeCopy
+		}
+		lodDoc.Scenes = make([]*gltf.Scene, len(doc.Scenes))
+		for i, scene := range doc.Scenes {
+			sceneCopy := *scene
+			sceneCopy.Nodes = slices.DeleteFunc(slices.Clone(scene.Nodes), func(node uint32) bool {
+				return excluded[node]
+			})
+			lodDoc.Scenes[i] = &sceneCopy
+		}
+		// Saving sets the buffer URIs
+		lodDoc.Buffers = make([]*gltf.Buffer, len(doc.Buffers))
+		for i, buffer := range doc.Buffers {
+			bufferCopy := *buffer
+			lodDoc.Buffers[i] = &bufferCopy
+		}
+		if err := extractor.SaveDocument(ctx, &lodDoc, fmt.Sprintf("%v.lod%v", stingrayFormat, lod), fileFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
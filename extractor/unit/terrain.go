@@ -0,0 +1,159 @@
+package unit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"path"
+
+	"github.com/xypwn/filediver/extractor"
+	extr_texture "github.com/xypwn/filediver/extractor/texture"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/stingray/unit"
+)
+
+type TerrainLayer struct {
+	Path       string `json:"path"`
+	Resolution uint32 `json:"resolution"`
+	File       string `json:"file,omitempty"`
+}
+
+// Describes how the heightmap images map to the world. Coordinates
+// are in stingray space, i.e. z is up. Row 0 of the images is at
+// min[1] and column 0 at min[0].
+type TerrainHeightfield struct {
+	Name       string     `json:"name"`
+	ParentBone string     `json:"parent_bone"`
+	Resolution uint32     `json:"resolution"`
+	Min        [3]float32 `json:"min"`
+	Max        [3]float32 `json:"max"`
+	// Distance between two adjacent heightmap samples
+	SampleSpacing [2]float32 `json:"sample_spacing"`
+	// Height of a 16-bit heightmap value v is
+	// height_min + v/65535 * (height_max - height_min). The .r32
+	// heightmap contains these heights directly. Heights are in the
+	// same space as min and max, so height_min and height_max equal
+	// min[2] and max[2].
+	HeightMin     float32        `json:"height_min"`
+	HeightMax     float32        `json:"height_max"`
+	HeightmapPNG  string         `json:"heightmap_png"`
+	HeightmapR32  string         `json:"heightmap_r32"`
+	Layers        []TerrainLayer `json:"layers"`
+	QuadtreeNodes int            `json:"quadtree_nodes"`
+}
+
+func writeTerrainFile(ctx *extractor.Context, suffix string, write func(w *bufio.Writer) error) error {
+	out, err := ctx.CreateFile(suffix)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	if err := write(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func writeTerrainHeightfield(ctx *extractor.Context, terrainInfo *unit.TerrainInfo, name string) (*TerrainHeightfield, error) {
+	values, resolution, err := terrainInfo.Heightmap()
+	if err != nil {
+		return nil, err
+	}
+	prefix := ".terrain/" + name
+	// DecompressHeight is relative to the center of the height range
+	center := (terrainInfo.Min[2] + terrainInfo.Max[2]) / 2
+	height := func(v uint16) float32 {
+		return center + terrainInfo.DecompressHeight(v)
+	}
+
+	hf := &TerrainHeightfield{
+		Name:       ctx.LookupThinHash(terrainInfo.Name),
+		ParentBone: ctx.LookupThinHash(terrainInfo.ParentBone),
+		Resolution: resolution,
+		Min:        terrainInfo.Min,
+		Max:        terrainInfo.Max,
+		SampleSpacing: [2]float32{
+			(terrainInfo.Max[0] - terrainInfo.Min[0]) / float32(resolution),
+			(terrainInfo.Max[1] - terrainInfo.Min[1]) / float32(resolution),
+		},
+		HeightMin:     height(0),
+		HeightMax:     height(math.MaxUint16),
+		HeightmapPNG:  path.Base(prefix) + ".height.png",
+		HeightmapR32:  path.Base(prefix) + ".height.r32",
+		Layers:        make([]TerrainLayer, 0, len(terrainInfo.Textures)),
+		QuadtreeNodes: len(terrainInfo.QuadtreeNodes),
+	}
+
+	if err := writeTerrainFile(ctx, prefix+".height.png", func(w *bufio.Writer) error {
+		img := image.NewGray16(image.Rect(0, 0, int(resolution), int(resolution)))
+		for i, v := range values {
+			binary.BigEndian.PutUint16(img.Pix[2*i:], v)
+		}
+		return png.Encode(w, img)
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := writeTerrainFile(ctx, prefix+".height.r32", func(w *bufio.Writer) error {
+		var buf [4]byte
+		for _, v := range values {
+			binary.LittleEndian.PutUint32(buf[:], math.Float32bits(height(v)))
+			if _, err := w.Write(buf[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for i, texture := range terrainInfo.Textures {
+		layer := TerrainLayer{
+			Path:       ctx.LookupHash(texture.Path),
+			Resolution: texture.Resolution,
+		}
+		data, err := extr_texture.ConvertToPNGData(ctx, stingray.NewFileID(texture.Path, stingray.Sum("texture")))
+		if err != nil {
+			ctx.Warnf("terrain %v layer %v: %v", hf.Name, layer.Path, err)
+		} else {
+			layer.File = fmt.Sprintf("%v.layer_%v_%v.png", path.Base(prefix), i, path.Base(layer.Path))
+			if err := writeTerrainFile(ctx, ".terrain/"+layer.File, func(w *bufio.Writer) error {
+				_, err := w.Write(data)
+				return err
+			}); err != nil {
+				return nil, err
+			}
+		}
+		hf.Layers = append(hf.Layers, layer)
+	}
+	return hf, nil
+}
+
+// Writes the terrains of the unit as 16-bit PNG and 32-bit float (.r32)
+// heightmaps, their texture layers (splat/weight maps) as PNGs and a
+// JSON describing their world extents.
+func WriteTerrainHeightfields(ctx *extractor.Context, unitInfo *unit.Info) error {
+	heightfields := make([]*TerrainHeightfield, 0, len(unitInfo.TerrainInfos))
+	for i := range unitInfo.TerrainInfos {
+		terrainInfo := &unitInfo.TerrainInfos[i]
+		name := path.Base(ctx.LookupThinHash(terrainInfo.Name))
+		if len(unitInfo.TerrainInfos) > 1 {
+			name = fmt.Sprintf("%v_%v", name, i)
+		}
+		hf, err := writeTerrainHeightfield(ctx, terrainInfo, name)
+		if err != nil {
+			return fmt.Errorf("terrain %v: %w", name, err)
+		}
+		heightfields = append(heightfields, hf)
+	}
+	return writeTerrainFile(ctx, ".terrain/terrain.json", func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return enc.Encode(heightfields)
+	})
+}
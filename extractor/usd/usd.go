@@ -0,0 +1,446 @@
+// Package usd writes gltf documents as text USD (usda) layers.
+package usd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+	"github.com/xypwn/filediver/extractor/gltf_helper"
+)
+
+// Name of the default prim of layers written by WriteLayer
+const AssetPrim = "Asset"
+
+// Saves an image of the document and returns its asset path relative to
+// the layer being written.
+type ImageWriter func(doc *gltf.Document, image uint32) (string, error)
+
+// Returns a valid USD prim name based on name.
+func PrimName(name string) string {
+	var sb strings.Builder
+	for i, c := range name {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || (i > 0 && c >= '0' && c <= '9') {
+			sb.WriteRune(c)
+		} else if i == 0 && c >= '0' && c <= '9' {
+			sb.WriteRune('_')
+			sb.WriteRune(c)
+		} else {
+			sb.WriteRune('_')
+		}
+	}
+	if sb.Len() == 0 {
+		return "_"
+	}
+	return sb.String()
+}
+
+// Quotes s as a USD string.
+func Quote(s string) string {
+	return strconv.Quote(s)
+}
+
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
+
+// Formats m as a USD matrix4d. USD matrices are row-major
+// and multiply row vectors, i.e. they're transposed to mgl32's.
+func FormatMatrix(m mgl32.Mat4) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for col := range 4 {
+		if col > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('(')
+		for row := range 4 {
+			if row > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(formatFloat(m.At(row, col)))
+		}
+		sb.WriteByte(')')
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// Writes the layer header with the given default prim.
+func WriteHeader(w io.Writer, defaultPrim string) {
+	fmt.Fprintf(w, "#usda 1.0\n(\n")
+	fmt.Fprintf(w, "    defaultPrim = %v\n", Quote(defaultPrim))
+	fmt.Fprintf(w, "    metersPerUnit = 1\n")
+	fmt.Fprintf(w, "    upAxis = \"Y\"\n")
+	fmt.Fprintf(w, ")\n\n")
+}
+
+type layerWriter struct {
+	w           *bufio.Writer
+	doc         *gltf.Document
+	writeImage  ImageWriter
+	imagePaths  map[uint32]string
+	materials   []string // prim path of each material
+	paths       []string // prim path of each written node
+	world       []mgl32.Mat4
+	children    [][]uint32
+	instances   map[uint32][]gltf_helper.Instance // by parent node
+	hasGeometry []bool
+	err         error
+}
+
+func (lw *layerWriter) printf(depth int, format string, args ...any) {
+	lw.w.WriteString(strings.Repeat("    ", depth))
+	fmt.Fprintf(lw.w, format, args...)
+}
+
+// Marks nodes which have meshes or instances below them.
+func (lw *layerWriter) markGeometry(node uint32) bool {
+	has := lw.doc.Nodes[node].Mesh != nil || len(lw.instances[node]) > 0
+	for _, child := range lw.children[node] {
+		if lw.markGeometry(child) {
+			has = true
+		}
+	}
+	lw.hasGeometry[node] = has
+	return has
+}
+
+func (lw *layerWriter) imagePath(texture uint32) (string, bool) {
+	if int(texture) >= len(lw.doc.Textures) || lw.doc.Textures[texture].Source == nil {
+		return "", false
+	}
+	image := *lw.doc.Textures[texture].Source
+	if path, ok := lw.imagePaths[image]; ok {
+		return path, path != ""
+	}
+	path, err := lw.writeImage(lw.doc, image)
+	if err != nil && lw.err == nil {
+		lw.err = fmt.Errorf("image %v: %w", image, err)
+	}
+	lw.imagePaths[image] = path
+	return path, path != ""
+}
+
+// Writes the material as a UsdPreviewSurface network.
+func (lw *layerWriter) writeMaterial(depth int, path string, mat *gltf.Material) {
+	name := path[strings.LastIndex(path, "/")+1:]
+	lw.printf(depth, "def Material %v\n", Quote(name))
+	lw.printf(depth, "{\n")
+	lw.printf(depth+1, "token outputs:surface.connect = <%v/Surface.outputs:surface>\n", path)
+
+	var textures []string
+	texture := func(shader string, info uint32, colorSpace string, extra ...string) {
+		imgPath, ok := lw.imagePath(info)
+		if !ok {
+			return
+		}
+		textures = append(textures, shader)
+		lw.printf(depth+1, "def Shader %v\n", Quote(shader))
+		lw.printf(depth+1, "{\n")
+		lw.printf(depth+2, "uniform token info:id = \"UsdUVTexture\"\n")
+		lw.printf(depth+2, "asset inputs:file = @%v@\n", imgPath)
+		lw.printf(depth+2, "float2 inputs:st.connect = <%v/TexCoord.outputs:result>\n", path)
+		lw.printf(depth+2, "token inputs:sourceColorSpace = %v\n", Quote(colorSpace))
+		lw.printf(depth+2, "token inputs:wrapS = \"repeat\"\n")
+		lw.printf(depth+2, "token inputs:wrapT = \"repeat\"\n")
+		for _, line := range extra {
+			lw.printf(depth+2, "%v\n", line)
+		}
+		lw.printf(depth+2, "float3 outputs:rgb\n")
+		lw.printf(depth+2, "float outputs:g\n")
+		lw.printf(depth+2, "float outputs:b\n")
+		lw.printf(depth+2, "float outputs:a\n")
+		lw.printf(depth+1, "}\n")
+	}
+	pbr := mat.PBRMetallicRoughness
+	if pbr == nil {
+		pbr = &gltf.PBRMetallicRoughness{}
+	}
+	if pbr.BaseColorTexture != nil {
+		texture("BaseColor", pbr.BaseColorTexture.Index, "sRGB")
+	}
+	if pbr.MetallicRoughnessTexture != nil {
+		texture("MetallicRoughness", pbr.MetallicRoughnessTexture.Index, "raw")
+	}
+	if mat.NormalTexture != nil && mat.NormalTexture.Index != nil {
+		texture("Normal", *mat.NormalTexture.Index, "raw",
+			"float4 inputs:scale = (2, 2, 2, 1)",
+			"float4 inputs:bias = (-1, -1, -1, 0)",
+		)
+	}
+	if mat.EmissiveTexture != nil {
+		texture("Emissive", mat.EmissiveTexture.Index, "sRGB")
+	}
+	if len(textures) > 0 {
+		lw.printf(depth+1, "def Shader \"TexCoord\"\n")
+		lw.printf(depth+1, "{\n")
+		lw.printf(depth+2, "uniform token info:id = \"UsdPrimvarReader_float2\"\n")
+		lw.printf(depth+2, "string inputs:varname = \"st\"\n")
+		lw.printf(depth+2, "float2 outputs:result\n")
+		lw.printf(depth+1, "}\n")
+	}
+
+	lw.printf(depth+1, "def Shader \"Surface\"\n")
+	lw.printf(depth+1, "{\n")
+	lw.printf(depth+2, "uniform token info:id = \"UsdPreviewSurface\"\n")
+	if slices.Contains(textures, "BaseColor") {
+		lw.printf(depth+2, "color3f inputs:diffuseColor.connect = <%v/BaseColor.outputs:rgb>\n", path)
+	} else {
+		c := pbr.BaseColorFactorOrDefault()
+		lw.printf(depth+2, "color3f inputs:diffuseColor = (%v, %v, %v)\n", formatFloat(c[0]), formatFloat(c[1]), formatFloat(c[2]))
+	}
+	if slices.Contains(textures, "MetallicRoughness") {
+		lw.printf(depth+2, "float inputs:metallic.connect = <%v/MetallicRoughness.outputs:b>\n", path)
+		lw.printf(depth+2, "float inputs:roughness.connect = <%v/MetallicRoughness.outputs:g>\n", path)
+	} else {
+		lw.printf(depth+2, "float inputs:metallic = %v\n", formatFloat(pbr.MetallicFactorOrDefault()))
+		lw.printf(depth+2, "float inputs:roughness = %v\n", formatFloat(pbr.RoughnessFactorOrDefault()))
+	}
+	if slices.Contains(textures, "Normal") {
+		lw.printf(depth+2, "normal3f inputs:normal.connect = <%v/Normal.outputs:rgb>\n", path)
+	}
+	if slices.Contains(textures, "Emissive") {
+		lw.printf(depth+2, "color3f inputs:emissiveColor.connect = <%v/Emissive.outputs:rgb>\n", path)
+	} else if e := mat.EmissiveFactor; e != [3]float32{} {
+		lw.printf(depth+2, "color3f inputs:emissiveColor = (%v, %v, %v)\n", formatFloat(e[0]), formatFloat(e[1]), formatFloat(e[2]))
+	}
+	if mat.AlphaMode == gltf.AlphaMask {
+		lw.printf(depth+2, "float inputs:opacityThreshold = %v\n", formatFloat(mat.AlphaCutoffOrDefault()))
+	}
+	if mat.AlphaMode != gltf.AlphaOpaque && slices.Contains(textures, "BaseColor") {
+		lw.printf(depth+2, "float inputs:opacity.connect = <%v/BaseColor.outputs:a>\n", path)
+	}
+	lw.printf(depth+2, "token outputs:surface\n")
+	lw.printf(depth+1, "}\n")
+	lw.printf(depth, "}\n")
+}
+
+func writeArray[T any](lw *layerWriter, depth int, decl string, values []T, format func(T) string) {
+	lw.printf(depth, "%v = [", decl)
+	for i, v := range values {
+		if i > 0 {
+			lw.w.WriteString(", ")
+		}
+		lw.w.WriteString(format(v))
+	}
+	lw.w.WriteString("]")
+}
+
+func formatVec3(v [3]float32) string {
+	return "(" + formatFloat(v[0]) + ", " + formatFloat(v[1]) + ", " + formatFloat(v[2]) + ")"
+}
+
+func formatInt[T uint32 | int](v T) string {
+	return strconv.Itoa(int(v))
+}
+
+// Writes a gltf primitive as a USD mesh.
+func (lw *layerWriter) writePrimitive(depth int, name string, prim *gltf.Primitive) error {
+	if prim.Mode != gltf.PrimitiveTriangles || prim.Indices == nil {
+		// Bounding boxes etc. aren't meshes
+		return nil
+	}
+	posIdx, ok := prim.Attributes[gltf.POSITION]
+	if !ok {
+		return nil
+	}
+	positions, err := modeler.ReadPosition(lw.doc, lw.doc.Accessors[posIdx], nil)
+	if err != nil {
+		return err
+	}
+	indices, err := modeler.ReadIndices(lw.doc, lw.doc.Accessors[*prim.Indices], nil)
+	if err != nil {
+		return err
+	}
+	if len(indices) < 3 {
+		return nil
+	}
+	indices = indices[:len(indices)/3*3]
+
+	lw.printf(depth, "def Mesh %v (\n", Quote(name))
+	lw.printf(depth+1, "prepend apiSchemas = [\"MaterialBindingAPI\"]\n")
+	lw.printf(depth, ")\n")
+	lw.printf(depth, "{\n")
+	lw.printf(depth+1, "uniform token subdivisionScheme = \"none\"\n")
+	counts := make([]int, len(indices)/3)
+	for i := range counts {
+		counts[i] = 3
+	}
+	writeArray(lw, depth+1, "int[] faceVertexCounts", counts, formatInt)
+	lw.w.WriteByte('\n')
+	writeArray(lw, depth+1, "int[] faceVertexIndices", indices, formatInt)
+	lw.w.WriteByte('\n')
+	writeArray(lw, depth+1, "point3f[] points", positions, formatVec3)
+	lw.w.WriteByte('\n')
+	if idx, ok := prim.Attributes[gltf.NORMAL]; ok {
+		if normals, err := modeler.ReadNormal(lw.doc, lw.doc.Accessors[idx], nil); err == nil && len(normals) == len(positions) {
+			writeArray(lw, depth+1, "normal3f[] normals", normals, formatVec3)
+			lw.w.WriteString(" (\n")
+			lw.printf(depth+2, "interpolation = \"vertex\"\n")
+			lw.printf(depth+1, ")\n")
+		}
+	}
+	if idx, ok := prim.Attributes[gltf.TEXCOORD_0]; ok {
+		if uvs, err := modeler.ReadTextureCoord(lw.doc, lw.doc.Accessors[idx], nil); err == nil && len(uvs) == len(positions) {
+			writeArray(lw, depth+1, "texCoord2f[] primvars:st", uvs, func(uv [2]float32) string {
+				// USD's texture origin is at the bottom
+				return "(" + formatFloat(uv[0]) + ", " + formatFloat(1-uv[1]) + ")"
+			})
+			lw.w.WriteString(" (\n")
+			lw.printf(depth+2, "interpolation = \"vertex\"\n")
+			lw.printf(depth+1, ")\n")
+		}
+	}
+	if prim.Material != nil && int(*prim.Material) < len(lw.materials) {
+		lw.printf(depth+1, "rel material:binding = <%v>\n", lw.materials[*prim.Material])
+	}
+	lw.printf(depth, "}\n")
+	return nil
+}
+
+// Assigns unique prim names to the given nodes.
+func (lw *layerWriter) childNames(nodes []uint32) []string {
+	names := make([]string, len(nodes))
+	// Reserved for the materials scope
+	used := map[string]int{"Looks": 1}
+	for i, node := range nodes {
+		names[i] = uniqueName(used, PrimName(lw.doc.Nodes[node].Name))
+	}
+	return names
+}
+
+// Returns name, or name_N with the lowest N >= 1 that is not yet used.
+// used counts the names already handed out per base name.
+func uniqueName(used map[string]int, name string) string {
+	base := name
+	for used[name] > 0 {
+		name = fmt.Sprintf("%v_%v", base, used[base])
+		used[base]++
+	}
+	used[name]++
+	return name
+}
+
+func (lw *layerWriter) assignPaths(nodes []uint32, parentPath string, parentWorld mgl32.Mat4) {
+	names := lw.childNames(nodes)
+	for i, node := range nodes {
+		lw.paths[node] = parentPath + "/" + names[i]
+		lw.world[node] = parentWorld.Mul4(gltf_helper.NodeMatrix(lw.doc.Nodes[node]))
+		lw.assignPaths(lw.children[node], lw.paths[node], lw.world[node])
+	}
+}
+
+func (lw *layerWriter) writeNode(depth int, node uint32, parentWorld mgl32.Mat4) error {
+	n := lw.doc.Nodes[node]
+	name := lw.paths[node][strings.LastIndex(lw.paths[node], "/")+1:]
+	matrix := gltf_helper.NodeMatrix(n)
+	if n.Skin != nil {
+		// Skinned vertices are in the space of the skeleton's root
+		// node, regardless of where the mesh node is
+		skeletonWorld := mgl32.Ident4()
+		if skeleton := lw.doc.Skins[*n.Skin].Skeleton; skeleton != nil {
+			skeletonWorld = lw.world[*skeleton]
+		}
+		matrix = parentWorld.Inv().Mul4(skeletonWorld)
+	}
+
+	lw.printf(depth, "def Xform %v\n", Quote(name))
+	lw.printf(depth, "{\n")
+	if matrix != mgl32.Ident4() {
+		lw.printf(depth+1, "matrix4d xformOp:transform = %v\n", FormatMatrix(matrix))
+		lw.printf(depth+1, "uniform token[] xformOpOrder = [\"xformOp:transform\"]\n")
+	}
+	if n.Mesh != nil {
+		for i, prim := range lw.doc.Meshes[*n.Mesh].Primitives {
+			if err := lw.writePrimitive(depth+1, fmt.Sprintf("mesh_%v", i), prim); err != nil {
+				return fmt.Errorf("mesh %v: %w", lw.doc.Meshes[*n.Mesh].Name, err)
+			}
+		}
+	}
+	for _, child := range lw.children[node] {
+		if !lw.hasGeometry[child] {
+			continue
+		}
+		if err := lw.writeNode(depth+1, child, lw.world[node]); err != nil {
+			return err
+		}
+	}
+	for i, instance := range lw.instances[node] {
+		lw.printf(depth+1, "def Xform \"instance_%v\" (\n", i)
+		lw.printf(depth+2, "instanceable = true\n")
+		lw.printf(depth+2, "prepend references = <%v>\n", lw.paths[instance.Root])
+		lw.printf(depth+1, ")\n")
+		lw.printf(depth+1, "{\n")
+		lw.printf(depth+2, "matrix4d xformOp:transform = %v\n", FormatMatrix(instance.Matrix))
+		lw.printf(depth+2, "uniform token[] xformOpOrder = [\"xformOp:transform\"]\n")
+		lw.printf(depth+1, "}\n")
+	}
+	lw.printf(depth, "}\n")
+	return nil
+}
+
+// Writes the scene of doc as a layer with the default prim AssetPrim.
+// Materials are converted to UsdPreviewSurface, skeletons and animations
+// are omitted.
+func WriteLayer(w io.Writer, doc *gltf.Document, writeImage ImageWriter) error {
+	lw := &layerWriter{
+		w:           bufio.NewWriter(w),
+		doc:         doc,
+		writeImage:  writeImage,
+		imagePaths:  make(map[uint32]string),
+		paths:       make([]string, len(doc.Nodes)),
+		world:       make([]mgl32.Mat4, len(doc.Nodes)),
+		children:    make([][]uint32, len(doc.Nodes)),
+		instances:   gltf_helper.Instances(doc),
+		hasGeometry: make([]bool, len(doc.Nodes)),
+	}
+	for i, node := range doc.Nodes {
+		lw.children[i] = node.Children
+	}
+	roots := gltf_helper.RootNodes(doc)
+	for _, root := range roots {
+		lw.markGeometry(root)
+	}
+
+	rootPath := "/" + AssetPrim
+	lw.assignPaths(roots, rootPath, mgl32.Ident4())
+
+	WriteHeader(lw.w, AssetPrim)
+	lw.printf(0, "def Xform %v (\n", Quote(AssetPrim))
+	lw.printf(1, "kind = \"component\"\n")
+	lw.printf(0, ")\n")
+	lw.printf(0, "{\n")
+
+	if len(doc.Materials) > 0 {
+		lw.printf(1, "def Scope \"Looks\"\n")
+		lw.printf(1, "{\n")
+		used := make(map[string]int)
+		for i, mat := range doc.Materials {
+			name := uniqueName(used, PrimName(mat.Name))
+			lw.materials = append(lw.materials, rootPath+"/Looks/"+name)
+			lw.writeMaterial(2, lw.materials[i], mat)
+		}
+		lw.printf(1, "}\n")
+	}
+
+	for _, root := range roots {
+		if !lw.hasGeometry[root] {
+			continue
+		}
+		if err := lw.writeNode(1, root, mgl32.Ident4()); err != nil {
+			return err
+		}
+	}
+	lw.printf(0, "}\n")
+	if lw.err != nil {
+		return lw.err
+	}
+	return lw.w.Flush()
+}
@@ -0,0 +1,168 @@
+package wwise
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray"
+	"github.com/xypwn/filediver/wwise"
+)
+
+type eventPathStep struct {
+	ID       uint32   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Type     string   `json:"type"`
+	PlayMode string   `json:"play_mode,omitempty"`
+	Weight   *float64 `json:"weight,omitempty"`
+	Switches []string `json:"switches,omitempty"`
+}
+
+type eventSound struct {
+	Index int    `json:"index"`
+	File  string `json:"file,omitempty"` // relative to the event folder
+	// Sound or music track ID
+	ObjectID uint32 `json:"object_id"`
+	SourceID uint32 `json:"source_id"`
+	Stream   string `json:"stream,omitempty"`
+	// Chance of this sound being picked by random containers
+	// (1 if there are none)
+	Probability float64 `json:"probability"`
+	// Objects from the played object down to the sound
+	Path  []eventPathStep `json:"path"`
+	Error string          `json:"error,omitempty"`
+}
+
+type eventSounds struct {
+	ID     uint32       `json:"id"`
+	Name   string       `json:"name,omitempty"`
+	Sounds []eventSound `json:"sounds"`
+}
+
+// Collects the sounds below n in playback order.
+func collectEventSounds(n *bankGraphNode, path []eventPathStep, probability float64, res *[]eventSound) {
+	path = append(path, eventPathStep{
+		ID:       n.ID,
+		Name:     n.Name,
+		Type:     n.Type,
+		PlayMode: n.PlayMode,
+		Weight:   n.Weight,
+		Switches: n.Switches,
+	})
+	for _, src := range n.Sources {
+		*res = append(*res, eventSound{
+			ObjectID:    n.ID,
+			SourceID:    src.SourceID,
+			Stream:      src.Stream,
+			Probability: probability,
+			Path:        append([]eventPathStep(nil), path...),
+		})
+	}
+
+	var weightSum float64
+	if n.PlayMode == "random" {
+		for _, child := range n.Children {
+			if child.Weight != nil {
+				weightSum += *child.Weight
+			}
+		}
+	}
+	for _, child := range n.Children {
+		p := probability
+		if n.PlayMode == "random" {
+			if weightSum > 0 && child.Weight != nil {
+				p *= *child.Weight / weightSum
+			} else {
+				p /= float64(len(n.Children))
+			}
+		}
+		collectEventSounds(child, path, p, res)
+	}
+}
+
+var eventNameReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_")
+
+// Exports the sounds played by each event of the bank into
+// a folder named after the event.
+func convertBnkByEvent(ctx *extractor.Context, bnk *wwise.Bnk, graph bankGraph, format format) error {
+	readSource := func(snd eventSound) ([]byte, error) {
+		if snd.Stream != "" {
+			id := stingray.NewFileID(stingray.Sum(snd.Stream), stingray.Sum("wwise_stream"))
+			return ctx.Read(id, stingray.DataStream)
+		}
+		for i := range bnk.NumFiles() {
+			if bnk.FileID(i) == snd.SourceID {
+				r, err := bnk.OpenFile(i)
+				if err != nil {
+					return nil, err
+				}
+				return io.ReadAll(r)
+			}
+		}
+		return nil, fmt.Errorf("source %v is neither streamed nor contained in the bank", snd.SourceID)
+	}
+
+	for _, ev := range graph.Events {
+		var sounds []eventSound
+		for _, act := range ev.Actions {
+			if act.Target != nil {
+				collectEventSounds(act.Target, nil, 1, &sounds)
+			}
+		}
+		if len(sounds) == 0 {
+			continue
+		}
+
+		evName := ev.Name
+		if evName == "" {
+			evName = fmt.Sprint(ev.ID)
+		}
+		dir := ".bnk.events/" + eventNameReplacer.Replace(evName)
+		digits := len(fmt.Sprint(len(sounds)))
+		files := make(map[uint32]string) // source ID to file
+		for i := range sounds {
+			snd := &sounds[i]
+			snd.Index = i + 1
+			if file, ok := files[snd.SourceID]; ok {
+				snd.File = file
+				continue
+			}
+			data, err := readSource(*snd)
+			if err == nil {
+				sndName := snd.Path[len(snd.Path)-1].Name
+				if sndName == "" {
+					sndName = fmt.Sprint(snd.SourceID)
+				}
+				outName := fmt.Sprintf("%v/%0*d_%v", dir, digits, snd.Index, eventNameReplacer.Replace(sndName))
+				var outPath string
+				outPath, err = convertWemStream(ctx, outName, bytes.NewReader(data), format)
+				if err == nil {
+					snd.File = filepath.Base(outPath)
+					files[snd.SourceID] = snd.File
+				}
+			}
+			if err != nil {
+				snd.Error = err.Error()
+				ctx.Warnf("event %v: source %v: %v", evName, snd.SourceID, err)
+			}
+		}
+
+		out, err := ctx.CreateFile(dir + "/event.json")
+		if err != nil {
+			return err
+		}
+		err = writeJSON(out, eventSounds{
+			ID:     ev.ID,
+			Name:   ev.Name,
+			Sounds: sounds,
+		})
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+package wwise
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/stingray"
+	stingray_wwise "github.com/xypwn/filediver/stingray/wwise"
+	"github.com/xypwn/filediver/wwise"
+)
+
+type bankGraphSource struct {
+	SourceID uint32 `json:"source_id"`
+	// Name of the wwise_stream file, if the source is streamed
+	Stream string `json:"stream,omitempty"`
+	// Source media is contained in the bank itself
+	Embedded bool `json:"embedded,omitempty"`
+}
+
+type bankGraphNode struct {
+	ID         uint32 `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Type       string `json:"type"`
+	NotInBank  bool   `json:"not_in_bank,omitempty"`
+	ParseError string `json:"parse_error,omitempty"`
+
+	// Properties of this node within its parent container
+	Weight   *float64 `json:"weight,omitempty"`   // random container weight
+	Switches []string `json:"switches,omitempty"` // switch container values selecting this node
+	Layers   []uint32 `json:"layers,omitempty"`   // blend container layers containing this node
+
+	// Random/sequence containers
+	PlayMode  string `json:"play_mode,omitempty"`
+	LoopCount *int   `json:"loop_count,omitempty"` // 0 means infinite
+	// Switch containers. Music switches join the groups of their
+	// arguments, and the values selecting their children, with "/".
+	SwitchGroup   string `json:"switch_group,omitempty"`
+	DefaultSwitch string `json:"default_switch,omitempty"`
+	// Music segments
+	DurationMs float64 `json:"duration_ms,omitempty"`
+	// Sounds and music tracks
+	Sources []bankGraphSource `json:"sources,omitempty"`
+
+	Children []*bankGraphNode `json:"children,omitempty"`
+}
+
+type bankGraphAction struct {
+	ID         uint32 `json:"id"`
+	Type       string `json:"type"`
+	TargetID   uint32 `json:"target_id,omitempty"`
+	TargetName string `json:"target_name,omitempty"`
+	// Set/switch state actions
+	Group string `json:"group,omitempty"`
+	Value string `json:"value,omitempty"`
+	// Object tree played by play actions
+	Target *bankGraphNode `json:"target,omitempty"`
+}
+
+type bankGraphEvent struct {
+	ID      uint32            `json:"id"`
+	Name    string            `json:"name,omitempty"`
+	Actions []bankGraphAction `json:"actions"`
+}
+
+type bankGraphObject struct {
+	ID         uint32   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	Type       string   `json:"type"`
+	ParentID   uint32   `json:"parent_id,omitempty"`
+	Children   []uint32 `json:"children,omitempty"`
+	ParseError string   `json:"parse_error,omitempty"`
+}
+
+type bankGraph struct {
+	Bank    string            `json:"bank"`
+	Version uint32            `json:"version"`
+	Events  []bankGraphEvent  `json:"events"`
+	Objects []bankGraphObject `json:"objects"`
+}
+
+// Wwise short IDs of all known names. Hashing every known name takes
+// much longer than building a bank's graph, so the table is only
+// rebuilt when the known hashes change.
+var (
+	wwiseNamesMu         sync.Mutex
+	wwiseNamesHashes     uintptr // identity of the hash maps the table was built from
+	wwiseNamesThinHashes uintptr
+	wwiseNamesTable      map[uint32]string
+)
+
+// Returns a table resolving Wwise short IDs to known names.
+// The table is shared and must not be modified.
+func wwiseNames(ctx *extractor.Context) map[uint32]string {
+	wwiseNamesMu.Lock()
+	defer wwiseNamesMu.Unlock()
+	hashes := reflect.ValueOf(ctx.Hashes()).Pointer()
+	thinHashes := reflect.ValueOf(ctx.ThinHashes()).Pointer()
+	if wwiseNamesTable != nil && hashes == wwiseNamesHashes && thinHashes == wwiseNamesThinHashes {
+		return wwiseNamesTable
+	}
+	names := make(map[uint32]string)
+	add := func(name string) {
+		id := wwise.HashName(name)
+		// Pick the same name on collisions, regardless of map order
+		if other, ok := names[id]; !ok || name < other {
+			names[id] = name
+		}
+	}
+	for _, name := range ctx.Hashes() {
+		add(name)
+	}
+	for _, name := range ctx.ThinHashes() {
+		add(name)
+	}
+	wwiseNamesHashes, wwiseNamesThinHashes, wwiseNamesTable = hashes, thinHashes, names
+	return names
+}
+
+type bankGraphBuilder struct {
+	objects map[uint32]*wwise.BnkHircObject
+	// Children of each node, including nodes which only
+	// reference their parent
+	children map[uint32][]uint32
+	names    map[uint32]string
+	// Returns the sources of a sound or music track
+	sources func(src wwise.BnkHircSourceData) bankGraphSource
+}
+
+func (b *bankGraphBuilder) nameOrID(id uint32) string {
+	if name, ok := b.names[id]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// Builds the tree of nodes below (and including) id.
+// visiting is used to guard against cycles.
+func (b *bankGraphBuilder) node(id uint32, visiting map[uint32]bool) *bankGraphNode {
+	obj, ok := b.objects[id]
+	if !ok {
+		return &bankGraphNode{
+			ID:        id,
+			Name:      b.names[id],
+			Type:      "unknown",
+			NotInBank: true,
+		}
+	}
+	n := &bankGraphNode{
+		ID:   id,
+		Name: b.names[id],
+		Type: obj.Header.Type.String(),
+	}
+	if obj.ParseErr != nil {
+		n.ParseError = obj.ParseErr.Error()
+	}
+
+	switch obj.Header.Type {
+	case wwise.BnkHircObjectSound:
+		n.Sources = []bankGraphSource{b.sources(obj.Sound)}
+	case wwise.BnkHircObjectMusicTrack:
+		for _, src := range obj.MusicTrack.Sources {
+			n.Sources = append(n.Sources, b.sources(src))
+		}
+	case wwise.BnkHircObjectRandomSequence:
+		if obj.RandomSequence.Mode == wwise.BnkHircRandomSequenceModeRandom {
+			n.PlayMode = "random"
+		} else {
+			n.PlayMode = "sequence"
+		}
+		loopCount := int(obj.RandomSequence.LoopCount)
+		n.LoopCount = &loopCount
+	case wwise.BnkHircObjectSwitch:
+		n.SwitchGroup = b.nameOrID(obj.Switch.GroupID)
+		n.DefaultSwitch = b.nameOrID(obj.Switch.DefaultSwitch)
+	case wwise.BnkHircObjectMusicSwitch:
+		var groups []string
+		for _, arg := range obj.MusicSwitch.Arguments {
+			groups = append(groups, b.nameOrID(arg.GroupID))
+		}
+		n.SwitchGroup = strings.Join(groups, "/")
+	case wwise.BnkHircObjectMusicRandomSequence:
+		switch obj.MusicRandomSequence.Playlist.Type {
+		case 0, 1:
+			n.PlayMode = "sequence"
+		case 2, 3:
+			n.PlayMode = "random"
+		}
+		loopCount := int(obj.MusicRandomSequence.Playlist.LoopCount)
+		n.LoopCount = &loopCount
+	case wwise.BnkHircObjectMusicSegment:
+		n.DurationMs = obj.MusicSegment.Duration
+	}
+
+	if visiting[id] {
+		return n
+	}
+	visiting[id] = true
+	defer delete(visiting, id)
+
+	childIDs := b.children[id]
+	var playlistIDs []uint32
+	switch obj.Header.Type {
+	case wwise.BnkHircObjectRandomSequence:
+		for _, item := range obj.RandomSequence.Playlist {
+			playlistIDs = append(playlistIDs, item.ID)
+		}
+	case wwise.BnkHircObjectMusicRandomSequence:
+		walkMusicPlaylist(obj.MusicRandomSequence.Playlist, func(item wwise.BnkHircMusicPlaylistItem) {
+			playlistIDs = append(playlistIDs, item.SegmentID)
+		})
+	}
+	if playlistIDs != nil {
+		// Playlist order is the playback order of sequences
+		var ordered []uint32
+		for _, playlistID := range playlistIDs {
+			if slices.Contains(childIDs, playlistID) && !slices.Contains(ordered, playlistID) {
+				ordered = append(ordered, playlistID)
+			}
+		}
+		for _, childID := range childIDs {
+			if !slices.Contains(ordered, childID) {
+				ordered = append(ordered, childID)
+			}
+		}
+		childIDs = ordered
+	}
+	for _, childID := range childIDs {
+		child := b.node(childID, visiting)
+		switch obj.Header.Type {
+		case wwise.BnkHircObjectRandomSequence:
+			for _, item := range obj.RandomSequence.Playlist {
+				if item.ID == childID {
+					weight := float64(item.Weight) / 1000
+					child.Weight = &weight
+				}
+			}
+		case wwise.BnkHircObjectSwitch:
+			for _, pkg := range obj.Switch.Packages {
+				for _, nodeID := range pkg.NodeIDs {
+					if nodeID == childID {
+						child.Switches = append(child.Switches, b.nameOrID(pkg.SwitchID))
+					}
+				}
+			}
+		case wwise.BnkHircObjectMusicRandomSequence:
+			walkMusicPlaylist(obj.MusicRandomSequence.Playlist, func(item wwise.BnkHircMusicPlaylistItem) {
+				if item.SegmentID == childID && child.Weight == nil {
+					weight := float64(item.Weight) / 1000
+					child.Weight = &weight
+				}
+			})
+		case wwise.BnkHircObjectMusicSwitch:
+			walkDecisionTree(obj.MusicSwitch.Tree, nil, func(path []uint32, nodeID uint32) {
+				if nodeID != childID {
+					return
+				}
+				var values []string
+				for _, key := range path {
+					if key == 0 {
+						values = append(values, "*")
+					} else {
+						values = append(values, b.nameOrID(key))
+					}
+				}
+				child.Switches = append(child.Switches, strings.Join(values, "/"))
+			})
+		case wwise.BnkHircObjectBlend:
+			for _, layer := range obj.Blend.Layers {
+				for _, layerChildID := range layer.ChildIDs {
+					if layerChildID == childID {
+						child.Layers = append(child.Layers, layer.LayerID)
+					}
+				}
+			}
+		}
+		n.Children = append(n.Children, child)
+	}
+	return n
+}
+
+// Calls fn for every segment of a music playlist, in playback order.
+func walkMusicPlaylist(item wwise.BnkHircMusicPlaylistItem, fn func(item wwise.BnkHircMusicPlaylistItem)) {
+	if item.SegmentID != 0 {
+		fn(item)
+	}
+	for _, child := range item.Children {
+		walkMusicPlaylist(child, fn)
+	}
+}
+
+// Calls fn for every leaf of a music switch's decision tree with the
+// keys leading to it, excluding the root's.
+func walkDecisionTree(node wwise.BnkHircDecisionTreeNode, path []uint32, fn func(path []uint32, nodeID uint32)) {
+	if len(node.Children) == 0 {
+		if node.NodeID != 0 {
+			fn(path, node.NodeID)
+		}
+		return
+	}
+	for _, child := range node.Children {
+		walkDecisionTree(child, append(path[:len(path):len(path)], child.Key), fn)
+	}
+}
+
+func buildBankGraph(ctx *extractor.Context, bnk *wwise.Bnk, bankName string, streamExists func(sourceID uint32) (string, bool)) bankGraph {
+	b := &bankGraphBuilder{
+		objects:  make(map[uint32]*wwise.BnkHircObject),
+		children: make(map[uint32][]uint32),
+	}
+
+	embedded := make(map[uint32]bool)
+	for i := range bnk.NumFiles() {
+		embedded[bnk.FileID(i)] = true
+	}
+	b.sources = func(src wwise.BnkHircSourceData) bankGraphSource {
+		res := bankGraphSource{SourceID: src.SourceID}
+		if name, ok := streamExists(src.SourceID); ok {
+			res.Stream = name
+		}
+		res.Embedded = embedded[src.SourceID]
+		return res
+	}
+
+	for i := range bnk.HircObjects {
+		obj := &bnk.HircObjects[i]
+		b.objects[obj.Header.ObjectID] = obj
+	}
+	b.names = wwiseNames(ctx)
+
+	// Container child lists, plus nodes only referencing their
+	// parent (e.g. if the container failed to parse)
+	for i := range bnk.HircObjects {
+		obj := &bnk.HircObjects[i]
+		b.children[obj.Header.ObjectID] = append(b.children[obj.Header.ObjectID], obj.Children...)
+	}
+	for i := range bnk.HircObjects {
+		obj := &bnk.HircObjects[i]
+		parentID := obj.Node.ParentID
+		if parentID == 0 || obj.ParseErr != nil {
+			continue
+		}
+		if _, ok := b.objects[parentID]; !ok {
+			continue
+		}
+		if !slices.Contains(b.children[parentID], obj.Header.ObjectID) {
+			b.children[parentID] = append(b.children[parentID], obj.Header.ObjectID)
+		}
+	}
+
+	graph := bankGraph{
+		Bank:    bankName,
+		Version: bnk.Version,
+		Events:  []bankGraphEvent{},
+		Objects: []bankGraphObject{},
+	}
+	for i := range bnk.HircObjects {
+		obj := &bnk.HircObjects[i]
+		id := obj.Header.ObjectID
+
+		gObj := bankGraphObject{
+			ID:       id,
+			Name:     b.names[id],
+			Type:     obj.Header.Type.String(),
+			ParentID: obj.Node.ParentID,
+			Children: b.children[id],
+		}
+		if obj.ParseErr != nil {
+			gObj.ParseError = obj.ParseErr.Error()
+		}
+		graph.Objects = append(graph.Objects, gObj)
+
+		if obj.Header.Type != wwise.BnkHircObjectEvent {
+			continue
+		}
+		ev := bankGraphEvent{
+			ID:      id,
+			Name:    b.names[id],
+			Actions: []bankGraphAction{},
+		}
+		for _, actionID := range obj.Event.ActionIDs {
+			actObj, ok := b.objects[actionID]
+			if !ok || actObj.Header.Type != wwise.BnkHircObjectAction {
+				ev.Actions = append(ev.Actions, bankGraphAction{
+					ID:   actionID,
+					Type: "unknown",
+				})
+				continue
+			}
+			act := actObj.Action
+			gAct := bankGraphAction{
+				ID:         actionID,
+				Type:       act.Type.Kind().String(),
+				TargetID:   act.TargetID,
+				TargetName: b.names[act.TargetID],
+			}
+			switch act.Type.Kind() {
+			case wwise.BnkHircActionPlay, wwise.BnkHircActionPlayAndContinue:
+				if !act.TargetIsBus {
+					gAct.Target = b.node(act.TargetID, make(map[uint32]bool))
+				}
+			case wwise.BnkHircActionSetState, wwise.BnkHircActionSetSwitch:
+				gAct.Group = b.nameOrID(act.GroupID)
+				gAct.Value = b.nameOrID(act.ValueID)
+			}
+			ev.Actions = append(ev.Actions, gAct)
+		}
+		graph.Events = append(graph.Events, ev)
+	}
+	return graph
+}
+
+// Opens the bank being extracted and builds its event graph.
+func loadBankGraph(ctx *extractor.Context) (*wwise.Bnk, bankGraph, error) {
+	in, err := ctx.Open(ctx.FileID(), stingray.DataMain)
+	if err != nil {
+		return nil, bankGraph{}, err
+	}
+	bnk, err := stingray_wwise.OpenBnk(in)
+	if err != nil {
+		return nil, bankGraph{}, err
+	}
+
+	bankName := ctx.LookupHash(ctx.FileID().Name)
+	dir := path.Dir(bankName)
+	streamExists := func(sourceID uint32) (string, bool) {
+		name := path.Join(dir, fmt.Sprint(sourceID))
+		id := stingray.NewFileID(stingray.Sum(name), stingray.Sum("wwise_stream"))
+		return name, ctx.Exists(id, stingray.DataStream)
+	}
+
+	return bnk, buildBankGraph(ctx, bnk, bankName, streamExists), nil
+}
+
+// Writes the bank's events and the objects they play as JSON.
+func writeBankGraph(ctx *extractor.Context, graph bankGraph) error {
+	out, err := ctx.CreateFile(".bnk.json")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return writeJSON(out, graph)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	return enc.Encode(v)
+}
@@ -10,12 +10,11 @@ import (
 	"os"
 	"path"
 
-	"github.com/go-audio/audio"
-	"github.com/go-audio/wav"
-
 	"github.com/xypwn/filediver/extractor"
+	"github.com/xypwn/filediver/flac"
 	"github.com/xypwn/filediver/stingray"
 	stingray_wwise "github.com/xypwn/filediver/stingray/wwise"
+	"github.com/xypwn/filediver/wav"
 	"github.com/xypwn/filediver/wwise"
 )
 
@@ -26,6 +25,7 @@ const (
 	formatMp3
 	formatOgg
 	formatAac
+	formatFlac
 )
 
 type wemPcmF32ByteReader struct {
@@ -68,7 +68,7 @@ func (r *wemPcmF32ByteReader) Read(p []byte) (int, error) {
 	return len(p), nil
 }
 
-func pcmFloat32ToIntS16(dst []int, src []float32) {
+func pcmFloat32ToIntS16(dst []int16, src []float32) {
 	if len(dst) != len(src) {
 		panic("dst and src must be the same length")
 	}
@@ -79,90 +79,256 @@ func pcmFloat32ToIntS16(dst []int, src []float32) {
 			val = 32767
 		}
 		if val < -32768 {
-			val = 32768
+			val = -32768
 		}
-		dst[i] = val
+		dst[i] = int16(val)
 	}
 }
 
-func convertWemStream(ctx *extractor.Context, outName string, in io.ReadSeeker, format format) error {
-	if !ctx.Runner().Has("ffmpeg") {
-		format = formatWav
+// Loop comments as understood by most game audio tools
+// and players (in samples).
+func loopComments(dec *wwise.Wem) []string {
+	start, end, ok := dec.Loop()
+	if !ok {
+		return nil
 	}
+	return []string{
+		fmt.Sprintf("LOOPSTART=%v", start),
+		fmt.Sprintf("LOOPLENGTH=%v", end-start),
+	}
+}
 
-	dec, err := wwise.OpenWem(in)
+type markerJSON struct {
+	ID       uint32 `json:"id"`
+	Position int    `json:"position"`
+	Label    string `json:"label,omitempty"`
+}
+
+type loopJSON struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type markersJSON struct {
+	SampleRate int          `json:"sample_rate"`
+	Loop       *loopJSON    `json:"loop,omitempty"`
+	Markers    []markerJSON `json:"markers"`
+}
+
+// Writes the loop region and markers (in samples) to a
+// JSON file, if the stream has any.
+func writeWemMarkers(ctx *extractor.Context, outName string, dec *wwise.Wem) error {
+	data := markersJSON{
+		SampleRate: dec.SampleRate(),
+		Markers:    []markerJSON{},
+	}
+	if start, end, ok := dec.Loop(); ok {
+		data.Loop = &loopJSON{Start: start, End: end}
+	}
+	for _, m := range dec.Markers() {
+		data.Markers = append(data.Markers, markerJSON{
+			ID:       m.ID,
+			Position: m.Position,
+			Label:    m.Label,
+		})
+	}
+	if data.Loop == nil && len(data.Markers) == 0 {
+		return nil
+	}
+
+	outPath, err := ctx.AllocateFile(outName + ".markers.json")
 	if err != nil {
 		return err
 	}
-	switch format {
-	case formatWav:
-		outPath, err := ctx.AllocateFile(outName + ".wav")
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return writeJSON(out, data)
+}
+
+// Calls fn for each block of decoded 16-bit samples.
+// The slice passed to fn is only valid until fn returns.
+func decodeWemS16(dec *wwise.Wem, fn func(samples []int16) error) error {
+	smpBuf := make([]int16, dec.BufferSize())
+	for {
+		data, err := dec.Decode()
 		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
 			return err
 		}
-		out, err := os.Create(outPath)
-		if err != nil {
+		pcmFloat32ToIntS16(smpBuf[:len(data)], data)
+		if err := fn(smpBuf[:len(data)]); err != nil {
 			return err
 		}
-		defer out.Close()
-		enc := wav.NewEncoder(out, dec.SampleRate(), 16, dec.Channels(), 1)
-		defer enc.Close()
-		smpBuf := make([]int, dec.BufferSize())
-		for {
-			data, err := dec.Decode()
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					break
-				}
-				return err
-			}
+	}
+}
 
-			pcmFloat32ToIntS16(smpBuf[:len(data)], data)
+func writeWemWav(ctx *extractor.Context, outName string, dec *wwise.Wem) (string, error) {
+	outPath, err := ctx.AllocateFile(outName + ".wav")
+	if err != nil {
+		return "", err
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	enc, err := wav.NewWriter(out, dec.SampleRate(), dec.Channels(), uint32(dec.ChannelLayout()))
+	if err != nil {
+		return "", err
+	}
+	if start, end, ok := dec.Loop(); ok {
+		enc.SetLoop(uint32(start), uint32(end))
+	}
+	for _, m := range dec.Markers() {
+		enc.AddCue(wav.Cue{
+			ID:       m.ID,
+			Position: uint32(m.Position),
+			Label:    m.Label,
+		})
+	}
+	if err := decodeWemS16(dec, enc.WriteSamples); err != nil {
+		return "", err
+	}
+	return outPath, enc.Close()
+}
 
-			if err := enc.Write(&audio.IntBuffer{
-				Format: &audio.Format{
-					NumChannels: dec.Channels(),
-					SampleRate:  dec.SampleRate(),
-				},
-				Data:           smpBuf[:len(data)],
-				SourceBitDepth: 16,
-			}); err != nil {
-				return err
+func writeWemFlac(ctx *extractor.Context, outName string, dec *wwise.Wem) (string, error) {
+	outPath, err := ctx.AllocateFile(outName + ".flac")
+	if err != nil {
+		return "", err
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	enc, err := flac.NewEncoder(out, flac.Config{
+		SampleRate:    dec.SampleRate(),
+		Channels:      dec.Channels(),
+		BitsPerSample: 16,
+		ChannelMask:   uint32(dec.ChannelLayout()),
+		Comments:      loopComments(dec),
+	})
+	if err != nil {
+		return "", err
+	}
+	var smpBuf []int32
+	if err := decodeWemS16(dec, func(samples []int16) error {
+		smpBuf = smpBuf[:0]
+		for _, smp := range samples {
+			smpBuf = append(smpBuf, int32(smp))
+		}
+		return enc.Write(smpBuf)
+	}); err != nil {
+		return "", err
+	}
+	return outPath, enc.Close()
+}
+
+// Losslessly repacks Vorbis or Opus audio into an Ogg container.
+func writeWemOgg(ctx *extractor.Context, outName string, dec *wwise.Wem) (string, error) {
+	outPath, err := ctx.AllocateFile(outName + ".ogg")
+	if err != nil {
+		return "", err
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	return outPath, dec.WriteOgg(out, loopComments(dec))
+}
+
+func formatExt(format format) string {
+	switch format {
+	case formatWav:
+		return ".wav"
+	case formatMp3:
+		return ".mp3"
+	case formatOgg:
+		return ".ogg"
+	case formatAac:
+		return ".aac"
+	case formatFlac:
+		return ".flac"
+	default:
+		panic("unhandled case")
+	}
+}
+
+// Converts a WEM stream to the given format, falling back to
+// other formats if required. Returns the path of the audio file.
+func convertWemStream(ctx *extractor.Context, outName string, in io.ReadSeeker, format format) (string, error) {
+	dec, err := wwise.OpenWem(in)
+	if err != nil {
+		return "", err
+	}
+
+	if ctx.Config().Audio.Markers {
+		if err := writeWemMarkers(ctx, outName, dec); err != nil {
+			return "", err
+		}
+	}
+
+	// Only lossy re-encodes require FFmpeg.
+	hasFFmpeg := ctx.Runner().Has("ffmpeg")
+	switch format {
+	case formatOgg:
+		if dec.CanWriteOgg() {
+			return writeWemOgg(ctx, outName, dec)
+		}
+		if !hasFFmpeg {
+			format = formatWav
+		}
+	case formatMp3, formatAac:
+		if !hasFFmpeg {
+			if dec.CanWriteOgg() {
+				return writeWemOgg(ctx, outName, dec)
 			}
+			format = formatWav
 		}
+	}
+
+	switch format {
+	case formatWav:
+		return writeWemWav(ctx, outName, dec)
+	case formatFlac:
+		return writeWemFlac(ctx, outName, dec)
 	default:
 		if format == formatAac && !dec.ChannelLayout().HasName() {
 			// AAC doesn't support custom layouts
+			if dec.CanWriteOgg() {
+				return writeWemOgg(ctx, outName, dec)
+			}
 			format = formatOgg
 		}
-		var fmtExt string
-		switch format {
-		case formatMp3:
-			fmtExt = ".mp3"
-		case formatOgg:
-			fmtExt = ".ogg"
-		case formatAac:
-			fmtExt = ".aac"
-		}
-		outPath, err := ctx.AllocateFile(outName + fmtExt)
+		outPath, err := ctx.AllocateFile(outName + formatExt(format))
 		if err != nil {
-			return err
+			return "", err
 		}
-		if err := ctx.Runner().Run(
-			"ffmpeg",
-			nil,
-			newWemPcmF32ByteReader(dec, binary.LittleEndian),
+		args := []string{
 			"-f", "f32le",
 			"-ar", fmt.Sprint(dec.SampleRate()),
 			"-ac", fmt.Sprint(dec.Channels()),
 			"-channel_layout", fmt.Sprintf("0x%x", uint32(dec.ChannelLayout())),
 			"-i", "pipe:",
-			outPath,
-		); err != nil {
-			return err
 		}
+		for _, c := range loopComments(dec) {
+			args = append(args, "-metadata", c)
+		}
+		args = append(args, outPath)
+		return outPath, ctx.Runner().Run(
+			"ffmpeg",
+			nil,
+			newWemPcmF32ByteReader(dec, binary.LittleEndian),
+			args...,
+		)
 	}
-	return nil
 }
 
 func getFormat(ctx *extractor.Context) (format, error) {
@@ -177,6 +343,8 @@ func getFormat(ctx *extractor.Context) (format, error) {
 		return formatOgg, nil
 	case "aac":
 		return formatAac, nil
+	case "flac":
+		return formatFlac, nil
 	default:
 		return 0, fmt.Errorf("invalid audio output format: \"%v\"", cfg.Audio.Format)
 	}
@@ -207,7 +375,7 @@ func ConvertWem(ctx *extractor.Context) error {
 	if err != nil {
 		return err
 	}
-	if err := convertWemStream(ctx, "", r, format); err != nil {
+	if _, err := convertWemStream(ctx, "", r, format); err != nil {
 		return err
 	}
 	return nil
@@ -231,6 +399,15 @@ func ExtractBnk(ctx *extractor.Context) error {
 	if _, err := io.Copy(out, r); err != nil {
 		return err
 	}
+	if ctx.Config().Audio.EventGraph {
+		_, graph, err := loadBankGraph(ctx)
+		if err != nil {
+			return err
+		}
+		if err := writeBankGraph(ctx, graph); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -271,10 +448,25 @@ func ConvertBnk(ctx *extractor.Context) error {
 		return err
 	}
 
+	if cfg := ctx.Config(); cfg.Audio.EventGraph || cfg.Audio.ByEvent {
+		bnk, graph, err := loadBankGraph(ctx)
+		if err != nil {
+			return err
+		}
+		if cfg.Audio.EventGraph {
+			if err := writeBankGraph(ctx, graph); err != nil {
+				return err
+			}
+		}
+		if cfg.Audio.ByEvent {
+			return convertBnkByEvent(ctx, bnk, graph, format)
+		}
+	}
+
 	for id, dataResult := range streams {
 		err := dataResult.Err
 		if err == nil {
-			err = convertWemStream(ctx, fmt.Sprintf(".bnk.dir/%v", id), bytes.NewReader(dataResult.Data), format)
+			_, err = convertWemStream(ctx, fmt.Sprintf(".bnk.dir/%v", id), bytes.NewReader(dataResult.Data), format)
 		}
 		if err != nil {
 			ctx.Warnf("stream file with ID %v: %v", id, err)
@@ -0,0 +1,48 @@
+package flac
+
+// MSb-first bit writer which writes into a byte slice.
+type bitWriter struct {
+	buf    []byte
+	cur    uint64
+	curLen uint8
+}
+
+// Writes the lowest n bits of v (n <= 32).
+func (w *bitWriter) writeBits(v uint64, n uint8) {
+	w.cur = (w.cur << n) | (v & (1<<n - 1))
+	w.curLen += n
+	for w.curLen >= 8 {
+		w.curLen -= 8
+		w.buf = append(w.buf, byte(w.cur>>w.curLen))
+	}
+}
+
+func (w *bitWriter) writeSigned(v int64, n uint8) {
+	w.writeBits(uint64(v), n)
+}
+
+// Writes q zero bits followed by a one bit.
+func (w *bitWriter) writeUnary(q uint64) {
+	for q >= 32 {
+		w.writeBits(0, 32)
+		q -= 32
+	}
+	w.writeBits(1, uint8(q)+1)
+}
+
+// Pads with zero bits up to the next byte boundary.
+func (w *bitWriter) align() {
+	if w.curLen > 0 {
+		w.writeBits(0, 8-w.curLen)
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+func (w *bitWriter) reset() {
+	w.buf = w.buf[:0]
+	w.cur = 0
+	w.curLen = 0
+}
@@ -0,0 +1,27 @@
+package flac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBitWriter(t *testing.T) {
+	var bw bitWriter
+	bw.writeBits(0b101, 3)
+	bw.writeSigned(-1, 4)   // 1111
+	bw.writeBits(0xff00, 8) // only the lowest 8 bits: 00000000
+	bw.writeUnary(2)        // 001
+	bw.align()
+	if want := []byte{0b10111110, 0b00000000, 0b01000000}; !bytes.Equal(bw.bytes(), want) {
+		t.Errorf("expected %08b, got %08b", want, bw.bytes())
+	}
+
+	bw.reset()
+	bw.writeUnary(40) // longer than a single write
+	bw.writeBits(0xdeadbeef, 32)
+	bw.align()
+	want := []byte{0, 0, 0, 0, 0, 0b11101111, 0b01010110, 0b11011111, 0b01110111, 0b10000000}
+	if !bytes.Equal(bw.bytes(), want) {
+		t.Errorf("expected %08b, got %08b", want, bw.bytes())
+	}
+}
@@ -0,0 +1,23 @@
+package flac
+
+import "testing"
+
+func TestCRC(t *testing.T) {
+	check := []byte("123456789")
+	// Check values of CRC-8/SMBUS and CRC-16/UMTS, which use the same
+	// polynomials and parameters as FLAC
+	if crc := crc8(check); crc != 0xf4 {
+		t.Errorf("crc8: expected 0xf4, got 0x%02x", crc)
+	}
+	if crc := crc16(check); crc != 0xfee8 {
+		t.Errorf("crc16: expected 0xfee8, got 0x%04x", crc)
+	}
+	if crc := crc8(nil); crc != 0 {
+		t.Errorf("crc8 of nothing: expected 0, got 0x%02x", crc)
+	}
+	// Appending the big-endian CRC yields 0, which decoders rely on
+	b := append(check, byte(crc16(check)>>8), byte(crc16(check)))
+	if crc := crc16(b); crc != 0 {
+		t.Errorf("crc16 including its checksum: expected 0, got 0x%04x", crc)
+	}
+}
@@ -0,0 +1,564 @@
+// Implements a simple FLAC encoder.
+// Only fixed-predictor and verbatim/constant subframes are used, which
+// compresses reasonably well while keeping the encoder small.
+// See https://xiph.org/flac/format.html.
+package flac
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+const blockSize = 4096
+
+const maxRiceParam = 14 // 15 is the escape code
+
+const maxPartitionOrder = 8
+
+// Channel masks FLAC decoders assume when no
+// WAVEFORMATEXTENSIBLE_CHANNEL_MASK tag is present.
+var defaultChannelMasks = [...]uint32{
+	1: 0x4,   // FC
+	2: 0x3,   // FL FR
+	3: 0x7,   // FL FR FC
+	4: 0x33,  // FL FR BL BR
+	5: 0x37,  // FL FR FC BL BR
+	6: 0x3f,  // FL FR FC LFE BL BR
+	7: 0x70f, // FL FR FC LFE BC SL SR
+	8: 0x63f, // FL FR FC LFE BL BR SL SR
+}
+
+type Config struct {
+	SampleRate    int
+	Channels      int // 1...8
+	BitsPerSample int // 4...32
+	// WAVEFORMATEXTENSIBLE speaker mask, or 0 for
+	// the default FLAC channel order
+	ChannelMask uint32
+	// Vorbis comments in the form "NAME=value"
+	Comments []string
+}
+
+type Encoder struct {
+	w   io.Writer
+	cfg Config
+
+	streamInfoOffset int64 // offset of the STREAMINFO block data, -1 if not seekable
+
+	block        [][]int64 // per-channel samples of the current block
+	blockLen     int
+	frameNum     uint64
+	totalSamples uint64
+	minFrameSize int
+	maxFrameSize int
+	md5          hash.Hash
+	md5Buf       []byte
+
+	bw     bitWriter
+	closed bool
+}
+
+// Writes the FLAC header and metadata. If w is an io.WriteSeeker,
+// the total sample count and MD5 checksum are patched in on Close.
+func NewEncoder(w io.Writer, cfg Config) (*Encoder, error) {
+	if cfg.Channels < 1 || cfg.Channels > 8 {
+		return nil, fmt.Errorf("flac: unsupported channel count: %v", cfg.Channels)
+	}
+	if cfg.BitsPerSample < 4 || cfg.BitsPerSample > 32 {
+		return nil, fmt.Errorf("flac: unsupported bits per sample: %v", cfg.BitsPerSample)
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate >= 1<<20 {
+		return nil, fmt.Errorf("flac: unsupported sample rate: %v", cfg.SampleRate)
+	}
+
+	e := &Encoder{
+		w:                w,
+		cfg:              cfg,
+		streamInfoOffset: -1,
+		block:            make([][]int64, cfg.Channels),
+		md5:              md5.New(),
+	}
+	for i := range e.block {
+		e.block[i] = make([]int64, blockSize)
+	}
+
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if off, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			e.streamInfoOffset = off + 4 + 4
+		}
+	}
+
+	var hdr []byte
+	hdr = append(hdr, "fLaC"...)
+	hdr = appendBlockHeader(hdr, 0, false, 34) // STREAMINFO
+	hdr = append(hdr, e.streamInfo()...)
+	if cfg.ChannelMask != 0 && cfg.ChannelMask != defaultChannelMasks[cfg.Channels] {
+		cfg.Comments = append(
+			cfg.Comments[:len(cfg.Comments):len(cfg.Comments)],
+			fmt.Sprintf("WAVEFORMATEXTENSIBLE_CHANNEL_MASK=0x%x", cfg.ChannelMask),
+		)
+	}
+	var comments []byte
+	{
+		const vendor = "filediver flac encoder"
+		comments = binary.LittleEndian.AppendUint32(comments, uint32(len(vendor)))
+		comments = append(comments, vendor...)
+		comments = binary.LittleEndian.AppendUint32(comments, uint32(len(cfg.Comments)))
+		for _, c := range cfg.Comments {
+			comments = binary.LittleEndian.AppendUint32(comments, uint32(len(c)))
+			comments = append(comments, c...)
+		}
+	}
+	hdr = appendBlockHeader(hdr, 4, true, len(comments)) // VORBIS_COMMENT
+	hdr = append(hdr, comments...)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func appendBlockHeader(b []byte, typ uint8, isLast bool, size int) []byte {
+	if isLast {
+		typ |= 0x80
+	}
+	return append(b, typ, byte(size>>16), byte(size>>8), byte(size))
+}
+
+func (e *Encoder) streamInfo() []byte {
+	var bw bitWriter
+	// Min block size excludes the last block
+	bw.writeBits(blockSize, 16)
+	bw.writeBits(blockSize, 16)
+	bw.writeBits(uint64(e.minFrameSize), 24)
+	bw.writeBits(uint64(e.maxFrameSize), 24)
+	bw.writeBits(uint64(e.cfg.SampleRate), 20)
+	bw.writeBits(uint64(e.cfg.Channels-1), 3)
+	bw.writeBits(uint64(e.cfg.BitsPerSample-1), 5)
+	bw.writeBits(e.totalSamples>>32, 4)
+	bw.writeBits(e.totalSamples, 32)
+	b := bw.bytes()
+	if e.closed {
+		b = e.md5.Sum(b)
+	} else {
+		b = append(b, make([]byte, md5.Size)...) // unknown
+	}
+	return b
+}
+
+// Writes interleaved samples. len(samples) must be a
+// multiple of the channel count.
+func (e *Encoder) Write(samples []int32) error {
+	if e.closed {
+		return errors.New("flac: write to closed encoder")
+	}
+	if len(samples)%e.cfg.Channels != 0 {
+		return errors.New("flac: sample count must be a multiple of the channel count")
+	}
+	bytesPerSample := (e.cfg.BitsPerSample + 7) / 8
+	e.md5Buf = e.md5Buf[:0]
+	for i := 0; i < len(samples); i += e.cfg.Channels {
+		for ch := range e.cfg.Channels {
+			smp := samples[i+ch]
+			e.block[ch][e.blockLen] = int64(smp)
+			for b := range bytesPerSample {
+				e.md5Buf = append(e.md5Buf, byte(smp>>(8*b)))
+			}
+		}
+		e.blockLen++
+		if e.blockLen == blockSize {
+			if err := e.writeFrame(); err != nil {
+				return err
+			}
+		}
+	}
+	e.md5.Write(e.md5Buf)
+	return nil
+}
+
+// Writes the remaining samples and, if possible, updates the
+// STREAMINFO block. Does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	if e.blockLen > 0 {
+		if err := e.writeFrame(); err != nil {
+			return err
+		}
+	}
+	e.closed = true
+	if e.streamInfoOffset < 0 {
+		return nil
+	}
+	ws := e.w.(io.WriteSeeker)
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(e.streamInfoOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(e.streamInfo()); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+type channelAssignment uint8
+
+const (
+	// 0-7: independent channels
+	assignLeftSide  channelAssignment = 8
+	assignRightSide channelAssignment = 9
+	assignMidSide   channelAssignment = 10
+)
+
+func sampleRateCode(rate int) (code uint8, extra uint64, extraBits uint8) {
+	switch rate {
+	case 88200:
+		return 1, 0, 0
+	case 176400:
+		return 2, 0, 0
+	case 192000:
+		return 3, 0, 0
+	case 8000:
+		return 4, 0, 0
+	case 16000:
+		return 5, 0, 0
+	case 22050:
+		return 6, 0, 0
+	case 24000:
+		return 7, 0, 0
+	case 32000:
+		return 8, 0, 0
+	case 44100:
+		return 9, 0, 0
+	case 48000:
+		return 10, 0, 0
+	case 96000:
+		return 11, 0, 0
+	}
+	if rate%1000 == 0 && rate/1000 < 256 {
+		return 12, uint64(rate / 1000), 8
+	}
+	if rate < 1<<16 {
+		return 13, uint64(rate), 16
+	}
+	if rate%10 == 0 && rate/10 < 1<<16 {
+		return 14, uint64(rate / 10), 16
+	}
+	return 0, 0, 0 // get from STREAMINFO
+}
+
+func sampleSizeCode(bps int) uint8 {
+	switch bps {
+	case 8:
+		return 1
+	case 12:
+		return 2
+	case 16:
+		return 4
+	case 20:
+		return 5
+	case 24:
+		return 6
+	case 32:
+		return 7
+	default:
+		return 0 // get from STREAMINFO
+	}
+}
+
+// UTF-8-like coding of the frame number.
+func (w *bitWriter) writeUTF8(v uint64) {
+	if v < 0x80 {
+		w.writeBits(v, 8)
+		return
+	}
+	n := 2
+	for v >= 1<<(5*n+1) {
+		n++
+	}
+	w.writeBits((0xff00>>n)&0xff|(v>>(6*(n-1))), 8)
+	for i := n - 2; i >= 0; i-- {
+		w.writeBits(0x80|(v>>(6*i))&0x3f, 8)
+	}
+}
+
+func (e *Encoder) writeFrame() error {
+	n := e.blockLen
+	bps := e.cfg.BitsPerSample
+	chans := e.cfg.Channels
+
+	// Pick channel decorrelation for stereo
+	assignment := channelAssignment(chans - 1)
+	subframes := make([][]int64, chans)
+	subframeBps := make([]int, chans)
+	for ch := range chans {
+		subframes[ch] = e.block[ch][:n]
+		subframeBps[ch] = bps
+	}
+	if chans == 2 && bps < 32 {
+		left, right := e.block[0][:n], e.block[1][:n]
+		mid := make([]int64, n)
+		side := make([]int64, n)
+		for i := range n {
+			mid[i] = (left[i] + right[i]) >> 1
+			side[i] = left[i] - right[i]
+		}
+		costL, costR := estimateBits(left, bps), estimateBits(right, bps)
+		costM, costS := estimateBits(mid, bps), estimateBits(side, bps+1)
+		best := costL + costR
+		if c := costL + costS; c < best {
+			best = c
+			assignment = assignLeftSide
+			subframes = [][]int64{left, side}
+			subframeBps = []int{bps, bps + 1}
+		}
+		if c := costS + costR; c < best {
+			best = c
+			assignment = assignRightSide
+			subframes = [][]int64{side, right}
+			subframeBps = []int{bps + 1, bps}
+		}
+		if c := costM + costS; c < best {
+			assignment = assignMidSide
+			subframes = [][]int64{mid, side}
+			subframeBps = []int{bps, bps + 1}
+		}
+	}
+
+	bw := &e.bw
+	bw.reset()
+
+	// Frame header
+	bw.writeBits(0b11111111111110, 14) // sync code
+	bw.writeBits(0, 1)                 // reserved
+	bw.writeBits(0, 1)                 // fixed block size
+	var blockSizeCode uint8
+	if n == blockSize {
+		blockSizeCode = 12 // 256 * 2^(12-8) = 4096
+	} else {
+		blockSizeCode = 7 // 16 bit (blocksize-1) at end of header
+	}
+	bw.writeBits(uint64(blockSizeCode), 4)
+	rateCode, rateExtra, rateExtraBits := sampleRateCode(e.cfg.SampleRate)
+	bw.writeBits(uint64(rateCode), 4)
+	bw.writeBits(uint64(assignment), 4)
+	bw.writeBits(uint64(sampleSizeCode(bps)), 3)
+	bw.writeBits(0, 1) // reserved
+	bw.writeUTF8(e.frameNum)
+	if blockSizeCode == 7 {
+		bw.writeBits(uint64(n-1), 16)
+	}
+	if rateExtraBits > 0 {
+		bw.writeBits(rateExtra, rateExtraBits)
+	}
+	bw.writeBits(uint64(crc8(bw.bytes())), 8)
+
+	// Subframes
+	for ch := range subframes {
+		writeSubframe(bw, subframes[ch], subframeBps[ch])
+	}
+
+	// Footer
+	bw.align()
+	bw.writeBits(uint64(crc16(bw.bytes())), 16)
+
+	frame := bw.bytes()
+	if _, err := e.w.Write(frame); err != nil {
+		return err
+	}
+	if e.frameNum == 0 || len(frame) < e.minFrameSize {
+		e.minFrameSize = len(frame)
+	}
+	e.maxFrameSize = max(e.maxFrameSize, len(frame))
+	e.frameNum++
+	e.totalSamples += uint64(n)
+	e.blockLen = 0
+	return nil
+}
+
+// Computes the residual of a fixed predictor of the given order.
+func fixedResidual(dst, samples []int64, order int) {
+	for i := order; i < len(samples); i++ {
+		var pred int64
+		switch order {
+		case 0:
+			pred = 0
+		case 1:
+			pred = samples[i-1]
+		case 2:
+			pred = 2*samples[i-1] - samples[i-2]
+		case 3:
+			pred = 3*samples[i-1] - 3*samples[i-2] + samples[i-3]
+		case 4:
+			pred = 4*samples[i-1] - 6*samples[i-2] + 4*samples[i-3] - samples[i-4]
+		}
+		dst[i-order] = samples[i] - pred
+	}
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// Finds the optimal Rice parameter for the given values.
+// Returns the parameter and the number of bits needed.
+func bestRiceParam(residual []int64) (param uint8, bits uint64) {
+	var sum uint64
+	for _, v := range residual {
+		sum += zigzag(v)
+	}
+	bits = math.MaxUint64
+	for k := uint8(0); k <= maxRiceParam; k++ {
+		// Cost estimate: unary quotients + (k + 1) bits per value
+		var b uint64
+		if k == 0 {
+			b = sum + uint64(len(residual))
+		} else {
+			b = 0
+			for _, v := range residual {
+				b += zigzag(v) >> k
+			}
+			b += uint64(len(residual)) * uint64(k+1)
+		}
+		if b < bits {
+			bits, param = b, k
+		}
+		if sum>>k == 0 {
+			break
+		}
+	}
+	return
+}
+
+type residualCoding struct {
+	partitionOrder int
+	params         []uint8
+	bits           uint64
+}
+
+// Finds the best Rice partition order for a residual (which
+// excludes the predictor's warm-up samples).
+func bestResidualCoding(residual []int64, blockLen, predOrder int) residualCoding {
+	best := residualCoding{bits: math.MaxUint64}
+	for p := 0; p <= maxPartitionOrder; p++ {
+		if blockLen%(1<<p) != 0 || blockLen>>p <= predOrder {
+			break
+		}
+		partLen := blockLen >> p
+		coding := residualCoding{partitionOrder: p, bits: 2 + 4}
+		start := 0
+		for part := range 1 << p {
+			end := start + partLen
+			if part == 0 {
+				end -= predOrder
+			}
+			param, bits := bestRiceParam(residual[start:end])
+			coding.params = append(coding.params, param)
+			coding.bits += 4 + bits
+			start = end
+		}
+		if coding.bits < best.bits {
+			best = coding
+		}
+	}
+	return best
+}
+
+// Estimates the bits needed to encode the samples (used
+// for choosing stereo decorrelation).
+func estimateBits(samples []int64, bps int) uint64 {
+	best := uint64(len(samples)) * uint64(bps)
+	residual := make([]int64, len(samples))
+	for order := 0; order <= 4 && order < len(samples); order++ {
+		fixedResidual(residual, samples, order)
+		_, bits := bestRiceParam(residual[:len(samples)-order])
+		bits += uint64(order * bps)
+		best = min(best, bits)
+	}
+	return best
+}
+
+func writeSubframe(bw *bitWriter, samples []int64, bps int) {
+	n := len(samples)
+
+	isConstant := true
+	for _, v := range samples[1:] {
+		if v != samples[0] {
+			isConstant = false
+			break
+		}
+	}
+	if isConstant {
+		bw.writeBits(0, 1)        // padding
+		bw.writeBits(0b000000, 6) // CONSTANT
+		bw.writeBits(0, 1)        // no wasted bits
+		bw.writeSigned(samples[0], uint8(bps))
+		return
+	}
+
+	verbatimBits := uint64(n) * uint64(bps)
+	bestOrder := -1
+	var bestCoding residualCoding
+	bestBits := verbatimBits
+	residual := make([]int64, n)
+	var bestResidual []int64
+	for order := 0; order <= 4 && order < n; order++ {
+		fixedResidual(residual, samples, order)
+		coding := bestResidualCoding(residual[:n-order], n, order)
+		if coding.bits == math.MaxUint64 {
+			continue
+		}
+		bits := uint64(order*bps) + coding.bits
+		if bits < bestBits {
+			bestBits = bits
+			bestOrder = order
+			bestCoding = coding
+			bestResidual = append(bestResidual[:0], residual[:n-order]...)
+		}
+	}
+
+	if bestOrder < 0 {
+		bw.writeBits(0, 1)        // padding
+		bw.writeBits(0b000001, 6) // VERBATIM
+		bw.writeBits(0, 1)        // no wasted bits
+		for _, v := range samples {
+			bw.writeSigned(v, uint8(bps))
+		}
+		return
+	}
+
+	bw.writeBits(0, 1)                          // padding
+	bw.writeBits(0b001000|uint64(bestOrder), 6) // FIXED
+	bw.writeBits(0, 1)                          // no wasted bits
+	for _, v := range samples[:bestOrder] {
+		bw.writeSigned(v, uint8(bps))
+	}
+	bw.writeBits(0b00, 2) // Rice coding with 4-bit parameters
+	bw.writeBits(uint64(bestCoding.partitionOrder), 4)
+	partLen := n >> bestCoding.partitionOrder
+	start := 0
+	for part, param := range bestCoding.params {
+		end := start + partLen
+		if part == 0 {
+			end -= bestOrder
+		}
+		bw.writeBits(uint64(param), 4)
+		for _, v := range bestResidual[start:end] {
+			u := zigzag(v)
+			bw.writeUnary(u >> param)
+			if param > 0 {
+				bw.writeBits(u, param)
+			}
+		}
+		start = end
+	}
+}
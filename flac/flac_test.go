@@ -0,0 +1,437 @@
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// MSb-first bit reader for decoding the encoder's output.
+type bitReader struct {
+	b   []byte
+	pos int // in bits
+}
+
+func (r *bitReader) readBits(n uint8) (uint64, error) {
+	if r.pos+int(n) > 8*len(r.b) {
+		return 0, errors.New("unexpected end of data")
+	}
+	var v uint64
+	for range n {
+		v = v<<1 | uint64(r.b[r.pos/8]>>(7-r.pos%8))&1
+		r.pos++
+	}
+	return v, nil
+}
+
+func (r *bitReader) readSigned(n uint8) (int64, error) {
+	v, err := r.readBits(n)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+func (r *bitReader) readUnary() (uint64, error) {
+	var q uint64
+	for {
+		bit, err := r.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			return q, nil
+		}
+		q++
+	}
+}
+
+type streamInfo struct {
+	minBlockSize, maxBlockSize int
+	sampleRate                 int
+	channels                   int
+	bitsPerSample              int
+	totalSamples               uint64
+	md5                        [16]byte
+}
+
+// Decodes a FLAC stream as described in https://xiph.org/flac/format.html,
+// independently of the encoder. Supports all subframe types except LPC,
+// which the encoder doesn't produce. Returns the interleaved samples.
+func decodeFLAC(data []byte) (streamInfo, []string, []int64, error) {
+	var info streamInfo
+	var comments []string
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		return info, nil, nil, errors.New("missing fLaC marker")
+	}
+	data = data[4:]
+	for {
+		if len(data) < 4 {
+			return info, nil, nil, errors.New("truncated metadata block header")
+		}
+		isLast := data[0]&0x80 != 0
+		typ := data[0] & 0x7f
+		size := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		if len(data) < 4+size {
+			return info, nil, nil, errors.New("truncated metadata block")
+		}
+		block := data[4 : 4+size]
+		data = data[4+size:]
+		switch typ {
+		case 0:
+			r := &bitReader{b: block}
+			fields := make([]uint64, 8)
+			for i, n := range []uint8{16, 16, 24, 24, 20, 3, 5, 36} {
+				fields[i], _ = r.readBits(n)
+			}
+			info = streamInfo{
+				minBlockSize:  int(fields[0]),
+				maxBlockSize:  int(fields[1]),
+				sampleRate:    int(fields[4]),
+				channels:      int(fields[5]) + 1,
+				bitsPerSample: int(fields[6]) + 1,
+				totalSamples:  fields[7],
+			}
+			copy(info.md5[:], block[18:])
+		case 4:
+			vendorLen := binary.LittleEndian.Uint32(block)
+			block = block[4+vendorLen:]
+			n := binary.LittleEndian.Uint32(block)
+			block = block[4:]
+			for range n {
+				l := binary.LittleEndian.Uint32(block)
+				comments = append(comments, string(block[4:4+l]))
+				block = block[4+l:]
+			}
+		}
+		if isLast {
+			break
+		}
+	}
+
+	var samples []int64
+	for frameNum := uint64(0); len(data) > 0; frameNum++ {
+		frameSamples, n, err := decodeFrame(data, info, frameNum)
+		if err != nil {
+			return info, nil, nil, fmt.Errorf("frame %v: %w", frameNum, err)
+		}
+		samples = append(samples, frameSamples...)
+		data = data[n:]
+	}
+	return info, comments, samples, nil
+}
+
+func decodeFrame(data []byte, info streamInfo, frameNum uint64) (samples []int64, size int, err error) {
+	r := &bitReader{b: data}
+	read := func(n uint8) uint64 {
+		v, e := r.readBits(n)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	}
+	if read(14) != 0b11111111111110 || read(1) != 0 {
+		return nil, 0, errors.New("bad sync code")
+	}
+	if read(1) != 0 {
+		return nil, 0, errors.New("expected fixed block size stream")
+	}
+	blockSizeCode := read(4)
+	rateCode := read(4)
+	assignment := read(4)
+	sizeCode := read(3)
+	read(1)
+	// Frame number, UTF-8 coded
+	first := read(8)
+	number := first
+	if first >= 0x80 {
+		n := 0
+		for first&(0x80>>n) != 0 {
+			n++
+		}
+		number = first & (0x7f >> n)
+		for range n - 1 {
+			number = number<<6 | read(8)&0x3f
+		}
+	}
+	if number != frameNum {
+		return nil, 0, fmt.Errorf("expected frame number %v, got %v", frameNum, number)
+	}
+	var blockLen int
+	switch {
+	case blockSizeCode == 6:
+		blockLen = int(read(8)) + 1
+	case blockSizeCode == 7:
+		blockLen = int(read(16)) + 1
+	case blockSizeCode >= 8:
+		blockLen = 256 << (blockSizeCode - 8)
+	default:
+		return nil, 0, fmt.Errorf("unexpected block size code %v", blockSizeCode)
+	}
+	switch rateCode {
+	case 12:
+		read(8)
+	case 13, 14:
+		read(16)
+	}
+	if sizes := []int{0, 8, 12, 0, 16, 20, 24, 32}; sizeCode != 0 && sizes[sizeCode] != info.bitsPerSample {
+		return nil, 0, fmt.Errorf("sample size code %v doesn't match STREAMINFO", sizeCode)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if crc := read(8); uint8(crc) != crc8(data[:r.pos/8-1]) {
+		return nil, 0, errors.New("header CRC mismatch")
+	}
+
+	channels := info.channels
+	if assignment >= 8 {
+		channels = 2
+	}
+	subframes := make([][]int64, channels)
+	for ch := range subframes {
+		bps := uint8(info.bitsPerSample)
+		if (assignment == 8 && ch == 1) || (assignment == 9 && ch == 0) || (assignment == 10 && ch == 1) {
+			bps++ // side channel
+		}
+		subframes[ch], err = decodeSubframe(r, blockLen, bps)
+		if err != nil {
+			return nil, 0, fmt.Errorf("subframe %v: %w", ch, err)
+		}
+	}
+	for i := range blockLen {
+		switch assignment {
+		case 8:
+			subframes[1][i] = subframes[0][i] - subframes[1][i]
+		case 9:
+			subframes[0][i] += subframes[1][i]
+		case 10:
+			mid, side := subframes[0][i]<<1|subframes[1][i]&1, subframes[1][i]
+			subframes[0][i], subframes[1][i] = (mid+side)>>1, (mid-side)>>1
+		}
+	}
+
+	r.pos = (r.pos + 7) / 8 * 8
+	footer := r.pos / 8
+	if crc, err := r.readBits(16); err != nil {
+		return nil, 0, err
+	} else if uint16(crc) != crc16(data[:footer]) {
+		return nil, 0, errors.New("footer CRC mismatch")
+	}
+	for i := range blockLen {
+		for ch := range subframes {
+			samples = append(samples, subframes[ch][i])
+		}
+	}
+	return samples, footer + 2, nil
+}
+
+func decodeSubframe(r *bitReader, blockLen int, bps uint8) ([]int64, error) {
+	hdr, err := r.readBits(8)
+	if err != nil {
+		return nil, err
+	}
+	if hdr&0x81 != 0 {
+		return nil, errors.New("unexpected padding or wasted bits")
+	}
+	typ := hdr >> 1
+	samples := make([]int64, blockLen)
+	switch {
+	case typ == 0: // CONSTANT
+		v, err := r.readSigned(bps)
+		if err != nil {
+			return nil, err
+		}
+		for i := range samples {
+			samples[i] = v
+		}
+		return samples, nil
+	case typ == 1: // VERBATIM
+		for i := range samples {
+			if samples[i], err = r.readSigned(bps); err != nil {
+				return nil, err
+			}
+		}
+		return samples, nil
+	case typ >= 8 && typ <= 12: // FIXED
+	default:
+		return nil, fmt.Errorf("unsupported subframe type %v", typ)
+	}
+
+	order := int(typ - 8)
+	for i := range order {
+		if samples[i], err = r.readSigned(bps); err != nil {
+			return nil, err
+		}
+	}
+	if method, err := r.readBits(2); err != nil || method != 0 {
+		return nil, fmt.Errorf("expected Rice coding with 4-bit parameters, got %v", method)
+	}
+	partitionOrder, err := r.readBits(4)
+	if err != nil {
+		return nil, err
+	}
+	i := order
+	for part := range 1 << partitionOrder {
+		param, err := r.readBits(4)
+		if err != nil {
+			return nil, err
+		}
+		if param == 15 {
+			return nil, errors.New("unexpected escape code")
+		}
+		n := blockLen >> partitionOrder
+		if part == 0 {
+			n -= order
+		}
+		for range n {
+			q, err := r.readUnary()
+			if err != nil {
+				return nil, err
+			}
+			low, err := r.readBits(uint8(param))
+			if err != nil {
+				return nil, err
+			}
+			u := q<<param | low
+			samples[i] = int64(u>>1) ^ -int64(u&1)
+			i++
+		}
+	}
+	coeffs := [][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}[order]
+	for i := order; i < blockLen; i++ {
+		for j, c := range coeffs {
+			samples[i] += c * samples[i-1-j]
+		}
+	}
+	return samples, nil
+}
+
+func encodeFLAC(t *testing.T, cfg Config, samples []int32) []byte {
+	// Use a file, so the encoder can patch STREAMINFO
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enc, err := NewEncoder(f, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Split the writes unevenly across blocks
+	for len(samples) > 0 {
+		n := min(len(samples), 1000*cfg.Channels)
+		if err := enc.Write(samples[:n]); err != nil {
+			t.Fatal(err)
+		}
+		samples = samples[n:]
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestEncoder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const frames = 2*blockSize + 123
+	for _, test := range []struct {
+		name string
+		cfg  Config
+		// Generates the sample of a channel at a frame
+		sample func(ch, i int) int32
+	}{
+		{
+			name:   "mono sine",
+			cfg:    Config{SampleRate: 48000, Channels: 1, BitsPerSample: 16},
+			sample: func(ch, i int) int32 { return int32(20000 * math.Sin(float64(i)/20)) },
+		},
+		{
+			name: "correlated stereo",
+			cfg:  Config{SampleRate: 44100, Channels: 2, BitsPerSample: 16},
+			sample: func(ch, i int) int32 {
+				return int32(15000*math.Sin(float64(i)/30)) + int32(ch*(i%7))
+			},
+		},
+		{
+			name:   "independent stereo with silence",
+			cfg:    Config{SampleRate: 44100, Channels: 2, BitsPerSample: 16},
+			sample: func(ch, i int) int32 { return int32(ch * int(rng.Int31n(1<<16)-1<<15)) },
+		},
+		{
+			name:   "24 bit noise with odd sample rate",
+			cfg:    Config{SampleRate: 12345, Channels: 3, BitsPerSample: 24},
+			sample: func(ch, i int) int32 { return rng.Int31n(1<<24) - 1<<23 },
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			samples := make([]int32, 0, frames*test.cfg.Channels)
+			for i := range frames {
+				for ch := range test.cfg.Channels {
+					samples = append(samples, test.sample(ch, i))
+				}
+			}
+			test.cfg.Comments = []string{"TITLE=test"}
+			data := encodeFLAC(t, test.cfg, samples)
+
+			info, comments, decoded, err := decodeFLAC(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.sampleRate != test.cfg.SampleRate || info.channels != test.cfg.Channels || info.bitsPerSample != test.cfg.BitsPerSample {
+				t.Errorf("unexpected STREAMINFO %+v", info)
+			}
+			if info.minBlockSize != blockSize || info.maxBlockSize != blockSize || info.totalSamples != frames {
+				t.Errorf("unexpected STREAMINFO block sizes or sample count %+v", info)
+			}
+			if !slices.Equal(comments, test.cfg.Comments) {
+				t.Errorf("expected comments %q, got %q", test.cfg.Comments, comments)
+			}
+			if len(decoded) != len(samples) {
+				t.Fatalf("expected %v samples, got %v", len(samples), len(decoded))
+			}
+			for i := range samples {
+				if decoded[i] != int64(samples[i]) {
+					t.Fatalf("sample %v: expected %v, got %v", i, samples[i], decoded[i])
+				}
+			}
+
+			var pcm []byte
+			for _, smp := range samples {
+				for b := range (test.cfg.BitsPerSample + 7) / 8 {
+					pcm = append(pcm, byte(smp>>(8*b)))
+				}
+			}
+			if info.md5 != md5.Sum(pcm) {
+				t.Errorf("MD5 mismatch")
+			}
+		})
+	}
+}
+
+func TestEncoderChannelMask(t *testing.T) {
+	cfg := Config{SampleRate: 48000, Channels: 2, BitsPerSample: 16, ChannelMask: 0x3}
+	if _, comments, _, err := decodeFLAC(encodeFLAC(t, cfg, []int32{1, 2})); err != nil {
+		t.Fatal(err)
+	} else if len(comments) != 0 {
+		t.Errorf("expected no comments for the default channel mask, got %q", comments)
+	}
+	cfg.ChannelMask = 0x30 // BL BR
+	if _, comments, _, err := decodeFLAC(encodeFLAC(t, cfg, []int32{1, 2})); err != nil {
+		t.Fatal(err)
+	} else if !slices.Equal(comments, []string{"WAVEFORMATEXTENSIBLE_CHANNEL_MASK=0x30"}) {
+		t.Errorf("unexpected comments %q", comments)
+	}
+}
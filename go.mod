@@ -8,14 +8,13 @@ require (
 	github.com/andygrunwald/vdf v1.1.0
 	github.com/ebitengine/oto/v3 v3.4.0
 	github.com/expr-lang/expr v1.17.8
-	github.com/go-audio/audio v1.0.0
-	github.com/go-audio/wav v1.1.0
 	github.com/go-gl/gl v0.0.0-20231021071112-07e5d0ea2e71
 	github.com/go-gl/mathgl v1.2.0
 	github.com/gobwas/glob v0.2.3
 	github.com/hellflame/argparse v1.12.2
 	github.com/iancoleman/strcase v0.3.0
 	github.com/jfreymuth/vorbis v1.0.2
+	github.com/jj11hh/opus v1.0.1
 	github.com/jwalton/go-supportscolor v1.2.0
 	github.com/klauspost/compress v1.18.4
 	github.com/mattn/go-shellwords v1.0.12
@@ -46,7 +45,6 @@ require (
 	github.com/dchest/jsmin v1.0.0 // indirect
 	github.com/dsnet/compress v0.0.2-0.20230904184137-39efe44ab707 // indirect
 	github.com/ebitengine/purego v0.9.1 // indirect
-	github.com/go-audio/riff v1.0.0 // indirect
 	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
 	github.com/inconshreveable/go-update v0.0.0-20160112193335-8152e7eb6ccf // indirect
 	github.com/josephspurrier/goversioninfo v1.5.0 // indirect
@@ -64,6 +62,7 @@ require (
 	github.com/spf13/afero v1.15.0 // indirect
 	github.com/tc-hib/go-winres v0.3.3 // indirect
 	github.com/tc-hib/winres v0.2.1 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
 	github.com/ulikunitz/xz v0.5.15 // indirect
 	github.com/urfave/cli/v2 v2.25.7 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
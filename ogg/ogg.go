@@ -0,0 +1,164 @@
+// Implements a minimal Ogg bitstream writer (RFC 3533).
+// Packets are collected into pages of up to roughly pageTargetSize
+// bytes. Codecs which require certain packets to end a page (e.g. the
+// Vorbis/Opus identification headers) should call Flush() after writing them.
+package ogg
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	headerTypeContinued = 0x01
+	headerTypeBOS       = 0x02
+	headerTypeEOS       = 0x04
+)
+
+// Pages are flushed once they contain at least this amount of data.
+const pageTargetSize = 4096
+
+var crcTable = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = (r << 1) ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return
+}()
+
+func crc32(crc uint32, b []byte) uint32 {
+	for _, v := range b {
+		crc = (crc << 8) ^ crcTable[byte(crc>>24)^v]
+	}
+	return crc
+}
+
+// Writes a single logical Ogg bitstream.
+type Writer struct {
+	w      io.Writer
+	serial uint32
+	seq    uint32
+	closed bool
+
+	wroteFirstPage bool
+	continued      bool // first segment of current page continues a packet
+	segments       []byte
+	data           []byte
+	granulePos     int64
+	packetEnded    bool // at least one packet ends on the current page
+}
+
+// serial is the bitstream serial number, which should be unique within
+// a physical stream, but can be arbitrary for single-stream files.
+func NewWriter(w io.Writer, serial uint32) *Writer {
+	return &Writer{
+		w:      w,
+		serial: serial,
+	}
+}
+
+// Appends a packet to the stream. granulePos is the codec-specific
+// position after this packet has been decoded (e.g. the total
+// number of PCM samples for Vorbis).
+func (w *Writer) WritePacket(packet []byte, granulePos int64) error {
+	if w.closed {
+		return errors.New("ogg: write to closed writer")
+	}
+	for {
+		if len(w.segments) == 255 {
+			if err := w.flushPage(false); err != nil {
+				return err
+			}
+		}
+		n := min(len(packet), 255)
+		w.segments = append(w.segments, byte(n))
+		w.data = append(w.data, packet[:n]...)
+		packet = packet[n:]
+		if n < 255 {
+			break
+		}
+	}
+	w.granulePos = granulePos
+	w.packetEnded = true
+	if len(w.data) >= pageTargetSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Ends the current page, if there are any buffered packets.
+func (w *Writer) Flush() error {
+	if len(w.segments) == 0 {
+		return nil
+	}
+	return w.flushPage(false)
+}
+
+// Writes all remaining packets and marks the end of the stream.
+// Does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.flushPage(true); err != nil {
+		return err
+	}
+	w.closed = true
+	return nil
+}
+
+func (w *Writer) flushPage(eos bool) error {
+	var headerType uint8
+	if w.continued {
+		headerType |= headerTypeContinued
+	}
+	if !w.wroteFirstPage {
+		headerType |= headerTypeBOS
+	}
+	if eos {
+		headerType |= headerTypeEOS
+	}
+	granulePos := w.granulePos
+	if !w.packetEnded {
+		// No packet finishes on this page
+		granulePos = -1
+	}
+
+	hdr := make([]byte, 27, 27+len(w.segments))
+	copy(hdr[0:4], "OggS")
+	hdr[4] = 0 // version
+	hdr[5] = headerType
+	binary.LittleEndian.PutUint64(hdr[6:14], uint64(granulePos))
+	binary.LittleEndian.PutUint32(hdr[14:18], w.serial)
+	binary.LittleEndian.PutUint32(hdr[18:22], w.seq)
+	// hdr[22:26] is the checksum, which is calculated with the field set to 0
+	hdr[26] = uint8(len(w.segments))
+	hdr = append(hdr, w.segments...)
+
+	crc := crc32(crc32(0, hdr), w.data)
+	binary.LittleEndian.PutUint32(hdr[22:26], crc)
+
+	if _, err := w.w.Write(hdr); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(w.data); err != nil {
+		return err
+	}
+
+	w.seq++
+	w.wroteFirstPage = true
+	// A lacing value of 255 means the packet continues on the next page
+	w.continued = len(w.segments) > 0 && w.segments[len(w.segments)-1] == 255
+	w.packetEnded = false
+	w.segments = w.segments[:0]
+	w.data = w.data[:0]
+	return nil
+}
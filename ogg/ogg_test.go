@@ -0,0 +1,151 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func TestCRC(t *testing.T) {
+	// Check value of the CRC-32 without final XOR, as used by Ogg
+	if crc := crc32(0, []byte("123456789")); crc != 0x89a1897f {
+		t.Errorf("expected 0x89a1897f, got 0x%08x", crc)
+	}
+	if crc := crc32(crc32(0, []byte("1234")), []byte("56789")); crc != 0x89a1897f {
+		t.Errorf("expected incremental CRC 0x89a1897f, got 0x%08x", crc)
+	}
+}
+
+type page struct {
+	headerType uint8
+	granulePos int64
+	serial     uint32
+	seq        uint32
+	segments   []byte
+	data       []byte
+}
+
+func parsePages(t *testing.T, data []byte) []page {
+	var pages []page
+	for len(data) > 0 {
+		if !bytes.HasPrefix(data, []byte("OggS")) || data[4] != 0 {
+			t.Fatalf("page %v: bad capture pattern or version", len(pages))
+		}
+		numSegments := int(data[26])
+		p := page{
+			headerType: data[5],
+			granulePos: int64(binary.LittleEndian.Uint64(data[6:])),
+			serial:     binary.LittleEndian.Uint32(data[14:]),
+			seq:        binary.LittleEndian.Uint32(data[18:]),
+			segments:   data[27 : 27+numSegments],
+		}
+		size := 27 + numSegments
+		for _, s := range p.segments {
+			size += int(s)
+		}
+		p.data = data[27+numSegments : size]
+
+		hdr := slices.Clone(data[:size])
+		crc := binary.LittleEndian.Uint32(hdr[22:])
+		clear(hdr[22:26])
+		if want := crc32(0, hdr); crc != want {
+			t.Errorf("page %v: expected CRC 0x%08x, got 0x%08x", len(pages), want, crc)
+		}
+		pages = append(pages, p)
+		data = data[size:]
+	}
+	return pages
+}
+
+func TestWriter(t *testing.T) {
+	header := []byte("header")
+	short := bytes.Repeat([]byte{1}, 600)
+	exact := bytes.Repeat([]byte{2}, 255)
+	// Needs more than the 255 segments of a single page
+	long := bytes.Repeat([]byte{3}, 255*300)
+
+	var b bytes.Buffer
+	w := NewWriter(&b, 0x1234)
+	if err := w.WritePacket(header, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []struct {
+		data       []byte
+		granulePos int64
+	}{
+		{short, 100},
+		{exact, 200},
+		{long, 300},
+	} {
+		if err := w.WritePacket(p.data, p.granulePos); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePacket(header, 400); err == nil {
+		t.Error("expected error writing to closed writer")
+	}
+
+	pages := parsePages(t, b.Bytes())
+	var packets [][]byte
+	var packet []byte
+	for i, p := range pages {
+		if p.serial != 0x1234 || p.seq != uint32(i) {
+			t.Errorf("page %v: unexpected serial 0x%x or sequence number %v", i, p.serial, p.seq)
+		}
+		wantType := uint8(0)
+		if i == 0 {
+			wantType |= headerTypeBOS
+		}
+		if i == len(pages)-1 {
+			wantType |= headerTypeEOS
+		}
+		if len(packet) > 0 {
+			wantType |= headerTypeContinued
+		}
+		if p.headerType != wantType {
+			t.Errorf("page %v: expected header type %v, got %v", i, wantType, p.headerType)
+		}
+		data := p.data
+		packetEnded := false
+		for _, s := range p.segments {
+			packet = append(packet, data[:s]...)
+			data = data[s:]
+			if s < 255 {
+				packets = append(packets, packet)
+				packet = nil
+				packetEnded = true
+			}
+		}
+		if !packetEnded && p.granulePos != -1 {
+			t.Errorf("page %v: expected granule position -1 without a finished packet, got %v", i, p.granulePos)
+		}
+	}
+
+	// The long packet ends on the third page, which is flushed since it
+	// exceeds the target size, leaving an empty page to mark the end
+	if len(pages) != 4 {
+		t.Fatalf("expected 4 pages, got %v", len(pages))
+	}
+	if !slices.Equal(pages[0].segments, []byte{6}) || pages[0].granulePos != 0 {
+		t.Errorf("expected the header packet alone on the first page, got segments %v", pages[0].segments)
+	}
+	if !slices.Equal(pages[1].segments[:5], []byte{255, 255, 90, 255, 0}) {
+		t.Errorf("unexpected lacing values %v", pages[1].segments[:5])
+	}
+	if pages[1].granulePos != 200 || pages[2].granulePos != 300 {
+		t.Errorf("expected granule positions 200 and 300, got %v and %v", pages[1].granulePos, pages[2].granulePos)
+	}
+	if len(pages[3].segments) != 0 {
+		t.Errorf("expected an empty last page, got %v segments", len(pages[3].segments))
+	}
+	if len(packets) != 4 || !bytes.Equal(packets[0], header) || !bytes.Equal(packets[1], short) || !bytes.Equal(packets[2], exact) || !bytes.Equal(packets[3], long) {
+		t.Errorf("packets don't match the written ones")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/xypwn/filediver/stingray"
 	"github.com/xypwn/filediver/util"
@@ -27,6 +28,11 @@ type BuildInfo struct {
 	BuildId  uint32 `json:"build_id"`
 }
 
+// Time returns the time the game was built at.
+func (b *BuildInfo) Time() time.Time {
+	return time.Date(int(b.Year), time.Month(b.Month), int(b.Day), int(b.Hour), int(b.Minute), int(b.Second), 0, time.UTC)
+}
+
 func LoadBuildInfo(r io.Reader) (*BuildInfo, error) {
 	commit, err := util.ReadCString(r)
 	if err != nil {
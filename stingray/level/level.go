@@ -107,6 +107,15 @@ func (m *MetadataEntry) Value() any {
 	return nil
 }
 
+// Returns the values of the entries by their resolved keys.
+func MetadataValues(entries []MetadataEntry, lookupThinhash func(stingray.ThinHash) string) map[string]any {
+	values := make(map[string]any)
+	for i := range entries {
+		values[entries[i].Key(lookupThinhash)] = entries[i].Value()
+	}
+	return values
+}
+
 func parseMetadataEntry(r io.ReadSeeker) (*MetadataEntry, error) {
 	offset, err := r.Seek(0, io.SeekCurrent)
 	if err != nil {
@@ -174,6 +183,23 @@ type HashIndexRange struct {
 	End   uint32 // Exclusive
 }
 
+// Returns whether the range contains the index.
+func (h *HashIndexRange) Contains(idx int) bool {
+	return idx >= 0 && uint32(idx) >= h.Start && uint32(idx) < h.End
+}
+
+// Returns the names of all ranges which contain the index, e.g. the
+// groups of a unit in UnitHashIndexRange.
+func RangeNames(ranges []HashIndexRange, idx int) []stingray.ThinHash {
+	var names []stingray.ThinHash
+	for i := range ranges {
+		if ranges[i].Contains(idx) {
+			names = append(names, ranges[i].Hash)
+		}
+	}
+	return names
+}
+
 type UnknownTransformedItem struct {
 	Hash stingray.Hash
 	stingray.Transform
@@ -333,16 +359,23 @@ func readExtraUnitsContainer(r io.ReadSeeker, extraUnitsHeaderOffset uint32) (*E
 		if err := binary.Read(r, binary.LittleEndian, &extraPrefabsCount); err != nil {
 			return nil, err
 		}
-		var extraPrefabsOffset uint32
-		if err := binary.Read(r, binary.LittleEndian, &extraPrefabsOffset); err != nil {
-			return nil, fmt.Errorf("reading extraPrefabsOffsets: %v", err)
+		if extraPrefabsCount > 512 {
+			return nil, fmt.Errorf("extraPrefabsCount too big: %v", extraPrefabsCount)
 		}
-		if _, err := r.Seek(int64(extraUnitsHeaderOffset+extraUnitsHeader.ExtraPrefabsPtrListOffset+extraPrefabsOffset), io.SeekStart); err != nil {
-			return nil, fmt.Errorf("seeking extra prefab: %v", err)
+		extraPrefabsOffsets := make([]uint32, extraPrefabsCount)
+		if err := binary.Read(r, binary.LittleEndian, extraPrefabsOffsets); err != nil {
+			return nil, fmt.Errorf("reading extraPrefabsOffsets: %v", err)
 		}
-		extraUnitsContainer.ExtraPrefabs = make([]ExtraPrefab, 0)
-		if err := binary.Read(r, binary.LittleEndian, extraUnitsContainer.ExtraPrefabs); err != nil {
-			return nil, fmt.Errorf("reading extra prefab: %v", err)
+		extraUnitsContainer.ExtraPrefabs = make([]ExtraPrefab, 0, extraPrefabsCount)
+		for _, offset := range extraPrefabsOffsets {
+			if _, err := r.Seek(int64(extraUnitsHeaderOffset+extraUnitsHeader.ExtraPrefabsPtrListOffset+offset), io.SeekStart); err != nil {
+				return nil, fmt.Errorf("seeking extra prefab: %v", err)
+			}
+			var prefab ExtraPrefab
+			if err := binary.Read(r, binary.LittleEndian, &prefab); err != nil {
+				return nil, fmt.Errorf("reading extra prefab: %v", err)
+			}
+			extraUnitsContainer.ExtraPrefabs = append(extraUnitsContainer.ExtraPrefabs, prefab)
 		}
 	}
 
@@ -0,0 +1,306 @@
+package physics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Physics resources embed PhysX cooked mesh streams. Each stream starts with
+// "NXS" followed by an endianness byte, a four character chunk type and a
+// version.
+var cookedMagic = []byte("NXS")
+
+type CookedMeshType uint8
+
+const (
+	CookedMeshType_Convex CookedMeshType = iota
+	CookedMeshType_Triangle
+)
+
+func (t CookedMeshType) String() string {
+	switch t {
+	case CookedMeshType_Convex:
+		return "convex"
+	case CookedMeshType_Triangle:
+		return "triangle_mesh"
+	}
+	return fmt.Sprintf("CookedMeshType(%v)", uint8(t))
+}
+
+func (t CookedMeshType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+type ConvexPolygon struct {
+	Plane [4]float32
+	// Indices into the hull's vertices
+	Indices []uint32
+}
+
+type CookedMesh struct {
+	// Offset of the cooked stream within the physics resource
+	Offset  uint32
+	Type    CookedMeshType
+	Version uint32
+	// Vertices in the shape's local space
+	Vertices [][3]float32
+	// Triangle list indices into Vertices
+	Indices []uint32
+	// Polygons of convex hulls
+	Polygons []ConvexPolygon `json:",omitempty"`
+	// Per-triangle material indices of triangle meshes, if present
+	MaterialIndices []uint16 `json:",omitempty"`
+}
+
+type cookedHeader struct {
+	Magic   [3]byte
+	Endian  uint8
+	Chunk   [4]byte
+	Version uint32
+}
+
+func readCookedHeader(r io.Reader, chunk string) (cookedHeader, error) {
+	var hdr cookedHeader
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return hdr, err
+	}
+	if !bytes.Equal(hdr.Magic[:], cookedMagic) || string(hdr.Chunk[:]) != chunk {
+		return hdr, fmt.Errorf("expected cooked %v chunk", chunk)
+	}
+	if hdr.Endian != 1 {
+		return hdr, fmt.Errorf("big endian cooked %v chunk is unsupported", chunk)
+	}
+	if hdr.Version == 0 || hdr.Version > maxCookedVersion {
+		return hdr, fmt.Errorf("implausible cooked %v chunk version %v", chunk, hdr.Version)
+	}
+	return hdr, nil
+}
+
+// Upper bounds of element counts, versions and coordinates, to reject
+// false positives when scanning for cooked streams
+const (
+	maxCookedElements   = 1 << 22
+	maxCookedVersion    = 64
+	maxCookedCoordinate = 1e6
+)
+
+// Reports whether all vertices are finite and within a sensible range.
+func plausibleVertices(vertices [][3]float32) bool {
+	for _, v := range vertices {
+		for _, c := range v {
+			// Also false for NaN
+			if !(math.Abs(float64(c)) <= maxCookedCoordinate) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Loads a convex mesh (CVXM chunk, already consumed).
+func loadCookedConvex(r io.Reader) (*CookedMesh, error) {
+	var serialFlags uint32
+	if err := binary.Read(r, binary.LittleEndian, &serialFlags); err != nil {
+		return nil, err
+	}
+	if _, err := readCookedHeader(r, "CLHL"); err != nil {
+		return nil, err
+	}
+	if _, err := readCookedHeader(r, "CVHL"); err != nil {
+		return nil, err
+	}
+	var counts struct {
+		NumVertices    uint32
+		NumEdges       uint32
+		NumPolygons    uint32
+		NumPolyIndices uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &counts); err != nil {
+		return nil, err
+	}
+	// Hull indices are 8 bits wide, and a closed hull has at least
+	// four vertices and faces
+	if counts.NumVertices < 4 || counts.NumVertices > 0xff ||
+		counts.NumPolygons < 4 || counts.NumPolygons > 0xff ||
+		counts.NumPolyIndices > maxCookedElements {
+		return nil, fmt.Errorf("implausible convex hull size")
+	}
+
+	mesh := &CookedMesh{
+		Type:     CookedMeshType_Convex,
+		Vertices: make([][3]float32, counts.NumVertices),
+	}
+	if err := binary.Read(r, binary.LittleEndian, mesh.Vertices); err != nil {
+		return nil, err
+	}
+	if !plausibleVertices(mesh.Vertices) {
+		return nil, fmt.Errorf("implausible convex hull vertices")
+	}
+	type hullPolygonData struct {
+		Plane   [4]float32
+		VRef8   uint16
+		NbVerts uint8
+		MinIdx  uint8
+	}
+	polygons := make([]hullPolygonData, counts.NumPolygons)
+	if err := binary.Read(r, binary.LittleEndian, polygons); err != nil {
+		return nil, err
+	}
+	vertexData := make([]uint8, counts.NumPolyIndices)
+	if _, err := io.ReadFull(r, vertexData); err != nil {
+		return nil, err
+	}
+
+	for _, poly := range polygons {
+		normal := poly.Plane[:3]
+		lenSq := normal[0]*normal[0] + normal[1]*normal[1] + normal[2]*normal[2]
+		if !(math.Abs(float64(lenSq)-1) < 1e-3) {
+			return nil, fmt.Errorf("convex hull plane normal isn't normalized")
+		}
+		if poly.NbVerts < 3 {
+			return nil, fmt.Errorf("convex hull polygon has less than 3 vertices")
+		}
+		end := int(poly.VRef8) + int(poly.NbVerts)
+		if end > len(vertexData) {
+			return nil, fmt.Errorf("convex hull polygon indices out of range")
+		}
+		indices := make([]uint32, poly.NbVerts)
+		for i, idx := range vertexData[poly.VRef8:end] {
+			if int(idx) >= len(mesh.Vertices) {
+				return nil, fmt.Errorf("convex hull vertex index out of range")
+			}
+			indices[i] = uint32(idx)
+		}
+		mesh.Polygons = append(mesh.Polygons, ConvexPolygon{
+			Plane:   poly.Plane,
+			Indices: indices,
+		})
+		// Polygons are convex, so a fan triangulates them
+		for i := 2; i < len(indices); i++ {
+			mesh.Indices = append(mesh.Indices, indices[0], indices[i-1], indices[i])
+		}
+	}
+	return mesh, nil
+}
+
+// Triangle mesh serialization flags
+const (
+	meshFlagMaterials     = 1 << 0
+	meshFlag8BitIndices   = 1 << 2
+	meshFlag16BitIndices  = 1 << 3
+	meshFlagsKnownMaskMax = 1 << 6
+)
+
+// Loads a triangle mesh (MESH chunk, already consumed).
+func loadCookedTriangleMesh(r io.Reader, version uint32) (*CookedMesh, error) {
+	// Newer versions store the midphase structure type first
+	if version >= 14 {
+		var midphase uint32
+		if err := binary.Read(r, binary.LittleEndian, &midphase); err != nil {
+			return nil, err
+		}
+		if midphase > 1 {
+			return nil, fmt.Errorf("unknown triangle mesh midphase %v", midphase)
+		}
+	}
+	var hdr struct {
+		SerialFlags  uint32
+		NumVertices  uint32
+		NumTriangles uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.SerialFlags >= meshFlagsKnownMaskMax ||
+		hdr.NumVertices < 3 || hdr.NumVertices > maxCookedElements ||
+		hdr.NumTriangles == 0 || hdr.NumTriangles > maxCookedElements {
+		return nil, fmt.Errorf("implausible triangle mesh header")
+	}
+
+	mesh := &CookedMesh{
+		Type:     CookedMeshType_Triangle,
+		Vertices: make([][3]float32, hdr.NumVertices),
+		Indices:  make([]uint32, 3*hdr.NumTriangles),
+	}
+	if err := binary.Read(r, binary.LittleEndian, mesh.Vertices); err != nil {
+		return nil, err
+	}
+	if !plausibleVertices(mesh.Vertices) {
+		return nil, fmt.Errorf("implausible triangle mesh vertices")
+	}
+	switch {
+	case hdr.SerialFlags&meshFlag8BitIndices != 0:
+		indices := make([]uint8, len(mesh.Indices))
+		if _, err := io.ReadFull(r, indices); err != nil {
+			return nil, err
+		}
+		for i, idx := range indices {
+			mesh.Indices[i] = uint32(idx)
+		}
+	case hdr.SerialFlags&meshFlag16BitIndices != 0:
+		indices := make([]uint16, len(mesh.Indices))
+		if err := binary.Read(r, binary.LittleEndian, indices); err != nil {
+			return nil, err
+		}
+		for i, idx := range indices {
+			mesh.Indices[i] = uint32(idx)
+		}
+	default:
+		if err := binary.Read(r, binary.LittleEndian, mesh.Indices); err != nil {
+			return nil, err
+		}
+	}
+	for _, idx := range mesh.Indices {
+		if idx >= hdr.NumVertices {
+			return nil, fmt.Errorf("triangle mesh index out of range")
+		}
+	}
+	if hdr.SerialFlags&meshFlagMaterials != 0 {
+		mesh.MaterialIndices = make([]uint16, hdr.NumTriangles)
+		if err := binary.Read(r, binary.LittleEndian, mesh.MaterialIndices); err != nil {
+			return nil, err
+		}
+	}
+	return mesh, nil
+}
+
+// Finds and loads all convex and triangle meshes cooked into data.
+// As the actor and shape tables pointing to the streams aren't decoded,
+// data is scanned for stream headers. Candidates which fail to load or
+// whose counts, versions, coordinates, plane normals or indices are
+// implausible are skipped.
+func findCookedMeshes(data []byte) []CookedMesh {
+	var meshes []CookedMesh
+	for offset := 0; ; {
+		idx := bytes.Index(data[offset:], cookedMagic)
+		if idx == -1 {
+			break
+		}
+		offset += idx
+		r := bytes.NewReader(data[offset:])
+		var hdr cookedHeader
+		var mesh *CookedMesh
+		var err error
+		if hdr, err = readCookedHeader(r, "CVXM"); err == nil {
+			mesh, err = loadCookedConvex(r)
+		} else if _, err = r.Seek(0, io.SeekStart); err == nil {
+			if hdr, err = readCookedHeader(r, "MESH"); err == nil {
+				mesh, err = loadCookedTriangleMesh(r, hdr.Version)
+			}
+		}
+		if err != nil || mesh == nil {
+			offset += len(cookedMagic)
+			continue
+		}
+		mesh.Offset = uint32(offset)
+		mesh.Version = hdr.Version
+		meshes = append(meshes, *mesh)
+		// Skip the parsed mesh, the remaining data of the stream
+		// (bounds, mass, midphase structures) is left alone
+		offset += int(r.Size()) - r.Len()
+	}
+	return meshes
+}
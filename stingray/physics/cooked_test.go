@@ -0,0 +1,106 @@
+package physics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func writeCookedHeader(b *bytes.Buffer, chunk string, version uint32) {
+	b.WriteString("NXS\x01")
+	b.WriteString(chunk)
+	binary.Write(b, binary.LittleEndian, version)
+}
+
+// Builds a cooked convex hull of the tetrahedron (0,0,0), (1,0,0),
+// (0,1,0), (0,0,1).
+func makeCookedTetrahedron() []byte {
+	var b bytes.Buffer
+	writeCookedHeader(&b, "CVXM", 13)
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // serial flags
+	writeCookedHeader(&b, "CLHL", 6)
+	writeCookedHeader(&b, "CVHL", 6)
+	binary.Write(&b, binary.LittleEndian, [4]uint32{4, 6, 4, 12})
+	binary.Write(&b, binary.LittleEndian, [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}})
+	const invSqrt3 = 0.57735026
+	type polygon struct {
+		Plane   [4]float32
+		VRef8   uint16
+		NbVerts uint8
+		MinIdx  uint8
+	}
+	binary.Write(&b, binary.LittleEndian, []polygon{
+		{[4]float32{0, 0, -1, 0}, 0, 3, 0},
+		{[4]float32{0, -1, 0, 0}, 3, 3, 0},
+		{[4]float32{-1, 0, 0, 0}, 6, 3, 0},
+		{[4]float32{invSqrt3, invSqrt3, invSqrt3, -invSqrt3}, 9, 3, 1},
+	})
+	b.Write([]byte{0, 2, 1, 0, 1, 3, 0, 3, 2, 1, 2, 3})
+	return b.Bytes()
+}
+
+// Builds a cooked triangle mesh of a quad with 16-bit indices and
+// per-triangle materials.
+func makeCookedQuad() []byte {
+	var b bytes.Buffer
+	writeCookedHeader(&b, "MESH", 15)
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // midphase
+	binary.Write(&b, binary.LittleEndian, [3]uint32{meshFlagMaterials | meshFlag16BitIndices, 4, 2})
+	binary.Write(&b, binary.LittleEndian, [][3]float32{{0, 0, 0}, {2, 0, 0}, {2, 2, 0}, {0, 2, 0}})
+	binary.Write(&b, binary.LittleEndian, []uint16{0, 1, 2, 0, 2, 3})
+	binary.Write(&b, binary.LittleEndian, []uint16{5, 7})
+	return b.Bytes()
+}
+
+func TestFindCookedMeshes(t *testing.T) {
+	var data bytes.Buffer
+	data.Write(make([]byte, 16))
+	// False positives: a stray magic and a convex header followed by
+	// garbage counts
+	data.WriteString("NXS")
+	data.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	writeCookedHeader(&data, "CVXM", 13)
+	data.Write(bytes.Repeat([]byte{0xab}, 64))
+	// Triangle mesh whose vertices aren't finite
+	nan := makeCookedQuad()
+	copy(nan[32:], []byte{0x00, 0x00, 0xc0, 0x7f})
+	data.Write(nan)
+
+	convexOffset := data.Len()
+	data.Write(makeCookedTetrahedron())
+	data.Write(make([]byte, 5))
+	quadOffset := data.Len()
+	data.Write(makeCookedQuad())
+	data.Write(make([]byte, 8))
+
+	meshes := findCookedMeshes(data.Bytes())
+	if len(meshes) != 2 {
+		t.Fatalf("expected 2 meshes, got %v", len(meshes))
+	}
+
+	convex := meshes[0]
+	if convex.Type != CookedMeshType_Convex || convex.Offset != uint32(convexOffset) || convex.Version != 13 {
+		t.Errorf("unexpected convex mesh %v at %v, version %v", convex.Type, convex.Offset, convex.Version)
+	}
+	if len(convex.Vertices) != 4 || len(convex.Polygons) != 4 {
+		t.Errorf("expected 4 vertices and polygons, got %v and %v", len(convex.Vertices), len(convex.Polygons))
+	}
+	if !slices.Equal(convex.Indices, []uint32{0, 2, 1, 0, 1, 3, 0, 3, 2, 1, 2, 3}) {
+		t.Errorf("unexpected convex mesh indices %v", convex.Indices)
+	}
+
+	quad := meshes[1]
+	if quad.Type != CookedMeshType_Triangle || quad.Offset != uint32(quadOffset) || quad.Version != 15 {
+		t.Errorf("unexpected triangle mesh %v at %v, version %v", quad.Type, quad.Offset, quad.Version)
+	}
+	if !slices.Equal(quad.Indices, []uint32{0, 1, 2, 0, 2, 3}) {
+		t.Errorf("unexpected triangle mesh indices %v", quad.Indices)
+	}
+	if !slices.Equal(quad.MaterialIndices, []uint16{5, 7}) {
+		t.Errorf("unexpected triangle mesh materials %v", quad.MaterialIndices)
+	}
+	if quad.Vertices[2] != [3]float32{2, 2, 0} {
+		t.Errorf("unexpected triangle mesh vertex %v", quad.Vertices[2])
+	}
+}
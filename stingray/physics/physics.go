@@ -21,7 +21,12 @@ type Header struct {
 
 type Physics struct {
 	Header
-	// TODO: Add data chunks
+	// Convex and triangle meshes cooked into the resource, in the
+	// local space of the shape using them.
+	// TODO: Decode actors, primitive shapes (box, sphere,
+	// capsule), shape poses and materials, whose layout is still
+	// unknown. Until then, meshes can't be placed on their unit.
+	Meshes []CookedMesh
 }
 
 func LoadPhysics(mainR io.ReadSeeker) (*Physics, error) {
@@ -29,7 +34,15 @@ func LoadPhysics(mainR io.ReadSeeker) (*Physics, error) {
 	if err := binary.Read(mainR, binary.LittleEndian, &hdr); err != nil {
 		return nil, err
 	}
+	if _, err := mainR.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(mainR)
+	if err != nil {
+		return nil, err
+	}
 	return &Physics{
 		Header: hdr,
+		Meshes: findCookedMeshes(data),
 	}, nil
 }
@@ -0,0 +1,201 @@
+package state_machine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/xypwn/filediver/stingray"
+)
+
+func clamp01(x float32) float32 {
+	return min(max(x, 0), 1)
+}
+
+// Weight of value in the triangle rising from minimum to 1 at center,
+// falling back to 0 at maximum.
+func matchRange(value, minimum, center, maximum float32) float32 {
+	if minimum == center {
+		minimum -= 1
+	}
+	if maximum == center {
+		maximum += 1
+	}
+	return clamp01((value-minimum)/(center-minimum)) - clamp01((value-center)/(maximum-center))
+}
+
+func (n postFixNode) evaluate(variables []float32) (float32, error) {
+	if n.Operator == CustomBlendFunctionType_None {
+		if IsNaN(n.Value) {
+			idx := getVariableIdx(n.Value)
+			if idx >= uint32(len(variables)) {
+				return 0, fmt.Errorf("animation variable %v out of range", idx)
+			}
+			return variables[idx], nil
+		}
+		return math.Float32frombits(n.Value), nil
+	}
+
+	ops := make([]float32, len(n.Operands))
+	for i, operand := range n.Operands {
+		var err error
+		ops[i], err = operand.evaluate(variables)
+		if err != nil {
+			return 0, err
+		}
+	}
+	switch n.Operator {
+	case CustomBlendFunctionType_Add:
+		return ops[0] + ops[1], nil
+	case CustomBlendFunctionType_Sub:
+		return ops[0] - ops[1], nil
+	case CustomBlendFunctionType_Mult:
+		return ops[0] * ops[1], nil
+	case CustomBlendFunctionType_Divide:
+		return ops[0] / ops[1], nil
+	case CustomBlendFunctionType_Negate:
+		return -ops[0], nil
+	case CustomBlendFunctionType_UnaryPlus:
+		return ops[0], nil
+	case CustomBlendFunctionType_Sin:
+		return float32(math.Sin(float64(ops[0]))), nil
+	case CustomBlendFunctionType_Cos:
+		return float32(math.Cos(float64(ops[0]))), nil
+	case CustomBlendFunctionType_Abs:
+		return float32(math.Abs(float64(ops[0]))), nil
+	case CustomBlendFunctionType_Match:
+		return matchRange(ops[0], ops[1]-1, ops[1], ops[1]+1), nil
+	case CustomBlendFunctionType_Match2d:
+		return matchRange(ops[0], ops[1]-1, ops[1], ops[1]+1) *
+			matchRange(ops[2], ops[3]-1, ops[3], ops[3]+1), nil
+	case CustomBlendFunctionType_MatchRange:
+		return matchRange(ops[0], ops[1], ops[2], ops[3]), nil
+	case CustomBlendFunctionType_MatchRange2d:
+		return matchRange(ops[0], ops[1], ops[2], ops[3]) *
+			matchRange(ops[4], ops[5], ops[6], ops[7]), nil
+	case CustomBlendFunctionType_Rand:
+		return ops[0] + rand.Float32()*(ops[1]-ops[0]), nil
+	case CustomBlendFunctionType_Clamp:
+		return min(max(ops[0], ops[1]), ops[2]), nil
+	}
+	return 0, fmt.Errorf("unknown function type %v", n.Operator.String())
+}
+
+func (n postFixNode) describe(variables []string) string {
+	if n.Operator == CustomBlendFunctionType_None {
+		if IsNaN(n.Value) {
+			idx := getVariableIdx(n.Value)
+			if idx < uint32(len(variables)) {
+				return variables[idx]
+			}
+			return fmt.Sprintf("animation_variables[%v]", idx)
+		}
+		return fmt.Sprintf("%g", math.Float32frombits(n.Value))
+	}
+	params := make([]string, len(n.Operands))
+	for i, operand := range n.Operands {
+		params[i] = operand.describe(variables)
+	}
+	switch n.Operator {
+	case CustomBlendFunctionType_Add, CustomBlendFunctionType_Sub, CustomBlendFunctionType_Mult, CustomBlendFunctionType_Divide:
+		return fmt.Sprintf("(%v %v %v)", params[0], n.Operator.Operator(), params[1])
+	case CustomBlendFunctionType_Negate, CustomBlendFunctionType_UnaryPlus:
+		return n.Operator.Operator() + params[0]
+	}
+	return fmt.Sprintf("%v(%v)", n.Operator.Operator(), strings.Join(params, ", "))
+}
+
+func (f CustomBlendFunction) root() (postFixNode, error) {
+	operandStack, err := f.ParsePostfix()
+	if err != nil {
+		return postFixNode{}, err
+	}
+	if len(operandStack) != 1 {
+		return postFixNode{}, fmt.Errorf("expected a single expression in custom blend function, got %v", len(operandStack))
+	}
+	return operandStack[0], nil
+}
+
+// Evaluate runs the blend function for the given animation
+// variable values, indexed like StateMachine.AnimationVariableNames.
+func (f CustomBlendFunction) Evaluate(variables []float32) (float32, error) {
+	root, err := f.root()
+	if err != nil {
+		return 0, err
+	}
+	return root.evaluate(variables)
+}
+
+// Describe returns the blend function in function call notation,
+// e.g. "match_range(move_speed, 0, 2, 4)".
+func (f CustomBlendFunction) Describe(variables []string) (string, error) {
+	root, err := f.root()
+	if err != nil {
+		return "", err
+	}
+	return root.describe(variables), nil
+}
+
+// BlendFunctions returns the state's playback speed function (nil if it
+// has none) and the influence function of each animation (nil if the
+// animations aren't driven by blend functions).
+func (s *State) BlendFunctions() (speed *CustomBlendFunction, influences []CustomBlendFunction) {
+	funcs := s.CustomBlendFuncDefinition
+	if len(funcs) > 0 && funcs[0].DriverType == DriverType_PlaybackSpeed {
+		speed = &funcs[0]
+		funcs = funcs[1:]
+	}
+	if len(funcs) > 0 {
+		influences = funcs
+	}
+	return
+}
+
+// EvaluateBlend evaluates the state's blend functions for the given
+// animation variable values, returning the playback speed and the
+// weight of each of the state's animations.
+func (s *State) EvaluateBlend(variables []float32) (speed float32, weights []float32, err error) {
+	speedFunc, influences := s.BlendFunctions()
+	speed = 1
+	if speedFunc != nil {
+		speed, err = speedFunc.Evaluate(variables)
+		if err != nil {
+			return 0, nil, fmt.Errorf("playback speed: %w", err)
+		}
+	}
+
+	weights = make([]float32, len(s.AnimationHashes))
+	for i := range weights {
+		switch {
+		case influences != nil:
+			if i >= len(influences) {
+				continue
+			}
+			weights[i], err = influences[i].Evaluate(variables)
+			if err != nil {
+				return 0, nil, fmt.Errorf("influence of animation %v: %w", i, err)
+			}
+		case len(s.AnimationWeights) == len(s.AnimationHashes):
+			weights[i] = s.AnimationWeights[i]
+		default:
+			weights[i] = 1
+		}
+	}
+	return speed, weights, nil
+}
+
+// DefaultVariables returns the default value of each animation variable,
+// with overrides taking precedence.
+func (sm *StateMachine) DefaultVariables(overrides map[stingray.ThinHash]float32) []float32 {
+	variables := make([]float32, len(sm.AnimationVariableNames))
+	for i, name := range sm.AnimationVariableNames {
+		if i < len(sm.AnimationVariableValues) {
+			variables[i] = sm.AnimationVariableValues[i]
+		}
+		if value, ok := overrides[name]; ok {
+			variables[i] = value
+		}
+	}
+	return variables
+}
@@ -0,0 +1,173 @@
+package state_machine
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xypwn/filediver/stingray"
+)
+
+func TestEvaluateBlend(t *testing.T) {
+	variable := func(idx uint32) uint32 { return uint32(CustomBlendVariableType_VariableBase) + idx }
+	constant := math.Float32bits
+
+	state := State{
+		AnimationHashes: make([]stingray.Hash, 3),
+		CustomBlendFuncDefinition: []CustomBlendFunction{
+			// speed = move_speed / 2
+			{DriverType_PlaybackSpeed, []uint32{variable(0), constant(2), uint32(CustomBlendFunctionType_Divide)}},
+			// idle, walk and run, centered at speeds 0, 2 and 5
+			{DriverType_Influence, []uint32{variable(0), constant(0), constant(0), constant(2), uint32(CustomBlendFunctionType_MatchRange)}},
+			{DriverType_Influence, []uint32{variable(0), constant(0), constant(2), constant(5), uint32(CustomBlendFunctionType_MatchRange)}},
+			{DriverType_Influence, []uint32{variable(0), constant(2), constant(5), constant(5), uint32(CustomBlendFunctionType_MatchRange)}},
+		},
+	}
+
+	for _, test := range []struct {
+		speed   float32
+		weights []float32
+	}{
+		{0, []float32{1, 0, 0}},
+		{1, []float32{0.5, 0.5, 0}},
+		{3.5, []float32{0, 0.5, 0.5}},
+		{5, []float32{0, 0, 1}},
+	} {
+		speed, weights, err := state.EvaluateBlend([]float32{test.speed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if speed != test.speed/2 {
+			t.Errorf("move_speed=%v: expected playback speed %v, got %v", test.speed, test.speed/2, speed)
+		}
+		for i := range weights {
+			if math.Abs(float64(weights[i]-test.weights[i])) > 1e-6 {
+				t.Errorf("move_speed=%v: expected weights %v, got %v", test.speed, test.weights, weights)
+				break
+			}
+		}
+	}
+
+	desc, err := state.CustomBlendFuncDefinition[2].Describe([]string{"move_speed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc != "match_range(move_speed, 0, 2, 5)" {
+		t.Errorf("unexpected description %q", desc)
+	}
+}
+
+// evalExpression evaluates a driver expression made up of numbers, the
+// basic arithmetic operators, parentheses and clamp.
+func evalExpression(t *testing.T, expr string) float64 {
+	pos := 0
+	var parseSum func() float64
+	peek := func() byte {
+		if pos < len(expr) {
+			return expr[pos]
+		}
+		return 0
+	}
+	expect := func(c byte) {
+		if peek() != c {
+			t.Fatalf("expected %q at %v in %q", c, pos, expr)
+		}
+		pos++
+	}
+	var parseFactor func() float64
+	parseFactor = func() float64 {
+		switch {
+		case peek() == '-':
+			pos++
+			return -parseFactor()
+		case peek() == '(':
+			pos++
+			v := parseSum()
+			expect(')')
+			return v
+		case strings.HasPrefix(expr[pos:], "clamp("):
+			pos += len("clamp(")
+			v := parseSum()
+			expect(',')
+			lo := parseSum()
+			expect(',')
+			hi := parseSum()
+			expect(')')
+			return min(max(v, lo), hi)
+		}
+		start := pos
+		for pos < len(expr) && (expr[pos] == '.' || expr[pos] >= '0' && expr[pos] <= '9') {
+			pos++
+		}
+		v, err := strconv.ParseFloat(expr[start:pos], 64)
+		if err != nil {
+			t.Fatalf("%q: %v", expr, err)
+		}
+		return v
+	}
+	parseProduct := func() float64 {
+		v := parseFactor()
+		for peek() == '*' || peek() == '/' {
+			op := peek()
+			pos++
+			if op == '*' {
+				v *= parseFactor()
+			} else {
+				v /= parseFactor()
+			}
+		}
+		return v
+	}
+	parseSum = func() float64 {
+		v := parseProduct()
+		for peek() == '+' || peek() == '-' {
+			op := peek()
+			pos++
+			if op == '+' {
+				v += parseProduct()
+			} else {
+				v -= parseProduct()
+			}
+		}
+		return v
+	}
+	v := parseSum()
+	if pos != len(expr) {
+		t.Fatalf("unexpected %q in %q", expr[pos:], expr)
+	}
+	return v
+}
+
+func TestDriverExpressionMatchesEvaluate(t *testing.T) {
+	variable := func(idx uint32) uint32 { return uint32(CustomBlendVariableType_VariableBase) + idx }
+	constant := math.Float32bits
+
+	for _, f := range []CustomBlendFunction{
+		{DriverType_Influence, []uint32{variable(0), constant(2), uint32(CustomBlendFunctionType_Match)}},
+		{DriverType_Influence, []uint32{variable(0), constant(2), variable(1), constant(1), uint32(CustomBlendFunctionType_Match2d)}},
+		{DriverType_Influence, []uint32{variable(0), constant(1), constant(2), constant(4), uint32(CustomBlendFunctionType_MatchRange)}},
+	} {
+		driver, err := f.ToDriver([]string{"x", "y"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc, err := f.Describe([]string{"x", "y"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, values := range [][]float32{{0, 0}, {1.5, 1}, {2, 1}, {2.5, 0.5}, {3, 1.5}, {3.5, 2}} {
+			want, err := f.Evaluate(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expr := strings.NewReplacer(
+				"x", strconv.FormatFloat(float64(values[0]), 'f', -1, 32),
+				"y", strconv.FormatFloat(float64(values[1]), 'f', -1, 32),
+			).Replace(driver.Expression)
+			if got := evalExpression(t, expr); math.Abs(got-float64(want)) > 1e-6 {
+				t.Errorf("%v at %v: expression %q gives %v, expected %v", desc, values, driver.Expression, got, want)
+			}
+		}
+	}
+}
@@ -422,7 +422,7 @@ func (n postFixNode) ToExpression(variables []string) string {
 	case CustomBlendFunctionType_Match:
 		variable := n.Operands[0].ToExpression(variables)
 		constant := n.Operands[1].ToExpression(variables)
-		return fmt.Sprintf("clamp(((%v)-(%v)-1.0),0.0,1.0)-clamp(((%v)-(%v)),0.0,1.0)",
+		return fmt.Sprintf("clamp(((%v)-(%v)+1.0),0.0,1.0)-clamp(((%v)-(%v)),0.0,1.0)",
 			variable,
 			constant,
 			variable,
@@ -456,7 +456,7 @@ func (n postFixNode) ToExpression(variables []string) string {
 		constant0 := n.Operands[1].ToExpression(variables)
 		variable1 := n.Operands[2].ToExpression(variables)
 		constant1 := n.Operands[3].ToExpression(variables)
-		return fmt.Sprintf("(clamp(((%v)-(%v)-1.0),0.0,1.0)-clamp(((%v)-(%v)),0.0,1.0))*(clamp(((%v)-(%v)-1.0),0.0,1.0)-clamp(((%v)-(%v)),0.0,1.0))",
+		return fmt.Sprintf("(clamp(((%v)-(%v)+1.0),0.0,1.0)-clamp(((%v)-(%v)),0.0,1.0))*(clamp(((%v)-(%v)+1.0),0.0,1.0)-clamp(((%v)-(%v)),0.0,1.0))",
 			variable0,
 			constant0,
 			variable0,
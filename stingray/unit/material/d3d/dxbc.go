@@ -160,6 +160,19 @@ func (d *DXBC) ToGLSL() string {
 	return toReturn
 }
 
+func (d *DXBC) ToHLSL() string {
+	toReturn := fmt.Sprintf("// Shader model %v.%v\n", d.ShaderCode.Version.Major, d.ShaderCode.Version.Minor)
+	toReturn += d3dops.DecompileHLSL(
+		d.ShaderCode.ProgramType,
+		d.ResourceDefinitions.ConstantBuffers,
+		d.InputSignature.Elements,
+		d.OutputSignature.Elements,
+		d.ResourceDefinitions.ResourceBindings,
+		d.ShaderCode.Opcodes,
+	)
+	return toReturn
+}
+
 func getGLSL(opcode d3dops.Opcode, cbs []d3dops.ConstantBuffer, isg, osg []d3dops.Element, res []d3dops.ResourceBinding) string {
 	// defer func() {
 	// 	if r := recover(); r != nil {
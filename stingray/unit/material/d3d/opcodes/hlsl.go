@@ -0,0 +1,2143 @@
+package d3dops
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Expressions longer than this are assigned to their register
+// instead of being folded into the instruction that reads them.
+const hlslMaxFoldLength = 160
+
+// hlslKind is the type an HLSL expression evaluates to. Registers
+// hold untyped 32-bit values, so expressions are bitcast with
+// asfloat/asint/asuint whenever they cross between kinds.
+type hlslKind uint8
+
+const (
+	hlslAny hlslKind = iota // keep the kind the expression already has
+	hlslFloat
+	hlslInt
+	hlslUint
+	hlslBool
+)
+
+func hlslKindFromNumberType(t opcodeNumberType) hlslKind {
+	switch t {
+	case internalNumberTypeInt:
+		return hlslInt
+	case internalNumberTypeUInt:
+		return hlslUint
+	case internalNumberTypeFloat, internalNumberTypeDouble:
+		return hlslFloat
+	case internalNumberTypeBool:
+		return hlslBool
+	}
+	return hlslAny
+}
+
+func hlslKindFromComponentType(t RegisterComponentType) hlslKind {
+	switch t {
+	case RCT_SINT32:
+		return hlslInt
+	case RCT_UINT32:
+		return hlslUint
+	}
+	return hlslFloat
+}
+
+func hlslKindFromVariableType(t ShaderVariableType) hlslKind {
+	switch t.GLSLPrefix() {
+	case "i":
+		return hlslInt
+	case "u":
+		return hlslUint
+	case "b":
+		return hlslBool
+	}
+	return hlslFloat
+}
+
+func (k hlslKind) typeName(width int) string {
+	name := "float"
+	switch k {
+	case hlslInt:
+		name = "int"
+	case hlslUint:
+		name = "uint"
+	case hlslBool:
+		name = "bool"
+	}
+	if width > 1 {
+		name += strconv.Itoa(width)
+	}
+	return name
+}
+
+// Operator precedence, lowest to highest.
+const (
+	hlslPrecTernary = iota + 1
+	hlslPrecLogicalOr
+	hlslPrecLogicalAnd
+	hlslPrecBitOr
+	hlslPrecBitXor
+	hlslPrecBitAnd
+	hlslPrecEquality
+	hlslPrecRelational
+	hlslPrecShift
+	hlslPrecAdditive
+	hlslPrecMultiplicative
+	hlslPrecUnary
+	hlslPrecPrimary
+)
+
+type hlslExpr struct {
+	Text  string
+	Kind  hlslKind
+	Prec  int
+	Width int
+	// Set if the expression is a plain read of temp registers,
+	// which store every kind as float bits.
+	tempRead bool
+}
+
+// paren returns the expression text, parenthesized if it binds
+// less tightly than prec.
+func (e hlslExpr) paren(prec int) string {
+	if e.Prec < prec {
+		return "(" + e.Text + ")"
+	}
+	return e.Text
+}
+
+func hlslPrimary(text string, kind hlslKind, width int) hlslExpr {
+	return hlslExpr{Text: text, Kind: kind, Prec: hlslPrecPrimary, Width: width}
+}
+
+func hlslCall(name string, kind hlslKind, width int, args ...hlslExpr) hlslExpr {
+	argTexts := make([]string, len(args))
+	for i, arg := range args {
+		argTexts[i] = arg.Text
+	}
+	return hlslPrimary(name+"("+strings.Join(argTexts, ", ")+")", kind, width)
+}
+
+// hlslBitwise reports whether prec is that of a bitwise or shift
+// operator, which are always parenthesized when mixed with other
+// operators for readability.
+func hlslBitwise(prec int) bool {
+	return prec == hlslPrecShift || (prec >= hlslPrecBitOr && prec <= hlslPrecBitAnd)
+}
+
+func hlslBinary(op string, prec int, kind hlslKind, a, b hlslExpr) hlslExpr {
+	operand := func(e hlslExpr, minPrec int) string {
+		if e.Prec != prec && e.Prec < hlslPrecUnary && (hlslBitwise(prec) || hlslBitwise(e.Prec)) {
+			return "(" + e.Text + ")"
+		}
+		return e.paren(minPrec)
+	}
+	return hlslExpr{
+		Text:  operand(a, prec) + " " + op + " " + operand(b, prec+1),
+		Kind:  kind,
+		Prec:  prec,
+		Width: max(a.Width, b.Width),
+	}
+}
+
+func hlslUnary(op string, e hlslExpr) hlslExpr {
+	text := e.paren(hlslPrecUnary)
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "!") {
+		text = "(" + text + ")"
+	}
+	return hlslExpr{Text: op + text, Kind: e.Kind, Prec: hlslPrecUnary, Width: e.Width}
+}
+
+func hlslTernary(cond, a, b hlslExpr) hlslExpr {
+	return hlslExpr{
+		Text:  cond.paren(hlslPrecTernary+1) + " ? " + a.paren(hlslPrecTernary+1) + " : " + b.paren(hlslPrecTernary),
+		Kind:  a.Kind,
+		Prec:  hlslPrecTernary,
+		Width: max(cond.Width, a.Width, b.Width),
+	}
+}
+
+func hlslSwizzleString(comps []int) string {
+	var sb strings.Builder
+	for _, c := range comps {
+		sb.WriteByte("xyzw"[c])
+	}
+	return sb.String()
+}
+
+// hlslSwizzle selects the components at positions of e.
+func hlslSwizzle(e hlslExpr, positions []int) hlslExpr {
+	identity := len(positions) == e.Width
+	for i, p := range positions {
+		if p != i {
+			identity = false
+		}
+	}
+	if identity || e.Width == 1 {
+		// Scalars are promoted to vectors implicitly
+		return e
+	}
+	return hlslExpr{
+		Text:  e.paren(hlslPrecPrimary) + "." + hlslSwizzleString(positions),
+		Kind:  e.Kind,
+		Prec:  hlslPrecPrimary,
+		Width: len(positions),
+	}
+}
+
+// hlslConvert bitcasts e to want.
+func hlslConvert(e hlslExpr, want hlslKind) hlslExpr {
+	if want == hlslAny || e.Kind == want || e.Kind == hlslAny {
+		if e.Kind == hlslAny {
+			e.Kind = want
+		}
+		return e
+	}
+	if e.Kind == hlslBool {
+		mask := hlslExpr{Text: e.paren(hlslPrecTernary+1) + " ? 0xffffffff : 0", Kind: hlslUint, Prec: hlslPrecTernary, Width: e.Width}
+		switch want {
+		case hlslInt:
+			mask.Text = e.paren(hlslPrecTernary+1) + " ? -1 : 0"
+			mask.Kind = hlslInt
+			return mask
+		case hlslFloat:
+			return hlslCall("asfloat", hlslFloat, e.Width, mask)
+		}
+		return mask
+	}
+	switch want {
+	case hlslBool:
+		if e.Kind == hlslFloat {
+			e = hlslCall("asuint", hlslUint, e.Width, e)
+		}
+		return hlslBinary("!=", hlslPrecEquality, hlslBool, e, hlslPrimary("0", hlslUint, 1))
+	case hlslFloat:
+		return hlslCall("asfloat", hlslFloat, e.Width, e)
+	case hlslInt:
+		return hlslCall("asint", hlslInt, e.Width, e)
+	case hlslUint:
+		return hlslCall("asuint", hlslUint, e.Width, e)
+	}
+	return e
+}
+
+func hlslFloatLiteral(u uint32) hlslExpr {
+	f := math.Float32frombits(u)
+	exp := u & 0x7f800000
+	if exp == 0x7f800000 || (exp == 0 && u&0x007fffff != 0) {
+		// NaN, infinity or denormal: keep the exact bits
+		return hlslPrimary(fmt.Sprintf("asfloat(0x%08x)", u), hlslFloat, 1)
+	}
+	text := strconv.FormatFloat(float64(f), 'g', -1, 32)
+	if !strings.ContainsAny(text, ".e") {
+		text += ".0"
+	}
+	prec := hlslPrecPrimary
+	if strings.HasPrefix(text, "-") {
+		prec = hlslPrecUnary
+	}
+	return hlslExpr{Text: text, Kind: hlslFloat, Prec: prec, Width: 1}
+}
+
+func hlslLiteral(u uint32, kind hlslKind, hex bool) hlslExpr {
+	switch kind {
+	case hlslInt:
+		v := int32(u)
+		prec := hlslPrecPrimary
+		if v < 0 {
+			prec = hlslPrecUnary
+		}
+		if hex {
+			return hlslPrimary(fmt.Sprintf("0x%08x", u), hlslInt, 1)
+		}
+		return hlslExpr{Text: strconv.Itoa(int(v)), Kind: hlslInt, Prec: prec, Width: 1}
+	case hlslUint:
+		if hex || u > 0xffff {
+			return hlslPrimary(fmt.Sprintf("0x%08x", u), hlslUint, 1)
+		}
+		return hlslPrimary(strconv.FormatUint(uint64(u), 10), hlslUint, 1)
+	}
+	return hlslFloatLiteral(u)
+}
+
+// hlslPart is a run of components read from a single named value.
+type hlslPart struct {
+	base   string
+	suffix string // component selector, e.g. "y" or "_m12"
+	kind   hlslKind
+	// Components of the named value, or 0 if unknown
+	width int
+}
+
+// selector returns the selector for reading suffixes from the part's
+// value, which is empty if they select the whole value in order.
+func (p hlslPart) selector(suffixes []string) string {
+	joined := strings.Join(suffixes, "")
+	if p.width > 0 && joined == "xyzw"[:p.width] {
+		return ""
+	}
+	return "." + joined
+}
+
+// hlslMerge joins the per-component parts of an operand into one
+// expression, using a constructor if they come from different values.
+func hlslMerge(parts []hlslPart, want hlslKind) hlslExpr {
+	type group struct {
+		hlslPart
+		suffixes []string
+	}
+	var groups []group
+	for _, part := range parts {
+		if n := len(groups); n > 0 && groups[n-1].base == part.base {
+			groups[n-1].suffixes = append(groups[n-1].suffixes, part.suffix)
+			continue
+		}
+		groups = append(groups, group{hlslPart: part, suffixes: []string{part.suffix}})
+	}
+	exprs := make([]hlslExpr, len(groups))
+	for i, g := range groups {
+		text := g.base + g.selector(g.suffixes)
+		exprs[i] = hlslPrimary(text, g.kind, len(g.suffixes))
+	}
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	kind := want
+	if kind == hlslAny {
+		kind = exprs[0].Kind
+		for _, e := range exprs {
+			if e.Kind != kind {
+				kind = hlslFloat
+			}
+		}
+	}
+	for i := range exprs {
+		exprs[i] = hlslConvert(exprs[i], kind)
+	}
+	return hlslCall(kind.typeName(len(parts)), kind, len(parts), exprs...)
+}
+
+// hlslSanitize turns a name from the resource definitions into a
+// valid identifier.
+func hlslSanitize(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	if sb.Len() == 0 {
+		return "_"
+	}
+	return sb.String()
+}
+
+// hlslElementNames returns unique struct member names for the
+// elements of a signature.
+func hlslElementNames(elems []Element) []string {
+	names := make([]string, len(elems))
+	used := map[string]bool{}
+	for i, e := range elems {
+		var name string
+		if targetName, ok := stingrayTargetName(e); ok {
+			name = targetName
+		} else {
+			upper := strings.ToUpper(e.Name)
+			name = strings.ToLower(hlslSanitize(strings.TrimPrefix(upper, "SV_")))
+			if !strings.HasPrefix(upper, "SV_") || e.SemanticIndex != 0 {
+				name += strconv.Itoa(int(e.SemanticIndex))
+			}
+		}
+		unique := name
+		for j := 1; used[unique]; j++ {
+			unique = fmt.Sprintf("%v_%v", name, j)
+		}
+		used[unique] = true
+		names[i] = unique
+	}
+	return names
+}
+
+// hlslElementWidth returns the first component and component count of
+// a signature element.
+func hlslElementWidth(e Element) (first, width int) {
+	if e.Mask == 0 {
+		return 0, 4
+	}
+	first = bits.TrailingZeros8(e.Mask)
+	return first, bits.Len8(e.Mask) - first
+}
+
+func hlslResourceType(rb ResourceBinding) string {
+	var kind hlslKind
+	switch rb.ReturnType {
+	case SINT:
+		kind = hlslInt
+	case UINT:
+		kind = hlslUint
+	default:
+		kind = hlslFloat
+	}
+	var typ string
+	switch rb.ViewDimension {
+	case BUFFER:
+		typ = "Buffer"
+	case TEXTURE_1D:
+		typ = "Texture1D"
+	case TEXTURE_1D_ARRAY:
+		typ = "Texture1DArray"
+	case TEXTURE_2D:
+		typ = "Texture2D"
+	case TEXTURE_2D_ARRAY:
+		typ = "Texture2DArray"
+	case TEXTURE_2D_MULTISAMPLED:
+		typ = "Texture2DMS"
+	case TEXTURE_3D:
+		typ = "Texture3D"
+	case TEXTURE_CUBE:
+		typ = "TextureCube"
+	case TEXTURE_CUBE_ARRAY:
+		typ = "TextureCubeArray"
+	default:
+		return fmt.Sprintf("/* %v */ Texture2D<%v>", rb.ViewDimension.ToString(), kind.typeName(4))
+	}
+	return fmt.Sprintf("%v<%v>", typ, kind.typeName(4))
+}
+
+// HLSLType returns the HLSL type of v, or an empty string for structs.
+func (v Variable) HLSLType() string {
+	kind := hlslKindFromVariableType(v.Type)
+	var typ string
+	switch v.Class {
+	case SVC_SCALAR, SVC_V10_SCALAR:
+		typ = kind.typeName(1)
+	case SVC_VECTOR, SVC_V10_VECTOR:
+		typ = kind.typeName(int(v.Cols))
+	case SVC_MATRIX_ROWS, SVC_V10_MATRIX_ROWS:
+		typ = fmt.Sprintf("row_major %v%vx%v", kind.typeName(1), v.Rows, v.Cols)
+	case SVC_MATRIX_COLUMNS, SVC_V10_MATRIX_COLUMNS:
+		typ = fmt.Sprintf("%v%vx%v", kind.typeName(1), v.Rows, v.Cols)
+	default:
+		return ""
+	}
+	return typ
+}
+
+// hlslDeclaration declares v at its exact offset in the constant buffer.
+func (v Variable) hlslDeclaration() string {
+	name := hlslSanitize(v.Name)
+	typ := v.HLSLType()
+	comment := fmt.Sprintf("offset: %v, size: %v", v.BufferOffset, v.Size)
+	if typ == "" {
+		// Structs are declared as raw registers and read as such
+		typ = "float4"
+		name += fmt.Sprintf("[%v]", (v.Size+15)/16)
+		comment += ", " + v.VariableType.Name
+	} else if v.Elements > 0 {
+		name += fmt.Sprintf("[%v]", v.Elements)
+	}
+	if v.Flags&0x2 == 0 { // D3D_SVF_USED
+		comment += ", unused"
+	}
+	pack := fmt.Sprintf("c%v", v.BufferOffset/16)
+	if comp := (v.BufferOffset % 16) / 4; comp != 0 {
+		pack += "." + string("xyzw"[comp])
+	}
+	return fmt.Sprintf("%v %v : packoffset(%v); // %v", typ, name, pack, comment)
+}
+
+// hlslSwizzleSrc is like SwizzleSrc, but reads all components of
+// source operands encoded in mask mode, like vector immediates.
+func (o OperandToken0) hlslSwizzleSrc() [4]int8 {
+	if o.ComponentSelectionMode() == OPERAND_4_COMPONENT_MASK_MODE {
+		return [4]int8{0, 1, 2, 3}
+	}
+	return o.SwizzleSrc()
+}
+
+type hlslLoc struct {
+	typ  OPERAND_TYPE
+	reg  uint64
+	comp int // -1 for the whole (indexable) register
+}
+
+// hlslUseKey identifies where an operand is read: sub is 0 for the
+// operand itself and 1+n for the register in its n-th index.
+type hlslUseKey struct {
+	instr, operand, sub int
+}
+
+type hlslDef struct {
+	instr    int
+	reg      uint64
+	mask     uint8
+	block    int
+	loop     int // index of the outermost enclosing loop, or -1
+	foldable bool
+	sources  []hlslLoc
+	uses     map[hlslUseKey]bool
+	// Set if one of the uses is in a different block
+	crossed bool
+	// Instruction overwriting one of the sources, or -1
+	clobbered int
+}
+
+type hlslDecompiler struct {
+	programType ShaderProgramType
+	cbs         []ConstantBuffer
+	isg, osg    []Element
+	res         []ResourceBinding
+	opcodes     []Opcode
+
+	inputNames, outputNames []string
+	cbSlots                 map[uint64]*ConstantBuffer
+
+	// Folded definitions by defining instruction and by use
+	folds     map[int]*hlslDef
+	foldUses  map[hlslUseKey]*hlslDef
+	foldExprs map[int]hlslExpr
+	consumed  map[int]bool
+
+	// Kind last stored in each temp register component
+	tempKinds map[hlslLoc]hlslKind
+	// Samplers each texture is sampled with
+	texSamplers map[uint32][]string
+
+	sb     strings.Builder
+	indent int
+	pre    []string
+}
+
+// DecompileHLSL translates a shader program to HLSL. Temporaries
+// which are only read once in the same block are folded into the
+// expression reading them.
+func DecompileHLSL(programType ShaderProgramType, cbs []ConstantBuffer, isg, osg []Element, res []ResourceBinding, opcodes []Opcode) string {
+	h := &hlslDecompiler{
+		programType: programType,
+		cbs:         cbs,
+		isg:         isg,
+		osg:         osg,
+		res:         res,
+		opcodes:     opcodes,
+		inputNames:  hlslElementNames(isg),
+		outputNames: hlslElementNames(osg),
+		cbSlots:     map[uint64]*ConstantBuffer{},
+		folds:       map[int]*hlslDef{},
+		foldUses:    map[hlslUseKey]*hlslDef{},
+		foldExprs:   map[int]hlslExpr{},
+		consumed:    map[int]bool{},
+		tempKinds:   map[hlslLoc]hlslKind{},
+		texSamplers: map[uint32][]string{},
+	}
+	for i := range cbs {
+		h.cbSlots[uint64(i)] = &cbs[i]
+	}
+	for _, rb := range res {
+		if rb.InputType != CBUFFER {
+			continue
+		}
+		for i := range cbs {
+			if cbs[i].Name == rb.Name {
+				h.cbSlots[uint64(rb.BindPoint)] = &cbs[i]
+			}
+		}
+	}
+	for texture, samplers := range TextureSamplers(opcodes) {
+		for _, sampler := range samplers {
+			h.texSamplers[texture] = append(h.texSamplers[texture], h.samplerName(uint64(sampler)))
+		}
+	}
+	h.analyze()
+	h.writeDeclarations()
+	h.writeMain()
+	return h.sb.String()
+}
+
+func (h *hlslDecompiler) line(format string, args ...any) {
+	if format != "" {
+		h.sb.WriteString(strings.Repeat("    ", h.indent))
+		fmt.Fprintf(&h.sb, format, args...)
+	}
+	h.sb.WriteByte('\n')
+}
+
+func (h *hlslDecompiler) resource(bindPoint uint64, typ ShaderInputType) *ResourceBinding {
+	for i := range h.res {
+		if h.res[i].InputType == typ && uint64(h.res[i].BindPoint) == bindPoint {
+			return &h.res[i]
+		}
+	}
+	return nil
+}
+
+func (tok *InstructionToken) opType() ShaderOpcodeType {
+	return ShaderOpcodeType(tok.opcode & TYPE_MASK)
+}
+
+func hlslIsControlFlow(op ShaderOpcodeType) bool {
+	switch op {
+	case OPCODE_IF, OPCODE_ELSE, OPCODE_ENDIF, OPCODE_LOOP, OPCODE_ENDLOOP,
+		OPCODE_BREAK, OPCODE_BREAKC, OPCODE_CONTINUE, OPCODE_CONTINUEC,
+		OPCODE_SWITCH, OPCODE_CASE, OPCODE_DEFAULT, OPCODE_ENDSWITCH,
+		OPCODE_RET, OPCODE_RETC, OPCODE_CALL, OPCODE_CALLC, OPCODE_LABEL,
+		OPCODE_11_HS_DECLS, OPCODE_11_HS_CONTROL_POINT_PHASE,
+		OPCODE_11_HS_FORK_PHASE, OPCODE_11_HS_JOIN_PHASE:
+		return true
+	}
+	return false
+}
+
+// hlslFoldable reports whether op computes a single value without side
+// effects, so it may be moved to where its result is read.
+func hlslFoldable(op ShaderOpcodeType) bool {
+	switch op {
+	case OPCODE_MOV, OPCODE_MOVC, OPCODE_ADD, OPCODE_MUL, OPCODE_DIV, OPCODE_MAD,
+		OPCODE_MIN, OPCODE_MAX, OPCODE_DP2, OPCODE_DP3, OPCODE_DP4,
+		OPCODE_EQ, OPCODE_NE, OPCODE_LT, OPCODE_GE,
+		OPCODE_IEQ, OPCODE_INE, OPCODE_ILT, OPCODE_IGE, OPCODE_ULT, OPCODE_UGE,
+		OPCODE_AND, OPCODE_OR, OPCODE_XOR, OPCODE_NOT,
+		OPCODE_ISHL, OPCODE_ISHR, OPCODE_USHR,
+		OPCODE_IADD, OPCODE_IMAD, OPCODE_UMAD, OPCODE_INEG,
+		OPCODE_IMIN, OPCODE_IMAX, OPCODE_UMIN, OPCODE_UMAX,
+		OPCODE_FTOI, OPCODE_FTOU, OPCODE_ITOF, OPCODE_UTOF,
+		OPCODE_EXP, OPCODE_LOG, OPCODE_FRC, OPCODE_RSQ, OPCODE_SQRT, OPCODE_11_RCP,
+		OPCODE_ROUND_NE, OPCODE_ROUND_NI, OPCODE_ROUND_PI, OPCODE_ROUND_Z,
+		OPCODE_DERIV_RTX, OPCODE_DERIV_RTY,
+		OPCODE_11_DERIV_RTX_COARSE, OPCODE_11_DERIV_RTX_FINE,
+		OPCODE_11_DERIV_RTY_COARSE, OPCODE_11_DERIV_RTY_FINE,
+		OPCODE_11_F32TOF16, OPCODE_11_F16TOF32, OPCODE_11_COUNTBITS,
+		OPCODE_11_FIRSTBIT_HI, OPCODE_11_FIRSTBIT_LO, OPCODE_11_FIRSTBIT_SHI,
+		OPCODE_11_BFREV, OPCODE_11_UBFE, OPCODE_11_IBFE, OPCODE_11_BFI,
+		OPCODE_SAMPLE, OPCODE_SAMPLE_L, OPCODE_SAMPLE_B, OPCODE_SAMPLE_D,
+		OPCODE_SAMPLE_C, OPCODE_SAMPLE_C_LZ, OPCODE_LD, OPCODE_10_1_GATHER4,
+		OPCODE_10_1_LOD:
+		return true
+	}
+	return false
+}
+
+// hlslDests returns the indices of the operands an instruction writes.
+func (tok *InstructionToken) hlslDests() []int {
+	op := tok.opType()
+	if hlslIsControlFlow(op) || len(tok.operands) < 2 {
+		return nil
+	}
+	switch op {
+	case OPCODE_DISCARD, OPCODE_11_STORE_RAW, OPCODE_11_STORE_STRUCTURED, OPCODE_11_STORE_UAV_TYPED:
+		return nil
+	case OPCODE_SINCOS, OPCODE_UDIV, OPCODE_UMUL, OPCODE_IMUL, OPCODE_11_SWAPC, OPCODE_11_UADDC, OPCODE_11_USUBB:
+		var dests []int
+		for _, i := range []int{0, 1} {
+			if tok.operands[i].OperandToken0.Type() != OPERAND_TYPE_NULL {
+				dests = append(dests, i)
+			}
+		}
+		return dests
+	}
+	return []int{0}
+}
+
+// hlslSingleDest returns the only operand written by an instruction.
+func (tok *InstructionToken) hlslSingleDest() (int, bool) {
+	dests := tok.hlslDests()
+	if len(dests) != 1 {
+		return 0, false
+	}
+	return dests[0], true
+}
+
+func (h *hlslDecompiler) resourceDimensions(tok *InstructionToken) int {
+	if len(tok.operands) > 2 {
+		if rb := tok.operands[2].ResourceBinding(h.res); rb != nil {
+			if dim := rb.ViewDimension.Dimensions(); dim > 0 {
+				return dim
+			}
+		}
+	}
+	return 2
+}
+
+func (h *hlslDecompiler) isBufferResource(tok *InstructionToken) bool {
+	if len(tok.operands) > 2 {
+		if rb := tok.operands[2].ResourceBinding(h.res); rb != nil {
+			return rb.ViewDimension == BUFFER
+		}
+	}
+	return false
+}
+
+// srcComps returns the components of operand j an instruction reads,
+// in the order the expression consumes them.
+func (h *hlslDecompiler) srcComps(tok *InstructionToken, j int) []int {
+	op := tok.opType()
+	swz := tok.operands[j].hlslSwizzleSrc()
+	first := func(n int) []int {
+		comps := make([]int, 0, n)
+		for i := range n {
+			if swz[i] >= 0 {
+				comps = append(comps, int(swz[i]))
+			}
+		}
+		return comps
+	}
+	if tok.operands[j].NumComponents() == 1 {
+		return []int{0}
+	}
+	if tok.operands[j].NumComponents() != 4 {
+		return nil
+	}
+	switch op {
+	case OPCODE_DP2:
+		return first(2)
+	case OPCODE_DP3:
+		return first(3)
+	case OPCODE_DP4:
+		return first(4)
+	case OPCODE_SAMPLE, OPCODE_SAMPLE_L, OPCODE_SAMPLE_B, OPCODE_SAMPLE_D, OPCODE_SAMPLE_C,
+		OPCODE_SAMPLE_C_LZ, OPCODE_10_1_GATHER4, OPCODE_10_1_LOD, OPCODE_LD, OPCODE_LD_MS, OPCODE_RESINFO:
+		switch {
+		case j == 1 && op == OPCODE_RESINFO:
+			return first(1)
+		case j == 1 && op == OPCODE_LD:
+			if h.isBufferResource(tok) {
+				return first(1)
+			}
+			return append(first(h.resourceDimensions(tok)), int(swz[3]))
+		case j == 1 || (op == OPCODE_SAMPLE_D && j >= 4):
+			return first(h.resourceDimensions(tok))
+		case j == 2:
+			return nil
+		default:
+			return first(1)
+		}
+	}
+	dests := tok.hlslDests()
+	if len(dests) == 0 {
+		return first(1)
+	}
+	var mask uint8
+	for _, d := range dests {
+		mask |= tok.operands[d].Mask()
+	}
+	var comps []int
+	for c := range 4 {
+		if mask&(1<<c) != 0 && swz[c] >= 0 {
+			comps = append(comps, int(swz[c]))
+		}
+	}
+	return comps
+}
+
+// regLocs returns the register components read or written through an
+// operand, excluding registers used in its indices.
+func regLocs(o *Operand, comps []int) []hlslLoc {
+	var locs []hlslLoc
+	switch o.OperandToken0.Type() {
+	case OPERAND_TYPE_TEMP, OPERAND_TYPE_OUTPUT:
+		if len(o.Indices) == 0 {
+			return nil
+		}
+		for _, c := range comps {
+			locs = append(locs, hlslLoc{o.OperandToken0.Type(), o.Indices[0].Value, c})
+		}
+	case OPERAND_TYPE_INDEXABLE_TEMP:
+		if len(o.Indices) == 0 {
+			return nil
+		}
+		locs = append(locs, hlslLoc{o.OperandToken0.Type(), o.Indices[0].Value, -1})
+	}
+	return locs
+}
+
+func maskComps(mask uint8) []int {
+	var comps []int
+	for c := range 4 {
+		if mask&(1<<c) != 0 {
+			comps = append(comps, c)
+		}
+	}
+	return comps
+}
+
+type hlslRead struct {
+	key  hlslUseKey
+	locs []hlslLoc
+}
+
+// reads returns all register components read by instruction i.
+func (h *hlslDecompiler) reads(i int, tok *InstructionToken) []hlslRead {
+	var reads []hlslRead
+	dests := tok.hlslDests()
+	for j := range tok.operands {
+		o := &tok.operands[j]
+		if !slices.Contains(dests, j) {
+			reads = append(reads, hlslRead{hlslUseKey{i, j, 0}, regLocs(o, h.srcComps(tok, j))})
+		}
+		for k, idx := range o.Indices {
+			if idx.Register == nil {
+				continue
+			}
+			swz := idx.Register.hlslSwizzleSrc()
+			comp := 0
+			if swz[0] >= 0 {
+				comp = int(swz[0])
+			}
+			reads = append(reads, hlslRead{hlslUseKey{i, j, 1 + k}, regLocs(idx.Register, []int{comp})})
+		}
+	}
+	return reads
+}
+
+// writes returns all register components written by an instruction.
+func (tok *InstructionToken) writes() []hlslLoc {
+	var locs []hlslLoc
+	for _, d := range tok.hlslDests() {
+		o := &tok.operands[d]
+		locs = append(locs, regLocs(o, maskComps(o.Mask()))...)
+	}
+	return locs
+}
+
+// analyze decides which definitions to fold into their single use.
+func (h *hlslDecompiler) analyze() {
+	var defs []*hlslDef
+	lastDef := map[hlslLoc]*hlslDef{}
+	readsAt := map[int][]hlslLoc{}
+	var loops []int
+	block := 0
+	for i, opcode := range h.opcodes {
+		tok, ok := opcode.(*InstructionToken)
+		if !ok {
+			continue
+		}
+		op := tok.opType()
+
+		for _, read := range h.reads(i, tok) {
+			readsAt[i] = append(readsAt[i], read.locs...)
+			for _, loc := range read.locs {
+				def, ok := lastDef[loc]
+				if !ok || loc.typ != OPERAND_TYPE_TEMP {
+					continue
+				}
+				def.uses[read.key] = true
+				if def.block != block {
+					def.crossed = true
+				}
+			}
+		}
+
+		writes := tok.writes()
+		for _, def := range defs {
+			if def.clobbered != -1 {
+				continue
+			}
+			for _, w := range writes {
+				if slices.ContainsFunc(def.sources, func(s hlslLoc) bool {
+					return s.typ == w.typ && s.reg == w.reg && (s.comp == w.comp || s.comp == -1 || w.comp == -1)
+				}) {
+					def.clobbered = i
+					break
+				}
+			}
+		}
+		if len(writes) > 0 {
+			loop := -1
+			if len(loops) > 0 {
+				loop = loops[0]
+			}
+			def := &hlslDef{
+				instr:     i,
+				block:     block,
+				loop:      loop,
+				uses:      map[hlslUseKey]bool{},
+				clobbered: -1,
+			}
+			if d, ok := tok.hlslSingleDest(); ok && hlslFoldable(op) && tok.operands[d].OperandToken0.Type() == OPERAND_TYPE_TEMP {
+				def.foldable = true
+				def.reg = tok.operands[d].Indices[0].Value
+				def.mask = tok.operands[d].Mask()
+				for _, read := range h.reads(i, tok) {
+					def.sources = append(def.sources, read.locs...)
+				}
+			}
+			defs = append(defs, def)
+			for _, w := range writes {
+				lastDef[w] = def
+			}
+		}
+
+		switch op {
+		case OPCODE_LOOP:
+			loops = append(loops, i)
+		case OPCODE_ENDLOOP:
+			if len(loops) > 0 {
+				loops = loops[:len(loops)-1]
+			}
+		}
+		if hlslIsControlFlow(op) {
+			block++
+		}
+	}
+
+	for _, def := range defs {
+		if !def.foldable || def.crossed || len(def.uses) != 1 {
+			continue
+		}
+		var use hlslUseKey
+		for use = range def.uses {
+		}
+		if def.clobbered != -1 && def.clobbered < use.instr {
+			continue
+		}
+		useTok, ok := h.opcodes[use.instr].(*InstructionToken)
+		if !ok || !h.canInline(useTok.opType()) || slices.Contains(useTok.hlslDests(), use.operand) {
+			continue
+		}
+		// All components the use reads must come from this definition
+		var useLocs []hlslLoc
+		for _, read := range h.reads(use.instr, useTok) {
+			if read.key == use {
+				useLocs = read.locs
+			}
+		}
+		if len(useLocs) == 0 || slices.ContainsFunc(useLocs, func(l hlslLoc) bool {
+			return l.typ != OPERAND_TYPE_TEMP || l.reg != def.reg || def.mask&(1<<l.comp) == 0
+		}) {
+			continue
+		}
+		// Inside loops, an earlier read may see this value through the back edge
+		if def.loop != -1 {
+			seenEarlier := false
+			for i := def.loop; i < def.instr; i++ {
+				if slices.ContainsFunc(readsAt[i], func(l hlslLoc) bool {
+					return l.typ == OPERAND_TYPE_TEMP && l.reg == def.reg && def.mask&(1<<l.comp) != 0
+				}) {
+					seenEarlier = true
+					break
+				}
+			}
+			if seenEarlier {
+				continue
+			}
+		}
+		h.folds[def.instr] = def
+		h.foldUses[use] = def
+	}
+}
+
+// canInline reports whether instructions of type op render their
+// operands through h.src, so a folded expression can be placed there.
+func (h *hlslDecompiler) canInline(op ShaderOpcodeType) bool {
+	if hlslFoldable(op) {
+		return true
+	}
+	switch op {
+	case OPCODE_IF, OPCODE_BREAKC, OPCODE_CONTINUEC, OPCODE_RETC, OPCODE_DISCARD, OPCODE_SWITCH,
+		OPCODE_SINCOS, OPCODE_UDIV, OPCODE_UMUL, OPCODE_IMUL, OPCODE_RESINFO:
+		return true
+	}
+	return false
+}
+
+func (h *hlslDecompiler) samplerName(bindPoint uint64) string {
+	if rb := h.resource(bindPoint, SAMPLER); rb != nil {
+		return hlslSanitize(rb.Name)
+	}
+	return fmt.Sprintf("s%v", bindPoint)
+}
+
+func (h *hlslDecompiler) textureName(bindPoint uint64) string {
+	if rb := h.resource(bindPoint, TEXTURE); rb != nil {
+		return hlslSanitize(rb.Name)
+	}
+	return fmt.Sprintf("t%v", bindPoint)
+}
+
+func (h *hlslDecompiler) cbName(cb *ConstantBuffer) string {
+	return hlslSanitize(cb.Name)
+}
+
+func (h *hlslDecompiler) stageName() string {
+	switch h.programType {
+	case PIXEL_SHADER:
+		return "PS"
+	case VERTEX_SHADER:
+		return "VS"
+	case GEOMETRY_SHADER:
+		return "GS"
+	case HULL_SHADER:
+		return "HS"
+	case DOMAIN_SHADER:
+		return "DS"
+	case COMPUTE_SHADER:
+		return "CS"
+	}
+	return "SHADER"
+}
+
+func (h *hlslDecompiler) writeDeclarations() {
+	h.line("// Program type: %v", h.programType.ToString())
+	h.line("")
+
+	slots := make([]uint64, 0, len(h.cbSlots))
+	for slot := range h.cbSlots {
+		slots = append(slots, slot)
+	}
+	slices.Sort(slots)
+	declared := map[*ConstantBuffer]bool{}
+	for _, slot := range slots {
+		cb := h.cbSlots[slot]
+		if declared[cb] || cb.Type != CT_CBUFFER {
+			continue
+		}
+		declared[cb] = true
+		h.line("cbuffer %v : register(b%v) // size: %v", h.cbName(cb), slot, cb.Size)
+		h.line("{")
+		h.indent++
+		for _, v := range cb.Variables {
+			h.line("%v", v.hlslDeclaration())
+		}
+		h.indent--
+		h.line("};")
+		h.line("")
+	}
+
+	var declaredResources bool
+	for _, rb := range h.res {
+		switch rb.InputType {
+		case TEXTURE:
+			comment := ""
+			if samplers := h.texSamplers[rb.BindPoint]; len(samplers) > 0 {
+				comment = " // sampled with " + strings.Join(samplers, ", ")
+			}
+			h.line("%v %v : register(t%v);%v", hlslResourceType(rb), hlslSanitize(rb.Name), rb.BindPoint, comment)
+		case SAMPLER:
+			typ := "SamplerState"
+			if rb.Flags&SIF_COMPARISON_SAMPLER != 0 {
+				typ = "SamplerComparisonState"
+			}
+			h.line("%v %v : register(s%v);", typ, hlslSanitize(rb.Name), rb.BindPoint)
+		case CBUFFER:
+			continue
+		default:
+			h.line("// %v %v : register(%v) (not decompiled)", rb.InputType.ToString(), hlslSanitize(rb.Name), rb.BindPoint)
+		}
+		declaredResources = true
+	}
+	if declaredResources {
+		h.line("")
+	}
+
+	for _, opcode := range h.opcodes {
+		icb, ok := opcode.(*CustomDataDCLImmediateConstantBuffer)
+		if !ok {
+			continue
+		}
+		h.line("static const float4 icb[%v] = {", len(icb.Constants))
+		h.indent++
+		for _, c := range icb.Constants {
+			comps := make([]string, 4)
+			for k := range 4 {
+				comps[k] = hlslFloatLiteral(math.Float32bits(c[k])).Text
+			}
+			h.line("float4(%v),", strings.Join(comps, ", "))
+		}
+		h.indent--
+		h.line("};")
+		h.line("")
+	}
+
+	h.writeStruct(h.stageName()+"_INPUT", h.isg, h.inputNames, "v")
+	h.writeStruct(h.stageName()+"_OUTPUT", h.osg, h.outputNames, "o")
+}
+
+func (h *hlslDecompiler) writeStruct(name string, elems []Element, names []string, regPrefix string) {
+	if len(elems) == 0 {
+		return
+	}
+	h.line("struct %v", name)
+	h.line("{")
+	h.indent++
+	for i, e := range elems {
+		first, width := hlslElementWidth(e)
+		semantic := e.Name
+		if e.SemanticIndex != 0 || strings.EqualFold(e.Name, "SV_TARGET") || !strings.HasPrefix(strings.ToUpper(e.Name), "SV_") {
+			semantic += strconv.Itoa(int(e.SemanticIndex))
+		}
+		reg := fmt.Sprintf("%v%v", regPrefix, e.Register)
+		if e.Register == math.MaxUint32 {
+			reg = regPrefix + "Depth"
+		}
+		h.line("%v %v : %v; // %v.%v", hlslKindFromComponentType(e.ComponentType).typeName(width), names[i], semantic, reg, hlslSwizzleString(hlslSeq(first, width)))
+	}
+	h.indent--
+	h.line("};")
+	h.line("")
+}
+
+func hlslSeq(start, n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = start + i
+	}
+	return s
+}
+
+func (h *hlslDecompiler) writeMain() {
+	stage := h.stageName()
+	ret := "void"
+	if len(h.osg) > 0 {
+		ret = stage + "_OUTPUT"
+	}
+	params := ""
+	if len(h.isg) > 0 {
+		params = stage + "_INPUT input"
+	}
+	for _, opcode := range h.opcodes {
+		if glob, ok := opcode.(*DclGlobalFlags); ok && glob.opcode&earlyDepthStencil != 0 {
+			h.line("[earlydepthstencil]")
+		}
+	}
+	h.line("%v main(%v)", ret, params)
+	h.line("{")
+	h.indent++
+	if len(h.osg) > 0 {
+		h.line("%v output;", ret)
+	}
+	var temps uint32
+	for _, opcode := range h.opcodes {
+		switch dcl := opcode.(type) {
+		case *DclTemps:
+			var count uint32
+			if err := binary.Read(bytes.NewReader(dcl.data), binary.LittleEndian, &count); err == nil {
+				temps = max(temps, count)
+			}
+		case *DclIndexableTemp:
+			var index, count uint32
+			r := bytes.NewReader(dcl.data)
+			if binary.Read(r, binary.LittleEndian, &index) == nil && binary.Read(r, binary.LittleEndian, &count) == nil {
+				h.line("float4 x%v[%v];", index, count)
+			}
+		}
+	}
+	if temps > 0 {
+		names := make([]string, temps)
+		for i := range names {
+			names[i] = fmt.Sprintf("r%v", i)
+		}
+		h.line("float4 %v;", strings.Join(names, ", "))
+	}
+	h.line("")
+
+	for i := 0; i < len(h.opcodes); i++ {
+		tok, ok := h.opcodes[i].(*InstructionToken)
+		if !ok {
+			continue
+		}
+		i = h.instruction(i, tok)
+	}
+	h.indent--
+	h.line("}")
+}
+
+// instruction writes instruction i and returns the index of the last
+// instruction it consumed.
+func (h *hlslDecompiler) instruction(i int, tok *InstructionToken) (last int) {
+	last = i
+	op := tok.opType()
+	defer func() {
+		if r := recover(); r != nil {
+			h.pre = nil
+			h.line("// %v: %v", op.ToString(), r)
+		}
+	}()
+
+	returnStatement := "return;"
+	if len(h.osg) > 0 {
+		returnStatement = "return output;"
+	}
+
+	switch op {
+	case OPCODE_IF:
+		cond := h.condition(i, tok, false)
+		h.flush()
+		h.line("if (%v) {", cond.Text)
+		h.indent++
+	case OPCODE_ELSE:
+		h.indent--
+		h.line("} else {")
+		h.indent++
+	case OPCODE_ENDIF, OPCODE_ENDLOOP, OPCODE_ENDSWITCH:
+		h.indent--
+		h.line("}")
+	case OPCODE_LOOP:
+		// Turn a conditional break at the start of the loop into the loop
+		// condition, possibly with the test folded into it
+		isBreakc := func(j int) bool {
+			tok, ok := h.opcodeAt(j)
+			return ok && tok.opType() == OPCODE_BREAKC
+		}
+		brk := i + 1
+		if h.folds[brk] != nil && isBreakc(brk+1) && h.consumedBy(brk, brk+1) {
+			def, _ := h.opcodeAt(brk)
+			h.instruction(brk, def)
+			brk++
+		}
+		if tok, ok := h.opcodeAt(brk); ok && isBreakc(brk) {
+			cond := h.condition(brk, tok, true)
+			if len(h.pre) == 0 {
+				h.line("while (%v) {", cond.Text)
+				h.indent++
+				return brk
+			}
+			// Assignments the condition depends on have to run on every
+			// iteration, so they can't be placed before the loop
+			h.line("while (true) {")
+			h.indent++
+			h.flush()
+			h.line("if (%v) break;", hlslUnary("!", cond).Text)
+			return brk
+		}
+		h.line("while (true) {")
+		h.indent++
+	case OPCODE_BREAK:
+		h.line("break;")
+	case OPCODE_CONTINUE:
+		h.line("continue;")
+	case OPCODE_BREAKC, OPCODE_CONTINUEC, OPCODE_RETC, OPCODE_DISCARD:
+		stmt := map[ShaderOpcodeType]string{
+			OPCODE_BREAKC:    "break;",
+			OPCODE_CONTINUEC: "continue;",
+			OPCODE_RETC:      returnStatement,
+			OPCODE_DISCARD:   "discard;",
+		}[op]
+		cond := h.condition(i, tok, false)
+		h.flush()
+		h.line("if (%v) %v", cond.Text, stmt)
+	case OPCODE_SWITCH:
+		sel := h.src(i, tok, 0, []int{h.srcComps(tok, 0)[0]}, hlslInt)
+		h.flush()
+		h.line("switch (%v) {", sel.Text)
+		h.indent++
+	case OPCODE_CASE:
+		h.indent--
+		h.line("case %v:", h.src(i, tok, 0, []int{0}, hlslInt).Text)
+		h.indent++
+	case OPCODE_DEFAULT:
+		h.indent--
+		h.line("default:")
+		h.indent++
+	case OPCODE_RET:
+		if h.programType == HULL_SHADER {
+			h.line("// end of phase")
+			break
+		}
+		h.line("%v", returnStatement)
+	case OPCODE_11_HS_DECLS, OPCODE_11_HS_CONTROL_POINT_PHASE, OPCODE_11_HS_FORK_PHASE, OPCODE_11_HS_JOIN_PHASE:
+		h.line("// %v", op.ToString())
+	case OPCODE_NOP:
+	default:
+		h.statement(i, tok)
+	}
+	return last
+}
+
+// opcodeAt returns instruction i, if there is one.
+func (h *hlslDecompiler) opcodeAt(i int) (*InstructionToken, bool) {
+	if i < 0 || i >= len(h.opcodes) {
+		return nil, false
+	}
+	tok, ok := h.opcodes[i].(*InstructionToken)
+	return tok, ok
+}
+
+// consumedBy reports whether the folded definition at def was
+// substituted into instruction use.
+func (h *hlslDecompiler) consumedBy(def, use int) bool {
+	for key, d := range h.foldUses {
+		if d.instr == def && key.instr == use {
+			return true
+		}
+	}
+	return false
+}
+
+// flush writes definitions which were pending for the current statement.
+func (h *hlslDecompiler) flush() {
+	for _, stmt := range h.pre {
+		h.line("%v", stmt)
+	}
+	h.pre = nil
+}
+
+// condition renders the test of a conditional instruction. If invert is
+// set, the condition for not taking the branch is returned.
+func (h *hlslDecompiler) condition(i int, tok *InstructionToken, invert bool) hlslExpr {
+	zero := tok.InvertBoolean() // *_z variant
+	if invert {
+		zero = !zero
+	}
+	comps := h.srcComps(tok, 0)[:1]
+	e := h.src(i, tok, 0, comps, hlslAny)
+	if e.Kind != hlslBool {
+		kind := e.Kind
+		if e.tempRead {
+			kind = hlslUint
+			if k, ok := h.tempKinds[hlslLoc{OPERAND_TYPE_TEMP, tok.operands[0].Indices[0].Value, comps[0]}]; ok && k == hlslFloat {
+				kind = hlslFloat
+			}
+		}
+		if kind != hlslFloat {
+			e = hlslConvert(e, hlslUint)
+		}
+		op := "!="
+		if zero {
+			op = "=="
+		}
+		return hlslBinary(op, hlslPrecEquality, hlslBool, e, hlslPrimary("0", e.Kind, 1))
+	}
+	if zero {
+		return hlslUnary("!", hlslExpr{Text: e.paren(hlslPrecPrimary), Kind: hlslBool, Prec: hlslPrecPrimary, Width: 1})
+	}
+	return e
+}
+
+// src renders the components comps of operand j as kind want.
+func (h *hlslDecompiler) src(i int, tok *InstructionToken, j int, comps []int, want hlslKind) hlslExpr {
+	return h.operand(i, tok, j, comps, want, true)
+}
+
+// srcVec is like src, but never collapses repeated immediates into a
+// scalar, for intrinsics which need a vector argument.
+func (h *hlslDecompiler) srcVec(i int, tok *InstructionToken, j int, comps []int, want hlslKind) hlslExpr {
+	return h.operand(i, tok, j, comps, want, false)
+}
+
+func (h *hlslDecompiler) operand(i int, tok *InstructionToken, j int, comps []int, want hlslKind, broadcast bool) hlslExpr {
+	o := &tok.operands[j]
+	e := h.value(hlslUseKey{i, j, 0}, o, comps, want, broadcast, tok.opType().IsHex())
+	if e.tempRead && want != hlslAny {
+		e = hlslConvert(e, want)
+		e.tempRead = want == hlslFloat
+	} else {
+		tempRead := e.tempRead
+		e = hlslConvert(e, want)
+		e.tempRead = tempRead
+	}
+	switch o.Modifier() {
+	case OPERAND_MODIFIER_NEG:
+		e = hlslUnary("-", e)
+	case OPERAND_MODIFIER_ABS:
+		e = hlslCall("abs", e.Kind, e.Width, e)
+	case OPERAND_MODIFIER_ABSNEG:
+		e = hlslUnary("-", hlslCall("abs", e.Kind, e.Width, e))
+	}
+	return e
+}
+
+// index renders an operand index as an int expression.
+func (h *hlslDecompiler) index(key hlslUseKey, idx OperandIndex) hlslExpr {
+	imm := hlslPrimary(strconv.FormatUint(idx.Value, 10), hlslInt, 1)
+	if idx.Register == nil {
+		return imm
+	}
+	swz := idx.Register.hlslSwizzleSrc()
+	comp := 0
+	if swz[0] >= 0 {
+		comp = int(swz[0])
+	}
+	reg := hlslConvert(h.value(key, idx.Register, []int{comp}, hlslInt, true, false), hlslInt)
+	if idx.Value == 0 || idx.Representation == OPERAND_INDEX_RELATIVE {
+		return reg
+	}
+	return hlslBinary("+", hlslPrecAdditive, hlslInt, reg, imm)
+}
+
+func (h *hlslDecompiler) value(key hlslUseKey, o *Operand, comps []int, want hlslKind, broadcast, hex bool) hlslExpr {
+	swizzle := "." + hlslSwizzleString(comps)
+	if o.NumComponents() != 4 {
+		swizzle = ""
+	}
+	subKey := func(k int) hlslUseKey {
+		return hlslUseKey{key.instr, key.operand, key.sub + 1 + k}
+	}
+	if key.sub != 0 {
+		subKey = func(int) hlslUseKey { return hlslUseKey{-1, -1, -1} }
+	}
+
+	switch o.OperandToken0.Type() {
+	case OPERAND_TYPE_IMMEDIATE32:
+		return h.immediate(o, comps, want, broadcast, hex)
+	case OPERAND_TYPE_TEMP:
+		if def, ok := h.foldUses[key]; ok {
+			if e, ok := h.foldExprs[def.instr]; ok && !h.consumed[def.instr] {
+				if len(e.Text) <= hlslMaxFoldLength {
+					h.consumed[def.instr] = true
+					order := maskComps(def.mask)
+					positions := make([]int, len(comps))
+					for p, c := range comps {
+						positions[p] = slices.Index(order, c)
+					}
+					return hlslSwizzle(e, positions)
+				}
+				h.emitFolded(def)
+			}
+		}
+		e := hlslPrimary(fmt.Sprintf("r%v%v", o.Indices[0].Value, swizzle), hlslFloat, len(comps))
+		e.tempRead = true
+		return e
+	case OPERAND_TYPE_INDEXABLE_TEMP:
+		idx := h.index(subKey(1), o.Indices[1])
+		return hlslPrimary(fmt.Sprintf("x%v[%v]%v", o.Indices[0].Value, idx.Text, swizzle), hlslFloat, len(comps))
+	case OPERAND_TYPE_IMMEDIATE_CONSTANT_BUFFER:
+		idx := h.index(subKey(0), o.Indices[0])
+		return hlslPrimary(fmt.Sprintf("icb[%v]%v", idx.Text, swizzle), hlslFloat, len(comps))
+	case OPERAND_TYPE_CONSTANT_BUFFER:
+		return h.constantBuffer(subKey, o, comps, want)
+	case OPERAND_TYPE_INPUT, OPERAND_TYPE_INPUT_CONTROL_POINT:
+		if len(o.Indices) == 2 {
+			vertex := h.index(subKey(0), o.Indices[0])
+			return hlslMerge(h.elementParts(h.isg, h.inputNames, fmt.Sprintf("input[%v]", vertex.Text), o.Indices[1].Value, comps), want)
+		}
+		return hlslMerge(h.elementParts(h.isg, h.inputNames, "input", o.Indices[0].Value, comps), want)
+	case OPERAND_TYPE_OUTPUT:
+		return hlslMerge(h.elementParts(h.osg, h.outputNames, "output", o.Indices[0].Value, comps), want)
+	case OPERAND_TYPE_OUTPUT_DEPTH, OPERAND_TYPE_OUTPUT_DEPTH_GREATER_EQUAL, OPERAND_TYPE_OUTPUT_DEPTH_LESS_EQUAL:
+		return hlslPrimary("output."+h.systemValueName(SV_DEPTH, "depth"), hlslFloat, 1)
+	case OPERAND_TYPE_OUTPUT_COVERAGE_MASK:
+		return hlslPrimary("output."+h.systemValueName(SV_COVERAGE, "coverage"), hlslUint, 1)
+	case OPERAND_TYPE_RESOURCE:
+		return hlslPrimary(h.textureName(o.Indices[0].Value), hlslAny, 1)
+	case OPERAND_TYPE_SAMPLER:
+		return hlslPrimary(h.samplerName(o.Indices[0].Value), hlslAny, 1)
+	}
+
+	name, kind := hlslSpecialRegister(o.OperandToken0.Type())
+	return hlslPrimary(name+swizzle, kind, len(comps))
+}
+
+func hlslSpecialRegister(typ OPERAND_TYPE) (string, hlslKind) {
+	switch typ {
+	case OPERAND_TYPE_INPUT_PRIMITIVEID:
+		return "primitiveID", hlslUint
+	case OPERAND_TYPE_INPUT_COVERAGE_MASK:
+		return "coverageMask", hlslUint
+	case OPERAND_TYPE_INPUT_DOMAIN_POINT:
+		return "domainPoint", hlslFloat
+	case OPERAND_TYPE_OUTPUT_CONTROL_POINT_ID:
+		return "controlPointID", hlslUint
+	case OPERAND_TYPE_INPUT_FORK_INSTANCE_ID:
+		return "forkInstanceID", hlslUint
+	case OPERAND_TYPE_INPUT_JOIN_INSTANCE_ID:
+		return "joinInstanceID", hlslUint
+	case OPERAND_TYPE_INPUT_THREAD_ID:
+		return "threadID", hlslUint
+	case OPERAND_TYPE_INPUT_THREAD_GROUP_ID:
+		return "groupID", hlslUint
+	case OPERAND_TYPE_INPUT_THREAD_ID_IN_GROUP:
+		return "groupThreadID", hlslUint
+	case OPERAND_TYPE_INPUT_THREAD_ID_IN_GROUP_FLATTENED:
+		return "groupIndex", hlslUint
+	case OPERAND_TYPE_INPUT_GS_INSTANCE_ID:
+		return "gsInstanceID", hlslUint
+	}
+	return strings.ToLower(typ.ToString()), hlslFloat
+}
+
+func (h *hlslDecompiler) systemValueName(sv SystemValueType, fallback string) string {
+	for i, e := range h.osg {
+		if e.SystemValue == sv {
+			return h.outputNames[i]
+		}
+	}
+	return fallback
+}
+
+func (h *hlslDecompiler) immediate(o *Operand, comps []int, want hlslKind, broadcast, hex bool) hlslExpr {
+	imm, _ := o.GetImmediateUInt()
+	if len(imm) == 0 {
+		return hlslPrimary("0", want, 1)
+	}
+	values := make([]uint32, len(comps))
+	for k, c := range comps {
+		if len(imm) == 1 {
+			values[k] = imm[0]
+		} else {
+			values[k] = imm[min(c, len(imm)-1)]
+		}
+	}
+	kind := want
+	if kind == hlslAny || kind == hlslBool {
+		// Untyped moves of small integers would otherwise show up as denormals
+		kind = hlslFloat
+		intLike := false
+		for _, v := range values {
+			if v != 0 && v < 0x00800000 {
+				intLike = true
+			} else if v != 0 {
+				intLike = false
+				break
+			}
+		}
+		if intLike {
+			kind = hlslInt
+		}
+	}
+	allSame := !slices.ContainsFunc(values, func(v uint32) bool { return v != values[0] })
+	if len(values) == 1 || (allSame && broadcast) {
+		return hlslLiteral(values[0], kind, hex)
+	}
+	lits := make([]hlslExpr, len(values))
+	for k, v := range values {
+		lits[k] = hlslLiteral(v, kind, hex)
+	}
+	return hlslCall(kind.typeName(len(values)), kind, len(values), lits...)
+}
+
+// elementParts maps the components of a signature register to the
+// struct members they belong to.
+func (h *hlslDecompiler) elementParts(elems []Element, names []string, prefix string, reg uint64, comps []int) []hlslPart {
+	parts := make([]hlslPart, len(comps))
+	for k, c := range comps {
+		parts[k] = hlslPart{base: fmt.Sprintf("%v.reg%v", prefix, reg), suffix: string("xyzw"[c]), kind: hlslFloat}
+		for i, e := range elems {
+			if uint64(e.Register) != reg || e.Mask&(1<<c) == 0 {
+				continue
+			}
+			first, width := hlslElementWidth(e)
+			parts[k] = hlslPart{
+				base:   prefix + "." + names[i],
+				suffix: string("xyzw"[c-first]),
+				kind:   hlslKindFromComponentType(e.ComponentType),
+				width:  width,
+			}
+			break
+		}
+	}
+	return parts
+}
+
+// constantBuffer resolves the components of a constant buffer register
+// to the variables declared at those offsets.
+func (h *hlslDecompiler) constantBuffer(subKey func(int) hlslUseKey, o *Operand, comps []int, want hlslKind) hlslExpr {
+	slot := o.Indices[0].Value
+	cb := h.cbSlots[slot]
+	reg := o.Indices[1].Value
+	var rel *hlslExpr
+	if o.Indices[1].Register != nil {
+		e := h.index(subKey(1), OperandIndex{Representation: OPERAND_INDEX_RELATIVE, Register: o.Indices[1].Register})
+		rel = &e
+	}
+	parts := make([]hlslPart, len(comps))
+	for k, c := range comps {
+		parts[k] = hlslPart{base: fmt.Sprintf("cb%v[%v]", slot, reg), suffix: string("xyzw"[c]), kind: hlslFloat}
+		if cb == nil {
+			continue
+		}
+		offset := uint32(reg)*16 + uint32(c)*4
+		v, _, err := cb.VariableFromOffset(offset)
+		if err != nil {
+			continue
+		}
+		name := hlslSanitize(v.Name)
+		relOffset := offset - v.BufferOffset
+		regIdx := relOffset / 16
+		comp := (relOffset % 16) / 4
+		elem := func(i uint32, arrayed bool) string {
+			if !arrayed {
+				return name
+			}
+			if rel != nil {
+				if i == 0 {
+					return fmt.Sprintf("%v[%v]", name, rel.Text)
+				}
+				return fmt.Sprintf("%v[%v + %v]", name, rel.paren(hlslPrecAdditive), i)
+			}
+			return fmt.Sprintf("%v[%v]", name, i)
+		}
+		kind := hlslKindFromVariableType(v.Type)
+		switch v.Class {
+		case SVC_SCALAR, SVC_V10_SCALAR:
+			parts[k] = hlslPart{base: elem(regIdx, v.Elements > 0), suffix: "x", kind: kind, width: 1}
+		case SVC_VECTOR, SVC_V10_VECTOR:
+			parts[k] = hlslPart{base: elem(regIdx, v.Elements > 0), suffix: string("xyzw"[comp]), kind: kind, width: int(v.Cols)}
+		case SVC_MATRIX_ROWS, SVC_V10_MATRIX_ROWS:
+			rows := max(uint32(v.Rows), 1)
+			parts[k] = hlslPart{base: elem(regIdx/rows, v.Elements > 0), suffix: fmt.Sprintf("_m%v%v", regIdx%rows, comp), kind: kind}
+		case SVC_MATRIX_COLUMNS, SVC_V10_MATRIX_COLUMNS:
+			cols := max(uint32(v.Cols), 1)
+			parts[k] = hlslPart{base: elem(regIdx/cols, v.Elements > 0), suffix: fmt.Sprintf("_m%v%v", comp, regIdx%cols), kind: kind}
+		default:
+			parts[k] = hlslPart{base: elem(regIdx, true), suffix: string("xyzw"[comp]), kind: hlslFloat}
+		}
+		if parts[k].kind == hlslBool {
+			// bools are stored as 0 or 1
+			parts[k].base = "uint(" + parts[k].base + ")"
+			parts[k].kind = hlslUint
+		}
+	}
+	return hlslMerge(parts, want)
+}
+
+// emitFolded writes a folded definition as a regular assignment before
+// the current statement, if it wasn't substituted.
+func (h *hlslDecompiler) emitFolded(def *hlslDef) {
+	if h.consumed[def.instr] {
+		return
+	}
+	e, ok := h.foldExprs[def.instr]
+	if !ok {
+		return
+	}
+	h.consumed[def.instr] = true
+	tok := h.opcodes[def.instr].(*InstructionToken)
+	d, _ := tok.hlslSingleDest()
+	h.pre = append(h.pre, h.assignments(tok, d, e)...)
+}
+
+// statement writes an instruction which computes values.
+func (h *hlslDecompiler) statement(i int, tok *InstructionToken) {
+	op := tok.opType()
+	var stmts []string
+	if d, ok := tok.hlslSingleDest(); ok && hlslFoldable(op) {
+		e, ok := h.expression(i, tok, d)
+		if !ok {
+			h.unsupported(tok)
+			return
+		}
+		if _, folded := h.folds[i]; folded {
+			h.foldExprs[i] = e
+			h.flush()
+			return
+		}
+		stmts = h.assignments(tok, d, e)
+	} else {
+		var ok bool
+		stmts, ok = h.special(i, tok)
+		if !ok {
+			h.unsupported(tok)
+			return
+		}
+	}
+	// Definitions folded into this instruction which weren't substituted
+	var pending []*hlslDef
+	for key, def := range h.foldUses {
+		if key.instr == i {
+			pending = append(pending, def)
+		}
+	}
+	slices.SortFunc(pending, func(a, b *hlslDef) int { return a.instr - b.instr })
+	for _, def := range pending {
+		h.emitFolded(def)
+	}
+	h.flush()
+	for _, stmt := range stmts {
+		h.line("%v", stmt)
+	}
+}
+
+func (h *hlslDecompiler) unsupported(tok *InstructionToken) {
+	h.flush()
+	h.line("// %v (not decompiled)", tok.opType().ToString())
+}
+
+// assignments stores e into operand d, converting it to the kind of
+// the destination.
+func (h *hlslDecompiler) assignments(tok *InstructionToken, d int, e hlslExpr) []string {
+	o := &tok.operands[d]
+	if tok.Saturate() {
+		e = hlslCall("saturate", hlslFloat, e.Width, hlslConvert(e, hlslFloat))
+	}
+	comps := maskComps(o.Mask())
+	if o.NumComponents() != 4 {
+		comps = []int{0}
+	}
+	swizzle := "." + hlslSwizzleString(comps)
+	if o.NumComponents() != 4 {
+		swizzle = ""
+	}
+	kind := e.Kind
+	if kind == hlslAny {
+		kind = hlslFloat
+	}
+
+	switch o.OperandToken0.Type() {
+	case OPERAND_TYPE_NULL:
+		return nil
+	case OPERAND_TYPE_TEMP:
+		for _, c := range comps {
+			h.tempKinds[hlslLoc{OPERAND_TYPE_TEMP, o.Indices[0].Value, c}] = kind
+		}
+		return []string{fmt.Sprintf("r%v%v = %v;", o.Indices[0].Value, swizzle, hlslConvert(e, hlslFloat).Text)}
+	case OPERAND_TYPE_INDEXABLE_TEMP:
+		idx := h.index(hlslUseKey{-1, -1, -1}, o.Indices[1])
+		return []string{fmt.Sprintf("x%v[%v]%v = %v;", o.Indices[0].Value, idx.Text, swizzle, hlslConvert(e, hlslFloat).Text)}
+	case OPERAND_TYPE_OUTPUT:
+		parts := h.elementParts(h.osg, h.outputNames, "output", o.Indices[0].Value, comps)
+		var stmts []string
+		for start := 0; start < len(parts); {
+			end := start + 1
+			for end < len(parts) && parts[end].base == parts[start].base {
+				end++
+			}
+			var suffixes []string
+			positions := make([]int, 0, end-start)
+			for p := start; p < end; p++ {
+				suffixes = append(suffixes, parts[p].suffix)
+				positions = append(positions, p)
+			}
+			target := parts[start].base + parts[start].selector(suffixes)
+			value := e
+			if e.Width > 1 {
+				value = hlslSwizzle(e, positions)
+			}
+			stmts = append(stmts, fmt.Sprintf("%v = %v;", target, hlslConvert(value, parts[start].kind).Text))
+			start = end
+		}
+		return stmts
+	}
+	target := h.value(hlslUseKey{-1, -1, -1}, o, comps, hlslAny, true, false)
+	return []string{fmt.Sprintf("%v = %v;", target.Text, hlslConvert(e, target.Kind).Text)}
+}
+
+// destComps returns the components written to operand d.
+func (tok *InstructionToken) destComps(d int) []int {
+	if tok.operands[d].NumComponents() != 4 {
+		return []int{0}
+	}
+	return maskComps(tok.operands[d].Mask())
+}
+
+// expression renders the value a single-destination instruction
+// stores into operand d.
+func (h *hlslDecompiler) expression(i int, tok *InstructionToken, d int) (hlslExpr, bool) {
+	op := tok.opType()
+	numType := hlslKindFromNumberType(op.NumberType())
+	width := len(tok.destComps(d))
+	src := func(j int, want hlslKind) hlslExpr {
+		return h.src(i, tok, j, h.srcComps(tok, j), want)
+	}
+	srcVec := func(j int, want hlslKind) hlslExpr {
+		return h.srcVec(i, tok, j, h.srcComps(tok, j), want)
+	}
+	call := func(name string, kind hlslKind, args ...int) hlslExpr {
+		exprs := make([]hlslExpr, len(args))
+		for k, j := range args {
+			exprs[k] = src(j, kind)
+		}
+		return hlslCall(name, kind, width, exprs...)
+	}
+	binary := func(operator string, prec int, kind hlslKind) hlslExpr {
+		return hlslBinary(operator, prec, kind, src(1, numType), src(2, numType))
+	}
+
+	switch op {
+	case OPCODE_MOV:
+		return src(1, hlslAny), true
+	case OPCODE_MOVC:
+		cond := src(1, hlslAny)
+		if cond.Kind != hlslBool {
+			cond = hlslConvert(cond, hlslBool)
+		}
+		a, b := src(2, hlslAny), src(3, hlslAny)
+		if a.Kind != b.Kind {
+			a, b = hlslConvert(a, hlslFloat), hlslConvert(b, hlslFloat)
+		}
+		return hlslTernary(cond, a, b), true
+	case OPCODE_ADD, OPCODE_IADD:
+		a, b := src(1, numType), src(2, numType)
+		if strings.HasPrefix(b.Text, "-") && b.Prec == hlslPrecUnary {
+			b.Text = strings.TrimPrefix(b.Text, "-")
+			b.Prec = hlslPrecPrimary
+			if strings.HasPrefix(b.Text, "(") && strings.HasSuffix(b.Text, ")") && tok.operands[2].Modifier() != OPERAND_MODIFIER_NEG {
+				b.Prec = hlslPrecPrimary
+			}
+			return hlslBinary("-", hlslPrecAdditive, numType, a, b), true
+		}
+		return hlslBinary("+", hlslPrecAdditive, numType, a, b), true
+	case OPCODE_MUL:
+		return binary("*", hlslPrecMultiplicative, numType), true
+	case OPCODE_DIV:
+		return binary("/", hlslPrecMultiplicative, numType), true
+	case OPCODE_MAD, OPCODE_IMAD, OPCODE_UMAD:
+		mul := hlslBinary("*", hlslPrecMultiplicative, numType, src(1, numType), src(2, numType))
+		return hlslBinary("+", hlslPrecAdditive, numType, mul, src(3, numType)), true
+	case OPCODE_MIN, OPCODE_IMIN, OPCODE_UMIN:
+		return call("min", numType, 1, 2), true
+	case OPCODE_MAX, OPCODE_IMAX, OPCODE_UMAX:
+		return call("max", numType, 1, 2), true
+	case OPCODE_DP2, OPCODE_DP3, OPCODE_DP4:
+		return hlslCall("dot", hlslFloat, 1, srcVec(1, hlslFloat), srcVec(2, hlslFloat)), true
+	case OPCODE_EQ, OPCODE_IEQ:
+		return binary("==", hlslPrecEquality, hlslBool), true
+	case OPCODE_NE, OPCODE_INE:
+		return binary("!=", hlslPrecEquality, hlslBool), true
+	case OPCODE_LT, OPCODE_ILT, OPCODE_ULT:
+		return binary("<", hlslPrecRelational, hlslBool), true
+	case OPCODE_GE, OPCODE_IGE, OPCODE_UGE:
+		return binary(">=", hlslPrecRelational, hlslBool), true
+	case OPCODE_AND, OPCODE_OR:
+		a, b := src(1, hlslAny), src(2, hlslAny)
+		if a.Kind == hlslBool && b.Kind == hlslBool {
+			if op == OPCODE_AND {
+				return hlslBinary("&&", hlslPrecLogicalAnd, hlslBool, a, b), true
+			}
+			return hlslBinary("||", hlslPrecLogicalOr, hlslBool, a, b), true
+		}
+		if op == OPCODE_AND {
+			// Masking a constant with a comparison result selects it
+			if b.Kind == hlslBool && tok.operands[1].OperandToken0.Type() == OPERAND_TYPE_IMMEDIATE32 {
+				a, b = b, a
+				j := 1
+				return hlslTernary(a, h.src(i, tok, j, h.srcComps(tok, j), hlslFloat), hlslLiteral(0, hlslFloat, false)), true
+			}
+			if a.Kind == hlslBool && tok.operands[2].OperandToken0.Type() == OPERAND_TYPE_IMMEDIATE32 {
+				return hlslTernary(a, h.src(i, tok, 2, h.srcComps(tok, 2), hlslFloat), hlslLiteral(0, hlslFloat, false)), true
+			}
+		}
+		if op == OPCODE_AND {
+			return hlslBinary("&", hlslPrecBitAnd, hlslUint, hlslConvert(a, hlslUint), hlslConvert(b, hlslUint)), true
+		}
+		return hlslBinary("|", hlslPrecBitOr, hlslUint, hlslConvert(a, hlslUint), hlslConvert(b, hlslUint)), true
+	case OPCODE_XOR:
+		return binary("^", hlslPrecBitXor, hlslUint), true
+	case OPCODE_NOT:
+		return hlslUnary("~", src(1, hlslUint)), true
+	case OPCODE_ISHL:
+		return binary("<<", hlslPrecShift, hlslInt), true
+	case OPCODE_ISHR:
+		return binary(">>", hlslPrecShift, hlslInt), true
+	case OPCODE_USHR:
+		return hlslBinary(">>", hlslPrecShift, hlslUint, src(1, hlslUint), src(2, hlslUint)), true
+	case OPCODE_INEG:
+		return hlslUnary("-", src(1, hlslInt)), true
+	case OPCODE_FTOI:
+		return hlslCall(hlslInt.typeName(width), hlslInt, width, src(1, hlslFloat)), true
+	case OPCODE_FTOU:
+		return hlslCall(hlslUint.typeName(width), hlslUint, width, src(1, hlslFloat)), true
+	case OPCODE_ITOF:
+		return hlslCall(hlslFloat.typeName(width), hlslFloat, width, src(1, hlslInt)), true
+	case OPCODE_UTOF:
+		return hlslCall(hlslFloat.typeName(width), hlslFloat, width, src(1, hlslUint)), true
+	case OPCODE_EXP:
+		return call("exp2", hlslFloat, 1), true
+	case OPCODE_LOG:
+		return call("log2", hlslFloat, 1), true
+	case OPCODE_FRC:
+		return call("frac", hlslFloat, 1), true
+	case OPCODE_RSQ:
+		return call("rsqrt", hlslFloat, 1), true
+	case OPCODE_SQRT:
+		return call("sqrt", hlslFloat, 1), true
+	case OPCODE_11_RCP:
+		return call("rcp", hlslFloat, 1), true
+	case OPCODE_ROUND_NE:
+		return call("round", hlslFloat, 1), true
+	case OPCODE_ROUND_NI:
+		return call("floor", hlslFloat, 1), true
+	case OPCODE_ROUND_PI:
+		return call("ceil", hlslFloat, 1), true
+	case OPCODE_ROUND_Z:
+		return call("trunc", hlslFloat, 1), true
+	case OPCODE_DERIV_RTX:
+		return call("ddx", hlslFloat, 1), true
+	case OPCODE_DERIV_RTY:
+		return call("ddy", hlslFloat, 1), true
+	case OPCODE_11_DERIV_RTX_COARSE:
+		return call("ddx_coarse", hlslFloat, 1), true
+	case OPCODE_11_DERIV_RTX_FINE:
+		return call("ddx_fine", hlslFloat, 1), true
+	case OPCODE_11_DERIV_RTY_COARSE:
+		return call("ddy_coarse", hlslFloat, 1), true
+	case OPCODE_11_DERIV_RTY_FINE:
+		return call("ddy_fine", hlslFloat, 1), true
+	case OPCODE_11_F32TOF16:
+		return hlslCall("f32tof16", hlslUint, width, src(1, hlslFloat)), true
+	case OPCODE_11_F16TOF32:
+		return hlslCall("f16tof32", hlslFloat, width, src(1, hlslUint)), true
+	case OPCODE_11_COUNTBITS:
+		return call("countbits", hlslUint, 1), true
+	case OPCODE_11_FIRSTBIT_HI:
+		return call("firstbithigh", hlslUint, 1), true
+	case OPCODE_11_FIRSTBIT_SHI:
+		return call("firstbithigh", hlslInt, 1), true
+	case OPCODE_11_FIRSTBIT_LO:
+		return call("firstbitlow", hlslUint, 1), true
+	case OPCODE_11_BFREV:
+		return call("reversebits", hlslUint, 1), true
+	case OPCODE_11_UBFE, OPCODE_11_IBFE:
+		// (src << (32 - (width + offset))) >> (32 - width), with an arithmetic shift for ibfe
+		kind := hlslUint
+		if op == OPCODE_11_IBFE {
+			kind = hlslInt
+		}
+		bitWidth, offset, value := src(1, hlslUint), src(2, hlslUint), src(3, kind)
+		thirtyTwo := hlslPrimary("32", hlslUint, 1)
+		left := hlslBinary("-", hlslPrecAdditive, hlslUint, thirtyTwo, hlslBinary("+", hlslPrecAdditive, hlslUint, bitWidth, offset))
+		right := hlslBinary("-", hlslPrecAdditive, hlslUint, thirtyTwo, bitWidth)
+		return hlslBinary(">>", hlslPrecShift, kind, hlslBinary("<<", hlslPrecShift, kind, value, left), right), true
+	case OPCODE_11_BFI:
+		// mask = ((1 << width) - 1) << offset; ((insert << offset) & mask) | (base & ~mask)
+		bitWidth, offset := src(1, hlslUint), src(2, hlslUint)
+		one := hlslPrimary("1", hlslUint, 1)
+		mask := hlslBinary("<<", hlslPrecShift, hlslUint,
+			hlslBinary("-", hlslPrecAdditive, hlslUint, hlslBinary("<<", hlslPrecShift, hlslUint, one, bitWidth), one), offset)
+		insert := hlslBinary("&", hlslPrecBitAnd, hlslUint, hlslBinary("<<", hlslPrecShift, hlslUint, src(3, hlslUint), offset), mask)
+		base := hlslBinary("&", hlslPrecBitAnd, hlslUint, src(4, hlslUint), hlslUnary("~", mask))
+		return hlslBinary("|", hlslPrecBitOr, hlslUint, insert, base), true
+	case OPCODE_SAMPLE, OPCODE_SAMPLE_L, OPCODE_SAMPLE_B, OPCODE_SAMPLE_D, OPCODE_SAMPLE_C,
+		OPCODE_SAMPLE_C_LZ, OPCODE_LD, OPCODE_10_1_GATHER4, OPCODE_10_1_LOD:
+		return h.sample(i, tok, d)
+	}
+	return hlslExpr{}, false
+}
+
+// sampleOffset returns the immediate texel offset of a sample
+// instruction, if it has one.
+func (tok *InstructionToken) sampleOffset(dim int) (hlslExpr, bool) {
+	for _, ext := range tok.extensions {
+		if ext&0x3f != 1 { // D3D10_SB_EXTENDED_OPCODE_SAMPLE_CONTROLS
+			continue
+		}
+		signExtend := func(v uint32) int {
+			return int(int32(v<<28) >> 28)
+		}
+		offsets := []int{signExtend(ext >> 9), signExtend(ext >> 13), signExtend(ext >> 17)}[:min(dim, 3)]
+		if !slices.ContainsFunc(offsets, func(o int) bool { return o != 0 }) {
+			return hlslExpr{}, false
+		}
+		lits := make([]hlslExpr, len(offsets))
+		for k, off := range offsets {
+			lits[k] = hlslLiteral(uint32(int32(off)), hlslInt, false)
+		}
+		return hlslCall(hlslInt.typeName(len(offsets)), hlslInt, len(offsets), lits...), true
+	}
+	return hlslExpr{}, false
+}
+
+// sample renders texture sampling and load instructions as methods
+// on the texture object.
+func (h *hlslDecompiler) sample(i int, tok *InstructionToken, d int) (hlslExpr, bool) {
+	op := tok.opType()
+	texture := h.value(hlslUseKey{i, 2, 0}, &tok.operands[2], nil, hlslAny, true, false)
+	coord := h.srcVec(i, tok, 1, h.srcComps(tok, 1), hlslFloat)
+	args := []hlslExpr{}
+	var method string
+	var kind hlslKind = hlslFloat
+	if rb := tok.operands[2].ResourceBinding(h.res); rb != nil {
+		switch rb.ReturnType {
+		case SINT:
+			kind = hlslInt
+		case UINT:
+			kind = hlslUint
+		}
+	}
+	scalar := func(j int, want hlslKind) hlslExpr {
+		return h.src(i, tok, j, h.srcComps(tok, j)[:1], want)
+	}
+	if op != OPCODE_LD {
+		sampler := h.value(hlslUseKey{i, 3, 0}, &tok.operands[3], nil, hlslAny, true, false)
+		args = append(args, sampler)
+	}
+	switch op {
+	case OPCODE_SAMPLE:
+		method = "Sample"
+		args = append(args, coord)
+	case OPCODE_SAMPLE_L:
+		method = "SampleLevel"
+		args = append(args, coord, scalar(4, hlslFloat))
+	case OPCODE_SAMPLE_B:
+		method = "SampleBias"
+		args = append(args, coord, scalar(4, hlslFloat))
+	case OPCODE_SAMPLE_D:
+		method = "SampleGrad"
+		args = append(args, coord, h.srcVec(i, tok, 4, h.srcComps(tok, 4), hlslFloat), h.srcVec(i, tok, 5, h.srcComps(tok, 5), hlslFloat))
+	case OPCODE_SAMPLE_C:
+		method = "SampleCmp"
+		args = append(args, coord, scalar(4, hlslFloat))
+	case OPCODE_SAMPLE_C_LZ:
+		method = "SampleCmpLevelZero"
+		args = append(args, coord, scalar(4, hlslFloat))
+	case OPCODE_10_1_GATHER4:
+		method = "Gather" + []string{"Red", "Green", "Blue", "Alpha"}[max(tok.operands[3].hlslSwizzleSrc()[0], 0)]
+		args = append(args, coord)
+	case OPCODE_10_1_LOD:
+		return hlslCall(texture.Text+".CalculateLevelOfDetail", hlslFloat, 1, args[0], coord), true
+	case OPCODE_LD:
+		method = "Load"
+		args = append(args, h.srcVec(i, tok, 1, h.srcComps(tok, 1), hlslInt))
+	}
+	if offset, ok := tok.sampleOffset(h.resourceDimensions(tok)); ok && op != OPCODE_10_1_GATHER4 {
+		args = append(args, offset)
+	}
+	if op == OPCODE_SAMPLE_C || op == OPCODE_SAMPLE_C_LZ {
+		return hlslCall(texture.Text+"."+method, hlslFloat, 1, args...), true
+	}
+	result := hlslCall(texture.Text+"."+method, kind, 4, args...)
+	resSwz := tok.operands[2].hlslSwizzleSrc()
+	var positions []int
+	for _, c := range tok.destComps(d) {
+		positions = append(positions, int(max(resSwz[c], 0)))
+	}
+	return hlslSwizzle(result, positions), true
+}
+
+// special renders instructions which don't map to a single expression.
+func (h *hlslDecompiler) special(i int, tok *InstructionToken) ([]string, bool) {
+	op := tok.opType()
+	src := func(j int, want hlslKind, mask uint8) hlslExpr {
+		swz := tok.operands[j].hlslSwizzleSrc()
+		var comps []int
+		for _, c := range maskComps(mask) {
+			if swz[c] >= 0 {
+				comps = append(comps, int(swz[c]))
+			}
+		}
+		if tok.operands[j].NumComponents() == 1 {
+			comps = []int{0}
+		}
+		return h.src(i, tok, j, comps, want)
+	}
+
+	type result struct {
+		d int
+		e func(mask uint8) hlslExpr
+	}
+	var results []result
+	switch op {
+	case OPCODE_SINCOS:
+		results = []result{
+			{0, func(mask uint8) hlslExpr {
+				return hlslCall("sin", hlslFloat, bits.OnesCount8(mask), src(2, hlslFloat, mask))
+			}},
+			{1, func(mask uint8) hlslExpr {
+				return hlslCall("cos", hlslFloat, bits.OnesCount8(mask), src(2, hlslFloat, mask))
+			}},
+		}
+	case OPCODE_UDIV:
+		results = []result{
+			{0, func(mask uint8) hlslExpr {
+				return hlslBinary("/", hlslPrecMultiplicative, hlslUint, src(2, hlslUint, mask), src(3, hlslUint, mask))
+			}},
+			{1, func(mask uint8) hlslExpr {
+				return hlslBinary("%", hlslPrecMultiplicative, hlslUint, src(2, hlslUint, mask), src(3, hlslUint, mask))
+			}},
+		}
+	case OPCODE_UMUL, OPCODE_IMUL:
+		kind := hlslUint
+		if op == OPCODE_IMUL {
+			kind = hlslInt
+		}
+		results = []result{
+			{0, func(mask uint8) hlslExpr {
+				// High 32 bits of the product
+				return hlslCall("mul_hi", kind, bits.OnesCount8(mask), src(2, kind, mask), src(3, kind, mask))
+			}},
+			{1, func(mask uint8) hlslExpr {
+				return hlslBinary("*", hlslPrecMultiplicative, kind, src(2, kind, mask), src(3, kind, mask))
+			}},
+		}
+	case OPCODE_RESINFO:
+		return h.resinfo(i, tok), true
+	default:
+		return nil, false
+	}
+
+	var locals, assigns []string
+	var active []result
+	for _, r := range results {
+		if tok.operands[r.d].OperandToken0.Type() != OPERAND_TYPE_NULL {
+			active = append(active, r)
+		}
+	}
+	if len(active) == 1 {
+		r := active[0]
+		return h.assignments(tok, r.d, r.e(tok.operands[r.d].Mask())), true
+	}
+	for k, r := range active {
+		e := r.e(tok.operands[r.d].Mask())
+		local := fmt.Sprintf("t%v", k)
+		locals = append(locals, fmt.Sprintf("    %v %v = %v;", e.Kind.typeName(e.Width), local, e.Text))
+		for _, a := range h.assignments(tok, r.d, hlslPrimary(local, e.Kind, e.Width)) {
+			assigns = append(assigns, "    "+a)
+		}
+	}
+	lines := append([]string{"{"}, locals...)
+	lines = append(lines, assigns...)
+	return append(lines, "}"), true
+}
+
+// resinfo renders a texture size query through GetDimensions.
+func (h *hlslDecompiler) resinfo(i int, tok *InstructionToken) []string {
+	const returnTypeMask, returnTypeShift = 0x00001800, 11
+	returnType := (tok.opcode & returnTypeMask) >> returnTypeShift // 0: float, 1: rcp float, 2: uint
+	texture := h.value(hlslUseKey{i, 2, 0}, &tok.operands[2], nil, hlslAny, true, false)
+	mip := h.src(i, tok, 1, h.srcComps(tok, 1), hlslUint)
+
+	var names []string
+	switch dim := tok.operands[2].ResourceBinding(h.res); {
+	case dim == nil:
+		names = []string{"width", "height", "levels"}
+	case dim.ViewDimension == TEXTURE_1D:
+		names = []string{"width", "levels"}
+	case dim.ViewDimension == TEXTURE_1D_ARRAY:
+		names = []string{"width", "elements", "levels"}
+	case dim.ViewDimension == TEXTURE_2D_ARRAY, dim.ViewDimension == TEXTURE_CUBE_ARRAY:
+		names = []string{"width", "height", "elements", "levels"}
+	case dim.ViewDimension == TEXTURE_3D:
+		names = []string{"width", "height", "depth", "levels"}
+	default:
+		names = []string{"width", "height", "levels"}
+	}
+	// Components of the result: width, height, depth/elements, levels
+	values := []string{"width", "0", "0", "levels"}
+	for k, name := range names[:len(names)-1] {
+		values[k] = name
+	}
+
+	lines := []string{"{", fmt.Sprintf("    uint %v;", strings.Join(names, ", ")),
+		fmt.Sprintf("    %v.GetDimensions(%v, %v);", texture.Text, mip.Text, strings.Join(names, ", "))}
+	swz := tok.operands[2].hlslSwizzleSrc()
+	var comps []string
+	for _, c := range tok.destComps(0) {
+		v := values[max(swz[c], 0)]
+		switch {
+		case returnType == 2:
+		case returnType == 1 && v != "levels" && v != "0":
+			v = "1.0 / " + v
+		default:
+			v = "float(" + v + ")"
+		}
+		comps = append(comps, v)
+	}
+	kind := hlslFloat
+	if returnType == 2 {
+		kind = hlslUint
+	}
+	e := hlslPrimary(strings.Join(comps, ", "), kind, len(comps))
+	if len(comps) > 1 {
+		e = hlslPrimary(kind.typeName(len(comps))+"("+e.Text+")", kind, len(comps))
+	}
+	for _, a := range h.assignments(tok, 0, e) {
+		lines = append(lines, "    "+a)
+	}
+	return append(lines, "}")
+}
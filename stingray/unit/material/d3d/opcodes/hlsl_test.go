@@ -0,0 +1,259 @@
+package d3dops
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Operand tokens for hand-assembling shader programs.
+
+func swizzleBits(swz string) uint32 {
+	var bits uint32
+	for i, c := range swz {
+		bits |= uint32(strings.IndexRune("xyzw", c)) << (4 + 2*i)
+	}
+	return bits
+}
+
+func maskBits(mask string) uint32 {
+	var bits uint32
+	for _, c := range mask {
+		bits |= 1 << (4 + strings.IndexRune("xyzw", c))
+	}
+	return bits
+}
+
+// Register operand with immediate indices. Sources with a single
+// component use select-1 mode, others swizzle mode.
+func register(typ OPERAND_TYPE, dst bool, swz string, indices ...uint32) []uint32 {
+	token := uint32(OPERAND_4_COMPONENT) | uint32(typ)<<OPERAND_TYPE_SHIFT | uint32(len(indices))<<OPERAND_INDEX_DIMENSION_SHIFT
+	switch {
+	case dst:
+		token |= uint32(OPERAND_4_COMPONENT_MASK_MODE)<<OPERAND_4_COMPONENT_SELECTION_MODE_SHIFT | maskBits(swz)
+	case len(swz) == 1:
+		token |= uint32(OPERAND_4_COMPONENT_SELECT_1_MODE)<<OPERAND_4_COMPONENT_SELECTION_MODE_SHIFT | swizzleBits(swz)
+	default:
+		token |= uint32(OPERAND_4_COMPONENT_SWIZZLE_MODE)<<OPERAND_4_COMPONENT_SELECTION_MODE_SHIFT | swizzleBits(swz+strings.Repeat(swz[len(swz)-1:], 4-len(swz)))
+	}
+	return append([]uint32{token}, indices...)
+}
+
+func rDst(reg uint32, mask string) []uint32 { return register(OPERAND_TYPE_TEMP, true, mask, reg) }
+func rSrc(reg uint32, swz string) []uint32  { return register(OPERAND_TYPE_TEMP, false, swz, reg) }
+func vSrc(reg uint32, swz string) []uint32  { return register(OPERAND_TYPE_INPUT, false, swz, reg) }
+func oDst(reg uint32, mask string) []uint32 { return register(OPERAND_TYPE_OUTPUT, true, mask, reg) }
+func cbSrc(slot, reg uint32, swz string) []uint32 {
+	return register(OPERAND_TYPE_CONSTANT_BUFFER, false, swz, slot, reg)
+}
+
+func immF(f float32) []uint32 {
+	return []uint32{uint32(OPERAND_1_COMPONENT) | uint32(OPERAND_TYPE_IMMEDIATE32)<<OPERAND_TYPE_SHIFT, math.Float32bits(f)}
+}
+
+func immI(i int32) []uint32 {
+	return []uint32{uint32(OPERAND_1_COMPONENT) | uint32(OPERAND_TYPE_IMMEDIATE32)<<OPERAND_TYPE_SHIFT, uint32(i)}
+}
+
+// Instruction tokens with the given opcode flags, e.g. INVERT_BOOLEAN_MASK
+// for the *_nz variants of conditionals.
+func ins(op ShaderOpcodeType, flags uint32, operands ...[]uint32) []uint32 {
+	var body []uint32
+	for _, o := range operands {
+		body = append(body, o...)
+	}
+	return append([]uint32{uint32(op) | flags | uint32(1+len(body))<<LENGTH_SHIFT}, body...)
+}
+
+func assemble(t *testing.T, instructions ...[]uint32) []Opcode {
+	var b bytes.Buffer
+	for _, tokens := range instructions {
+		binary.Write(&b, binary.LittleEndian, tokens)
+	}
+	var opcodes []Opcode
+	for b.Len() > 0 {
+		opcode, err := ParseOpcode(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opcodes = append(opcodes, opcode)
+	}
+	return opcodes
+}
+
+func TestDecompileHLSL(t *testing.T) {
+	const nz = INVERT_BOOLEAN_MASK
+	longName := strings.Repeat("very_long_parameter_name_", 4)
+	cbs := []ConstantBuffer{{
+		Name: "c_per_object",
+		Size: 48,
+		Variables: []Variable{
+			{Name: "tint", BufferOffset: 0, Size: 16, Flags: 0x2, VariableType: VariableType{Class: SVC_VECTOR, Type: SVT_FLOAT, Rows: 1, Cols: 4}},
+			{Name: longName + "a", BufferOffset: 16, Size: 4, Flags: 0x2, VariableType: VariableType{Class: SVC_SCALAR, Type: SVT_FLOAT, Rows: 1, Cols: 1}},
+			{Name: longName + "b", BufferOffset: 20, Size: 4, Flags: 0x2, VariableType: VariableType{Class: SVC_SCALAR, Type: SVT_FLOAT, Rows: 1, Cols: 1}},
+			{Name: "count", BufferOffset: 32, Size: 4, Flags: 0x2, VariableType: VariableType{Class: SVC_SCALAR, Type: SVT_INT, Rows: 1, Cols: 1}},
+		},
+	}}
+	res := []ResourceBinding{{Name: "c_per_object", InputType: CBUFFER, BindPoint: 0}}
+	isg := []Element{{Name: "TEXCOORD", ComponentType: RCT_FLOAT32, Register: 0, Mask: 0x3}}
+	osg := []Element{{Name: "COLOR", ComponentType: RCT_FLOAT32, Register: 0, Mask: 0xf}}
+	temps := ins(OPCODE_DCL_TEMPS, 0, []uint32{2})
+
+	for _, test := range []struct {
+		name    string
+		program [][]uint32
+		// Lines which must appear in order
+		want []string
+		// Line prefixes which must not appear
+		notWant []string
+	}{
+		{
+			name: "fold single use",
+			program: [][]uint32{
+				temps,
+				ins(OPCODE_MUL, 0, rDst(0, "x"), vSrc(0, "x"), vSrc(0, "y")),
+				ins(OPCODE_ADD, 0, oDst(0, "x"), rSrc(0, "x"), immF(1)),
+				ins(OPCODE_RET, 0),
+			},
+			want:    []string{"output.color0.x = input.texcoord0.x * input.texcoord0.y + 1.0;", "return output;"},
+			notWant: []string{"r0.x ="},
+		},
+		{
+			name: "keep value read twice",
+			program: [][]uint32{
+				temps,
+				ins(OPCODE_MUL, 0, rDst(0, "x"), vSrc(0, "x"), vSrc(0, "y")),
+				ins(OPCODE_ADD, 0, oDst(0, "x"), rSrc(0, "x"), rSrc(0, "x")),
+			},
+			want: []string{"r0.x = input.texcoord0.x * input.texcoord0.y;", "output.color0.x = r0.x + r0.x;"},
+		},
+		{
+			name: "if else",
+			program: [][]uint32{
+				temps,
+				ins(OPCODE_LT, 0, rDst(0, "x"), vSrc(0, "x"), immF(0.5)),
+				ins(OPCODE_IF, nz, rSrc(0, "x")),
+				ins(OPCODE_MOV, 0, oDst(0, "x"), immF(1)),
+				ins(OPCODE_ELSE, 0),
+				ins(OPCODE_MOV, 0, oDst(0, "x"), immF(0)),
+				ins(OPCODE_ENDIF, 0),
+			},
+			want: []string{
+				"if (input.texcoord0.x < 0.5) {",
+				"    output.color0.x = 1.0;",
+				"} else {",
+				"    output.color0.x = 0.0;",
+				"}",
+			},
+		},
+		{
+			name: "loop to while",
+			program: [][]uint32{
+				temps,
+				ins(OPCODE_MOV, 0, rDst(0, "x"), immI(0)),
+				ins(OPCODE_LOOP, 0),
+				ins(OPCODE_IGE, 0, rDst(0, "y"), rSrc(0, "x"), cbSrc(0, 2, "x")),
+				ins(OPCODE_BREAKC, nz, rSrc(0, "y")),
+				ins(OPCODE_IADD, 0, rDst(0, "x"), rSrc(0, "x"), immI(1)),
+				ins(OPCODE_ENDLOOP, 0),
+			},
+			want: []string{
+				"while (!(asint(r0.x) >= count)) {",
+				"    r0.x = asfloat(asint(r0.x) + 1);",
+				"}",
+			},
+			notWant: []string{"r0.y ="},
+		},
+		{
+			name: "long loop condition stays in the loop",
+			program: [][]uint32{
+				temps,
+				ins(OPCODE_LOOP, 0),
+				ins(OPCODE_GE, 0, rDst(1, "x"), cbSrc(0, 1, "x"), cbSrc(0, 1, "y")),
+				ins(OPCODE_BREAKC, nz, rSrc(1, "x")),
+				ins(OPCODE_ADD, 0, oDst(0, "x"), immF(1), immF(2)),
+				ins(OPCODE_ENDLOOP, 0),
+			},
+			want: []string{
+				"while (true) {",
+				"    r1.x = asfloat(" + longName + "a >= " + longName + "b ? 0xffffffff : 0);",
+				"    if (!(asuint(r1.x) == 0)) break;",
+				"    output.color0.x = 1.0 + 2.0;",
+				"}",
+			},
+		},
+		{
+			name: "switch",
+			program: [][]uint32{
+				temps,
+				ins(OPCODE_FTOI, 0, rDst(0, "x"), vSrc(0, "x")),
+				ins(OPCODE_SWITCH, 0, rSrc(0, "x")),
+				ins(OPCODE_CASE, 0, immI(1)),
+				ins(OPCODE_MOV, 0, oDst(0, "x"), immF(1)),
+				ins(OPCODE_BREAK, 0),
+				ins(OPCODE_DEFAULT, 0),
+				ins(OPCODE_MOV, 0, oDst(0, "x"), immF(0)),
+				ins(OPCODE_BREAK, 0),
+				ins(OPCODE_ENDSWITCH, 0),
+			},
+			want: []string{
+				"switch (int(input.texcoord0.x)) {",
+				"case 1:",
+				"    output.color0.x = 1.0;",
+				"    break;",
+				"default:",
+				"    output.color0.x = 0.0;",
+				"    break;",
+				"}",
+			},
+		},
+		{
+			name: "cbuffer names",
+			program: [][]uint32{
+				temps,
+				ins(OPCODE_MUL, 0, oDst(0, "xyzw"), cbSrc(0, 0, "xyzw"), cbSrc(0, 1, "x")),
+			},
+			want: []string{
+				"cbuffer c_per_object : register(b0) // size: 48",
+				"float4 tint : packoffset(c0); // offset: 0, size: 16",
+				"float " + longName + "a : packoffset(c1); // offset: 16, size: 4",
+				"float " + longName + "b : packoffset(c1.y); // offset: 20, size: 4",
+				"int count : packoffset(c2); // offset: 32, size: 4",
+				"output.color0 = tint * " + longName + "a.xxxx;",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			hlsl := DecompileHLSL(PIXEL_SHADER, cbs, isg, osg, res, assemble(t, test.program...))
+			var lines []string
+			for _, line := range strings.Split(hlsl, "\n") {
+				// Strip the indentation of main's body
+				lines = append(lines, strings.TrimPrefix(line, "    "))
+			}
+			next := 0
+			for _, want := range test.want {
+				found := false
+				for next < len(lines) {
+					next++
+					if lines[next-1] == want {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("expected line %q (in order), got:\n%v", want, hlsl)
+					return
+				}
+			}
+			for _, notWant := range test.notWant {
+				for _, line := range lines {
+					if strings.HasPrefix(strings.TrimSpace(line), notWant) {
+						t.Errorf("unexpected %q in:\n%v", notWant, hlsl)
+					}
+				}
+			}
+		})
+	}
+}
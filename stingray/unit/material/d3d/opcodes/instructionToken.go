@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/bits"
+	"slices"
 	"strings"
 )
 
@@ -849,3 +850,30 @@ func ParseInstruction(opcode uint32, data []uint8) (Opcode, error) {
 		operands:      operands,
 	}, nil
 }
+
+// TextureSamplers returns the bind points of the samplers each texture
+// bind point is sampled with in a shader program.
+func TextureSamplers(opcodes []Opcode) map[uint32][]uint32 {
+	samplers := make(map[uint32][]uint32)
+	for _, opcode := range opcodes {
+		tok, ok := opcode.(*InstructionToken)
+		if !ok {
+			continue
+		}
+		switch ShaderOpcodeType(tok.opcode & TYPE_MASK) {
+		case OPCODE_SAMPLE, OPCODE_SAMPLE_L, OPCODE_SAMPLE_B, OPCODE_SAMPLE_D, OPCODE_SAMPLE_C, OPCODE_SAMPLE_C_LZ,
+			OPCODE_10_1_GATHER4, OPCODE_10_1_LOD:
+		default:
+			continue
+		}
+		if len(tok.operands) < 4 || len(tok.operands[2].Indices) == 0 || len(tok.operands[3].Indices) == 0 {
+			continue
+		}
+		texture := uint32(tok.operands[2].Indices[0].Value)
+		sampler := uint32(tok.operands[3].Indices[0].Value)
+		if !slices.Contains(samplers[texture], sampler) {
+			samplers[texture] = append(samplers[texture], sampler)
+		}
+	}
+	return samplers
+}
@@ -764,22 +764,31 @@ func (e Element) NameWithIndex(isInput bool) string {
 	if !isInput {
 		prefix = "o"
 	}
-	if e.Name == "SV_TARGET" {
-		// From core/stingray_renderer/shader_libraries/common.shader_source
-		switch e.SemanticIndex {
-		case 0:
-			return "base_color_rgb_material_id_w"
-		case 1:
-			return "normal_or_shell_direction_xyz_roughness_w"
-		case 2:
-			return "ao_x_metallic_density_cloth_clearcoat_shellnormal_y_velocity_zw"
-		case 3:
-			return "ambient_diffuse_light_xyzw"
-		}
+	if name, ok := stingrayTargetName(e); ok {
+		return name
 	}
 	return fmt.Sprintf("%v%v%v", prefix, e.Name, semantic)
 }
 
+// stingrayTargetName returns the name of a G-buffer render target output.
+func stingrayTargetName(e Element) (string, bool) {
+	if e.Name != "SV_TARGET" {
+		return "", false
+	}
+	// From core/stingray_renderer/shader_libraries/common.shader_source
+	switch e.SemanticIndex {
+	case 0:
+		return "base_color_rgb_material_id_w", true
+	case 1:
+		return "normal_or_shell_direction_xyz_roughness_w", true
+	case 2:
+		return "ao_x_metallic_density_cloth_clearcoat_shellnormal_y_velocity_zw", true
+	case 3:
+		return "ambient_diffuse_light_xyzw", true
+	}
+	return "", false
+}
+
 type ShaderInputType uint32
 
 const (
@@ -34,6 +34,22 @@ const (
 	SettingTypeOther   SettingsType = 12
 )
 
+func (t SettingsType) String() string {
+	switch t {
+	case SettingTypeScalar:
+		return "scalar"
+	case SettingTypeVector2:
+		return "vector2"
+	case SettingTypeVector3:
+		return "vector3"
+	case SettingTypeVector4:
+		return "vector4"
+	case SettingTypeOther:
+		return "other"
+	}
+	return fmt.Sprintf("unknown(%v)", uint32(t))
+}
+
 type SettingDefinition struct {
 	Type   SettingsType
 	Count  uint32
@@ -46,6 +62,7 @@ type Material struct {
 	BaseMaterial stingray.Hash
 	Textures     map[stingray.ThinHash]stingray.Hash
 	Settings     map[stingray.ThinHash][]float32
+	SettingTypes map[stingray.ThinHash]SettingsType
 }
 
 type UnkArrayEntry struct {
@@ -184,6 +201,32 @@ type ShaderProgram struct {
 	PixelShader           *Shader
 }
 
+// StageShader is a shader of a program and the name of its stage.
+type StageShader struct {
+	Stage  string
+	Shader *Shader
+}
+
+// Stages returns the shaders of the program which have DXBC, in the
+// order of their fields.
+func (p *ShaderProgram) Stages() []StageShader {
+	var shaders []StageShader
+	for _, s := range []StageShader{
+		{"vertex", p.VertexShader},
+		{"unknown1", p.UnknownShader1},
+		{"instanced_vertex", p.InstancedVertexShader},
+		{"domain", p.DomainShader},
+		{"hull", p.HullShader},
+		{"unknown2", p.UnknownShader2},
+		{"pixel", p.PixelShader},
+	} {
+		if s.Shader != nil && s.Shader.DXBC != nil {
+			shaders = append(shaders, s)
+		}
+	}
+	return shaders
+}
+
 type ShaderProgramBlock struct {
 	Headers  []ShaderProgramHeader
 	Programs []ShaderProgram
@@ -264,6 +307,7 @@ func LoadMain(r io.ReadSeeker) (*Material, error) {
 		}
 	}
 	settingsMap := make(map[stingray.ThinHash][]float32)
+	settingTypes := make(map[stingray.ThinHash]SettingsType)
 	{
 		definitions := make([]SettingDefinition, hdr.NumSettings)
 		if err := binary.Read(r, binary.LittleEndian, &definitions); err != nil {
@@ -289,12 +333,14 @@ func LoadMain(r io.ReadSeeker) (*Material, error) {
 				data = []float32{}
 			}
 			settingsMap[definition.Usage] = data
+			settingTypes[definition.Usage] = definition.Type
 		}
 	}
 	return &Material{
 		BaseMaterial: hdr.BaseMaterial,
 		Textures:     textureMap,
 		Settings:     settingsMap,
+		SettingTypes: settingTypes,
 	}, nil
 }
 
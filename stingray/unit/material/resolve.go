@@ -0,0 +1,135 @@
+package material
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/xypwn/filediver/stingray"
+)
+
+// FileReader reads game file data. It is implemented by
+// *stingray.DataDir.
+type FileReader interface {
+	Read(id stingray.FileID, typ stingray.DataType) ([]byte, error)
+}
+
+// ReadFunc adapts a function to a FileReader.
+type ReadFunc func(id stingray.FileID, typ stingray.DataType) ([]byte, error)
+
+func (f ReadFunc) Read(id stingray.FileID, typ stingray.DataType) ([]byte, error) {
+	return f(id, typ)
+}
+
+// ResolvedTexture is a texture slot of a resolved material.
+type ResolvedTexture struct {
+	Texture stingray.Hash
+	// Index into ResolvedMaterial.Chain of the material which set the slot
+	Level int
+}
+
+// ResolvedSetting is a setting of a resolved material.
+type ResolvedSetting struct {
+	Value []float32
+	Type  SettingsType
+	// Index into ResolvedMaterial.Chain of the material which set the value
+	Level int
+}
+
+// ResolvedMaterial is a material with the textures and settings it
+// inherits from its base materials merged in.
+type ResolvedMaterial struct {
+	// Chain[0] is the resolved material and Chain[i+1] the base
+	// material of Chain[i].
+	Chain     []stingray.Hash
+	Materials []*Material
+	Textures  map[stingray.ThinHash]ResolvedTexture
+	Settings  map[stingray.ThinHash]ResolvedSetting
+	// Base material which couldn't be found, ending the chain early
+	Missing stingray.Hash
+}
+
+// Resolve walks the BaseMaterial chain of mat, which is named name,
+// through r. Values of a material override those of its base materials.
+func Resolve(r FileReader, name stingray.Hash, mat *Material) (*ResolvedMaterial, error) {
+	res := &ResolvedMaterial{
+		Chain:     []stingray.Hash{name},
+		Materials: []*Material{mat},
+		Textures:  make(map[stingray.ThinHash]ResolvedTexture),
+		Settings:  make(map[stingray.ThinHash]ResolvedSetting),
+	}
+	for base := mat.BaseMaterial; base.Value != 0; {
+		if slices.Contains(res.Chain, base) {
+			// Cyclic inheritance; the values are already complete
+			break
+		}
+		data, err := r.Read(stingray.NewFileID(base, stingray.Sum("material")), stingray.DataMain)
+		if errors.Is(err, stingray.ErrFileNotExist) || errors.Is(err, stingray.ErrFileDataTypeNotExist) {
+			res.Missing = base
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("base material %v: %w", base, err)
+		}
+		baseMat, err := LoadMain(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("base material %v: %w", base, err)
+		}
+		res.Chain = append(res.Chain, base)
+		res.Materials = append(res.Materials, baseMat)
+		base = baseMat.BaseMaterial
+	}
+	for level := len(res.Materials) - 1; level >= 0; level-- {
+		m := res.Materials[level]
+		for usage, texture := range m.Textures {
+			res.Textures[usage] = ResolvedTexture{Texture: texture, Level: level}
+		}
+		for usage, value := range m.Settings {
+			res.Settings[usage] = ResolvedSetting{Value: value, Type: m.SettingTypes[usage], Level: level}
+		}
+	}
+	return res, nil
+}
+
+// ResolveFile loads the material with the given name and resolves it.
+func ResolveFile(r FileReader, name stingray.Hash) (*ResolvedMaterial, error) {
+	data, err := r.Read(stingray.NewFileID(name, stingray.Sum("material")), stingray.DataMain)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := LoadMain(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return Resolve(r, name, mat)
+}
+
+// Effective returns the merged material. Its BaseMaterial is the
+// base material of the resolved material.
+func (r *ResolvedMaterial) Effective() *Material {
+	mat := &Material{
+		BaseMaterial: r.Materials[0].BaseMaterial,
+		Textures:     make(map[stingray.ThinHash]stingray.Hash, len(r.Textures)),
+		Settings:     make(map[stingray.ThinHash][]float32, len(r.Settings)),
+		SettingTypes: make(map[stingray.ThinHash]SettingsType, len(r.Settings)),
+	}
+	for usage, texture := range r.Textures {
+		mat.Textures[usage] = texture.Texture
+	}
+	for usage, setting := range r.Settings {
+		mat.Settings[usage] = slices.Clone(setting.Value)
+		mat.SettingTypes[usage] = setting.Type
+	}
+	return mat
+}
+
+// SortedTextures returns the texture slots ordered by hash.
+func (r *ResolvedMaterial) SortedTextures() []stingray.ThinHash {
+	return slices.SortedFunc(maps.Keys(r.Textures), stingray.ThinHash.Cmp)
+}
+
+// SortedSettings returns the settings ordered by hash.
+func (r *ResolvedMaterial) SortedSettings() []stingray.ThinHash {
+	return slices.SortedFunc(maps.Keys(r.Settings), stingray.ThinHash.Cmp)
+}
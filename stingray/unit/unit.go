@@ -796,19 +796,35 @@ func loadMesh(gpuR io.ReadSeeker, info MeshInfo, layout MeshLayout) (Mesh, error
 	return mesh, nil
 }
 
-func LoadTerrain(terrainInfo TerrainInfo) (Mesh, error) {
-	if uint32(math.Sqrt(float64(len(terrainInfo.HeightmapData)/2))) != terrainInfo.Textures[0].Resolution {
-		return Mesh{}, fmt.Errorf("loading terrain: heightmap resolution mismatch")
+// Returns the row-major heightmap values and the width/height of the
+// square heightmap.
+func (t *TerrainInfo) Heightmap() ([]uint16, uint32, error) {
+	if len(t.Textures) == 0 {
+		return nil, 0, fmt.Errorf("terrain has no textures")
+	}
+	if uint32(math.Sqrt(float64(len(t.HeightmapData)/2))) != t.Textures[0].Resolution {
+		return nil, 0, fmt.Errorf("heightmap resolution mismatch")
 	}
-	terrainValues := make([]uint16, len(terrainInfo.HeightmapData)/2)
-	if _, err := binary.Decode(terrainInfo.HeightmapData, binary.LittleEndian, terrainValues); err != nil {
-		return Mesh{}, fmt.Errorf("loading terrain: failed to decode heightmap value: %v", err)
+	values := make([]uint16, len(t.HeightmapData)/2)
+	if _, err := binary.Decode(t.HeightmapData, binary.LittleEndian, values); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode heightmap value: %v", err)
 	}
+	return values, t.Textures[0].Resolution, nil
+}
 
-	decompressHeight := func(value uint16, min, max float32) float32 {
-		percent := float32(value) / 65535.0
-		return (percent - 0.5) * (max - min)
+// Returns the height of a heightmap value, relative to the center
+// of the terrain's height range.
+func (t *TerrainInfo) DecompressHeight(value uint16) float32 {
+	percent := float32(value) / 65535.0
+	return (percent - 0.5) * (t.Max[2] - t.Min[2])
+}
+
+func LoadTerrain(terrainInfo TerrainInfo) (Mesh, error) {
+	terrainValues, _, err := terrainInfo.Heightmap()
+	if err != nil {
+		return Mesh{}, fmt.Errorf("loading terrain: %v", err)
 	}
+
 	vertices := make([][3]float32, 0)
 	indices := make([]uint32, 0)
 	uvs := make([][2]float32, 0)
@@ -818,7 +834,7 @@ func LoadTerrain(terrainInfo TerrainInfo) (Mesh, error) {
 	up := mgl32.Vec3{0, 1, 0}
 	for y := range terrainInfo.Textures[0].Resolution {
 		for x := range terrainInfo.Textures[0].Resolution {
-			center := decompressHeight(terrainValues[y*terrainInfo.Textures[0].Resolution+x], terrainInfo.Min[2], terrainInfo.Max[2])
+			center := terrainInfo.DecompressHeight(terrainValues[y*terrainInfo.Textures[0].Resolution+x])
 			vertices = append(vertices, [3]float32{
 				(terrainInfo.Max[0]-terrainInfo.Min[0])*(float32(x)/float32(terrainInfo.Textures[0].Resolution)) + terrainInfo.Min[0],
 				center,
@@ -831,16 +847,16 @@ func LoadTerrain(terrainInfo TerrainInfo) (Mesh, error) {
 			// Central differencing for normals
 			var left, right, top, bottom float32 = center, center, center, center
 			if x > 0 {
-				left = decompressHeight(terrainValues[y*terrainInfo.Textures[0].Resolution+(x-1)], terrainInfo.Min[2], terrainInfo.Max[2])
+				left = terrainInfo.DecompressHeight(terrainValues[y*terrainInfo.Textures[0].Resolution+(x-1)])
 			}
 			if x < terrainInfo.Textures[0].Resolution-1 {
-				right = decompressHeight(terrainValues[y*terrainInfo.Textures[0].Resolution+(x+1)], terrainInfo.Min[2], terrainInfo.Max[2])
+				right = terrainInfo.DecompressHeight(terrainValues[y*terrainInfo.Textures[0].Resolution+(x+1)])
 			}
 			if y > 0 {
-				top = decompressHeight(terrainValues[(y-1)*terrainInfo.Textures[0].Resolution+x], terrainInfo.Min[2], terrainInfo.Max[2])
+				top = terrainInfo.DecompressHeight(terrainValues[(y-1)*terrainInfo.Textures[0].Resolution+x])
 			}
 			if y < terrainInfo.Textures[0].Resolution-1 {
-				bottom = decompressHeight(terrainValues[(y+1)*terrainInfo.Textures[0].Resolution+x], terrainInfo.Min[2], terrainInfo.Max[2])
+				bottom = terrainInfo.DecompressHeight(terrainValues[(y+1)*terrainInfo.Textures[0].Resolution+x])
 			}
 			normal := mgl32.Vec3{-2 * (right - left), 4, -2 * (bottom - top)}.Normalize()
 			normals = append(normals, normal)
@@ -0,0 +1,224 @@
+// Implements a 16-bit PCM RIFF/WAVE writer. Multichannel
+// or non-default speaker layouts are written as WAVEFORMATEXTENSIBLE,
+// so players know which channel belongs to which speaker.
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const bitsPerSample = 16
+
+// KSDATAFORMAT_SUBTYPE_PCM
+var subFormatPCM = [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+// WAVEFORMATEXTENSIBLE speaker masks players assume for
+// plain WAVE_FORMAT_PCM files.
+const (
+	maskMono   = 0x4 // FC
+	maskStereo = 0x3 // FL | FR
+)
+
+// A cue point. Written to the "cue " chunk, with the
+// label in the associated data list ("LIST"/"adtl") chunk.
+type Cue struct {
+	ID       uint32
+	Position uint32 // in sample frames
+	Label    string
+}
+
+type Writer struct {
+	w          io.WriteSeeker
+	sampleRate int
+	channels   int
+	headerSize int64
+	dataSize   uint32
+	buf        []byte
+	closed     bool
+
+	hasLoop   bool
+	loopStart uint32
+	loopEnd   uint32
+	cues      []Cue
+}
+
+// Writes the WAV header. channelMask is a WAVEFORMATEXTENSIBLE
+// speaker mask with one bit set per channel, or 0 to use the default layout.
+// w must be seekable, since the chunk sizes are patched in on Close.
+func NewWriter(w io.WriteSeeker, sampleRate, channels int, channelMask uint32) (*Writer, error) {
+	if channels <= 0 {
+		return nil, errors.New("wav: expected at least one channel")
+	}
+	blockAlign := channels * bitsPerSample / 8
+
+	extensible := channels > 2 ||
+		(channels == 1 && channelMask != 0 && channelMask != maskMono) ||
+		(channels == 2 && channelMask != 0 && channelMask != maskStereo)
+
+	var fmtChunk []byte
+	if extensible {
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, 0xFFFE) // WAVE_FORMAT_EXTENSIBLE
+	} else {
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, 0x0001) // WAVE_FORMAT_PCM
+	}
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(channels))
+	fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, uint32(sampleRate))
+	fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, uint32(sampleRate*blockAlign))
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(blockAlign))
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, bitsPerSample)
+	if extensible {
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, 22)            // extra size
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, bitsPerSample) // valid bits per sample
+		fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, channelMask)
+		fmtChunk = append(fmtChunk, subFormatPCM[:]...)
+	}
+
+	var hdr []byte
+	hdr = append(hdr, "RIFF"...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, 0) // patched on Close
+	hdr = append(hdr, "WAVE"...)
+	hdr = append(hdr, "fmt "...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(len(fmtChunk)))
+	hdr = append(hdr, fmtChunk...)
+	hdr = append(hdr, "data"...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, 0) // patched on Close
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		w:          w,
+		sampleRate: sampleRate,
+		channels:   channels,
+		headerSize: int64(len(hdr)),
+	}, nil
+}
+
+// Writes interleaved samples. len(samples) must be
+// a multiple of the channel count.
+func (w *Writer) WriteSamples(samples []int16) error {
+	if w.closed {
+		return errors.New("wav: write to closed writer")
+	}
+	if len(samples)%w.channels != 0 {
+		return errors.New("wav: sample count must be a multiple of the channel count")
+	}
+	w.buf = w.buf[:0]
+	for _, smp := range samples {
+		w.buf = binary.LittleEndian.AppendUint16(w.buf, uint16(smp))
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+	w.dataSize += uint32(len(w.buf))
+	return nil
+}
+
+// Sets the loop region (in sample frames) to be written
+// to the "smpl" chunk on Close. end is exclusive.
+func (w *Writer) SetLoop(start, end uint32) {
+	w.hasLoop = true
+	w.loopStart = start
+	w.loopEnd = end
+}
+
+// Adds a cue point to be written on Close.
+func (w *Writer) AddCue(cue Cue) {
+	w.cues = append(w.cues, cue)
+}
+
+func appendChunk(b []byte, id string, data []byte) []byte {
+	b = append(b, id...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 != 0 {
+		b = append(b, 0) // pad byte
+	}
+	return b
+}
+
+// Builds the chunks following the data chunk.
+func (w *Writer) trailingChunks() []byte {
+	var b []byte
+	if w.hasLoop {
+		var smpl []byte
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0) // manufacturer
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0) // product
+		smpl = binary.LittleEndian.AppendUint32(smpl, uint32(1_000_000_000/w.sampleRate))
+		smpl = binary.LittleEndian.AppendUint32(smpl, 60) // MIDI unity note (middle C)
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)  // MIDI pitch fraction
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)  // SMPTE format
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)  // SMPTE offset
+		smpl = binary.LittleEndian.AppendUint32(smpl, 1)  // number of loops
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)  // sampler data size
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)  // cue point ID
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)  // type: forward
+		smpl = binary.LittleEndian.AppendUint32(smpl, w.loopStart)
+		smpl = binary.LittleEndian.AppendUint32(smpl, w.loopEnd-1) // inclusive
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)           // fraction
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)           // play count: infinite
+		b = appendChunk(b, "smpl", smpl)
+	}
+	if len(w.cues) > 0 {
+		var cue []byte
+		cue = binary.LittleEndian.AppendUint32(cue, uint32(len(w.cues)))
+		for _, c := range w.cues {
+			cue = binary.LittleEndian.AppendUint32(cue, c.ID)
+			cue = binary.LittleEndian.AppendUint32(cue, c.Position)
+			cue = append(cue, "data"...)
+			cue = binary.LittleEndian.AppendUint32(cue, 0) // chunk start
+			cue = binary.LittleEndian.AppendUint32(cue, 0) // block start
+			cue = binary.LittleEndian.AppendUint32(cue, c.Position)
+		}
+		b = appendChunk(b, "cue ", cue)
+
+		adtl := []byte("adtl")
+		for _, c := range w.cues {
+			if c.Label == "" {
+				continue
+			}
+			labl := binary.LittleEndian.AppendUint32(nil, c.ID)
+			labl = append(labl, c.Label...)
+			labl = append(labl, 0)
+			adtl = appendChunk(adtl, "labl", labl)
+		}
+		if len(adtl) > 4 {
+			b = appendChunk(b, "LIST", adtl)
+		}
+	}
+	return b
+}
+
+// Writes any loop and cue chunks and patches in the chunk
+// sizes. Does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	trailing := w.trailingChunks()
+	if _, err := w.w.Write(trailing); err != nil {
+		return err
+	}
+
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(w.headerSize-8)+w.dataSize+uint32(len(trailing)))
+	if _, err := w.w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(b[:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b[:], w.dataSize)
+	if _, err := w.w.Seek(w.headerSize-4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(b[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,159 @@
+package wav_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xypwn/filediver/wav"
+)
+
+func writeWAV(t *testing.T, channels int, channelMask uint32, samples []int16, setup func(w *wav.Writer)) []byte {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := wav.NewWriter(f, 48000, channels, channelMask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(w)
+	}
+	if err := w.WriteSamples(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type chunk struct {
+	id   string
+	data []byte
+}
+
+func parseChunks(t *testing.T, data []byte) []chunk {
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		t.Fatalf("expected RIFF/WAVE header, got %q", data[:12])
+	}
+	if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Errorf("expected RIFF size %v, got %v", len(data)-8, size)
+	}
+	var chunks []chunk
+	data = data[12:]
+	for len(data) > 0 {
+		size := binary.LittleEndian.Uint32(data[4:])
+		chunks = append(chunks, chunk{string(data[:4]), data[8 : 8+size]})
+		data = data[8+size+size%2:]
+	}
+	return chunks
+}
+
+func TestWriterPCM(t *testing.T) {
+	chunks := parseChunks(t, writeWAV(t, 2, 0x3, []int16{1, -2, 3, -4}, nil))
+	if len(chunks) != 2 || chunks[0].id != "fmt " || chunks[1].id != "data" {
+		t.Fatalf("expected fmt and data chunks, got %v", chunks)
+	}
+	var fmtChunk struct {
+		FormatTag      uint16
+		Channels       uint16
+		SampleRate     uint32
+		AvgBytesPerSec uint32
+		BlockAlign     uint16
+		BitsPerSample  uint16
+	}
+	if len(chunks[0].data) != 16 {
+		t.Fatalf("expected 16 byte fmt chunk, got %v", len(chunks[0].data))
+	}
+	binary.Read(bytes.NewReader(chunks[0].data), binary.LittleEndian, &fmtChunk)
+	if fmtChunk.FormatTag != 1 || fmtChunk.Channels != 2 || fmtChunk.SampleRate != 48000 ||
+		fmtChunk.AvgBytesPerSec != 48000*4 || fmtChunk.BlockAlign != 4 || fmtChunk.BitsPerSample != 16 {
+		t.Errorf("unexpected fmt chunk %+v", fmtChunk)
+	}
+	if want := []byte{1, 0, 0xfe, 0xff, 3, 0, 0xfc, 0xff}; !bytes.Equal(chunks[1].data, want) {
+		t.Errorf("expected data %v, got %v", want, chunks[1].data)
+	}
+}
+
+func TestWriterExtensible(t *testing.T) {
+	const mask = 0x3f // 5.1
+	chunks := parseChunks(t, writeWAV(t, 6, mask, make([]int16, 6), nil))
+	fmtChunk := chunks[0].data
+	if len(fmtChunk) != 40 {
+		t.Fatalf("expected 40 byte fmt chunk, got %v", len(fmtChunk))
+	}
+	if tag := binary.LittleEndian.Uint16(fmtChunk); tag != 0xfffe {
+		t.Errorf("expected WAVE_FORMAT_EXTENSIBLE, got 0x%x", tag)
+	}
+	if blockAlign := binary.LittleEndian.Uint16(fmtChunk[12:]); blockAlign != 12 {
+		t.Errorf("expected block align 12, got %v", blockAlign)
+	}
+	if extra := binary.LittleEndian.Uint16(fmtChunk[16:]); extra != 22 {
+		t.Errorf("expected 22 extra bytes, got %v", extra)
+	}
+	if m := binary.LittleEndian.Uint32(fmtChunk[20:]); m != mask {
+		t.Errorf("expected channel mask 0x%x, got 0x%x", mask, m)
+	}
+	// KSDATAFORMAT_SUBTYPE_PCM
+	if !bytes.Equal(fmtChunk[24:26], []byte{1, 0}) || !bytes.Equal(fmtChunk[26:], []byte{0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xaa, 0, 0x38, 0x9b, 0x71}) {
+		t.Errorf("unexpected sub format %x", fmtChunk[24:])
+	}
+
+	// A mono file with a non-center speaker also needs the mask
+	chunks = parseChunks(t, writeWAV(t, 1, 0x1, []int16{0}, nil))
+	if len(chunks[0].data) != 40 {
+		t.Errorf("expected extensible fmt chunk for a left-only mono file")
+	}
+}
+
+func TestWriterLoopAndCues(t *testing.T) {
+	chunks := parseChunks(t, writeWAV(t, 1, 0, make([]int16, 100), func(w *wav.Writer) {
+		w.SetLoop(10, 90)
+		w.AddCue(wav.Cue{ID: 1, Position: 10, Label: "start"})
+		w.AddCue(wav.Cue{ID: 2, Position: 50})
+	}))
+	var ids []string
+	for _, c := range chunks {
+		ids = append(ids, c.id)
+	}
+	if len(chunks) != 5 || chunks[1].id != "data" || chunks[2].id != "smpl" || chunks[3].id != "cue " || chunks[4].id != "LIST" {
+		t.Fatalf("unexpected chunks %q", ids)
+	}
+	if len(chunks[1].data) != 200 {
+		t.Errorf("expected 200 bytes of data, got %v", len(chunks[1].data))
+	}
+
+	smpl := chunks[2].data
+	if period := binary.LittleEndian.Uint32(smpl[8:]); period != 1_000_000_000/48000 {
+		t.Errorf("unexpected sample period %v", period)
+	}
+	if loops := binary.LittleEndian.Uint32(smpl[28:]); loops != 1 {
+		t.Errorf("expected one loop, got %v", loops)
+	}
+	if start, end := binary.LittleEndian.Uint32(smpl[44:]), binary.LittleEndian.Uint32(smpl[48:]); start != 10 || end != 89 {
+		t.Errorf("expected loop 10 to 89 inclusive, got %v to %v", start, end)
+	}
+
+	cue := chunks[3].data
+	if n := binary.LittleEndian.Uint32(cue); n != 2 || len(cue) != 4+2*24 {
+		t.Fatalf("expected 2 cue points, got %v (%v bytes)", n, len(cue))
+	}
+	if id, pos := binary.LittleEndian.Uint32(cue[28:]), binary.LittleEndian.Uint32(cue[32:]); id != 2 || pos != 50 || string(cue[36:40]) != "data" {
+		t.Errorf("unexpected second cue point %x", cue[28:52])
+	}
+
+	// Only the labeled cue point gets a label, padded to an even size
+	list := chunks[4].data
+	if want := []byte("adtllabl\x0a\x00\x00\x00\x01\x00\x00\x00start\x00"); !bytes.Equal(list, want) {
+		t.Errorf("expected adtl list %q, got %q", want, list)
+	}
+}
@@ -2,11 +2,12 @@
 package wwise
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 
 	"github.com/xypwn/filediver/util"
 )
@@ -36,13 +37,60 @@ type bnkIndex struct {
 type BnkHircObjectType uint8
 
 var (
-	BnkHircObjectSound       BnkHircObjectType = 0x02
-	BnkHircObjectAction      BnkHircObjectType = 0x03
-	BnkHircObjectEvent       BnkHircObjectType = 0x04
-	BnkHircObjectActorMixer  BnkHircObjectType = 0x07
-	BnkHircObjectAttenuation BnkHircObjectType = 0x0E
+	BnkHircObjectState               BnkHircObjectType = 0x01
+	BnkHircObjectSound               BnkHircObjectType = 0x02
+	BnkHircObjectAction              BnkHircObjectType = 0x03
+	BnkHircObjectEvent               BnkHircObjectType = 0x04
+	BnkHircObjectRandomSequence      BnkHircObjectType = 0x05
+	BnkHircObjectSwitch              BnkHircObjectType = 0x06
+	BnkHircObjectActorMixer          BnkHircObjectType = 0x07
+	BnkHircObjectBus                 BnkHircObjectType = 0x08
+	BnkHircObjectBlend               BnkHircObjectType = 0x09
+	BnkHircObjectMusicSegment        BnkHircObjectType = 0x0A
+	BnkHircObjectMusicTrack          BnkHircObjectType = 0x0B
+	BnkHircObjectMusicSwitch         BnkHircObjectType = 0x0C
+	BnkHircObjectMusicRandomSequence BnkHircObjectType = 0x0D
+	BnkHircObjectAttenuation         BnkHircObjectType = 0x0E
+	BnkHircObjectAuxBus              BnkHircObjectType = 0x12
 )
 
+func (t BnkHircObjectType) String() string {
+	switch t {
+	case BnkHircObjectState:
+		return "state"
+	case BnkHircObjectSound:
+		return "sound"
+	case BnkHircObjectAction:
+		return "action"
+	case BnkHircObjectEvent:
+		return "event"
+	case BnkHircObjectRandomSequence:
+		return "random_sequence_container"
+	case BnkHircObjectSwitch:
+		return "switch_container"
+	case BnkHircObjectActorMixer:
+		return "actor_mixer"
+	case BnkHircObjectBus:
+		return "bus"
+	case BnkHircObjectBlend:
+		return "blend_container"
+	case BnkHircObjectMusicSegment:
+		return "music_segment"
+	case BnkHircObjectMusicTrack:
+		return "music_track"
+	case BnkHircObjectMusicSwitch:
+		return "music_switch_container"
+	case BnkHircObjectMusicRandomSequence:
+		return "music_playlist_container"
+	case BnkHircObjectAttenuation:
+		return "attenuation"
+	case BnkHircObjectAuxBus:
+		return "aux_bus"
+	default:
+		return fmt.Sprintf("BnkHircObjectType(0x%02x)", uint8(t))
+	}
+}
+
 type BnkHircSoundPluginID uint32
 
 var (
@@ -65,26 +113,53 @@ var (
 	BnkHircSoundStreamSourceBitHasSource          = BnkHircSoundStreamSourceBits(1 << 7)
 )
 
+type BnkHircSourceData struct {
+	PluginID          BnkHircSoundPluginID
+	StreamType        BnkHircSoundStreamType
+	SourceID          uint32
+	CacheID           uint32 // thanks to @dekr0 for pointing out this field
+	InMemoryMediaSize uint32
+	SourceBits        BnkHircSoundStreamSourceBits
+}
+
 type BnkHircObject struct {
 	Header struct {
 		Type     BnkHircObjectType
 		Size     uint32
 		ObjectID uint32
 	}
-	Sound struct {
-		PluginID          BnkHircSoundPluginID
-		StreamType        BnkHircSoundStreamType
-		SourceID          uint32
-		CacheID           uint32 // thanks to @dekr0 for pointing out this field
-		InMemoryMediaSize uint32
-		SourceBits        BnkHircSoundStreamSourceBits
+	// Set if the object body couldn't be fully parsed. Any
+	// fields parsed before the error are still filled in.
+	ParseErr error
+	Sound    BnkHircSourceData
+	// Common parameters of sounds, containers, actor mixers,
+	// music objects and buses.
+	Node struct {
+		OverrideBusID uint32
+		// Parent in the actor-mixer/music/bus hierarchy
+		ParentID uint32
 	}
+	// Child node IDs of containers, actor mixers and
+	// music objects.
+	Children            []uint32
+	Event               BnkHircEvent
+	Action              BnkHircAction
+	RandomSequence      BnkHircRandomSequence
+	Switch              BnkHircSwitch
+	State               BnkHircState
+	Blend               BnkHircBlend
+	MusicSegment        BnkHircMusicSegment
+	MusicTrack          BnkHircMusicTrack
+	MusicSwitch         BnkHircMusicSwitch
+	MusicRandomSequence BnkHircMusicRandomSequence
 }
 
 type Bnk struct {
 	r           io.ReadSeeker
 	sections    bnkSections
 	files       []bnkIndex
+	Version     uint32
+	ID          uint32
 	HircObjects []BnkHircObject
 }
 
@@ -188,7 +263,7 @@ func openBnk(r io.ReadSeeker, bkhdKey *BkhdXorKey) (*Bnk, error) {
 		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
 			return nil, err
 		}
-		var buf bytes.Buffer
+		var buf []byte
 		hircObjects = make([]BnkHircObject, count)
 		for i := range hircObjects {
 			obj := &hircObjects[i]
@@ -199,38 +274,11 @@ func openBnk(r io.ReadSeeker, bkhdKey *BkhdXorKey) (*Bnk, error) {
 				return nil, fmt.Errorf("expected HIRC object size to be >= 4 (got size %v)", obj.Header.Size)
 			}
 			objSize := obj.Header.Size - 0x04
-			switch obj.Header.Type {
-			case BnkHircObjectSound:
-				if _, err := io.CopyN(&buf, r, int64(objSize)); err != nil {
-					return nil, err
-				}
-				if hdr.Version <= 150 {
-					// wwise version <= 150; pre HD2 patch 1.003.200
-					var sound struct {
-						PluginID          BnkHircSoundPluginID
-						StreamType        BnkHircSoundStreamType
-						SourceID          uint32
-						InMemoryMediaSize uint32
-						SourceBits        BnkHircSoundStreamSourceBits
-					}
-					if err := binary.Read(&buf, binary.LittleEndian, &sound); err != nil {
-						return nil, err
-					}
-					obj.Sound.PluginID = sound.PluginID
-					obj.Sound.StreamType = sound.StreamType
-					obj.Sound.SourceID = sound.SourceID
-					obj.Sound.CacheID = 0
-					obj.Sound.InMemoryMediaSize = sound.InMemoryMediaSize
-					obj.Sound.SourceBits = sound.SourceBits
-				} else {
-					if err := binary.Read(&buf, binary.LittleEndian, &obj.Sound); err != nil {
-						return nil, err
-					}
-				}
-				buf.Reset()
-			default:
-				r.Seek(int64(objSize), io.SeekCurrent)
+			buf = slices.Grow(buf[:0], int(objSize))[:objSize]
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, err
 			}
+			parseHircObject(obj, buf, hdr.Version)
 		}
 	}
 
@@ -238,6 +286,8 @@ func openBnk(r io.ReadSeeker, bkhdKey *BkhdXorKey) (*Bnk, error) {
 		r:           r,
 		sections:    sections,
 		files:       files,
+		Version:     hdr.Version,
+		ID:          hdr.ID,
 		HircObjects: hircObjects,
 	}, nil
 }
@@ -277,3 +327,14 @@ func (b *Bnk) OpenFile(idx int) (io.ReadSeeker, error) {
 	}
 	return r, nil
 }
+
+// Returns the Wwise short ID of a name, which is
+// the 32-bit FNV-1 hash of the lowercase name.
+func HashName(name string) uint32 {
+	h := uint32(2166136261)
+	for _, c := range []byte(strings.ToLower(name)) {
+		h *= 16777619
+		h ^= uint32(c)
+	}
+	return h
+}
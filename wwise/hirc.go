@@ -0,0 +1,727 @@
+// HIRC object layouts are based on the Wwise SDK bank reading code and wwiser (https://github.com/bnnm/wwiser)
+package wwise
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+type BnkHircActionType uint16
+
+// The high byte of the action type specifies what the action does,
+// the low byte specifies the scope (e.g. game object or global).
+func (t BnkHircActionType) Kind() BnkHircActionKind {
+	return BnkHircActionKind(t >> 8)
+}
+
+type BnkHircActionKind uint8
+
+var (
+	BnkHircActionStop               BnkHircActionKind = 0x01
+	BnkHircActionPause              BnkHircActionKind = 0x02
+	BnkHircActionResume             BnkHircActionKind = 0x03
+	BnkHircActionPlay               BnkHircActionKind = 0x04
+	BnkHircActionPlayAndContinue    BnkHircActionKind = 0x05
+	BnkHircActionMute               BnkHircActionKind = 0x06
+	BnkHircActionUnmute             BnkHircActionKind = 0x07
+	BnkHircActionSetState           BnkHircActionKind = 0x12
+	BnkHircActionSetGameParameter   BnkHircActionKind = 0x13
+	BnkHircActionResetGameParameter BnkHircActionKind = 0x14
+	BnkHircActionSetSwitch          BnkHircActionKind = 0x19
+	BnkHircActionBreak              BnkHircActionKind = 0x1C
+	BnkHircActionTrigger            BnkHircActionKind = 0x1D
+	BnkHircActionSeek               BnkHircActionKind = 0x1E
+)
+
+func (k BnkHircActionKind) String() string {
+	switch k {
+	case BnkHircActionStop:
+		return "stop"
+	case BnkHircActionPause:
+		return "pause"
+	case BnkHircActionResume:
+		return "resume"
+	case BnkHircActionPlay:
+		return "play"
+	case BnkHircActionPlayAndContinue:
+		return "play_and_continue"
+	case BnkHircActionMute:
+		return "mute"
+	case BnkHircActionUnmute:
+		return "unmute"
+	case BnkHircActionSetState:
+		return "set_state"
+	case BnkHircActionSetGameParameter:
+		return "set_game_parameter"
+	case BnkHircActionResetGameParameter:
+		return "reset_game_parameter"
+	case BnkHircActionSetSwitch:
+		return "set_switch"
+	case BnkHircActionBreak:
+		return "break"
+	case BnkHircActionTrigger:
+		return "trigger"
+	case BnkHircActionSeek:
+		return "seek"
+	default:
+		return fmt.Sprintf("BnkHircActionKind(0x%02x)", uint8(k))
+	}
+}
+
+type BnkHircEvent struct {
+	ActionIDs []uint32
+}
+
+type BnkHircAction struct {
+	Type BnkHircActionType
+	// Object the action applies to (e.g. the node to play)
+	TargetID    uint32
+	TargetIsBus bool
+	// State/switch group and value for SetState/SetSwitch
+	GroupID uint32
+	ValueID uint32
+}
+
+type BnkHircRandomSequenceMode uint8
+
+var (
+	BnkHircRandomSequenceModeSequence BnkHircRandomSequenceMode = 0
+	BnkHircRandomSequenceModeRandom   BnkHircRandomSequenceMode = 1
+)
+
+type BnkHircPlaylistItem struct {
+	ID     uint32
+	Weight int32 // random weight * 1000
+}
+
+type BnkHircRandomSequence struct {
+	LoopCount        uint16 // 0 means infinite
+	AvoidRepeatCount uint16
+	TransitionMode   uint8
+	RandomMode       uint8 // 0: normal, 1: shuffle
+	Mode             BnkHircRandomSequenceMode
+	Playlist         []BnkHircPlaylistItem
+}
+
+type BnkHircSwitchPackage struct {
+	SwitchID uint32
+	NodeIDs  []uint32
+}
+
+type BnkHircSwitch struct {
+	GroupType     uint8 // 0: switch, 1: state
+	GroupID       uint32
+	DefaultSwitch uint32
+	Packages      []BnkHircSwitchPackage
+}
+
+type BnkHircBlendLayer struct {
+	LayerID  uint32
+	RTPCID   uint32
+	ChildIDs []uint32
+}
+
+type BnkHircBlend struct {
+	Layers []BnkHircBlendLayer
+}
+
+type BnkHircMusicSegment struct {
+	Duration float64 // in ms
+}
+
+type BnkHircMusicTrackClip struct {
+	TrackID         uint32
+	SourceID        uint32
+	EventID         uint32
+	PlayAt          float64 // in ms
+	BeginTrimOffset float64 // in ms
+	EndTrimOffset   float64 // in ms
+	SourceDuration  float64 // in ms
+}
+
+type BnkHircMusicTrack struct {
+	Sources  []BnkHircSourceData
+	Playlist []BnkHircMusicTrackClip
+}
+
+type BnkHircStateProp struct {
+	ID    uint16 // AkPropID, e.g. 0 for volume
+	Value float32
+}
+
+// Property changes applied while a state is active.
+type BnkHircState struct {
+	Props []BnkHircStateProp
+}
+
+type BnkHircMusicSwitchArgument struct {
+	GroupID   uint32
+	GroupType uint8 // 0: switch, 1: state
+}
+
+// Node of a music switch's decision tree. Each level of the tree
+// matches the value of one argument, so the path from the root to
+// a leaf is the combination of values which plays the leaf's node.
+type BnkHircDecisionTreeNode struct {
+	Key         uint32 // switch/state value ID, 0 matches any value
+	NodeID      uint32 // only set on leaves
+	Weight      uint16
+	Probability uint16
+	Children    []BnkHircDecisionTreeNode
+}
+
+type BnkHircMusicSwitch struct {
+	ContinuePlayback bool
+	Arguments        []BnkHircMusicSwitchArgument
+	Mode             uint8 // 0: best match, 1: weighted
+	// Root of the decision tree. Its key doesn't match any argument.
+	Tree BnkHircDecisionTreeNode
+}
+
+// Item of a music playlist. Items without a segment are groups
+// playing their children.
+type BnkHircMusicPlaylistItem struct {
+	SegmentID        uint32
+	PlaylistItemID   uint32
+	Type             uint32 // 0: sequence continuous, 1: sequence step, 2: random continuous, 3: random step
+	LoopCount        int16  // 0 means infinite
+	Weight           uint32 // random weight * 1000
+	AvoidRepeatCount uint16
+	UseWeight        bool
+	Shuffle          bool
+	Children         []BnkHircMusicPlaylistItem
+}
+
+type BnkHircMusicRandomSequence struct {
+	// Root item of the playlist
+	Playlist BnkHircMusicPlaylistItem
+}
+
+// Little-endian reader for HIRC object bodies. Errors are
+// sticky, so the result only needs to be checked at the end.
+type hircReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *hircReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b)-r.pos {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	res := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return res
+}
+
+func (r *hircReader) skip(n int) {
+	r.read(n)
+}
+
+func (r *hircReader) u8() uint8 {
+	if b := r.read(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *hircReader) u16() uint16 {
+	if b := r.read(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *hircReader) u32() uint32 {
+	if b := r.read(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *hircReader) f64() float64 {
+	if b := r.read(8); b != nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// Variable-length integer (7 bits per byte, MSB first).
+func (r *hircReader) varUint() uint32 {
+	var v uint32
+	for range 5 {
+		b := r.u8()
+		v = (v << 7) | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	if r.err == nil {
+		r.err = errors.New("variable-length integer too long")
+	}
+	return 0
+}
+
+// Reads a u32 count followed by that many u32 IDs.
+func (r *hircReader) ids(count uint32) []uint32 {
+	b := r.read(4 * int(count))
+	if b == nil {
+		return nil
+	}
+	res := make([]uint32, count)
+	for i := range res {
+		res[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return res
+}
+
+// Returns an error if not all bytes were consumed.
+func (r *hircReader) expectEnd() {
+	if r.err == nil && r.pos != len(r.b) {
+		r.err = fmt.Errorf("%v unexpected trailing bytes", len(r.b)-r.pos)
+	}
+}
+
+func (r *hircReader) sourceData(version uint32) BnkHircSourceData {
+	var src BnkHircSourceData
+	src.PluginID = BnkHircSoundPluginID(r.u32())
+	src.StreamType = BnkHircSoundStreamType(r.u8())
+	src.SourceID = r.u32()
+	if version > 150 {
+		// wwise version > 150; HD2 patch 1.003.200 and later
+		src.CacheID = r.u32()
+	}
+	src.InMemoryMediaSize = r.u32()
+	src.SourceBits = BnkHircSoundStreamSourceBits(r.u8())
+	if src.PluginID&0x0F == 0x02 {
+		// Source plugins (e.g. tone generator) have parameters
+		size := r.u32()
+		r.skip(int(size))
+	}
+	return src
+}
+
+// AkPropBundle and AkPropBundle<RANGED_MODIFIERS>
+func (r *hircReader) propBundles() {
+	n := int(r.u8())
+	r.skip(n + 4*n) // IDs, values
+	n = int(r.u8())
+	r.skip(n + 8*n) // IDs, min/max values
+}
+
+// InitialRTPC
+func (r *hircReader) rtpcs() {
+	numCurves := r.u16()
+	for range numCurves {
+		r.skip(4) // RTPC ID
+		r.skip(1) // RTPC type
+		r.skip(1) // RTPC accumulation
+		r.varUint()
+		r.skip(4) // curve ID
+		r.skip(1) // scaling
+		numPoints := r.u16()
+		r.skip(12 * int(numPoints))
+		if r.err != nil {
+			return
+		}
+	}
+}
+
+// Reads NodeBaseParams, which is shared between all objects
+// in the actor-mixer and interactive music hierarchies.
+func (r *hircReader) nodeBaseParams(obj *BnkHircObject, version uint32) {
+	// NodeInitialFxParams
+	r.skip(1) // override parent FX
+	numFx := int(r.u8())
+	if numFx > 0 {
+		r.skip(1) // FX bypass bits
+	}
+	if version <= 145 {
+		r.skip(numFx * 7)
+	} else {
+		r.skip(numFx * 6)
+	}
+
+	// NodeInitialMetadataParams
+	if version > 136 {
+		r.skip(1) // override parent metadata
+		numMetadata := int(r.u8())
+		r.skip(numMetadata * 6)
+	}
+
+	if version <= 145 {
+		r.skip(1) // override attachment params
+	}
+	obj.Node.OverrideBusID = r.u32()
+	obj.Node.ParentID = r.u32()
+	r.skip(1) // priority and misc. bits
+
+	// NodeInitialParams
+	r.propBundles()
+
+	// PositioningParams
+	posBits := r.u8()
+	if posBits&(1<<0) != 0 && posBits&(1<<1) != 0 {
+		// Overrides parent and has listener relative routing
+		r.skip(1) // 3D bits
+		positionType := (posBits >> 5) & 0x03
+		if positionType != 0 {
+			// Emitter with automation or listener with automation
+			r.skip(1) // path mode
+			r.skip(4) // transition time
+			numVertices := r.u32()
+			r.skip(16 * int(numVertices))
+			numPlaylistItems := r.u32()
+			r.skip(8 * int(numPlaylistItems))
+			r.skip(12 * int(numPlaylistItems)) // automation ranges
+		}
+	}
+
+	// AuxParams
+	auxBits := r.u8()
+	if auxBits&(1<<3) != 0 {
+		r.skip(4 * 4) // aux bus IDs
+	}
+	if version > 134 {
+		r.skip(4) // reflections aux bus
+	}
+
+	// AdvSettingsParams
+	r.skip(1 + 1 + 2 + 1 + 1)
+
+	// StateParameters
+	numStateProps := r.varUint()
+	for range numStateProps {
+		r.varUint() // property ID
+		r.skip(1)   // accumulation type
+		if version > 126 {
+			r.skip(1) // in dB
+		}
+		if r.err != nil {
+			return
+		}
+	}
+	numStateGroups := r.varUint()
+	for range numStateGroups {
+		r.skip(4) // state group ID
+		r.skip(1) // sync type
+		numStates := r.varUint()
+		r.skip(8 * int(numStates))
+		if r.err != nil {
+			return
+		}
+	}
+
+	r.rtpcs()
+}
+
+// MusicNodeParams
+func (r *hircReader) musicNodeParams(obj *BnkHircObject, version uint32) {
+	r.skip(1) // flags
+	r.nodeBaseParams(obj, version)
+	obj.Children = r.ids(r.u32())
+	r.skip(8 + 8 + 4 + 1 + 1) // AkMeterInfo
+	r.skip(1)                 // meter info flag
+	numStingers := r.u32()
+	r.skip(24 * int(numStingers))
+}
+
+// MusicTransNodeParams. The transition rules are skipped.
+func (r *hircReader) musicTransNodeParams(obj *BnkHircObject, version uint32) {
+	r.musicNodeParams(obj, version)
+	numRules := r.u32()
+	for range numRules {
+		r.ids(r.u32()) // source IDs
+		r.ids(r.u32()) // destination IDs
+		// AkMusicTransSrcRule
+		r.skip(4 + 4 + 4 + 4 + 4 + 1)
+		// AkMusicTransDstRule
+		r.skip(4 + 4 + 4 + 4 + 4)
+		if version > 132 {
+			r.skip(2) // jump to type
+		}
+		r.skip(2 + 1 + 1)
+		if r.u8() != 0 {
+			// AkMusicTransitionObject
+			r.skip(4 + 12 + 12 + 1 + 1)
+		}
+		if r.err != nil {
+			return
+		}
+	}
+}
+
+// Reads the decision tree node at idx of the nodes array, whose
+// nodes are stored breadth-first and are 12 bytes each.
+func (r *hircReader) decisionTreeNode(nodes []byte, idx int, depth, maxDepth uint32, visited *int) BnkHircDecisionTreeNode {
+	if r.err != nil {
+		return BnkHircDecisionTreeNode{}
+	}
+	*visited++
+	if *visited > len(nodes)/12 {
+		r.err = errors.New("decision tree nodes are referenced more than once")
+		return BnkHircDecisionTreeNode{}
+	}
+	if idx >= len(nodes)/12 {
+		r.err = fmt.Errorf("decision tree node %v out of range", idx)
+		return BnkHircDecisionTreeNode{}
+	}
+	b := nodes[12*idx:]
+	node := BnkHircDecisionTreeNode{
+		Key:         binary.LittleEndian.Uint32(b[0:]),
+		Weight:      binary.LittleEndian.Uint16(b[8:]),
+		Probability: binary.LittleEndian.Uint16(b[10:]),
+	}
+	if depth == maxDepth {
+		node.NodeID = binary.LittleEndian.Uint32(b[4:])
+		return node
+	}
+	childIdx := int(binary.LittleEndian.Uint16(b[4:]))
+	numChildren := int(binary.LittleEndian.Uint16(b[6:]))
+	if childIdx <= idx && numChildren > 0 {
+		// Children always come after their parent
+		r.err = fmt.Errorf("decision tree node %v has invalid child index %v", idx, childIdx)
+		return node
+	}
+	for i := range numChildren {
+		node.Children = append(node.Children, r.decisionTreeNode(nodes, childIdx+i, depth+1, maxDepth, visited))
+	}
+	return node
+}
+
+// Reads a music playlist item and its children, which are
+// stored depth-first. remaining is the number of items left.
+func (r *hircReader) musicPlaylistItem(remaining *uint32) BnkHircMusicPlaylistItem {
+	var item BnkHircMusicPlaylistItem
+	if *remaining == 0 {
+		if r.err == nil {
+			r.err = errors.New("music playlist has fewer items than referenced")
+		}
+		return item
+	}
+	*remaining--
+	item.SegmentID = r.u32()
+	item.PlaylistItemID = r.u32()
+	numChildren := r.u32()
+	item.Type = r.u32()
+	item.LoopCount = int16(r.u16())
+	r.skip(2 + 2) // loop count modifier min/max
+	item.Weight = r.u32()
+	item.AvoidRepeatCount = r.u16()
+	item.UseWeight = r.u8() != 0
+	item.Shuffle = r.u8() != 0
+	for range numChildren {
+		if r.err != nil {
+			break
+		}
+		item.Children = append(item.Children, r.musicPlaylistItem(remaining))
+	}
+	return item
+}
+
+// Parses the body of a HIRC object (after the object ID).
+// Parsing errors are stored in obj.ParseErr, along with any
+// fields parsed before the error.
+func parseHircObject(obj *BnkHircObject, b []byte, version uint32) {
+	r := &hircReader{b: b}
+	switch obj.Header.Type {
+	case BnkHircObjectState:
+		st := &obj.State
+		numProps := r.u16()
+		propIDs := r.read(2 * int(numProps))
+		for i := range int(numProps) {
+			if r.err != nil {
+				break
+			}
+			st.Props = append(st.Props, BnkHircStateProp{
+				ID:    binary.LittleEndian.Uint16(propIDs[2*i:]),
+				Value: math.Float32frombits(r.u32()),
+			})
+		}
+		r.expectEnd()
+	case BnkHircObjectSound:
+		obj.Sound = r.sourceData(version)
+		r.nodeBaseParams(obj, version)
+		r.expectEnd()
+	case BnkHircObjectEvent:
+		numActions := r.varUint()
+		obj.Event.ActionIDs = r.ids(numActions)
+		r.expectEnd()
+	case BnkHircObjectAction:
+		act := &obj.Action
+		act.Type = BnkHircActionType(r.u16())
+		act.TargetID = r.u32()
+		act.TargetIsBus = r.u8() != 0
+		r.propBundles()
+		switch act.Type.Kind() {
+		case BnkHircActionSetState, BnkHircActionSetSwitch:
+			act.GroupID = r.u32()
+			act.ValueID = r.u32()
+		}
+	case BnkHircObjectActorMixer:
+		r.nodeBaseParams(obj, version)
+		obj.Children = r.ids(r.u32())
+		r.expectEnd()
+	case BnkHircObjectRandomSequence:
+		rs := &obj.RandomSequence
+		r.nodeBaseParams(obj, version)
+		rs.LoopCount = r.u16()
+		r.skip(2 + 2)     // loop count modifier min/max
+		r.skip(4 + 4 + 4) // transition time, modifier min/max
+		rs.AvoidRepeatCount = r.u16()
+		rs.TransitionMode = r.u8()
+		rs.RandomMode = r.u8()
+		rs.Mode = BnkHircRandomSequenceMode(r.u8())
+		r.skip(1) // misc. bits
+		obj.Children = r.ids(r.u32())
+		numItems := r.u16()
+		for range numItems {
+			rs.Playlist = append(rs.Playlist, BnkHircPlaylistItem{
+				ID:     r.u32(),
+				Weight: int32(r.u32()),
+			})
+		}
+		r.expectEnd()
+	case BnkHircObjectSwitch:
+		sw := &obj.Switch
+		r.nodeBaseParams(obj, version)
+		sw.GroupType = r.u8()
+		sw.GroupID = r.u32()
+		sw.DefaultSwitch = r.u32()
+		r.skip(1) // continuous validation
+		obj.Children = r.ids(r.u32())
+		numPackages := r.u32()
+		for range numPackages {
+			switchID := r.u32()
+			nodeIDs := r.ids(r.u32())
+			if r.err != nil {
+				break
+			}
+			sw.Packages = append(sw.Packages, BnkHircSwitchPackage{
+				SwitchID: switchID,
+				NodeIDs:  nodeIDs,
+			})
+		}
+		numParams := r.u32()
+		r.skip(14 * int(numParams)) // per-node play/fade settings
+		r.expectEnd()
+	case BnkHircObjectBlend:
+		bl := &obj.Blend
+		r.nodeBaseParams(obj, version)
+		obj.Children = r.ids(r.u32())
+		numLayers := r.u32()
+		for range numLayers {
+			var layer BnkHircBlendLayer
+			layer.LayerID = r.u32()
+			r.rtpcs()
+			layer.RTPCID = r.u32()
+			r.skip(1) // RTPC type
+			numAssoc := r.u32()
+			for range numAssoc {
+				layer.ChildIDs = append(layer.ChildIDs, r.u32())
+				numPoints := r.u32()
+				r.skip(12 * int(numPoints))
+				if r.err != nil {
+					break
+				}
+			}
+			if r.err != nil {
+				break
+			}
+			bl.Layers = append(bl.Layers, layer)
+		}
+		r.skip(1) // continuous validation
+		r.expectEnd()
+	case BnkHircObjectMusicSegment:
+		r.musicNodeParams(obj, version)
+		obj.MusicSegment.Duration = r.f64()
+		// Markers follow
+	case BnkHircObjectMusicTrack:
+		mt := &obj.MusicTrack
+		r.skip(1) // flags
+		numSources := r.u32()
+		for range numSources {
+			src := r.sourceData(version)
+			if r.err != nil {
+				break
+			}
+			mt.Sources = append(mt.Sources, src)
+		}
+		numClips := r.u32()
+		for range numClips {
+			var clip BnkHircMusicTrackClip
+			clip.TrackID = r.u32()
+			clip.SourceID = r.u32()
+			if version > 150 {
+				r.skip(4) // cache ID
+			}
+			clip.EventID = r.u32()
+			clip.PlayAt = r.f64()
+			clip.BeginTrimOffset = r.f64()
+			clip.EndTrimOffset = r.f64()
+			clip.SourceDuration = r.f64()
+			if r.err != nil {
+				break
+			}
+			mt.Playlist = append(mt.Playlist, clip)
+		}
+		// Clip automation and NodeBaseParams follow, which we
+		// don't need. Sanity check the clips instead.
+		for _, clip := range mt.Playlist {
+			found := false
+			for _, src := range mt.Sources {
+				if src.SourceID == clip.SourceID {
+					found = true
+					break
+				}
+			}
+			if !found && r.err == nil {
+				r.err = fmt.Errorf("music track clip references unknown source %v", clip.SourceID)
+				mt.Playlist = nil
+			}
+		}
+	case BnkHircObjectMusicSwitch:
+		ms := &obj.MusicSwitch
+		r.musicTransNodeParams(obj, version)
+		ms.ContinuePlayback = r.u8() != 0
+		treeDepth := r.u32()
+		groupIDs := r.ids(treeDepth)
+		groupTypes := r.read(int(treeDepth))
+		for i := range groupTypes {
+			ms.Arguments = append(ms.Arguments, BnkHircMusicSwitchArgument{
+				GroupID:   groupIDs[i],
+				GroupType: groupTypes[i],
+			})
+		}
+		treeSize := r.u32()
+		ms.Mode = r.u8()
+		nodes := r.read(int(treeSize))
+		if r.err == nil && len(nodes) > 0 {
+			var visited int
+			ms.Tree = r.decisionTreeNode(nodes, 0, 0, treeDepth, &visited)
+		}
+		r.expectEnd()
+	case BnkHircObjectMusicRandomSequence:
+		r.musicTransNodeParams(obj, version)
+		numItems := r.u32()
+		if numItems > 0 {
+			obj.MusicRandomSequence.Playlist = r.musicPlaylistItem(&numItems)
+		}
+		if r.err == nil && numItems != 0 {
+			r.err = fmt.Errorf("%v music playlist items aren't part of the playlist", numItems)
+		}
+		r.expectEnd()
+	case BnkHircObjectBus, BnkHircObjectAuxBus:
+		obj.Node.ParentID = r.u32()
+	}
+	if r.err != nil {
+		obj.ParseErr = r.err
+	}
+}
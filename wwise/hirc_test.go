@@ -0,0 +1,211 @@
+package wwise_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/xypwn/filediver/wwise"
+)
+
+const testBnkVersion = 154
+
+// Concatenates the little-endian encodings of the values.
+func le(values ...any) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		if err := binary.Write(&b, binary.LittleEndian, v); err != nil {
+			panic(err)
+		}
+	}
+	return b.Bytes()
+}
+
+func makeHircObject(typ wwise.BnkHircObjectType, id uint32, body []byte) []byte {
+	return slices.Concat(le(uint8(typ), uint32(4+len(body)), id), body)
+}
+
+func makeBnk(objects ...[]byte) []byte {
+	hirc := slices.Concat(append([][]byte{le(uint32(len(objects)))}, objects...)...)
+	return slices.Concat(
+		makeChunk("BKHD", le(uint32(testBnkVersion), uint32(1234))),
+		makeChunk("HIRC", hirc),
+	)
+}
+
+// NodeBaseParams without any effects, properties or positioning.
+func nodeBaseParams(parentID uint32) []byte {
+	return slices.Concat(
+		le(uint8(0), uint8(0)),  // FX
+		le(uint8(0), uint8(0)),  // metadata
+		le(uint32(0), parentID), // override bus, parent
+		le(uint8(0)),            // priority
+		le(uint8(0), uint8(0)),  // property bundles
+		le(uint8(0)),            // positioning
+		le(uint8(0), uint32(0)), // aux
+		make([]byte, 6),         // advanced settings
+		le(uint8(0), uint8(0)),  // state properties and groups
+		le(uint16(0)),           // RTPCs
+	)
+}
+
+func musicNodeParams(parentID uint32, children ...uint32) []byte {
+	return slices.Concat(
+		le(uint8(0)),
+		nodeBaseParams(parentID),
+		le(uint32(len(children)), children),
+		make([]byte, 8+8+4+1+1), // meter info
+		le(uint8(0), uint32(0)), // meter info flag, stingers
+	)
+}
+
+// A single transition rule with a transition segment.
+func musicTransitionRules() []byte {
+	return slices.Concat(
+		le(uint32(1)),
+		le(uint32(1), uint32(0xffffffff), uint32(1), uint32(0xffffffff)),
+		make([]byte, 21), // source rule
+		make([]byte, 26), // destination rule
+		le(uint8(1)),
+		make([]byte, 30), // transition object
+	)
+}
+
+func decisionTreeNode(key uint32, idxOrNodeID uint32, count uint16) []byte {
+	if count > 0 {
+		return le(key, uint16(idxOrNodeID), count, uint16(50), uint16(100))
+	}
+	return le(key, idxOrNodeID, uint16(50), uint16(100))
+}
+
+func musicPlaylistItem(segmentID, itemID, numChildren, typ uint32, weight uint32) []byte {
+	return slices.Concat(
+		le(segmentID, itemID, numChildren, typ),
+		le(int16(0), int16(0), int16(0)), // loop count and modifiers
+		le(weight, uint16(1), uint8(1), uint8(0)),
+	)
+}
+
+func sourceData(sourceID uint32) []byte {
+	// Vorbis, streamed
+	return le(uint32(0x00040001), uint8(2), sourceID, uint32(0), uint32(0), uint8(0))
+}
+
+func TestParseHircObjects(t *testing.T) {
+	musicSwitch := slices.Concat(
+		musicNodeParams(0, 20, 21),
+		musicTransitionRules(),
+		le(uint8(1)), // continue playback
+		le(uint32(2), []uint32{100, 200}, []uint8{0, 1}), // arguments
+		le(uint32(5*12), uint8(0)),                       // tree size, mode
+		decisionTreeNode(0, 1, 2),                        // root
+		decisionTreeNode(101, 3, 1),                      // first group value
+		decisionTreeNode(0, 4, 1),                        // any first group value
+		decisionTreeNode(201, 20, 0),                     // leaves
+		decisionTreeNode(0, 21, 0),
+	)
+	musicRandomSequence := slices.Concat(
+		musicNodeParams(0, 30, 31),
+		le(uint32(0)), // transition rules
+		le(uint32(3)),
+		musicPlaylistItem(0, 1, 2, 2, 0),
+		musicPlaylistItem(31, 2, 0, 0, 25000),
+		musicPlaylistItem(30, 3, 0, 0, 75000),
+	)
+	data := makeBnk(
+		makeHircObject(wwise.BnkHircObjectState, 1, le(uint16(2), []uint16{0, 8}, []float32{-6, 0.5})),
+		makeHircObject(wwise.BnkHircObjectSound, 2, slices.Concat(sourceData(1000), nodeBaseParams(7))),
+		makeHircObject(wwise.BnkHircObjectSound, 3, sourceData(1001)[:9]),
+		makeHircObject(wwise.BnkHircObjectMusicSwitch, 4, musicSwitch),
+		makeHircObject(wwise.BnkHircObjectMusicRandomSequence, 5, musicRandomSequence),
+	)
+	bnk, err := wwise.OpenBnk(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bnk.HircObjects) != 5 {
+		t.Fatalf("expected 5 HIRC objects, got %v", len(bnk.HircObjects))
+	}
+	for _, obj := range bnk.HircObjects {
+		if obj.ParseErr != nil && obj.Header.ObjectID != 3 {
+			t.Errorf("object %v: %v", obj.Header.ObjectID, obj.ParseErr)
+		}
+	}
+
+	state := bnk.HircObjects[0].State
+	if want := []wwise.BnkHircStateProp{{ID: 0, Value: -6}, {ID: 8, Value: 0.5}}; !slices.Equal(state.Props, want) {
+		t.Errorf("expected state properties %v, got %v", want, state.Props)
+	}
+
+	sound := bnk.HircObjects[1]
+	if sound.Sound.SourceID != 1000 || sound.Sound.StreamType != 2 || sound.Node.ParentID != 7 {
+		t.Errorf("unexpected sound source %+v with parent %v", sound.Sound, sound.Node.ParentID)
+	}
+	// A truncated sound doesn't fail the whole bank
+	truncated := bnk.HircObjects[2]
+	if truncated.ParseErr == nil {
+		t.Error("expected parse error for truncated sound")
+	}
+	if truncated.Sound.SourceID != 1001 {
+		t.Errorf("expected the source ID parsed before the error, got %v", truncated.Sound.SourceID)
+	}
+
+	ms := bnk.HircObjects[3].MusicSwitch
+	if !slices.Equal(bnk.HircObjects[3].Children, []uint32{20, 21}) {
+		t.Errorf("unexpected music switch children %v", bnk.HircObjects[3].Children)
+	}
+	wantArgs := []wwise.BnkHircMusicSwitchArgument{{GroupID: 100, GroupType: 0}, {GroupID: 200, GroupType: 1}}
+	if !ms.ContinuePlayback || !slices.Equal(ms.Arguments, wantArgs) {
+		t.Errorf("unexpected music switch %+v", ms)
+	}
+	tree := ms.Tree
+	if len(tree.Children) != 2 || tree.Children[0].Key != 101 || tree.Children[1].Key != 0 {
+		t.Fatalf("unexpected decision tree %+v", tree)
+	}
+	leaf := tree.Children[0].Children[0]
+	if leaf.Key != 201 || leaf.NodeID != 20 || leaf.Weight != 50 || leaf.Probability != 100 || leaf.Children != nil {
+		t.Errorf("unexpected decision tree leaf %+v", leaf)
+	}
+	if leaf := tree.Children[1].Children[0]; leaf.NodeID != 21 {
+		t.Errorf("expected default leaf playing 21, got %+v", leaf)
+	}
+
+	playlist := bnk.HircObjects[4].MusicRandomSequence.Playlist
+	if playlist.SegmentID != 0 || playlist.Type != 2 || len(playlist.Children) != 2 {
+		t.Fatalf("unexpected music playlist %+v", playlist)
+	}
+	if item := playlist.Children[0]; item.SegmentID != 31 || item.Weight != 25000 || !item.UseWeight || item.AvoidRepeatCount != 1 {
+		t.Errorf("unexpected music playlist item %+v", item)
+	}
+}
+
+func TestParseHircObjectsInvalidTrees(t *testing.T) {
+	// Child index pointing back at the root
+	musicSwitch := slices.Concat(
+		musicNodeParams(0),
+		le(uint32(0)),
+		le(uint8(0), uint32(1), uint32(100), uint8(0)),
+		le(uint32(12), uint8(0)),
+		decisionTreeNode(0, 0, 1),
+	)
+	// Root claims more items than stored
+	musicRandomSequence := slices.Concat(
+		musicNodeParams(0),
+		le(uint32(0)),
+		le(uint32(1)),
+		musicPlaylistItem(0, 1, 3, 0, 0),
+	)
+	bnk, err := wwise.OpenBnk(bytes.NewReader(makeBnk(
+		makeHircObject(wwise.BnkHircObjectMusicSwitch, 1, musicSwitch),
+		makeHircObject(wwise.BnkHircObjectMusicRandomSequence, 2, musicRandomSequence),
+	)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range bnk.HircObjects {
+		if obj.ParseErr == nil {
+			t.Errorf("expected parse error for %v", obj.Header.Type)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// The following is mostly manually converted from vgmstream (https://github.com/vgmstream/vgmstream)
+package wwise
+
+import (
+	"errors"
+	"io"
+)
+
+var imaStepTable = [89]int32{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17,
+	19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118,
+	130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+	337, 371, 408, 449, 494, 544, 598, 658, 724, 796,
+	876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+	2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358,
+	5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+	15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+}
+
+var imaIndexTable = [16]int32{
+	-1, -1, -1, -1, 2, 4, 6, 8,
+	-1, -1, -1, -1, 2, 4, 6, 8,
+}
+
+// Size of a single channel's frame within a block.
+const imaFrameSize = 0x24
+
+// Samples per channel in a full frame: the header sample, plus one sample
+// per nibble, with the last nibble skipped.
+const imaFrameSamples = (imaFrameSize - 0x04) * 2
+
+// Wwise IMA is mostly XBOX-IMA, but with header endianness and
+// each block containing one whole frame per channel
+// (instead of interleaving every 4 bytes).
+type wemIMADecoder struct {
+	r         io.Reader
+	h         *wemHeader
+	remaining int64 // remaining data bytes
+	blockBuf  []byte
+	sampleBuf []float32
+}
+
+func newWemIMADecoder(r io.ReadSeeker, h *wemHeader) (*wemIMADecoder, error) {
+	if h.Format.BitsPerSample != 4 {
+		return nil, errors.New("expected 4 bits per sample")
+	}
+	if h.Format.Channels == 0 {
+		return nil, errors.New("expected at least one channel")
+	}
+	if int(h.Format.BlockSize) != imaFrameSize*int(h.Format.Channels) {
+		return nil, errors.New("unexpected block size")
+	}
+	if _, err := r.Seek(int64(h.Chunks.DataOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &wemIMADecoder{
+		r:         r,
+		h:         h,
+		remaining: int64(h.Chunks.DataSize),
+		blockBuf:  make([]byte, h.Format.BlockSize),
+		sampleBuf: make([]float32, imaFrameSamples*int(h.Format.Channels)),
+	}, nil
+}
+
+func imaExpandNibble(nibble uint8, hist *int32, stepIndex *int32) {
+	step := imaStepTable[*stepIndex]
+	delta := step >> 3
+	if nibble&1 != 0 {
+		delta += step >> 2
+	}
+	if nibble&2 != 0 {
+		delta += step >> 1
+	}
+	if nibble&4 != 0 {
+		delta += step
+	}
+	if nibble&8 != 0 {
+		delta = -delta
+	}
+	*hist = min(max(*hist+delta, -32768), 32767)
+	*stepIndex = min(max(*stepIndex+imaIndexTable[nibble], 0), 88)
+}
+
+func (d *wemIMADecoder) Decode() ([]float32, error) {
+	channels := int(d.h.Format.Channels)
+	blockSize := min(int64(len(d.blockBuf)), d.remaining)
+	// The last block may be shorter, but it still
+	// contains one (shortened) frame per channel.
+	frameSize := int(blockSize) / channels
+	if frameSize <= 0x04 {
+		return nil, io.EOF
+	}
+	if _, err := io.ReadFull(d.r, d.blockBuf[:blockSize]); err != nil {
+		return nil, err
+	}
+	d.remaining -= blockSize
+
+	numSamples := min((frameSize-0x04)*2, imaFrameSamples)
+	for ch := range channels {
+		frame := d.blockBuf[ch*frameSize : (ch+1)*frameSize]
+		hist := int32(int16(d.h.Endian.Uint16(frame[0:2])))
+		stepIndex := min(max(int32(frame[2]), 0), 88)
+		// frame[3] is reserved
+
+		d.sampleBuf[ch] = float32(hist) / 32768
+		for i := 1; i < numSamples; i++ {
+			b := frame[0x04+(i-1)/2]
+			var nibble uint8
+			if (i-1)&1 != 0 {
+				nibble = b >> 4
+			} else {
+				nibble = b & 0x0f
+			}
+			imaExpandNibble(nibble, &hist, &stepIndex)
+			d.sampleBuf[i*channels+ch] = float32(hist) / 32768
+		}
+	}
+	return d.sampleBuf[:numSamples*channels], nil
+}
+
+func (d *wemIMADecoder) BufferSize() int {
+	return len(d.sampleBuf)
+}
@@ -0,0 +1,466 @@
+// The following is partially based on vgmstream (https://github.com/vgmstream/vgmstream)
+package wwise
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jj11hh/opus"
+	"github.com/xypwn/filediver/ogg"
+)
+
+// Opus always decodes at 48kHz, regardless of the input sample rate.
+const opusSampleRate = 48000
+
+// Maximum Opus packet duration (120ms at 48kHz).
+const opusMaxPacketSamples = 5760
+
+// The Opus decoders share a single libopus instance, which
+// doesn't support concurrent calls.
+var opusMu sync.Mutex
+
+type wemOpusDecoder struct {
+	r           io.ReadSeeker
+	h           *wemHeader
+	numSamples  int32
+	preSkip     uint16
+	mapping     uint8
+	packetSizes []uint16
+
+	// Decoding state, set up by the first call to Decode
+	streams      []*opus.Decoder
+	coupled      int
+	packet       int   // index of the next packet
+	packetOffset int64 // offset of the next packet
+	skip         int   // remaining samples to skip at the start
+	remaining    int64 // remaining samples to output; < 0 if unknown
+	streamBuf    []float32
+	sampleBuf    []float32
+}
+
+func newWemOpusDecoder(r io.ReadSeeker, h *wemHeader) (*wemOpusDecoder, error) {
+	if h.Format.BlockSize != 0 || h.Format.BitsPerSample != 0 {
+		return nil, errors.New("unexpected block size/bits per sample")
+	}
+	if h.Chunks.SeekOffset == 0 {
+		return nil, errors.New("expected seek chunk")
+	}
+	if h.Chunks.FmtSize < 0x24 {
+		return nil, errors.New("unsupported fmt size")
+	}
+	if h.Format.Channels == 0 || h.Format.Channels > 8 {
+		return nil, fmt.Errorf("unsupported channel count: %v", h.Format.Channels)
+	}
+
+	var extra struct {
+		NumSamples int32
+		TableCount uint32
+		PreSkip    uint16
+		Version    uint8
+		Mapping    uint8
+	}
+	if _, err := r.Seek(int64(h.Chunks.FmtOffset)+0x18, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, h.Endian, &extra); err != nil {
+		return nil, err
+	}
+	if extra.Version != 1 {
+		return nil, fmt.Errorf("unsupported wwise opus version: %v", extra.Version)
+	}
+	if extra.TableCount*2 > h.Chunks.SeekSize {
+		return nil, errors.New("packet table exceeds seek chunk")
+	}
+
+	packetSizes := make([]uint16, extra.TableCount)
+	if _, err := r.Seek(int64(h.Chunks.SeekOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, h.Endian, packetSizes); err != nil {
+		return nil, err
+	}
+	var totalSize uint32
+	for _, size := range packetSizes {
+		totalSize += uint32(size)
+	}
+	if totalSize > h.Chunks.DataSize {
+		return nil, errors.New("packet sizes exceed data chunk")
+	}
+
+	return &wemOpusDecoder{
+		r:           r,
+		h:           h,
+		numSamples:  extra.NumSamples,
+		preSkip:     extra.PreSkip,
+		mapping:     extra.Mapping,
+		packetSizes: packetSizes,
+	}, nil
+}
+
+// Returns the number of elementary streams and how many of them are
+// coupled (stereo). Mono and stereo streams consist of a single stream.
+func (d *wemOpusDecoder) streamLayout() (streams, coupled int) {
+	channels := int(d.h.Format.Channels)
+	if channels <= 2 && d.mapping <= 1 {
+		if channels == 2 {
+			return 1, 1
+		}
+		return 1, 0
+	}
+	// Like vgmstream, we assume the streams are in channel order,
+	// with the coupled streams coming first.
+	coupled = opusCoupledCount(ChannelLayout(d.h.Format.ChannelLayout))
+	return channels - coupled, coupled
+}
+
+func (d *wemOpusDecoder) initDecode() error {
+	numStreams, coupled := d.streamLayout()
+	d.streams = make([]*opus.Decoder, numStreams)
+	opusMu.Lock()
+	defer opusMu.Unlock()
+	for i := range d.streams {
+		channels := 1
+		if i < coupled {
+			channels = 2
+		}
+		dec, err := opus.NewDecoder(opusSampleRate, channels)
+		if err != nil {
+			return err
+		}
+		d.streams[i] = dec
+	}
+	d.coupled = coupled
+	d.packetOffset = int64(d.h.Chunks.DataOffset)
+	d.skip = int(d.preSkip)
+	d.remaining = -1
+	if d.numSamples > 0 {
+		d.remaining = int64(d.numSamples)
+	}
+	d.streamBuf = make([]float32, opusMaxPacketSamples*2)
+	d.sampleBuf = make([]float32, d.BufferSize())
+	return nil
+}
+
+// Decodes a (possibly multistream) packet into sampleBuf and
+// returns the number of samples per channel.
+func (d *wemOpusDecoder) decodePacket(packet []byte) (int, error) {
+	opusMu.Lock()
+	defer opusMu.Unlock()
+
+	channels := int(d.h.Format.Channels)
+	if len(d.streams) == 1 {
+		return d.streams[0].DecodeFloat32(packet, d.sampleBuf[:opusMaxPacketSamples*channels])
+	}
+
+	numSamples := -1
+	for i, dec := range d.streams {
+		// All but the last stream use self-delimited framing
+		// (RFC 6716, appendix B).
+		streamPacket := packet
+		if i < len(d.streams)-1 {
+			var size int
+			var err error
+			streamPacket, size, err = opusUndelimitPacket(packet)
+			if err != nil {
+				return 0, fmt.Errorf("stream %v: %w", i, err)
+			}
+			packet = packet[size:]
+		}
+		streamChannels := 1
+		firstChannel := d.coupled + i
+		if i < d.coupled {
+			streamChannels = 2
+			firstChannel = 2 * i
+		}
+		n, err := dec.DecodeFloat32(streamPacket, d.streamBuf[:opusMaxPacketSamples*streamChannels])
+		if err != nil {
+			return 0, fmt.Errorf("stream %v: %w", i, err)
+		}
+		if numSamples != -1 && n != numSamples {
+			return 0, fmt.Errorf("stream %v has %v samples, expected %v", i, n, numSamples)
+		}
+		numSamples = n
+		for s := range n {
+			for c := range streamChannels {
+				d.sampleBuf[s*channels+firstChannel+c] = d.streamBuf[s*streamChannels+c]
+			}
+		}
+	}
+	return numSamples, nil
+}
+
+func (d *wemOpusDecoder) Decode() ([]float32, error) {
+	if d.streams == nil {
+		if err := d.initDecode(); err != nil {
+			return nil, err
+		}
+	}
+	channels := int(d.h.Format.Channels)
+	for {
+		if d.packet >= len(d.packetSizes) || d.remaining == 0 {
+			return nil, io.EOF
+		}
+		// Seek every time, as WriteOgg shares the reader
+		if _, err := d.r.Seek(d.packetOffset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		packet := make([]byte, d.packetSizes[d.packet])
+		if _, err := io.ReadFull(d.r, packet); err != nil {
+			return nil, err
+		}
+		n, err := d.decodePacket(packet)
+		if err != nil {
+			return nil, fmt.Errorf("packet %v: %w", d.packet, err)
+		}
+		d.packet++
+		d.packetOffset += int64(len(packet))
+
+		start := min(d.skip, n)
+		d.skip -= start
+		end := n
+		if d.remaining >= 0 {
+			end = start + int(min(int64(n-start), d.remaining))
+			d.remaining -= int64(end - start)
+		}
+		if end > start {
+			return d.sampleBuf[start*channels : end*channels], nil
+		}
+	}
+}
+
+func (d *wemOpusDecoder) BufferSize() int {
+	return opusMaxPacketSamples * int(d.h.Format.Channels)
+}
+
+// Returns the number of samples (at 48kHz) contained
+// in an Opus packet, based on its TOC byte (RFC 6716, section 3.1).
+func opusPacketSamples(packet []byte) (int, error) {
+	if len(packet) < 1 {
+		return 0, errors.New("empty opus packet")
+	}
+	toc := packet[0]
+	config := toc >> 3
+	var frameSamples int
+	switch {
+	case config < 12: // SILK: 10, 20, 40, 60ms
+		frameSamples = [4]int{480, 960, 1920, 2880}[config&3]
+	case config < 16: // Hybrid: 10, 20ms
+		frameSamples = [2]int{480, 960}[config&1]
+	default: // CELT: 2.5, 5, 10, 20ms
+		frameSamples = [4]int{120, 240, 480, 960}[config&3]
+	}
+	var numFrames int
+	switch toc & 0x03 {
+	case 0:
+		numFrames = 1
+	case 1, 2:
+		numFrames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, errors.New("truncated opus packet")
+		}
+		numFrames = int(packet[1] & 0x3f)
+	}
+	return frameSamples * numFrames, nil
+}
+
+// Reads an Opus packet with self-delimited framing (RFC 6716,
+// appendix B) from the start of data and converts it to a regular
+// packet. Returns the regular packet and the size of the
+// self-delimited packet.
+func opusUndelimitPacket(data []byte) (packet []byte, size int, err error) {
+	errTruncated := errors.New("truncated self-delimited opus packet")
+	pos := 1
+	readSize := func() (int, error) {
+		if pos >= len(data) {
+			return 0, errTruncated
+		}
+		if data[pos] < 252 {
+			pos++
+			return int(data[pos-1]), nil
+		}
+		if pos+1 >= len(data) {
+			return 0, errTruncated
+		}
+		pos += 2
+		return int(data[pos-2]) + 4*int(data[pos-1]), nil
+	}
+
+	if len(data) < 1 {
+		return nil, 0, errTruncated
+	}
+	// The self-delimiting size is the last size field
+	// before the frame data.
+	var delimStart, delimEnd, dataSize int
+	switch data[0] & 0x03 {
+	case 0, 1:
+		delimStart = pos
+		frameSize, err := readSize()
+		if err != nil {
+			return nil, 0, err
+		}
+		delimEnd = pos
+		dataSize = frameSize
+		if data[0]&0x03 == 1 {
+			dataSize *= 2
+		}
+	case 2:
+		firstSize, err := readSize()
+		if err != nil {
+			return nil, 0, err
+		}
+		delimStart = pos
+		secondSize, err := readSize()
+		if err != nil {
+			return nil, 0, err
+		}
+		delimEnd = pos
+		dataSize = firstSize + secondSize
+	case 3:
+		if len(data) < 2 {
+			return nil, 0, errTruncated
+		}
+		vbr := data[1]&0x80 != 0
+		hasPadding := data[1]&0x40 != 0
+		numFrames := int(data[1] & 0x3f)
+		if numFrames == 0 {
+			return nil, 0, errors.New("opus packet without frames")
+		}
+		pos = 2
+		if hasPadding {
+			for {
+				if pos >= len(data) {
+					return nil, 0, errTruncated
+				}
+				pos++
+				if data[pos-1] != 255 {
+					dataSize += int(data[pos-1])
+					break
+				}
+				dataSize += 254
+			}
+		}
+		if vbr {
+			for range numFrames - 1 {
+				frameSize, err := readSize()
+				if err != nil {
+					return nil, 0, err
+				}
+				dataSize += frameSize
+			}
+		}
+		delimStart = pos
+		frameSize, err := readSize()
+		if err != nil {
+			return nil, 0, err
+		}
+		delimEnd = pos
+		if vbr {
+			dataSize += frameSize
+		} else {
+			dataSize += numFrames * frameSize
+		}
+	}
+	size = delimEnd + dataSize
+	if size > len(data) {
+		return nil, 0, errTruncated
+	}
+	packet = make([]byte, 0, size-(delimEnd-delimStart))
+	packet = append(packet, data[:delimStart]...)
+	packet = append(packet, data[delimEnd:size]...)
+	return packet, size, nil
+}
+
+// Returns the number of coupled (stereo) streams for a
+// multistream Opus layout.
+func opusCoupledCount(layout ChannelLayout) int {
+	pairs := [][2]SpeakerFlag{
+		{SpeakerFL, SpeakerFR},
+		{SpeakerBL, SpeakerBR},
+		{SpeakerSL, SpeakerSR},
+		{SpeakerFLC, SpeakerFRC},
+		{SpeakerTFL, SpeakerTFR},
+		{SpeakerTBL, SpeakerTBR},
+	}
+	var n int
+	for _, p := range pairs {
+		if layout&ChannelLayout(p[0]) != 0 && layout&ChannelLayout(p[1]) != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Writes the Ogg Opus identification and comment headers.
+func (d *wemOpusDecoder) writeOggHeaders(ow *ogg.Writer, comments []string) error {
+	channels := int(d.h.Format.Channels)
+	head := []byte("OpusHead")
+	head = append(head, 1, uint8(channels)) // version, channel count
+	head = binary.LittleEndian.AppendUint16(head, d.preSkip)
+	head = binary.LittleEndian.AppendUint32(head, d.h.Format.SampleRate)
+	head = binary.LittleEndian.AppendUint16(head, 0) // output gain
+	if channels <= 2 && d.mapping <= 1 {
+		head = append(head, 0) // mapping family: RTP (mono/stereo)
+	} else {
+		streams, coupled := d.streamLayout()
+		head = append(head, 1, uint8(streams), uint8(coupled))
+		for i := range channels {
+			head = append(head, uint8(i))
+		}
+	}
+	if err := ow.WritePacket(head, 0); err != nil {
+		return err
+	}
+	if err := ow.Flush(); err != nil {
+		return err
+	}
+
+	const vendor = "filediver wwise opus remuxer"
+	tags := []byte("OpusTags")
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(vendor)))
+	tags = append(tags, vendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(comments)))
+	for _, c := range comments {
+		tags = binary.LittleEndian.AppendUint32(tags, uint32(len(c)))
+		tags = append(tags, c...)
+	}
+	if err := ow.WritePacket(tags, 0); err != nil {
+		return err
+	}
+	return ow.Flush()
+}
+
+func (d *wemOpusDecoder) writeOgg(w io.Writer, serial uint32, comments []string) error {
+	ow := ogg.NewWriter(w, serial)
+	if err := d.writeOggHeaders(ow, comments); err != nil {
+		return err
+	}
+
+	if _, err := d.r.Seek(int64(d.h.Chunks.DataOffset), io.SeekStart); err != nil {
+		return err
+	}
+	endGranule := int64(d.preSkip) + int64(d.numSamples)
+	var granule int64
+	for i, size := range d.packetSizes {
+		packet := make([]byte, size)
+		if _, err := io.ReadFull(d.r, packet); err != nil {
+			return err
+		}
+		n, err := opusPacketSamples(packet)
+		if err != nil {
+			return fmt.Errorf("packet %v: %w", i, err)
+		}
+		granule += int64(n)
+		if i == len(d.packetSizes)-1 && endGranule > 0 {
+			// Last granule position specifies end trimming
+			granule = min(granule, endGranule)
+		}
+		if err := ow.WritePacket(packet, granule); err != nil {
+			return err
+		}
+	}
+	return ow.Close()
+}
@@ -0,0 +1,58 @@
+package wwise
+
+import (
+	"errors"
+	"io"
+)
+
+// Number of sample frames decoded per call to Decode.
+const pcmFramesPerDecode = 1024
+
+type wemPCMDecoder struct {
+	r         io.Reader
+	h         *wemHeader
+	remaining int64 // remaining data bytes
+	byteBuf   []byte
+	sampleBuf []float32
+}
+
+func newWemPCMDecoder(r io.ReadSeeker, h *wemHeader) (*wemPCMDecoder, error) {
+	if h.Format.BitsPerSample != 16 {
+		return nil, errors.New("only 16-bit PCM is supported")
+	}
+	if h.Format.Channels == 0 {
+		return nil, errors.New("expected at least one channel")
+	}
+	if _, err := r.Seek(int64(h.Chunks.DataOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	bufSize := pcmFramesPerDecode * int(h.Format.Channels)
+	return &wemPCMDecoder{
+		r:         r,
+		h:         h,
+		remaining: int64(h.Chunks.DataSize),
+		byteBuf:   make([]byte, 2*bufSize),
+		sampleBuf: make([]float32, bufSize),
+	}, nil
+}
+
+func (d *wemPCMDecoder) Decode() ([]float32, error) {
+	frameSize := 2 * int64(d.h.Format.Channels)
+	n := min(int64(len(d.byteBuf)), d.remaining/frameSize*frameSize)
+	if n == 0 {
+		return nil, io.EOF
+	}
+	if _, err := io.ReadFull(d.r, d.byteBuf[:n]); err != nil {
+		return nil, err
+	}
+	d.remaining -= n
+	for i := range n / 2 {
+		smp := int16(d.h.Endian.Uint16(d.byteBuf[2*i:]))
+		d.sampleBuf[i] = float32(smp) / 32768
+	}
+	return d.sampleBuf[:n/2], nil
+}
+
+func (d *wemPCMDecoder) BufferSize() int {
+	return len(d.sampleBuf)
+}
@@ -100,16 +100,34 @@ type Decoder struct {
 	buf           *bytes.Buffer
 	cfg           Config
 	sampleBuf     []float32
+	headers       [3][]byte
 	modeBlockFlag [64 + 1]bool
 	modeBits      uint8
 	prevBlockFlag bool
 }
 
+const packetID = "vorbis"
+
+// Builds a Vorbis comment header packet.
+// Each comment should be in the form "NAME=value".
+func CommentHeader(vendor string, comments []string) []byte {
+	b := []byte{0x03} // packet type: comment
+	b = append(b, packetID...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(vendor)))
+	b = append(b, vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(comments)))
+	for _, c := range comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	b = append(b, 0x01) // framing flag
+	return b
+}
+
 func NewDecoder(r io.ReadSeeker, cfg Config) (*Decoder, error) {
 	vorbDec := &vorbis.Decoder{}
 
-	packetID := [6]byte{'v', 'o', 'r', 'b', 'i', 's'}
-
+	var headers [3][]byte
 	buf := &bytes.Buffer{}
 
 	// Identification packet
@@ -127,8 +145,8 @@ func NewDecoder(r io.ReadSeeker, cfg Config) (*Decoder, error) {
 			Blocksize      uint8
 			FramingFlag    uint8
 		}{
-			Type:           0x01,     // packet type: id
-			ID:             packetID, // id: always "vorbis"
+			Type:           0x01, // packet type: id
+			ID:             [6]byte([]byte(packetID)),
 			Version:        0x00,
 			Channels:       uint8(cfg.Channels),
 			SampleRate:     cfg.SampleRate,
@@ -146,35 +164,13 @@ func NewDecoder(r io.ReadSeeker, cfg Config) (*Decoder, error) {
 		if err := vorbDec.ReadHeader(buf.Bytes()); err != nil {
 			return nil, err
 		}
+		headers[0] = bytes.Clone(buf.Bytes())
 	}
 
 	// Comment packet
-	{
-		buf.Reset()
-		const vendor = "filediver wwise vorbis decoder"
-		pkt := struct {
-			Type               uint8
-			ID                 [6]byte
-			VendorLength       uint32
-			VendorString       [len(vendor)]byte
-			UserCommentListLen uint32
-			FramingFlag        uint8
-		}{
-			Type:               0x03,     // packet type: comment
-			ID:                 packetID, // id: always "vorbis"
-			VendorLength:       uint32(len(vendor)),
-			UserCommentListLen: 0,    // no user comments
-			FramingFlag:        0x01, // fixed
-		}
-		copy(pkt.VendorString[:], vendor)
-
-		if err := binary.Write(buf, binary.LittleEndian, pkt); err != nil {
-			return nil, err
-		}
-
-		if err := vorbDec.ReadHeader(buf.Bytes()); err != nil {
-			return nil, err
-		}
+	headers[1] = CommentHeader("filediver wwise vorbis decoder", nil)
+	if err := vorbDec.ReadHeader(headers[1]); err != nil {
+		return nil, err
 	}
 
 	// Setup packet
@@ -194,7 +190,9 @@ func NewDecoder(r io.ReadSeeker, cfg Config) (*Decoder, error) {
 		if err := vorbDec.ReadHeader(buf.Bytes()); err != nil {
 			return nil, err
 		}
+		headers[2] = bytes.Clone(buf.Bytes())
 	}
+	d.headers = headers
 
 	if !vorbDec.HeadersRead() {
 		return nil, errors.New("headers not read")
@@ -219,6 +217,39 @@ func (d *Decoder) Decode() ([]float32, error) {
 	return d.vorbDec.DecodeInto(d.buf.Bytes(), d.sampleBuf)
 }
 
+// Returns the standard Vorbis identification, comment and setup
+// header packets, in that order.
+func (d *Decoder) HeaderPackets() [3][]byte {
+	return d.headers
+}
+
+// Converts the next packet into a standard Vorbis audio packet,
+// without decoding it. isLast is set for the final packet
+// of the stream.
+// Mixing calls to ReadPacket and Decode is not supported.
+func (d *Decoder) ReadPacket() (packet []byte, isLast bool, err error) {
+	d.buf.Reset()
+	wp, err := convertPacket(d, d.buf, d.r)
+	if err != nil {
+		return nil, false, err
+	}
+	return bytes.Clone(d.buf.Bytes()), !wp.HasNext, nil
+}
+
+// Returns the block size (in samples) of an audio packet
+// returned by ReadPacket.
+func (d *Decoder) PacketBlockSize(packet []byte) int {
+	if len(packet) == 0 {
+		return 0
+	}
+	// First bit is the packet type, followed by the mode number
+	modeNumber := (packet[0] >> 1) & ((1 << d.modeBits) - 1)
+	if d.modeBlockFlag[modeNumber] {
+		return 1 << d.cfg.Blocksize0Exp
+	}
+	return 1 << d.cfg.Blocksize1Exp
+}
+
 // Maximum amount of samples that can be decoded from a single packet.
 func (d *Decoder) BufferSize() int {
 	return d.vorbDec.BufferSize()
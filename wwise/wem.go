@@ -2,11 +2,13 @@
 package wwise
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 
+	"github.com/xypwn/filediver/ogg"
 	"github.com/xypwn/filediver/wwise/vorbis"
 )
 
@@ -25,6 +27,52 @@ type wemChunks struct {
 	DataSize   uint32
 	SmplOffset uint32
 	SmplSize   uint32
+	SeekOffset uint32
+	SeekSize   uint32
+	CueOffset  uint32
+	CueSize    uint32
+	ListOffset uint32
+	ListSize   uint32
+}
+
+type Codec int
+
+const (
+	CodecVorbis Codec = iota
+	CodecPCM
+	CodecIMA
+	CodecOpus
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecVorbis:
+		return "vorbis"
+	case CodecPCM:
+		return "pcm"
+	case CodecIMA:
+		return "ima"
+	case CodecOpus:
+		return "opus"
+	default:
+		return fmt.Sprintf("Codec(%v)", int(c))
+	}
+}
+
+// Maps the fmt chunk format tag to the codec.
+func codecFromFormatTag(tag uint16) (Codec, bool) {
+	switch tag {
+	case 0x0001, 0xFFFE: // PCM, WAVE_FORMAT_EXTENSIBLE
+		return CodecPCM, true
+	case 0x0002: // Wwise IMA ADPCM (NOT MS ADPCM)
+		return CodecIMA, true
+	case 0x3041: // Wwise Opus
+		return CodecOpus, true
+	case 0xFFFF: // Wwise Vorbis
+		return CodecVorbis, true
+	default:
+		return 0, false
+	}
 }
 
 type wemLoop struct {
@@ -33,6 +81,14 @@ type wemLoop struct {
 	EndSample   uint32
 }
 
+// A cue point. Position is in samples (of the
+// source sample rate).
+type wemMarker struct {
+	ID       uint32
+	Position uint32
+	Label    string
+}
+
 type wemFmt struct {
 	Format        uint16
 	Channels      uint16
@@ -49,8 +105,10 @@ type wemHeader struct {
 	FileSize int64
 	Endian   binary.ByteOrder
 	Chunks   wemChunks
+	Codec    Codec
 	Format   wemFmt
 	Loop     wemLoop
+	Markers  []wemMarker
 }
 
 func readWemHeader(r io.ReadSeeker) (*wemHeader, error) {
@@ -124,6 +182,22 @@ func readWemHeader(r io.ReadSeeker) (*wemHeader, error) {
 			case "smpl":
 				chunks.SmplOffset = ck.Offset
 				chunks.SmplSize = ck.Size
+			case "seek":
+				chunks.SeekOffset = ck.Offset
+				chunks.SeekSize = ck.Size
+			case "cue ":
+				chunks.CueOffset = ck.Offset
+				chunks.CueSize = ck.Size
+			case "LIST":
+				var listType [4]byte
+				if _, err := io.ReadFull(r, listType[:]); err != nil {
+					return nil, err
+				}
+				// Associated data list (cue labels)
+				if string(listType[:]) == "adtl" {
+					chunks.ListOffset = ck.Offset
+					chunks.ListSize = ck.Size
+				}
 			case "vorb":
 				return nil, errors.New("vorb chunk not supported")
 			case "XMA2":
@@ -138,7 +212,7 @@ func readWemHeader(r io.ReadSeeker) (*wemHeader, error) {
 		}
 	}
 
-	if chunks.FmtSize != 0x42 {
+	if chunks.FmtSize < 0x10 {
 		return nil, errors.New("unsupported fmt size")
 	}
 
@@ -147,22 +221,36 @@ func readWemHeader(r io.ReadSeeker) (*wemHeader, error) {
 		return nil, err
 	}
 	var format wemFmt
+	var codec Codec
 	{
-		if err := binary.Read(r, endian, &format); err != nil {
+		// Older/simpler formats (e.g. plain PCM) only
+		// have the first 0x10 or 0x12 bytes.
+		var b [0x18]byte
+		if _, err := io.ReadFull(r, b[:min(chunks.FmtSize, uint32(len(b)))]); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(bytes.NewReader(b[:]), endian, &format); err != nil {
 			return nil, err
 		}
 
-		if format.Format != 0xFFFF { // custom vorbis codec
-			return nil, errors.New("unsupported audio codec")
+		var ok bool
+		codec, ok = codecFromFormatTag(format.Format)
+		if !ok {
+			return nil, fmt.Errorf("unsupported audio codec: 0x%04x", format.Format)
 		}
 
-		if format.ChannelLayout&0xFF == uint32(format.Channels) {
+		if format.ExtraSize < 0x06 {
+			format.ChannelLayout = 0
+		} else if format.ChannelLayout&0xFF == uint32(format.Channels) {
 			channelType := (format.ChannelLayout >> 8) & 0x0F
 			format.ChannelLayout = format.ChannelLayout >> 12
 			if channelType != 1 {
 				return nil, errors.New("unsupported channel type")
 			}
 		}
+		if format.ChannelLayout == 0 {
+			format.ChannelLayout = uint32(defaultChannelLayout(int(format.Channels)))
+		}
 	}
 
 	// Read loop
@@ -195,6 +283,12 @@ func readWemHeader(r io.ReadSeeker) (*wemHeader, error) {
 		}
 	}
 
+	// Read markers
+	markers, err := readWemMarkers(r, endian, chunks)
+	if err != nil {
+		return nil, err
+	}
+
 	if chunks.DataOffset == 0 {
 		return nil, errors.New("expected data chunk")
 	}
@@ -203,11 +297,79 @@ func readWemHeader(r io.ReadSeeker) (*wemHeader, error) {
 		FileSize: fileSize,
 		Endian:   endian,
 		Chunks:   chunks,
+		Codec:    codec,
 		Format:   format,
 		Loop:     loop,
+		Markers:  markers,
 	}, nil
 }
 
+// Reads the cue points from the "cue " chunk and their labels
+// from the "LIST" (associated data list) chunk, if present.
+func readWemMarkers(r io.ReadSeeker, endian binary.ByteOrder, chunks wemChunks) ([]wemMarker, error) {
+	if chunks.CueOffset == 0 || chunks.CueSize < 0x04 {
+		return nil, nil
+	}
+	if _, err := r.Seek(int64(chunks.CueOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	var count uint32
+	if err := binary.Read(r, endian, &count); err != nil {
+		return nil, err
+	}
+	if 0x04+uint64(count)*0x18 > uint64(chunks.CueSize) {
+		return nil, errors.New("cue chunk too small for number of cue points")
+	}
+	markers := make([]wemMarker, count)
+	for i := range markers {
+		var cue struct {
+			ID           uint32
+			Position     uint32
+			DataChunkID  [4]byte
+			ChunkStart   uint32
+			BlockStart   uint32
+			SampleOffset uint32
+		}
+		if err := binary.Read(r, endian, &cue); err != nil {
+			return nil, err
+		}
+		markers[i] = wemMarker{
+			ID:       cue.ID,
+			Position: cue.Position,
+		}
+	}
+
+	if chunks.ListOffset == 0 || chunks.ListSize < 0x04 {
+		return markers, nil
+	}
+	sc := newChunkScanner(r, chunks.ListOffset+0x04, chunks.ListOffset+chunks.ListSize, endian)
+	for sc.Next() {
+		ck := sc.Chunk()
+		if string(ck.Type[:]) != "labl" || ck.Size < 0x04 {
+			continue
+		}
+		b := make([]byte, ck.Size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		id := endian.Uint32(b[:4])
+		label, _, _ := bytes.Cut(b[4:], []byte{0})
+		for i := range markers {
+			if markers[i].ID == id {
+				markers[i].Label = string(label)
+			}
+		}
+		// Chunks are word-aligned
+		if ck.Size%2 != 0 {
+			sc.pos++
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return markers, nil
+}
+
 type SpeakerFlag uint32
 
 // WAVEFORMATEXTENSIBLE speaker positions
@@ -307,6 +469,31 @@ const (
 	Mapping7Point1Top      = ChannelLayout(SpeakerFL | SpeakerFR | SpeakerFC | SpeakerLFE | SpeakerBL | SpeakerBR | SpeakerTFL | SpeakerTFR)
 )
 
+// Returns the usual WAVEFORMATEXTENSIBLE layout for the given
+// channel count. Used when the stream doesn't specify a layout.
+func defaultChannelLayout(channels int) ChannelLayout {
+	switch channels {
+	case 1:
+		return MappingMono
+	case 2:
+		return MappingStereo
+	case 3:
+		return Mapping2Point1
+	case 4:
+		return MappingQuad
+	case 5:
+		return Mapping5Point0
+	case 6:
+		return Mapping5Point1
+	case 7:
+		return Mapping6Point1Back
+	case 8:
+		return Mapping7Point1
+	default:
+		return ChannelLayout(1<<channels - 1)
+	}
+}
+
 // Returns true if the channel layout can be described by a simple name like "7.1" or "stereo".
 // The string can be obtained by calling String().
 func (cl ChannelLayout) HasName() bool {
@@ -407,9 +594,15 @@ func (cl ChannelLayout) String() string {
 	}
 }
 
+// Codec-specific PCM decoder.
+type wemDecoder interface {
+	Decode() ([]float32, error)
+	BufferSize() int
+}
+
 type Wem struct {
 	r   io.ReadSeeker
-	dec *vorbis.Decoder
+	dec wemDecoder
 	hdr *wemHeader
 }
 
@@ -419,6 +612,40 @@ func openWem(r io.ReadSeeker) (*Wem, error) {
 		return nil, err
 	}
 
+	var dec wemDecoder
+	switch h.Codec {
+	case CodecVorbis:
+		dec, err = newWemVorbisDecoder(r, h)
+	case CodecPCM:
+		dec, err = newWemPCMDecoder(r, h)
+	case CodecIMA:
+		dec, err = newWemIMADecoder(r, h)
+	case CodecOpus:
+		dec, err = newWemOpusDecoder(r, h)
+	default:
+		panic("unhandled case")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wwise_%v: %w", h.Codec, err)
+	}
+
+	return &Wem{
+		r:   r,
+		dec: dec,
+		hdr: h,
+	}, nil
+}
+
+type wemVorbisDecoder struct {
+	*vorbis.Decoder
+	numSamples int32
+}
+
+func newWemVorbisDecoder(r io.ReadSeeker, h *wemHeader) (*wemVorbisDecoder, error) {
+	if h.Chunks.FmtSize != 0x42 {
+		return nil, errors.New("unsupported fmt size")
+	}
+
 	extraOffset := h.Chunks.FmtOffset + 0x18
 	if h.Format.ExtraSize != 0x30 {
 		return nil, errors.New("unsupported extra size")
@@ -435,62 +662,106 @@ func openWem(r io.ReadSeeker) (*Wem, error) {
 		Endian:     h.Endian,
 		StreamEnd:  h.Chunks.DataOffset + h.Chunks.DataSize,
 	}
-	var dec *vorbis.Decoder
+	startOffset := h.Chunks.DataOffset
+	const dataOffsets = 0x10
+	const blockOffsets = 0x28
+	var numSamples int32
+	if _, err := r.Seek(int64(extraOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, h.Endian, &numSamples); err != nil {
+		return nil, err
+	}
+	var offsets struct {
+		SetupOffset uint32
+		AudioOffset uint32
+	}
+	if _, err := r.Seek(int64(extraOffset+dataOffsets), io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, h.Endian, &offsets); err != nil {
+		return nil, err
+	}
+	h.Chunks.DataSize -= offsets.AudioOffset
 	{
-		startOffset := h.Chunks.DataOffset
-		const dataOffsets = 0x10
-		const blockOffsets = 0x28
-		var numSamples int32
-		if _, err := r.Seek(int64(extraOffset), io.SeekStart); err != nil {
-			return nil, err
+		var bs struct {
+			Blocksize1Exp uint8
+			Blocksize0Exp uint8
 		}
-		if err := binary.Read(r, h.Endian, &numSamples); err != nil {
+		if _, err := r.Seek(int64(extraOffset+blockOffsets), io.SeekStart); err != nil {
 			return nil, err
 		}
-		var offsets struct {
-			SetupOffset uint32
-			AudioOffset uint32
-		}
-		if _, err := r.Seek(int64(extraOffset+dataOffsets), io.SeekStart); err != nil {
+		if err := binary.Read(r, h.Endian, &bs); err != nil {
 			return nil, err
 		}
-		if err := binary.Read(r, h.Endian, &offsets); err != nil {
-			return nil, err
+		if bs.Blocksize1Exp != 0x08 || bs.Blocksize0Exp != 0x0b {
+			return nil, errors.New("unexpected block sizes")
 		}
-		h.Chunks.DataSize -= offsets.AudioOffset
-		{
-			var bs struct {
-				Blocksize1Exp uint8
-				Blocksize0Exp uint8
-			}
-			if _, err := r.Seek(int64(extraOffset+blockOffsets), io.SeekStart); err != nil {
-				return nil, err
-			}
-			if err := binary.Read(r, h.Endian, &bs); err != nil {
-				return nil, err
-			}
-			if bs.Blocksize1Exp != 0x08 || bs.Blocksize0Exp != 0x0b {
-				return nil, errors.New("unexpected block sizes")
-			}
 
-			cfg.Blocksize1Exp = bs.Blocksize1Exp
-			cfg.Blocksize0Exp = bs.Blocksize0Exp
-		}
+		cfg.Blocksize1Exp = bs.Blocksize1Exp
+		cfg.Blocksize0Exp = bs.Blocksize0Exp
+	}
 
-		if _, err := r.Seek(int64(startOffset+offsets.SetupOffset), io.SeekStart); err != nil {
-			return nil, err
+	if _, err := r.Seek(int64(startOffset+offsets.SetupOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	dec, err := vorbis.NewDecoder(r, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &wemVorbisDecoder{
+		Decoder:    dec,
+		numSamples: numSamples,
+	}, nil
+}
+
+// Writes the rebuilt standard Vorbis packets into an Ogg container.
+func (d *wemVorbisDecoder) writeOgg(w io.Writer, serial uint32, comments []string) error {
+	ow := ogg.NewWriter(w, serial)
+	headers := d.HeaderPackets()
+	headers[1] = vorbis.CommentHeader("filediver wwise vorbis remuxer", comments)
+	for i, hdr := range headers {
+		if err := ow.WritePacket(hdr, 0); err != nil {
+			return err
 		}
-		dec, err = vorbis.NewDecoder(r, cfg)
-		if err != nil {
-			return nil, fmt.Errorf("wwise_vorbis: %w", err)
+		if i == 0 {
+			// Identification header must be alone on the first page
+			if err := ow.Flush(); err != nil {
+				return err
+			}
 		}
 	}
+	// Audio data must start on a fresh page
+	if err := ow.Flush(); err != nil {
+		return err
+	}
 
-	return &Wem{
-		r:   r,
-		dec: dec,
-		hdr: h,
-	}, nil
+	var granule int64
+	var prevBlockSize int
+	for {
+		packet, isLast, err := d.ReadPacket()
+		if err != nil {
+			return err
+		}
+		// Each packet (except the first) completes
+		// prevBlockSize/4 + blockSize/4 samples.
+		blockSize := d.PacketBlockSize(packet)
+		if prevBlockSize != 0 {
+			granule += int64(prevBlockSize/4 + blockSize/4)
+		}
+		prevBlockSize = blockSize
+		if isLast && d.numSamples > 0 {
+			// Last granule position specifies end trimming
+			granule = min(granule, int64(d.numSamples))
+		}
+		if err := ow.WritePacket(packet, granule); err != nil {
+			return err
+		}
+		if isLast {
+			break
+		}
+	}
+	return ow.Close()
 }
 
 func OpenWem(r io.ReadSeeker) (*Wem, error) {
@@ -511,13 +782,21 @@ func (w *Wem) Decode() ([]float32, error) {
 
 	data, err := w.dec.Decode()
 	if err != nil {
-		return nil, fmt.Errorf("%vwwise_vorbis: %w", errPfx, err)
+		return nil, fmt.Errorf("%vwwise_%v: %w", errPfx, w.hdr.Codec, err)
 	}
 
 	return data, nil
 }
 
+func (w *Wem) Codec() Codec {
+	return w.hdr.Codec
+}
+
+// Sample rate of the decoded PCM data.
 func (w *Wem) SampleRate() int {
+	if w.hdr.Codec == CodecOpus {
+		return opusSampleRate
+	}
 	return int(w.hdr.Format.SampleRate)
 }
 
@@ -529,7 +808,81 @@ func (w *Wem) ChannelLayout() ChannelLayout {
 	return ChannelLayout(w.hdr.Format.ChannelLayout)
 }
 
+// A named position within the stream.
+type Marker struct {
+	ID       uint32
+	Position int // in samples, at SampleRate
+	Label    string
+}
+
+// Converts a sample position in the source sample
+// rate to a position in the decoded sample rate.
+func (w *Wem) outputSamplePos(pos uint32) int {
+	srcRate := int64(w.hdr.Format.SampleRate)
+	dstRate := int64(w.SampleRate())
+	if srcRate == dstRate || srcRate == 0 {
+		return int(pos)
+	}
+	return int(int64(pos) * dstRate / srcRate)
+}
+
+// Returns the loop region in samples (at SampleRate), where
+// end is exclusive. ok is false if the stream doesn't loop.
+func (w *Wem) Loop() (start, end int, ok bool) {
+	if !w.hdr.Loop.Enabled {
+		return 0, 0, false
+	}
+	// smpl loop end is inclusive
+	return w.outputSamplePos(w.hdr.Loop.StartSample),
+		w.outputSamplePos(w.hdr.Loop.EndSample + 1),
+		true
+}
+
+// Returns the stream's cue points.
+func (w *Wem) Markers() []Marker {
+	res := make([]Marker, len(w.hdr.Markers))
+	for i, m := range w.hdr.Markers {
+		res[i] = Marker{
+			ID:       m.ID,
+			Position: w.outputSamplePos(m.Position),
+			Label:    m.Label,
+		}
+	}
+	return res
+}
+
 // Maximum amount of samples that can be decoded from a single packet.
 func (w *Wem) BufferSize() int {
 	return w.dec.BufferSize()
 }
+
+// Returns true if the stream can be written to an Ogg
+// container without re-encoding (see WriteOgg).
+func (w *Wem) CanWriteOgg() bool {
+	return w.hdr.Codec == CodecVorbis || w.hdr.Codec == CodecOpus
+}
+
+// Writes the stream into an Ogg container without re-encoding
+// (Ogg Vorbis or Ogg Opus). Only supported for Vorbis and Opus streams.
+// comments are Vorbis comments in the form "NAME=value".
+// Must be called before any call to Decode.
+func (w *Wem) WriteOgg(out io.Writer, comments []string) error {
+	const errPfx = errPfx + "Wem: WriteOgg: "
+
+	// Any serial number is fine for single-stream files
+	serial := w.hdr.Format.SampleRate ^ uint32(w.hdr.Chunks.DataSize)
+
+	var err error
+	switch dec := w.dec.(type) {
+	case *wemVorbisDecoder:
+		err = dec.writeOgg(out, serial, comments)
+	case *wemOpusDecoder:
+		err = dec.writeOgg(out, serial, comments)
+	default:
+		return fmt.Errorf("%vunsupported codec: %v", errPfx, w.hdr.Codec)
+	}
+	if err != nil {
+		return fmt.Errorf("%vwwise_%v: %w", errPfx, w.hdr.Codec, err)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package wwise_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/jj11hh/opus"
+	"github.com/xypwn/filediver/wwise"
+)
+
+func makeChunk(id string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+// Builds a minimal RIFF/WAVE file with the given fmt and data chunks,
+// followed by any extra (already built) chunks.
+func makeRiff(fmtChunk, data []byte, extraChunks ...[]byte) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	body.Write(makeChunk("fmt ", fmtChunk))
+	body.Write(makeChunk("data", data))
+	for _, ck := range extraChunks {
+		body.Write(ck)
+	}
+	return makeChunk("RIFF", body.Bytes())
+}
+
+func decodeAll(t *testing.T, wem *wwise.Wem) []float32 {
+	var res []float32
+	for {
+		data, err := wem.Decode()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			t.Fatal(err)
+		}
+		res = append(res, data...)
+	}
+	return res
+}
+
+func TestWemPCM(t *testing.T) {
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, struct {
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		AvgBitrate    uint32
+		BlockSize     uint16
+		BitsPerSample uint16
+	}{0x0001, 2, 48000, 48000 * 4, 4, 16})
+
+	samples := []int16{0, -32768, 16384, 32767, -1, 1}
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, samples)
+
+	wem, err := wwise.OpenWem(bytes.NewReader(makeRiff(fmtChunk.Bytes(), data.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wem.Codec() != wwise.CodecPCM {
+		t.Errorf("expected codec pcm, got %v", wem.Codec())
+	}
+	if wem.Channels() != 2 || wem.SampleRate() != 48000 {
+		t.Errorf("unexpected format: %v channels, %vHz", wem.Channels(), wem.SampleRate())
+	}
+	if wem.ChannelLayout() != wwise.MappingStereo {
+		t.Errorf("expected default stereo layout, got %v", wem.ChannelLayout())
+	}
+	decoded := decodeAll(t, wem)
+	if len(decoded) != len(samples) {
+		t.Fatalf("expected %v samples, got %v", len(samples), len(decoded))
+	}
+	for i := range samples {
+		if want := float32(samples[i]) / 32768; decoded[i] != want {
+			t.Errorf("sample %v: expected %v, got %v", i, want, decoded[i])
+		}
+	}
+}
+
+func TestWemIMA(t *testing.T) {
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, struct {
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		AvgBitrate    uint32
+		BlockSize     uint16
+		BitsPerSample uint16
+		ExtraSize     uint16
+		SamplesPerBlk uint16
+	}{0x0002, 1, 24000, 0, 0x24, 4, 2, 64})
+
+	// Single frame: header sample 100, step index 0,
+	// then nibbles alternating +7/-7.
+	frame := make([]byte, 0x24)
+	binary.LittleEndian.PutUint16(frame[0:], 100)
+	for i := 4; i < len(frame); i++ {
+		frame[i] = 0xf7
+	}
+
+	wem, err := wwise.OpenWem(bytes.NewReader(makeRiff(fmtChunk.Bytes(), frame)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := decodeAll(t, wem)
+	if len(decoded) != 64 {
+		t.Fatalf("expected 64 samples, got %v", len(decoded))
+	}
+	if decoded[0] != 100.0/32768 {
+		t.Errorf("expected header sample, got %v", decoded[0]*32768)
+	}
+	// step 7, nibble 7: delta = 0 + 1 + 3 + 7 = 11
+	if got := decoded[1] * 32768; got != 111 {
+		t.Errorf("expected second sample to be 111, got %v", got)
+	}
+}
+
+func TestWemMarkers(t *testing.T) {
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, struct {
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		AvgBitrate    uint32
+		BlockSize     uint16
+		BitsPerSample uint16
+	}{0x0001, 1, 48000, 48000 * 2, 2, 16})
+
+	var smpl bytes.Buffer
+	binary.Write(&smpl, binary.LittleEndian, [9]uint32{7: 1}) // header, 1 loop
+	binary.Write(&smpl, binary.LittleEndian, [6]uint32{0, 0, 100, 199, 0, 0})
+
+	var cue bytes.Buffer
+	binary.Write(&cue, binary.LittleEndian, uint32(2))
+	binary.Write(&cue, binary.LittleEndian, [6]uint32{1, 50, 0x61746164, 0, 0, 50})
+	binary.Write(&cue, binary.LittleEndian, [6]uint32{2, 150, 0x61746164, 0, 0, 150})
+
+	labl := binary.LittleEndian.AppendUint32(nil, 2)
+	labl = append(labl, "Beat\x00"...)
+	list := append([]byte("adtl"), makeChunk("labl", labl)...)
+
+	wem, err := wwise.OpenWem(bytes.NewReader(makeRiff(
+		fmtChunk.Bytes(),
+		make([]byte, 2*300),
+		makeChunk("smpl", smpl.Bytes()),
+		makeChunk("cue ", cue.Bytes()),
+		makeChunk("LIST", list),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end, ok := wem.Loop()
+	if !ok || start != 100 || end != 200 {
+		t.Errorf("expected loop [100, 200), got [%v, %v) (ok=%v)", start, end, ok)
+	}
+	markers := wem.Markers()
+	if len(markers) != 2 {
+		t.Fatalf("expected 2 markers, got %v", len(markers))
+	}
+	if markers[0].Position != 50 || markers[0].Label != "" {
+		t.Errorf("unexpected first marker: %+v", markers[0])
+	}
+	if markers[1].Position != 150 || markers[1].Label != "Beat" {
+		t.Errorf("unexpected second marker: %+v", markers[1])
+	}
+}
+
+// Converts a single-frame Opus packet to self-delimited
+// framing (RFC 6716, appendix B).
+func opusDelimit(t *testing.T, packet []byte) []byte {
+	if packet[0]&0x03 != 0 {
+		t.Fatalf("expected single-frame packet, got code %v", packet[0]&0x03)
+	}
+	size := len(packet) - 1
+	res := []byte{packet[0]}
+	if size < 252 {
+		res = append(res, uint8(size))
+	} else {
+		b0 := 252 + size&0x03
+		res = append(res, uint8(b0), uint8((size-b0)/4))
+	}
+	return append(res, packet[1:]...)
+}
+
+func TestWemOpus(t *testing.T) {
+	const (
+		frameSize  = 960
+		numFrames  = 10
+		preSkip    = 312
+		numSamples = numFrames*frameSize - preSkip - 100
+	)
+	// Channel amplitudes; the 3 channel stream consists of
+	// a coupled stream (FL, FR) and a mono stream (FC).
+	for _, amplitudes := range [][]float32{
+		{0.5},
+		{0.5, 0, 0.25},
+	} {
+		channels := len(amplitudes)
+		var encoders []*opus.Encoder
+		var streamChannels []int
+		if channels == 1 {
+			streamChannels = []int{1}
+		} else {
+			streamChannels = []int{2, 1}
+		}
+		for _, n := range streamChannels {
+			enc, err := opus.NewEncoder(48000, n, opus.AppAudio)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoders = append(encoders, enc)
+		}
+
+		var data bytes.Buffer
+		var packetSizes []uint16
+		for frame := range numFrames {
+			var packet []byte
+			firstChannel := 0
+			for i, enc := range encoders {
+				pcm := make([]float32, frameSize*streamChannels[i])
+				for s := range frameSize {
+					x := 2 * math.Pi * 440 * float64(frame*frameSize+s) / 48000
+					for c := range streamChannels[i] {
+						pcm[s*streamChannels[i]+c] = amplitudes[firstChannel+c] * float32(math.Sin(x))
+					}
+				}
+				firstChannel += streamChannels[i]
+				buf := make([]byte, 4000)
+				n, err := enc.EncodeFloat32(pcm, buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i < len(encoders)-1 {
+					packet = append(packet, opusDelimit(t, buf[:n])...)
+				} else {
+					packet = append(packet, buf[:n]...)
+				}
+			}
+			packetSizes = append(packetSizes, uint16(len(packet)))
+			data.Write(packet)
+		}
+
+		layout := wwise.SpeakerFC
+		if channels == 3 {
+			layout = wwise.SpeakerFL | wwise.SpeakerFR | wwise.SpeakerFC
+		}
+		var fmtChunk bytes.Buffer
+		binary.Write(&fmtChunk, binary.LittleEndian, struct {
+			Format        uint16
+			Channels      uint16
+			SampleRate    uint32
+			AvgBitrate    uint32
+			BlockSize     uint16
+			BitsPerSample uint16
+			ExtraSize     uint16
+			Unused00      uint16
+			ChannelLayout uint32
+			NumSamples    int32
+			TableCount    uint32
+			PreSkip       uint16
+			Version       uint8
+			Mapping       uint8
+		}{0x3041, uint16(channels), 48000, 0, 0, 0, 0x06, 0,
+			uint32(channels) | 1<<8 | uint32(layout)<<12,
+			numSamples, numFrames, preSkip, 1, 1})
+		var seek bytes.Buffer
+		binary.Write(&seek, binary.LittleEndian, packetSizes)
+
+		wem, err := wwise.OpenWem(bytes.NewReader(makeRiff(
+			fmtChunk.Bytes(),
+			data.Bytes(),
+			makeChunk("seek", seek.Bytes()),
+		)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wem.Codec() != wwise.CodecOpus || wem.Channels() != channels || wem.SampleRate() != 48000 {
+			t.Errorf("unexpected format: %v, %v channels, %vHz", wem.Codec(), wem.Channels(), wem.SampleRate())
+		}
+		decoded := decodeAll(t, wem)
+		if len(decoded) != numSamples*channels {
+			t.Fatalf("%v channels: expected %v samples, got %v", channels, numSamples*channels, len(decoded)/channels)
+		}
+		// Lossy, so only compare each channel's RMS
+		// (a sine's RMS is amplitude/sqrt(2))
+		for c, amplitude := range amplitudes {
+			var sum float64
+			for s := range numSamples {
+				sum += float64(decoded[s*channels+c] * decoded[s*channels+c])
+			}
+			rms := math.Sqrt(sum / numSamples)
+			if want := float64(amplitude) / math.Sqrt2; math.Abs(rms-want) > 0.05 {
+				t.Errorf("%v channels: channel %v: expected RMS %.3f, got %.3f", channels, c, want, rms)
+			}
+		}
+	}
+}